@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Annotations returned with a resolved template
+const (
+	// AnnotationCacheMaxAge is how many seconds the resolved template can be reused for
+	AnnotationCacheMaxAge = "template-resolver.tekton.dev/cache-max-age"
+
+	// AnnotationCacheImmutable is "true" when resolving the same request again always
+	// returns the same template, because it is pinned to a commit
+	AnnotationCacheImmutable = "template-resolver.tekton.dev/cache-immutable"
+
+	// AnnotationResolverVersion is the version of the resolver that rendered the template
+	AnnotationResolverVersion = "template-resolver.tekton.dev/resolver-version"
+
+	// AnnotationContentDigest is the sha256 digest of the template as fetched
+	AnnotationContentDigest = "template-resolver.tekton.dev/content-digest"
+
+	// AnnotationRevision is the commit the template was read at, or the requested revision
+	// for sources that do not report commits
+	AnnotationRevision = "template-resolver.tekton.dev/revision"
+
+	// AnnotationRenderedAt is when the template was rendered, in RFC 3339 format. Results
+	// served from the render cache have AnnotationRenderCached instead.
+	AnnotationRenderedAt = "template-resolver.tekton.dev/rendered-at"
+
+	// AnnotationRenderCached is "true" when the result was served from the render cache
+	AnnotationRenderCached = "template-resolver.tekton.dev/render-cached"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3"
+var version string
+
+// resolverVersion returns the version the resolver was built as: the version set at build
+// time, or the commit recorded by the Go toolchain, or "unknown"
+var resolverVersion = sync.OnceValue(func() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				return setting.Value
+			}
+		}
+		if info.Main.Version != "" && info.Main.Version != "(devel)" {
+			return info.Main.Version
+		}
+	}
+	return "unknown"
+})
+
+// immutableMaxAge is the max-age hint of templates pinned to a commit, one year as for
+// immutable HTTP responses
+const immutableMaxAge = 365 * 24 * time.Hour
+
+// commitSHAPattern matches a full SHA-1 or SHA-256 Git commit ID
+var commitSHAPattern = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// cacheHintAnnotations tells Tekton's resolution machinery how long a resolved template can
+// be reused. A template pinned to a full commit SHA never changes, unless its output depends
+// on more than the template and params, such as the time or random values, which
+// deterministic reports. Other revisions can move, so they are reused for as long as the
+// resolver itself caches results, or not at all when caching is disabled.
+func cacheHintAnnotations(revision string, deterministic bool) map[string]string {
+	if deterministic && commitSHAPattern.MatchString(revision) {
+		return map[string]string{
+			AnnotationCacheMaxAge:    strconv.Itoa(int(immutableMaxAge.Seconds())),
+			AnnotationCacheImmutable: "true",
+		}
+	}
+
+	maxAge := time.Duration(0)
+	if deterministic && cacheBackend != CacheBackendNone {
+		maxAge = cacheTTL
+	}
+	return map[string]string{
+		AnnotationCacheMaxAge:    strconv.Itoa(int(maxAge.Seconds())),
+		AnnotationCacheImmutable: "false",
+	}
+}
+
+// sha256Hex returns the hex encoded sha256 digest of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// contentDigest returns the digest of a template in the sha256:<hex> form
+func contentDigest(content string) string {
+	return "sha256:" + sha256Hex([]byte(content))
+}
+
+// addRenderAnnotations records what was rendered, so PipelineRuns carry the provenance of
+// their resolved template: the resolver version, the template digest and revision, and the
+// render time, or that the result came from the render cache
+func addRenderAnnotations(annotations map[string]string, fetched *FetchedTemplate, revision string, cached bool) map[string]string {
+	result := make(map[string]string, len(annotations)+4)
+	for key, value := range annotations {
+		result[key] = value
+	}
+	result[AnnotationResolverVersion] = resolverVersion()
+	result[AnnotationContentDigest] = contentDigest(fetched.Content)
+	if fetched.Commit != "" {
+		revision = fetched.Commit
+	}
+	if revision != "" {
+		result[AnnotationRevision] = revision
+	}
+	if cached {
+		result[AnnotationRenderCached] = "true"
+	} else {
+		result[AnnotationRenderedAt] = time.Now().UTC().Format(time.RFC3339)
+	}
+	return result
+}
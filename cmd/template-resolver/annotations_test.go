@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestCacheHintAnnotations(t *testing.T) {
+	originalBackend, originalTTL := cacheBackend, cacheTTL
+	defer func() { cacheBackend, cacheTTL = originalBackend, originalTTL }()
+	cacheTTL = 5 * time.Minute
+
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		name          string
+		revision      string
+		deterministic bool
+		backend       string
+		want          map[string]string
+	}{
+		{
+			name:          "pinned to a commit",
+			revision:      sha,
+			deterministic: true,
+			want:          map[string]string{AnnotationCacheMaxAge: "31536000", AnnotationCacheImmutable: "true"},
+		},
+		{
+			name:          "pinned to a SHA-256 commit",
+			revision:      sha + "0123456789abcdef01234567",
+			deterministic: true,
+			want:          map[string]string{AnnotationCacheMaxAge: "31536000", AnnotationCacheImmutable: "true"},
+		},
+		{
+			name:          "pinned but not deterministic",
+			revision:      sha,
+			deterministic: false,
+			backend:       CacheBackendMemory,
+			want:          map[string]string{AnnotationCacheMaxAge: "0", AnnotationCacheImmutable: "false"},
+		},
+		{
+			name:          "abbreviated commit",
+			revision:      sha[:7],
+			deterministic: true,
+			want:          map[string]string{AnnotationCacheMaxAge: "0", AnnotationCacheImmutable: "false"},
+		},
+		{
+			name:          "branch with caching",
+			revision:      "main",
+			deterministic: true,
+			backend:       CacheBackendMemory,
+			want:          map[string]string{AnnotationCacheMaxAge: "300", AnnotationCacheImmutable: "false"},
+		},
+		{
+			name:          "default branch without caching",
+			deterministic: true,
+			want:          map[string]string{AnnotationCacheMaxAge: "0", AnnotationCacheImmutable: "false"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheBackend = CacheBackendNone
+			if tt.backend != "" {
+				cacheBackend = tt.backend
+			}
+			assert.Equal(t, tt.want, cacheHintAnnotations(tt.revision, tt.deterministic))
+		})
+	}
+}
+
+func TestResolverCacheHintAnnotations(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:pipeline.yaml": "name: {{ .AppName }}\n",
+		"repo1:dated.yaml":    "name: {{ now }}\n",
+	}}}
+	resolve := func(path string) map[string]string {
+		resource, err := r.Resolve(context.Background(), []pipelinev1.Param{
+			{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+			{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: path}},
+			{Name: RevisionParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: sha}},
+		})
+		require.NoError(t, err)
+		return resource.Annotations()
+	}
+
+	assert.Equal(t, "true", resolve("pipeline.yaml")[AnnotationCacheImmutable])
+	assert.Equal(t, "false", resolve("dated.yaml")[AnnotationCacheImmutable])
+}
+
+func TestAddRenderAnnotations(t *testing.T) {
+	hints := map[string]string{AnnotationCacheImmutable: "false"}
+	fetched := &FetchedTemplate{Content: "kind: Pipeline\n", Commit: "0123456789abcdef0123456789abcdef01234567"}
+
+	annotations := addRenderAnnotations(hints, fetched, "main", false)
+	assert.Equal(t, "false", annotations[AnnotationCacheImmutable])
+	assert.Equal(t, resolverVersion(), annotations[AnnotationResolverVersion])
+	assert.NotEmpty(t, annotations[AnnotationResolverVersion])
+	assert.Equal(t, "sha256:8c0612ccd3a012a261ac5d4cba2e6a86e4960201a997dbd91a520cfc2a560740", annotations[AnnotationContentDigest])
+	assert.Equal(t, fetched.Commit, annotations[AnnotationRevision])
+	renderedAt, err := time.Parse(time.RFC3339, annotations[AnnotationRenderedAt])
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), renderedAt, time.Minute)
+	assert.NotContains(t, annotations, AnnotationRenderCached)
+	assert.Len(t, hints, 1, "the cache hints must not be modified")
+
+	// Sources without commits report the requested revision, cached results no render time
+	annotations = addRenderAnnotations(nil, &FetchedTemplate{Content: "kind: Pipeline\n"}, "v1.2.0", true)
+	assert.Equal(t, "v1.2.0", annotations[AnnotationRevision])
+	assert.Equal(t, "true", annotations[AnnotationRenderCached])
+	assert.NotContains(t, annotations, AnnotationRenderedAt)
+
+	annotations = addRenderAnnotations(nil, &FetchedTemplate{Content: "kind: Pipeline\n"}, "", false)
+	assert.NotContains(t, annotations, AnnotationRevision)
+}
+
+func TestResolverRenderAnnotations(t *testing.T) {
+	r := &resolver{
+		fetcher: &mockFetcher{templates: map[string]string{"repo1:pipeline.yaml": "name: {{ .AppName }}\n"}},
+		cache:   newMemoryCache(),
+	}
+	params := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+		{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "pipeline.yaml"}},
+	}
+
+	resource, err := r.Resolve(context.Background(), params)
+	require.NoError(t, err)
+	assert.Equal(t, contentDigest("name: {{ .AppName }}\n"), resource.Annotations()[AnnotationContentDigest])
+	assert.Contains(t, resource.Annotations(), AnnotationRenderedAt)
+
+	resource, err = r.Resolve(context.Background(), params)
+	require.NoError(t, err)
+	assert.Equal(t, "true", resource.Annotations()[AnnotationRenderCached])
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+// resolveRequest is the body of the resolve and lint endpoints
+type resolveRequest struct {
+	Parameters []pipelinev1.Param `json:"parameters" description:"Params of the resolution request, as in a ResolutionRequest"`
+}
+
+// templateDataResponse is the response of /resolve?debug=data
+type templateDataResponse struct {
+	Data map[string]interface{} `json:"data" description:"Data the Go template was rendered with"`
+	// Error is set when the resolution failed after the data was computed
+	Error string `json:"error,omitempty" description:"Why rendering or validating the template failed"`
+}
+
+// cacheInvalidateRequest is the body of the cache invalidation endpoint
+type cacheInvalidateRequest struct {
+	Repository string `json:"repository" description:"Repository whose cached templates are evicted, exactly as in the repository param"`
+	Path       string `json:"path,omitempty" description:"Template to evict, all templates of the repository when empty"`
+}
+
+// cacheInvalidateResponse reports the outcome of a cache invalidation
+type cacheInvalidateResponse struct {
+	Evicted int `json:"evicted" description:"Number of cached templates evicted"`
+}
+
+// errorResponse is the envelope of every error returned by the API endpoints
+type errorResponse struct {
+	Error errorDetail `json:"error"`
+}
+
+// errorDetail describes why a request failed
+type errorDetail struct {
+	Status  int    `json:"status" description:"HTTP status code of the response"`
+	Message string `json:"message" description:"Human-readable description of the error"`
+}
+
+// writeAPIError responds with an error wrapped in the errorResponse envelope
+func writeAPIError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	response := errorResponse{Error: errorDetail{Status: status, Message: fmt.Sprintf(format, args...)}}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Errorf("Error writing response: %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteAPIError(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writeAPIError(recorder, http.StatusBadRequest, "Invalid parameters: %s", "missing path")
+
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error": {"status": 400, "message": "Invalid parameters: missing path"}}`, recorder.Body.String())
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// loadAPIToken returns the token required by the HTTP endpoints: token when set, otherwise
+// the content of tokenFile, such as a key of a mounted Secret
+func loadAPIToken(token, tokenFile string) string {
+	if token != "" || tokenFile == "" {
+		return token
+	}
+	content, err := os.ReadFile(tokenFile)
+	if err != nil {
+		logger.Fatalf("Failed to read %s: %v", EnvAPITokenFile, err)
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// authEnabled reports whether the HTTP endpoints require credentials
+func authEnabled() bool {
+	return apiToken != "" || apiBasicAuthUsername != ""
+}
+
+// authorized checks the Authorization header of a request against the configured bearer
+// token and basic auth credentials, either of which is accepted
+func authorized(r *http.Request) bool {
+	if !authEnabled() {
+		return true
+	}
+	if apiToken != "" {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok &&
+			subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) == 1 {
+			return true
+		}
+	}
+	if apiBasicAuthUsername != "" {
+		if username, password, ok := r.BasicAuth(); ok &&
+			subtle.ConstantTimeCompare([]byte(username), []byte(apiBasicAuthUsername)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(apiBasicAuthPassword)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// requireAuth rejects requests without valid credentials before they reach handler. Health
+// and readiness probes are not wrapped, so the kubelet can reach them.
+func requireAuth(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r) {
+			if apiToken != "" {
+				w.Header().Add("WWW-Authenticate", `Bearer realm="template-resolver"`)
+			}
+			if apiBasicAuthUsername != "" {
+				w.Header().Add("WWW-Authenticate", `Basic realm="template-resolver"`)
+			}
+			writeAPIError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		handler(w, r)
+	}
+}
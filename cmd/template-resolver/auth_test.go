@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAPIToken(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("from-file\n"), 0600))
+
+	assert.Equal(t, "from-env", loadAPIToken("from-env", tokenFile))
+	assert.Equal(t, "from-file", loadAPIToken("", tokenFile))
+	assert.Equal(t, "", loadAPIToken("", ""))
+}
+
+func TestRequireAuth(t *testing.T) {
+	originalToken, originalUsername, originalPassword := apiToken, apiBasicAuthUsername, apiBasicAuthPassword
+	defer func() {
+		apiToken, apiBasicAuthUsername, apiBasicAuthPassword = originalToken, originalUsername, originalPassword
+	}()
+
+	handler := requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	call := func(setup func(r *http.Request)) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/resolve", nil)
+		if setup != nil {
+			setup(request)
+		}
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+		return recorder
+	}
+	bearer := func(token string) func(r *http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	basic := func(username, password string) func(r *http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(username, password) }
+	}
+
+	// Open when no credentials are configured
+	apiToken, apiBasicAuthUsername, apiBasicAuthPassword = "", "", ""
+	assert.Equal(t, http.StatusOK, call(nil).Code)
+
+	apiToken = "secret-token"
+	assert.Equal(t, http.StatusOK, call(bearer("secret-token")).Code)
+	recorder := call(bearer("wrong"))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Equal(t, []string{`Bearer realm="template-resolver"`}, recorder.Header().Values("WWW-Authenticate"))
+	assert.Equal(t, http.StatusUnauthorized, call(nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, call(basic("ci", "secret-token")).Code)
+
+	// Either credential is accepted when both are configured
+	apiBasicAuthUsername, apiBasicAuthPassword = "ci", "password"
+	assert.Equal(t, http.StatusOK, call(bearer("secret-token")).Code)
+	assert.Equal(t, http.StatusOK, call(basic("ci", "password")).Code)
+	assert.Equal(t, http.StatusUnauthorized, call(basic("ci", "wrong")).Code)
+	recorder = call(basic("other", "password"))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Len(t, recorder.Header().Values("WWW-Authenticate"), 2)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"github.com/tektoncd/pipeline/pkg/resolution/common"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// templateBindingResource identifies the TemplateBinding custom resource, installed with
+// config/templatebinding-crd.yaml
+var templateBindingResource = schema.GroupVersionResource{
+	Group:    "template-resolver.tekton.dev",
+	Version:  "v1alpha1",
+	Resource: "templatebindings",
+}
+
+// TemplateBinding names a template and the params it is rendered with, so PipelineRuns can
+// reference it with the binding param instead of repeating its repository, path and params
+type TemplateBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TemplateBindingSpec `json:"spec"`
+}
+
+// TemplateBindingSpec is the template of a TemplateBinding and its default params
+type TemplateBindingSpec struct {
+	Repository string `json:"repository"`
+	Path       string `json:"path"`
+	Revision   string `json:"revision,omitempty"`
+
+	// Params are used for the params the request does not set
+	Params []pipelinev1.Param `json:"params,omitempty"`
+}
+
+// applyBinding replaces the binding param of a request with the repository, path, revision
+// and params of the TemplateBinding it names in the request namespace. Params set by the
+// request take precedence over those of the binding. Requests without a binding are
+// returned unchanged.
+func (r *resolver) applyBinding(ctx context.Context, params []pipelinev1.Param) ([]pipelinev1.Param, error) {
+	name := paramString(params, BindingParam)
+	if name == "" {
+		return params, nil
+	}
+	binding, err := r.readTemplateBinding(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	debugContextf(ctx, "Using TemplateBinding %s: %s %s@%s", name, binding.Spec.Repository, binding.Spec.Path, binding.Spec.Revision)
+
+	defaults := slices.Clone(binding.Spec.Params)
+	for _, field := range []struct{ name, value string }{
+		{RepositoryParam, binding.Spec.Repository},
+		{PathParam, binding.Spec.Path},
+		{RevisionParam, binding.Spec.Revision},
+	} {
+		if field.value != "" {
+			defaults = append(defaults, pipelinev1.Param{Name: field.name, Value: *pipelinev1.NewStructuredValues(field.value)})
+		}
+	}
+
+	merged := slices.DeleteFunc(slices.Clone(params), func(param pipelinev1.Param) bool {
+		return param.Name == BindingParam
+	})
+	for _, param := range defaults {
+		if !slices.ContainsFunc(merged, func(set pipelinev1.Param) bool { return set.Name == param.Name }) {
+			merged = append(merged, param)
+		}
+	}
+	if err := r.ValidateParams(ctx, merged); err != nil {
+		return nil, fmt.Errorf("TemplateBinding %s: %w", name, err)
+	}
+	return merged, nil
+}
+
+// readTemplateBinding reads a TemplateBinding from the request namespace
+func (r *resolver) readTemplateBinding(ctx context.Context, name string) (*TemplateBinding, error) {
+	if r.dynamicClient == nil {
+		return nil, fmt.Errorf("%s is only supported when running as a Tekton resolver", BindingParam)
+	}
+	namespace := common.RequestNamespace(ctx)
+	if namespace == "" {
+		return nil, fmt.Errorf("cannot read TemplateBinding %s: request namespace is unknown", name)
+	}
+
+	object, err := r.dynamicClient.Resource(templateBindingResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TemplateBinding %s/%s: %w", namespace, name, err)
+	}
+	encoded, err := json.Marshal(object.Object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TemplateBinding %s/%s: %w", namespace, name, err)
+	}
+	var binding TemplateBinding
+	if err := json.Unmarshal(encoded, &binding); err != nil {
+		return nil, fmt.Errorf("invalid TemplateBinding %s/%s: %w", namespace, name, err)
+	}
+	return &binding, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"github.com/tektoncd/pipeline/pkg/resolution/common"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// newTestBindingClient returns a dynamic client serving the TemplateBinding my-service in
+// the team-a namespace
+func newTestBindingClient() *dynamicfake.FakeDynamicClient {
+	binding := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "template-resolver.tekton.dev/v1alpha1",
+		"kind":       "TemplateBinding",
+		"metadata":   map[string]interface{}{"name": "my-service", "namespace": "team-a"},
+		"spec": map[string]interface{}{
+			"repository": "https://github.com/org/templates",
+			"path":       "pipelines/service.yaml",
+			"revision":   "v1.2.0",
+			"params": []interface{}{
+				map[string]interface{}{"name": "app-name", "value": "my-service"},
+				map[string]interface{}{"name": "replicas", "value": "2"},
+			},
+		},
+	}}
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{templateBindingResource: "TemplateBindingList"}, binding)
+}
+
+func TestApplyBinding(t *testing.T) {
+	ctx := common.InjectRequestNamespace(context.Background(), "team-a")
+	r := &resolver{dynamicClient: newTestBindingClient()}
+
+	// Requests without a binding are unchanged
+	params := []pipelinev1.Param{{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("repo")}}
+	applied, err := r.applyBinding(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, params, applied)
+
+	// Params of the request take precedence over those of the binding
+	applied, err = r.applyBinding(ctx, []pipelinev1.Param{
+		{Name: BindingParam, Value: *pipelinev1.NewStructuredValues("my-service")},
+		{Name: "replicas", Value: *pipelinev1.NewStructuredValues("3")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []pipelinev1.Param{
+		{Name: "replicas", Value: *pipelinev1.NewStructuredValues("3")},
+		{Name: "app-name", Value: *pipelinev1.NewStructuredValues("my-service")},
+		{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("https://github.com/org/templates")},
+		{Name: PathParam, Value: *pipelinev1.NewStructuredValues("pipelines/service.yaml")},
+		{Name: RevisionParam, Value: *pipelinev1.NewStructuredValues("v1.2.0")},
+	}, applied)
+
+	binding := []pipelinev1.Param{{Name: BindingParam, Value: *pipelinev1.NewStructuredValues("my-service")}}
+	_, err = r.applyBinding(ctx, []pipelinev1.Param{{Name: BindingParam, Value: *pipelinev1.NewStructuredValues("missing")}})
+	assert.ErrorContains(t, err, "failed to read TemplateBinding team-a/missing")
+	_, err = r.applyBinding(context.Background(), binding)
+	assert.EqualError(t, err, "cannot read TemplateBinding my-service: request namespace is unknown")
+	_, err = (&resolver{}).applyBinding(ctx, binding)
+	assert.EqualError(t, err, "binding is only supported when running as a Tekton resolver")
+}
+
+func TestResolverBinding(t *testing.T) {
+	r := &resolver{
+		fetcher: &mockFetcher{templates: map[string]string{
+			"https://github.com/org/templates:pipelines/service.yaml": "apiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n  name: {{ .AppName }}\nspec:\n  description: {{ .Replicas }} replicas\n",
+		}},
+		dynamicClient: newTestBindingClient(),
+	}
+	params := []pipelinev1.Param{{Name: BindingParam, Value: *pipelinev1.NewStructuredValues("my-service")}}
+
+	// The binding stands in for the required params
+	require.NoError(t, r.ValidateParams(context.Background(), params))
+
+	resolved, err := r.Resolve(common.InjectRequestNamespace(context.Background(), "team-a"), params)
+	require.NoError(t, err)
+	assert.Contains(t, string(resolved.Data()), "name: my-service")
+	assert.Contains(t, string(resolved.Data()), "description: 2 replicas")
+	assert.Equal(t, "https://github.com/org/templates", resolved.RefSource().URI)
+	assert.Equal(t, "pipelines/service.yaml", resolved.RefSource().EntryPoint)
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+// Cache backends selectable with CACHE_BACKEND
+const (
+	CacheBackendNone   = "none"
+	CacheBackendMemory = "memory"
+	CacheBackendRedis  = "redis"
+)
+
+const (
+	// redisKeyPrefix namespaces the resolver's keys in a shared Redis database
+	redisKeyPrefix = "template-resolver:"
+
+	// memoryCacheSweepSize is the number of entries above which expired entries are removed on write
+	memoryCacheSweepSize = 1024
+)
+
+// Cache stores fetched templates and rendered results so they can be reused across
+// requests. Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get returns the value stored under key, or false if it is missing or expired
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// Set stores value under key for the given time to live
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// DeletePrefix removes every key starting with prefix and returns how many were removed
+	DeletePrefix(ctx context.Context, prefix string) (int, error)
+}
+
+// newCache creates the cache selected by CACHE_BACKEND, or nil when caching is disabled
+func newCache(backend string) (Cache, error) {
+	switch strings.ToLower(strings.TrimSpace(backend)) {
+	case "", CacheBackendNone:
+		return nil, nil
+	case CacheBackendMemory:
+		return newMemoryCache(), nil
+	case CacheBackendRedis:
+		if redisAddr == "" {
+			return nil, fmt.Errorf("%s must be set when %s is %s", EnvRedisAddr, EnvCacheBackend, CacheBackendRedis)
+		}
+		return newRedisCache(redis.NewClient(&redis.Options{
+			Addr:     redisAddr,
+			Password: redisPassword,
+			DB:       redisDB,
+		})), nil
+	default:
+		return nil, fmt.Errorf("invalid %s %q, must be %s, %s or %s", EnvCacheBackend, backend, CacheBackendNone, CacheBackendMemory, CacheBackendRedis)
+	}
+}
+
+// memoryCache is a Cache local to one replica. It holds at most maxBytes of values, set
+// from CACHE_MAX_BYTES, evicting the least recently used entries to make room for new ones.
+type memoryCache struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	maxBytes int64
+
+	// recent orders the entries from the most to the least recently used, and size is the
+	// total length of their values
+	recent *list.List
+	size   int64
+}
+
+type memoryCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+
+	// repository is the repository label the entry is counted under in the cache metrics
+	repository string
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{entries: make(map[string]*list.Element), maxBytes: cacheMaxBytes, recent: list.New()}
+}
+
+// Get implements Cache
+func (c *memoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	var entry *memoryCacheEntry
+	if ok {
+		entry = element.Value.(*memoryCacheEntry)
+		if time.Now().After(entry.expires) {
+			c.remove(element)
+			recordCacheEvictions(entry.repository, key, evictionExpired, 1)
+			ok = false
+		}
+	}
+	recordCacheLookup(ctx, key, ok)
+	if !ok {
+		return nil, false, nil
+	}
+	c.recent.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+// Set implements Cache
+func (c *memoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= memoryCacheSweepSize {
+		for k, element := range c.entries {
+			if entry := element.Value.(*memoryCacheEntry); now.After(entry.expires) {
+				c.remove(element)
+				recordCacheEvictions(entry.repository, k, evictionExpired, 1)
+			}
+		}
+	}
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	// A value that does not fit at all would only evict everything else
+	if c.maxBytes > 0 && int64(len(value)) > c.maxBytes {
+		return nil
+	}
+
+	entry := &memoryCacheEntry{key: key, value: value, expires: now.Add(ttl), repository: cacheRepository(ctx)}
+	c.entries[key] = c.recent.PushFront(entry)
+	c.size += int64(len(value))
+	recordCacheEntry(entry.repository, key, len(value), 1)
+	for c.maxBytes > 0 && c.size > c.maxBytes {
+		oldest := c.recent.Back()
+		evicted := oldest.Value.(*memoryCacheEntry)
+		c.remove(oldest)
+		recordCacheEvictions(evicted.repository, evicted.key, evictionSize, 1)
+	}
+	return nil
+}
+
+// DeletePrefix implements Cache
+func (c *memoryCache) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deleted := 0
+	for key, element := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			entry := element.Value.(*memoryCacheEntry)
+			c.remove(element)
+			recordCacheEvictions(entry.repository, key, evictionInvalidated, 1)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// remove deletes an entry and takes it out of the cache metrics, c.mu must be held
+func (c *memoryCache) remove(element *list.Element) {
+	entry := c.recent.Remove(element).(*memoryCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.value))
+	recordCacheEntry(entry.repository, entry.key, len(entry.value), -1)
+}
+
+// redisCache is a Cache shared by all replicas through Redis
+type redisCache struct {
+	client *redis.Client
+}
+
+func newRedisCache(client *redis.Client) *redisCache {
+	return &redisCache{client: client}
+}
+
+// Get implements Cache
+func (c *redisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := c.client.Get(ctx, redisKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		recordCacheLookup(ctx, key, false)
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s from Redis: %w", key, err)
+	}
+	recordCacheLookup(ctx, key, true)
+	return value, true, nil
+}
+
+// Set implements Cache
+func (c *redisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := c.client.Set(ctx, redisKeyPrefix+key, value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to write %s to Redis: %w", key, err)
+	}
+	return nil
+}
+
+// DeletePrefix implements Cache. Keys are found with SCAN so Redis is not blocked while
+// large databases are searched. Prefixes are built from hex digests and contain no glob characters.
+// Entries expired by Redis itself are not seen by the resolver and not counted as evictions.
+func (c *redisCache) DeletePrefix(ctx context.Context, prefix string) (deleted int, err error) {
+	defer func() { recordCacheEvictions(cacheRepository(ctx), prefix, evictionInvalidated, deleted) }()
+	iter := c.client.Scan(ctx, 0, redisKeyPrefix+prefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		n, err := c.client.Del(ctx, iter.Val()).Result()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete %s from Redis: %w", iter.Val(), err)
+		}
+		deleted += int(n)
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, fmt.Errorf("failed to scan Redis for %s: %w", prefix, err)
+	}
+	return deleted, nil
+}
+
+// cacheKey hashes the parts identifying a cached value into a key with the given prefix
+func cacheKey(prefix string, parts ...string) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		// Length-prefix each part so different splits never produce the same key
+		fmt.Fprintf(hash, "%d:%s", len(part), part)
+	}
+	return prefix + ":" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// templateCachePrefix is the common prefix of the cached templates of a repository, or of
+// one path in it when path is set, so they can be invalidated together
+func templateCachePrefix(repository, path string) string {
+	prefix := cacheKey("template", repository) + ":"
+	if path != "" {
+		prefix += cacheKey("path", path) + ":"
+	}
+	return prefix
+}
+
+// templateCacheKey identifies a fetched template
+func templateCacheKey(repository, revision, path, submodules string) string {
+	return templateCachePrefix(repository, path) + cacheKey("revision", revision, submodules)
+}
+
+// fetchTemplate fetches a template through the resolver's fetcher, reusing content from the
+// cache when possible, or from the listing of the glob path the template matched. Templates fetched with per-request credentials are never cached, so
+// they cannot be served to requests without access to the repository.
+func (r *resolver) fetchTemplate(ctx context.Context, repository, revision, path string, opts FetchOptions) (*FetchedTemplate, error) {
+	if fetched, ok := listedTemplate(ctx, repository, revision, path); ok {
+		return fetched, nil
+	}
+	if r.cache == nil || opts.Credentials != nil {
+		defer observeFetch(repository, opts, time.Now())
+		return r.fetcher.FetchTemplate(repository, revision, path, opts)
+	}
+
+	ctx = withCacheRepository(ctx, repository)
+	key := templateCacheKey(repository, revision, path, opts.Submodules)
+	if value, ok, err := r.cache.Get(ctx, key); err != nil {
+		debugContextf(ctx, "Template cache lookup failed: %v", err)
+	} else if ok {
+		var fetched FetchedTemplate
+		if err := json.Unmarshal(value, &fetched); err == nil {
+			debugContextf(ctx, "Using cached template for %s %s@%s", repository, path, revision)
+			return &fetched, nil
+		}
+		debugContextf(ctx, "Ignoring unreadable cached template %s", key)
+	}
+
+	return r.refreshTemplate(ctx, repository, revision, path, opts)
+}
+
+// refreshTemplate fetches a template without looking it up in the cache and caches it for
+// the next requests, unless it was fetched with credentials
+func (r *resolver) refreshTemplate(ctx context.Context, repository, revision, path string, opts FetchOptions) (*FetchedTemplate, error) {
+	started := time.Now()
+	fetched, err := r.fetcher.FetchTemplate(repository, revision, path, opts)
+	observeFetch(repository, opts, started)
+	if err != nil || r.cache == nil || opts.Credentials != nil {
+		return fetched, err
+	}
+	ctx = withCacheRepository(ctx, repository)
+	if value, err := json.Marshal(fetched); err == nil {
+		if err := r.cache.Set(ctx, templateCacheKey(repository, revision, path, opts.Submodules), value, cacheTTL); err != nil {
+			debugContextf(ctx, "Failed to cache template: %v", err)
+		}
+	}
+	return fetched, nil
+}
+
+// uncacheableTemplatePattern matches templates whose rendered result cannot be reused:
+// includes and template actions that may load partials, files read with readFile, tpl
+// with template text from params, lookups of cluster objects, environment variables and functions returning a
+// different value on every call, including the random, key generation and DNS functions of Helm mode
+var uncacheableTemplatePattern = regexp.MustCompile(`\{\{[^}]*\b(include|template|readFile|tpl|now|uuidv4|lookup|env|expandenv|rand[A-Z]\w*|gen[A-Z]\w*|bcrypt|htpasswd|getHostByName)\b`)
+
+// renderCacheable reports whether rendering the template with the same params always
+// produces the same result, so it can be served from the render cache
+func renderCacheable(content string) bool {
+	return !uncacheableTemplatePattern.MatchString(content)
+}
+
+// renderCacheKey identifies the rendered result of a template with a set of params, the
+// content of its default values file, empty when it has none, and its param schema, nil when
+// it has none. The schema is part of the key because it is read apart from the template, from
+// a sidecar file or a base template, and its declarations change how params are rendered.
+func renderCacheKey(content string, schema *paramSchema, params []pipelinev1.Param, valuesFile string) (string, error) {
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+	if schema == nil && valuesFile == "" {
+		return cacheKey("rendered", content, string(encoded)), nil
+	}
+	encodedSchema, err := json.Marshal(schema)
+	if err != nil {
+		return "", err
+	}
+	return cacheKey("rendered", content, string(encoded), valuesFile, string(encodedSchema)), nil
+}
+
+// cachedRender returns a previously rendered result for the template and params
+func (r *resolver) cachedRender(ctx context.Context, key string) ([]byte, bool) {
+	if r.cache == nil || key == "" {
+		return nil, false
+	}
+	value, ok, err := r.cache.Get(ctx, key)
+	if err != nil {
+		debugContextf(ctx, "Render cache lookup failed: %v", err)
+		return nil, false
+	}
+	return value, ok
+}
+
+// storeRender caches a rendered result, logging rather than failing the request on errors
+func (r *resolver) storeRender(ctx context.Context, key string, rendered []byte) {
+	if r.cache == nil || key == "" {
+		return
+	}
+	if err := r.cache.Set(ctx, key, rendered, cacheTTL); err != nil {
+		debugContextf(ctx, "Failed to cache rendered template: %v", err)
+	}
+}
+
+// invalidateTemplates evicts the cached templates of a repository, or of a single path in
+// it, so the next request fetches them again. Rendered results are keyed by template content
+// and are not reused once the template changes.
+func (r *resolver) invalidateTemplates(ctx context.Context, repository, path string) (int, error) {
+	if r.cache == nil {
+		return 0, nil
+	}
+	ctx = withCacheRepository(ctx, repository)
+	deleted, err := r.cache.DeletePrefix(ctx, templateCachePrefix(repository, path))
+	if err != nil {
+		return deleted, fmt.Errorf("failed to invalidate cached templates: %w", err)
+	}
+	debugContextf(ctx, "Invalidated %d cached templates for %s %s", deleted, repository, path)
+	return deleted, nil
+}
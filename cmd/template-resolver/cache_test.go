@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+// countingFetcher counts the fetches that reach the underlying fetcher
+type countingFetcher struct {
+	mockFetcher
+	calls int
+}
+
+func (c *countingFetcher) FetchTemplate(repo, revision, path string, opts FetchOptions) (*FetchedTemplate, error) {
+	c.calls++
+	return c.mockFetcher.FetchTemplate(repo, revision, path, opts)
+}
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	cache := newMemoryCache()
+
+	require.NoError(t, cache.Set(ctx, "key", []byte("value"), time.Minute))
+	value, ok, err := cache.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("value"), value)
+
+	// Expired entries are not returned
+	require.NoError(t, cache.Set(ctx, "expired", []byte("value"), -time.Second))
+	_, ok, err = cache.Get(ctx, "expired")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestMemoryCacheMaxBytes(t *testing.T) {
+	ctx := context.Background()
+	cache := newMemoryCache()
+	assert.Equal(t, int64(DefaultCacheMaxBytes), cache.maxBytes)
+	cache.maxBytes = 10
+
+	require.NoError(t, cache.Set(ctx, "a", []byte("aaaa"), time.Minute))
+	require.NoError(t, cache.Set(ctx, "b", []byte("bbbb"), time.Minute))
+	// Reading a makes b the least recently used entry, which makes room for c
+	_, ok, err := cache.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, cache.Set(ctx, "c", []byte("cccc"), time.Minute))
+	_, ok, _ = cache.Get(ctx, "b")
+	assert.False(t, ok)
+	_, ok, _ = cache.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Equal(t, int64(8), cache.size)
+
+	// Replacing an entry counts its new size only
+	require.NoError(t, cache.Set(ctx, "c", []byte("cc"), time.Minute))
+	assert.Equal(t, int64(6), cache.size)
+
+	// Values over the limit are not stored, and evict nothing
+	require.NoError(t, cache.Set(ctx, "large", []byte("large value"), time.Minute))
+	_, ok, _ = cache.Get(ctx, "large")
+	assert.False(t, ok)
+	_, ok, _ = cache.Get(ctx, "a")
+	assert.True(t, ok)
+	assert.Len(t, cache.entries, 2)
+}
+
+func TestRedisCache(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	cache := newRedisCache(redis.NewClient(&redis.Options{Addr: server.Addr()}))
+
+	_, ok, err := cache.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, cache.Set(ctx, "key", []byte("value"), time.Minute))
+	value, ok, err := cache.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("value"), value)
+	assert.True(t, server.Exists(redisKeyPrefix+"key"))
+
+	require.NoError(t, cache.Set(ctx, "template:a:1", []byte("value"), time.Minute))
+	require.NoError(t, cache.Set(ctx, "template:a:2", []byte("value"), time.Minute))
+	deleted, err := cache.DeletePrefix(ctx, "template:a:")
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	assert.False(t, server.Exists(redisKeyPrefix+"template:a:1"))
+
+	server.FastForward(2 * time.Minute)
+	_, ok, err = cache.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Connection errors are reported so callers can fall back to fetching
+	server.Close()
+	_, _, err = cache.Get(ctx, "key")
+	assert.Error(t, err)
+}
+
+func TestNewCache(t *testing.T) {
+	originalAddr := redisAddr
+	defer func() { redisAddr = originalAddr }()
+
+	cache, err := newCache(CacheBackendNone)
+	require.NoError(t, err)
+	assert.Nil(t, cache)
+
+	cache, err = newCache("Memory")
+	require.NoError(t, err)
+	assert.IsType(t, &memoryCache{}, cache)
+
+	redisAddr = ""
+	_, err = newCache(CacheBackendRedis)
+	assert.ErrorContains(t, err, EnvRedisAddr)
+
+	redisAddr = "localhost:6379"
+	cache, err = newCache(CacheBackendRedis)
+	require.NoError(t, err)
+	assert.IsType(t, &redisCache{}, cache)
+
+	_, err = newCache("memcached")
+	assert.Error(t, err)
+}
+
+func TestResolverCache(t *testing.T) {
+	fetcher := &countingFetcher{mockFetcher: mockFetcher{commit: "0123456789abcdef0123456789abcdef01234567"}}
+	r := &resolver{fetcher: fetcher, cache: newMemoryCache()}
+
+	params := func(appName string) []pipelinev1.Param {
+		return []pipelinev1.Param{
+			{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+			{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "path1"}},
+			{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: appName}},
+		}
+	}
+
+	first, err := r.Resolve(context.Background(), params("app"))
+	require.NoError(t, err)
+	second, err := r.Resolve(context.Background(), params("app"))
+	require.NoError(t, err)
+	assert.Equal(t, first.Data(), second.Data())
+	assert.Equal(t, first.RefSource(), second.RefSource())
+
+	// Different params reuse the fetched template but are rendered again
+	_, err = r.Resolve(context.Background(), params("other"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, fetcher.calls)
+
+	// Templates fetched with per-request credentials bypass the cache
+	_, err = r.fetchTemplate(context.Background(), "repo1", "", "path1", FetchOptions{Credentials: &GitCredentials{Password: "token"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, fetcher.calls)
+}
+
+func TestRenderCacheable(t *testing.T) {
+	assert.True(t, renderCacheable("name: {{ .AppName }}\n{{ toYAML .Tasks }}"))
+	assert.True(t, renderCacheable("note: the template is rendered now"))
+	assert.False(t, renderCacheable(`built: {{ now | date "2006-01-02" }}`))
+	assert.False(t, renderCacheable(`{{ include "partials/task" . }}`))
+	assert.False(t, renderCacheable(`{{ tpl .Snippet . }}`))
+	assert.False(t, renderCacheable(`- name: build-{{ uuidv4 }}`))
+	assert.False(t, renderCacheable(`password: {{ randAlphaNum 16 }}`))
+	assert.False(t, renderCacheable(`cluster: {{ env "CLUSTER_NAME" }}`))
+	assert.True(t, renderCacheable(`name: {{ .Values.generateName }}`))
+}
+
+func TestRenderCacheKey(t *testing.T) {
+	params := []pipelinev1.Param{{Name: "tasks", Value: *pipelinev1.NewStructuredValues("- name: build")}}
+	plain, err := renderCacheKey("{{ .tasks }}", nil, params, "")
+	require.NoError(t, err)
+	withValues, err := renderCacheKey("{{ .tasks }}", nil, params, "replicas: 1")
+	require.NoError(t, err)
+	assert.NotEqual(t, plain, withValues)
+
+	// A sidecar schema marking the param as structured renders it differently, so it is
+	// part of the key even though the template content is the same
+	structured, err := renderCacheKey("{{ .tasks }}", &paramSchema{Params: []paramSpec{{Name: "tasks", Structured: true}}}, params, "")
+	require.NoError(t, err)
+	notStructured, err := renderCacheKey("{{ .tasks }}", &paramSchema{Params: []paramSpec{{Name: "tasks"}}}, params, "")
+	require.NoError(t, err)
+	assert.NotEqual(t, plain, structured)
+	assert.NotEqual(t, structured, notStructured)
+
+	again, err := renderCacheKey("{{ .tasks }}", &paramSchema{Params: []paramSpec{{Name: "tasks", Structured: true}}}, params, "")
+	require.NoError(t, err)
+	assert.Equal(t, structured, again)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+var (
+	// Integers and decimal numbers as they are written in params. Numbers with leading
+	// zeros, signs or exponents are left alone, since they are more likely to be IDs or
+	// versions such as 007 or 1e3 than numbers.
+	integerPattern = regexp.MustCompile(`^-?(0|[1-9][0-9]*)$`)
+	floatPattern   = regexp.MustCompile(`^-?(0|[1-9][0-9]*)\.[0-9]+$`)
+)
+
+// coerceString converts a string param holding true, false, an integer or a decimal number
+// to a bool, int or float64, so templates can write `if .Flag` or `gt .Replicas 2` instead
+// of comparing strings. Anything else is returned as it is.
+func coerceString(value string) interface{} {
+	switch {
+	case value == "true":
+		return true
+	case value == "false":
+		return false
+	case integerPattern.MatchString(value):
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	case floatPattern.MatchString(value):
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return value
+}
+
+// coerceStringParams replaces the values of string params in data, stored under the key
+// returned by name, with their coerced values. Keys holding anything other than the value
+// of the param, such as parsed tasks or the values document, are left alone.
+func coerceStringParams(data map[string]interface{}, params []pipelinev1.Param, name func(string) string) {
+	for _, param := range params {
+		if param.Value.Type != pipelinev1.ParamTypeString || isOptionParam(param.Name) {
+			continue
+		}
+		key := name(param.Name)
+		if current, ok := data[key].(string); ok && current == param.Value.StringVal {
+			data[key] = coerceString(current)
+		}
+	}
+}
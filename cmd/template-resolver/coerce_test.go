@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestCoerceString(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected interface{}
+	}{
+		{"true", true},
+		{"false", false},
+		{"3", 3},
+		{"-12", -12},
+		{"0", 0},
+		{"1.5", 1.5},
+		{"-0.25", -0.25},
+		{"True", "True"},
+		{"yes", "yes"},
+		{"007", "007"},
+		{"1e3", "1e3"},
+		{"+1", "+1"},
+		{"1.", "1."},
+		{"v1.2", "v1.2"},
+		{"99999999999999999999", "99999999999999999999"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			assert.Equal(t, tt.expected, coerceString(tt.value))
+		})
+	}
+}
+
+func TestResolverCoerceTypes(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:pipeline.yaml":      "metadata:\n  name: {{ if .DeployEnabled }}deploy{{ else }}skip{{ end }}-{{ if gt .Replicas 2 }}ha{{ end }}-{{ .Version }}\n",
+		"repo1:helm/pipeline.yaml": "metadata:\n  name: {{ if .Values.deployEnabled }}deploy{{ end }}-{{ add .Values.replicas 1 }}\n",
+	}}}
+	params := func(path string, extra ...pipelinev1.Param) []pipelinev1.Param {
+		return append([]pipelinev1.Param{
+			{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+			{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: path}},
+			{Name: "deploy-enabled", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "false"}},
+			{Name: "replicas", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "3"}},
+			{Name: "version", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "1.20"}},
+		}, extra...)
+	}
+	coerce := pipelinev1.Param{Name: CoerceTypesParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "true"}}
+
+	resource, err := r.Resolve(context.Background(), params("pipeline.yaml", coerce))
+	require.NoError(t, err)
+	assert.Equal(t, "metadata:\n  name: skip-ha-1.2\n", string(resource.Data()))
+
+	// Without coercion "false" is a non-empty string and gt cannot compare strings to numbers
+	_, err = r.Resolve(context.Background(), params("pipeline.yaml"))
+	assert.ErrorContains(t, err, "incompatible types for comparison")
+
+	// Helm mode coerces the params under .Values
+	resource, err = r.Resolve(context.Background(), params("helm/pipeline.yaml", coerce,
+		pipelinev1.Param{Name: HelmParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "true"}}))
+	require.NoError(t, err)
+	assert.Equal(t, "metadata:\n  name: -4\n", string(resource.Data()))
+
+	coerce.Value.StringVal = "sometimes"
+	assert.ErrorContains(t, r.ValidateParams(context.Background(), params("pipeline.yaml", coerce)), "invalid coerce-types param")
+}
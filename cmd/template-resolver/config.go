@@ -1,9 +1,10 @@
 package main
 
 import (
-	"log"
+	"crypto"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -11,33 +12,294 @@ import (
 const (
 	// Environment variable names
 	EnvDebug             = "DEBUG"
+	EnvResolverName      = "RESOLVER_NAME"
+	EnvResolverType      = "RESOLVER_TYPE"
+	EnvResolverAliases   = "RESOLVER_TYPE_ALIASES"
 	EnvHTTPTimeout       = "HTTP_TIMEOUT"
+	EnvHTTPIdlePerHost   = "HTTP_MAX_IDLE_CONNS_PER_HOST"
+	EnvHTTPRetries       = "HTTP_RETRIES"
+	EnvHTTPRetryBackoff  = "HTTP_RETRY_BACKOFF"
 	EnvResolutionTimeout = "RESOLUTION_TIMEOUT"
 	EnvGitCloneDepth     = "GIT_CLONE_DEPTH"
+	EnvGitCloneLimit     = "GIT_CLONE_CONCURRENCY"
 	EnvGitBranch         = "GIT_DEFAULT_BRANCH"
+	EnvGitSSHKeyFile     = "GIT_SSH_KEY_FILE"
+	EnvGitSSHKnownHosts  = "GIT_SSH_KNOWN_HOSTS"
+	EnvGitSubmodules     = "GIT_SUBMODULES"
+	EnvGitLFS            = "GIT_LFS"
+	EnvGitCacheDir       = "GIT_CACHE_DIR"
+	EnvGitMirrorRepos    = "GIT_MIRROR_REPOSITORIES"
+	EnvGitMirrorInterval = "GIT_MIRROR_INTERVAL"
+	EnvGitRetries        = "GIT_RETRIES"
+	EnvGitRetryBackoff   = "GIT_RETRY_BACKOFF"
+	EnvGitLabToken       = "GITLAB_TOKEN"
+	EnvGitLabHosts       = "GITLAB_HOSTS"
+	EnvGitHubToken       = "GITHUB_TOKEN"
+	EnvGitHubAPIURL      = "GITHUB_API_URL"
+	EnvGitHubMaxWait     = "GITHUB_RATE_LIMIT_MAX_WAIT"
+	EnvGitHubAppID       = "GITHUB_APP_ID"
+	EnvGitHubInstallID   = "GITHUB_APP_INSTALLATION_ID"
+	EnvGitHubAppKeyFile  = "GITHUB_APP_PRIVATE_KEY_FILE"
+	EnvOCIPlainHTTP      = "OCI_PLAIN_HTTP"
+	EnvS3Endpoint        = "S3_ENDPOINT"
+	EnvAzureBlobEndpoint = "AZURE_BLOB_ENDPOINT"
+	EnvAzureSASToken     = "AZURE_STORAGE_SAS_TOKEN"
+	EnvAllowFileRepos    = "ALLOW_FILE_REPOSITORIES"
+	EnvGiteaHosts        = "GITEA_HOSTS"
+	EnvGiteaToken        = "GITEA_TOKEN"
+	EnvArtifactHosts     = "ARTIFACT_REPOSITORY_HOSTS"
+	EnvArtifactAPIKey    = "ARTIFACT_REPOSITORY_API_KEY"
+	EnvArtifactUsername  = "ARTIFACT_REPOSITORY_USERNAME"
+	EnvArtifactPassword  = "ARTIFACT_REPOSITORY_PASSWORD"
+	EnvHTTPProxy         = "RESOLVER_HTTP_PROXY"
+	EnvHTTPSProxy        = "RESOLVER_HTTPS_PROXY"
+	EnvNoProxy           = "RESOLVER_NO_PROXY"
+	EnvCacheBackend      = "CACHE_BACKEND"
+	EnvCacheTTL          = "CACHE_TTL"
+	EnvCacheMaxBytes     = "CACHE_MAX_BYTES"
+	EnvRedisAddr         = "REDIS_ADDR"
+	EnvRedisPassword     = "REDIS_PASSWORD"
+	EnvRedisDB           = "REDIS_DB"
+	EnvAdminPort         = "ADMIN_PORT"
+	EnvTemplateEnvAllow  = "TEMPLATE_ENV_ALLOWLIST"
+	EnvNormalizeSpace    = "RENDER_NORMALIZE_WHITESPACE"
+	EnvJsonnetBinary     = "JSONNET_BINARY"
+	EnvCUEBinary         = "CUE_BINARY"
+	EnvYttBinary         = "YTT_BINARY"
+	EnvValidateRendered  = "VALIDATE_RENDERED_RESOURCES"
+	EnvDeclareWorkspaces = "DECLARE_PIPELINE_WORKSPACES"
+	EnvDeclareParams     = "DECLARE_PIPELINE_PARAMS"
+	EnvParamSchemaFiles  = "PARAM_SCHEMA_SIDECARS"
+	EnvValuesFiles       = "TEMPLATE_VALUES_FILES"
+	EnvCoerceTypes       = "TEMPLATE_COERCE_TYPES"
+	EnvParamHeuristics   = "TEMPLATE_PARAM_HEURISTICS"
+	EnvStrictYAML        = "TEMPLATE_STRICT_YAML"
+	EnvProvenance        = "PROVENANCE_ENABLED"
+	EnvProvenanceKey     = "PROVENANCE_SIGNING_KEY"
+	EnvRekorURL          = "REKOR_URL"
+	EnvAPIToken          = "API_TOKEN"
+	EnvAPITokenFile      = "API_TOKEN_FILE"
+	EnvAPIBasicUsername  = "API_BASIC_AUTH_USERNAME"
+	EnvAPIBasicPassword  = "API_BASIC_AUTH_PASSWORD"
+	EnvShutdownTimeout   = "SHUTDOWN_TIMEOUT"
+	EnvRateLimitGlobal   = "RATE_LIMIT_GLOBAL"
+	EnvRateLimitClient   = "RATE_LIMIT_PER_CLIENT"
+	EnvRateLimitBurst    = "RATE_LIMIT_BURST"
+	EnvPprof             = "ENABLE_PPROF"
+	EnvCORSOrigins       = "CORS_ALLOWED_ORIGINS"
+	EnvLogFormat         = "LOG_FORMAT"
+	EnvMaxTemplateSize   = "MAX_TEMPLATE_SIZE"
+	EnvRenderTimeout     = "RENDER_TIMEOUT"
+	EnvRestrictTemplates = "RESTRICTED_TEMPLATES"
+	EnvRepoCredentials   = "REPOSITORY_CREDENTIALS"
+	EnvNetrc             = "NETRC"
+	EnvCheckRepos        = "STARTUP_CHECK_REPOSITORIES"
+	EnvWebhookPort       = "WEBHOOK_PORT"
+	EnvWebhookCertFile   = "WEBHOOK_TLS_CERT_FILE"
+	EnvWebhookKeyFile    = "WEBHOOK_TLS_KEY_FILE"
+	EnvWebhookRepos      = "WEBHOOK_ALLOWED_REPOSITORIES"
+	EnvWebhookDryRun     = "WEBHOOK_DRY_RUN"
+	EnvWatchTemplates    = "WATCH_TEMPLATES"
+	EnvWatchInterval     = "WATCH_INTERVAL"
+	EnvWatchSecret       = "WATCH_WEBHOOK_SECRET"
+
+	EnvTemplateLookupConfigMaps = "TEMPLATE_LOOKUP_CONFIGMAPS"
+	EnvTemplateLookupSecrets    = "TEMPLATE_LOOKUP_SECRETS"
 
 	// Default values
+	DefaultResolverName      = "Template"
+	DefaultResolverType      = "template"
 	DefaultHTTPTimeout       = 30 * time.Second
+	DefaultHTTPIdlePerHost   = 16
+	DefaultHTTPRetries       = 2
+	DefaultHTTPRetryBackoff  = 250 * time.Millisecond
 	DefaultResolutionTimeout = 60 * time.Second
 	DefaultGitCloneDepth     = 1
+	DefaultGitCloneLimit     = 8
 	DefaultGitBranch         = "main"
+	DefaultGitSSHKeyFile     = "/etc/git-secrets/ssh-privatekey"
+	DefaultGitSubmodules     = SubmodulesNone
+	DefaultGitMirrorInterval = 5 * time.Minute
+	DefaultGitRetries        = 2
+	DefaultGitRetryBackoff   = time.Second
+	DefaultGitHubAPIURL      = "https://api.github.com"
+	DefaultGitHubMaxWait     = 10 * time.Second
+	DefaultCacheBackend      = CacheBackendNone
+	DefaultCacheTTL          = 5 * time.Minute
+	DefaultJsonnetBinary     = "jsonnet"
+	DefaultCUEBinary         = "cue"
+	DefaultYttBinary         = "ytt"
+	DefaultShutdownTimeout   = 25 * time.Second
+	DefaultRateLimitBurst    = 10
+	DefaultLogFormat         = LogFormatJSON
+	DefaultMaxTemplateSize   = 1 << 20
+	DefaultCacheMaxBytes     = 64 << 20
+	DefaultRenderTimeout     = 10 * time.Second
+	DefaultWebhookCertFile   = "/etc/webhook-certs/tls.crt"
+	DefaultWebhookKeyFile    = "/etc/webhook-certs/tls.key"
+	DefaultWatchInterval     = time.Minute
 )
 
-// Global config flags
+// Global config flags, initialized to their defaults until loaded from the environment
 var (
-	debugMode         bool
-	httpTimeout       time.Duration
-	resolutionTimeout time.Duration
-	gitCloneDepth     int
-	gitDefaultBranch  string
+	debugMode              bool
+	resolverName           = DefaultResolverName
+	resolverType           = DefaultResolverType // resolution.tekton.dev/type of the requests served
+	resolverTypeAliases    []string              // Other resolver types served, during migrations
+	httpTimeout            = DefaultHTTPTimeout
+	httpMaxIdlePerHost     = DefaultHTTPIdlePerHost // Idle connections kept open to each host
+	httpRetries            = DefaultHTTPRetries     // Retries of idempotent requests failing transiently
+	httpRetryBackoff       = DefaultHTTPRetryBackoff
+	resolutionTimeout      = DefaultResolutionTimeout
+	gitCloneDepth          = DefaultGitCloneDepth
+	gitDefaultBranch       = DefaultGitBranch
+	gitSSHKeyFile          = DefaultGitSSHKeyFile
+	gitSSHKnownHosts       string
+	gitSubmodules          = DefaultGitSubmodules // Submodule mode when the request does not set one
+	gitLFS                 bool                   // Download Git LFS objects for pointer files
+	gitCacheDir            string                 // Directory of persistent clones, in-memory clones when empty
+	gitMirrorRepositories  []string               // Repositories fetched into the Git cache ahead of requests
+	gitMirrorInterval      = DefaultGitMirrorInterval
+	gitRetries             = DefaultGitRetries // Retries of clones and fetches failing transiently
+	gitRetryBackoff        = DefaultGitRetryBackoff
+	repositoryCredentials  []repositoryCredential // Secrets holding the credentials of matching repositories
+	gitlabToken            string
+	gitlabHosts            []string
+	githubToken            string
+	githubAPIURL           = DefaultGitHubAPIURL
+	githubRateLimitMaxWait = DefaultGitHubMaxWait // Longest rate limit reset to wait for
+	ociPlainHTTP           bool
+	s3Endpoint             string
+	azureBlobEndpoint      string
+	azureSASToken          string
+	allowFileRepositories  bool
+	giteaHosts             = DefaultGiteaHosts
+	giteaToken             string
+
+	artifactRepositoryHosts    []string
+	artifactRepositoryAPIKey   string
+	artifactRepositoryUsername string
+	artifactRepositoryPassword string
+
+	// .netrc file holding credentials for HTTPS fetches, defaulting to ~/.netrc
+	netrcFile string
+
+	// Git repositories checked to be reachable when the resolver starts
+	startupCheckRepositories []string
+
+	// Proxy configuration, defaulting to the standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	httpProxy  string
+	httpsProxy string
+	noProxy    string
+
+	// Cache shared by requests for fetched templates and rendered results
+	cacheBackend  = DefaultCacheBackend
+	cacheTTL      = DefaultCacheTTL
+	redisAddr     string
+	redisPassword string
+	redisDB       int
+
+	// Largest total size in bytes of the values of the memory cache, unlimited when 0
+	cacheMaxBytes int64 = DefaultCacheMaxBytes
+
+	// Port of the admin server in controller mode, disabled when 0
+	adminPort int
+
+	// Environment variables templates may read with the env function
+	templateEnvAllowlist []string
+
+	// ConfigMap name and Secret "name/key" patterns templates may read with the lookup function
+	templateLookupConfigMaps []string
+	templateLookupSecrets    []string
+
+	// Trim trailing spaces and squash blank lines in rendered templates
+	renderNormalizeWhitespace bool
+
+	// Commands evaluating Jsonnet, CUE and ytt templates
+	jsonnetBinary = DefaultJsonnetBinary
+	cueBinary     = DefaultCUEBinary
+	yttBinary     = DefaultYttBinary
+
+	// Run Tekton's validation on rendered Pipelines and Tasks
+	validateRendered = true
+
+	// Declare the workspaces the tasks of rendered Pipelines use but the Pipelines do not
+	declareWorkspaces = true
+
+	// Look for a sidecar param schema next to templates without frontmatter
+	paramSchemaSidecars bool
+
+	// Read default values of templates from a values file next to them
+	templateValuesFiles bool
+
+	// Convert string params holding booleans and numbers to typed values when the request
+	// does not set coerce-types
+	coerceParamTypes bool
+
+	// Detect task list params by name when neither the request nor the template declares them
+	structuredParamHeuristics = true
+
+	// Fail resolutions whose rendered Go template is not valid YAML when the request does not
+	// set strict-yaml
+	strictYAML bool
+
+	// Declare the params the tasks of rendered Pipelines reference but the Pipelines do not,
+	// when the request does not set declare-params
+	declareParams bool
+
+	// Annotate resolved templates with their SLSA provenance, signed with provenanceSigner
+	// when set and uploaded to the Rekor transparency log at rekorURL when set
+	provenanceEnabled bool
+	provenanceSigner  crypto.Signer
+	rekorURL          string
+
+	// Credentials required by the standalone and admin HTTP endpoints, open when unset
+	apiToken             string
+	apiBasicAuthUsername string
+	apiBasicAuthPassword string
+
+	// How long the standalone server waits for in-flight requests when stopping
+	shutdownTimeout = DefaultShutdownTimeout
+
+	// Requests per minute accepted by the rendering endpoints of the standalone server, from
+	// all clients and from each client, unlimited when 0
+	rateLimitGlobal    int
+	rateLimitPerClient int
+	rateLimitBurst     = DefaultRateLimitBurst
+
+	// Serve net/http/pprof profiles on the standalone or admin server
+	pprofEnabled bool
+
+	// Origin patterns of browser pages allowed to call the standalone API, none when empty
+	corsAllowedOrigins []string
+
+	// Largest template in bytes any fetcher reads, unlimited when 0
+	maxTemplateSize int64 = DefaultMaxTemplateSize
+
+	// How long a Go template may run before it is cancelled, unlimited when 0
+	renderTimeout = DefaultRenderTimeout
+
+	// Block template functions reading the environment, the cluster or the network
+	restrictedTemplates bool
+
+	// Port of the validating admission webhook for PipelineRuns, disabled when 0, with its
+	// serving certificate, the repository patterns it admits, all when empty, and whether it
+	// renders referenced templates
+	webhookPort         int
+	webhookCertFile     = DefaultWebhookCertFile
+	webhookKeyFile      = DefaultWebhookKeyFile
+	webhookRepositories []string
+	webhookDryRun       bool
+
+	// Templates kept in the cache and linted when they change, checked every watchInterval
+	// and on the push events authenticated with watchWebhookSecret
+	watchTemplates     []watchedTemplate
+	watchInterval      = DefaultWatchInterval
+	watchWebhookSecret string
 )
 
-// debugf prints debug messages only when debug mode is enabled
-func debugf(format string, args ...interface{}) {
-	if debugMode {
-		log.Printf(format, args...)
-	}
-}
+// DefaultGiteaHosts lists the public Gitea-compatible forges recognized without configuration
+var DefaultGiteaHosts = []string{"codeberg.org", "gitea.com"}
 
 // getEnvWithDefault gets an environment variable value or returns the default if not set
 func getEnvWithDefault(key string, defaultValue string) string {
@@ -53,7 +315,18 @@ func getEnvWithDefaultInt(key string, defaultValue int) int {
 		if intVal, err := strconv.Atoi(val); err == nil {
 			return intVal
 		}
-		log.Printf("WARNING: Invalid value for %s, using default: %d", key, defaultValue)
+		logger.Warnf("Invalid value for %s, using default: %d", key, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvWithDefaultBool gets an environment variable as bool or returns the default if not set
+func getEnvWithDefaultBool(key string, defaultValue bool) bool {
+	if val, ok := os.LookupEnv(key); ok {
+		if boolVal, err := strconv.ParseBool(val); err == nil {
+			return boolVal
+		}
+		logger.Warnf("Invalid value for %s, using default: %t", key, defaultValue)
 	}
 	return defaultValue
 }
@@ -64,7 +337,21 @@ func getEnvWithDefaultDuration(key string, defaultValue time.Duration) time.Dura
 		if duration, err := time.ParseDuration(val); err == nil {
 			return duration
 		}
-		log.Printf("WARNING: Invalid value for %s, using default: %v", key, defaultValue)
+		logger.Warnf("Invalid value for %s, using default: %v", key, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvWithDefaultList gets a comma-separated environment variable as a list or returns the default
+func getEnvWithDefaultList(key string, defaultValue []string) []string {
+	if val, ok := os.LookupEnv(key); ok {
+		var items []string
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items
 	}
 	return defaultValue
 }
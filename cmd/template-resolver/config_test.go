@@ -40,6 +40,23 @@ func TestConfigEnvHelpers(t *testing.T) {
 	assert.NoError(t, os.Unsetenv("TEST_INVALID_DURATION"))
 }
 
+func TestGetEnvWithDefaultBool(t *testing.T) {
+	assert.NoError(t, os.Setenv("TEST_BOOL_VAR", "true"))
+	assert.True(t, getEnvWithDefaultBool("TEST_BOOL_VAR", false))
+	assert.True(t, getEnvWithDefaultBool("NONEXISTENT_BOOL_VAR", true))
+	assert.NoError(t, os.Setenv("TEST_INVALID_BOOL", "not-a-bool"))
+	assert.False(t, getEnvWithDefaultBool("TEST_INVALID_BOOL", false))
+	assert.NoError(t, os.Unsetenv("TEST_BOOL_VAR"))
+	assert.NoError(t, os.Unsetenv("TEST_INVALID_BOOL"))
+}
+
+func TestGetEnvWithDefaultList(t *testing.T) {
+	assert.NoError(t, os.Setenv("TEST_LIST_VAR", "gitlab.example.com, git.internal ,,"))
+	assert.Equal(t, []string{"gitlab.example.com", "git.internal"}, getEnvWithDefaultList("TEST_LIST_VAR", nil))
+	assert.Equal(t, []string{"default"}, getEnvWithDefaultList("NONEXISTENT_LIST_VAR", []string{"default"}))
+	assert.NoError(t, os.Unsetenv("TEST_LIST_VAR"))
+}
+
 func TestDebugf(t *testing.T) {
 	// There's not much we can test here without mocking log.Printf
 	// or capturing stdout, but we can at least ensure it doesn't panic
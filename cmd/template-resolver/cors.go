@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// corsMaxAge is how long browsers may cache the result of a preflight request
+const corsMaxAge = 600
+
+// corsAllowedHeaders are the request headers browser clients may send
+var corsAllowedHeaders = []string{"Authorization", "Content-Type", RequestIDHeader}
+
+// corsExposedHeaders are the response headers browser clients may read
+var corsExposedHeaders = []string{RequestIDHeader, "Retry-After"}
+
+// corsOriginAllowed reports whether browser pages of origin may call the API: origins
+// matching a pattern of CORS_ALLOWED_ORIGINS, or every origin when it holds "*"
+func corsOriginAllowed(origin string) bool {
+	return origin != "" && (slices.Contains(corsAllowedOrigins, "*") || allowlisted(origin, corsAllowedOrigins))
+}
+
+// cors lets browser-based tools, such as template playgrounds and dashboards, call handler
+// from the origins in CORS_ALLOWED_ORIGINS. Preflight requests are answered here, before
+// authentication and rate limits, since browsers send them without credentials.
+func cors(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(corsAllowedOrigins) == 0 {
+			handler(w, r)
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		w.Header().Add("Vary", "Origin")
+		if !corsOriginAllowed(origin) {
+			if preflight {
+				writeAPIError(w, http.StatusForbidden, "Origin %s is not allowed", origin)
+				return
+			}
+			handler(w, r)
+			return
+		}
+
+		// Browsers only send credentials they manage, such as basic auth, to listed origins.
+		// Bearer tokens set by the page work with any origin.
+		if slices.Contains(corsAllowedOrigins, "*") {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if preflight {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join([]string{http.MethodPost, http.MethodOptions}, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsAllowedHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+		handler(w, r)
+	}
+}
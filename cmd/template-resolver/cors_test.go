@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	original := corsAllowedOrigins
+	defer func() { corsAllowedOrigins = original }()
+
+	handler := cors(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	call := func(method, origin string, preflight bool) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/render", nil)
+		if origin != "" {
+			request.Header.Set("Origin", origin)
+		}
+		if preflight {
+			request.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+		return recorder
+	}
+
+	// Without allowed origins no CORS headers are sent
+	corsAllowedOrigins = nil
+	recorder := call(http.MethodPost, "https://playground.example.com", false)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"))
+
+	corsAllowedOrigins = []string{"https://*.example.com"}
+	recorder = call(http.MethodPost, "https://playground.example.com", false)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "https://playground.example.com", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", recorder.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, recorder.Header().Get("Access-Control-Expose-Headers"), RequestIDHeader)
+
+	recorder = call(http.MethodOptions, "https://playground.example.com", true)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "POST, OPTIONS", recorder.Header().Get("Access-Control-Allow-Methods"))
+	assert.Contains(t, recorder.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+
+	// Other origins get no CORS headers, and their preflight requests are refused
+	recorder = call(http.MethodPost, "https://evil.test", false)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, http.StatusForbidden, call(http.MethodOptions, "https://evil.test", true).Code)
+
+	// Any origin is allowed with *, without browser-managed credentials
+	corsAllowedOrigins = []string{"*"}
+	recorder = call(http.MethodPost, "https://evil.test", false)
+	assert.Equal(t, "*", recorder.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, recorder.Header().Get("Access-Control-Allow-Credentials"))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/tektoncd/pipeline/pkg/resolution/common"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/system"
+)
+
+// Keys read from a git-credentials-secret. ssh-privatekey, username and password match the
+// kubernetes.io/ssh-auth and kubernetes.io/basic-auth Secret types.
+const (
+	secretKeySSHPrivateKey = "ssh-privatekey"
+	secretKeyToken         = "token"
+	secretKeyUsername      = "username"
+	secretKeyPassword      = "password"
+)
+
+// GitCredentials are the credentials for a single resolution, read from a Kubernetes Secret
+type GitCredentials struct {
+	// SSHPrivateKey is used for SSH repository URLs
+	SSHPrivateKey []byte
+
+	// Username and Password (or token) are sent as basic auth for HTTPS repository URLs
+	Username string
+	Password string
+}
+
+// loadGitCredentials reads the named Secret from the namespace of the ResolutionRequest.
+// A token takes precedence over a password for HTTPS repositories.
+func (r *resolver) loadGitCredentials(ctx context.Context, secretName string) (*GitCredentials, error) {
+	if r.kubeClient == nil {
+		return nil, fmt.Errorf("%s is only supported when running as a Tekton resolver", GitCredentialsSecretParam)
+	}
+	namespace := common.RequestNamespace(ctx)
+	if namespace == "" {
+		return nil, fmt.Errorf("cannot read %s %s: request namespace is unknown", GitCredentialsSecretParam, secretName)
+	}
+
+	return r.readGitCredentials(ctx, namespace, secretName)
+}
+
+// readGitCredentials reads Git credentials from a Secret. A token takes precedence over a
+// password for HTTPS repositories.
+func (r *resolver) readGitCredentials(ctx context.Context, namespace, secretName string) (*GitCredentials, error) {
+	debugContextf(ctx, "Loading Git credentials from secret %s/%s", namespace, secretName)
+	secret, err := r.kubeClient.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Git credentials secret %s/%s: %w", namespace, secretName, err)
+	}
+
+	creds := &GitCredentials{
+		SSHPrivateKey: secret.Data[secretKeySSHPrivateKey],
+		Username:      string(secret.Data[secretKeyUsername]),
+		Password:      string(secret.Data[secretKeyPassword]),
+	}
+	if token := secret.Data[secretKeyToken]; len(token) > 0 {
+		creds.Password = string(token)
+	}
+	if len(creds.SSHPrivateKey) == 0 && creds.Password == "" {
+		return nil, fmt.Errorf("credentials secret %s/%s must contain %s, %s or %s",
+			namespace, secretName, secretKeySSHPrivateKey, secretKeyToken, secretKeyPassword)
+	}
+	return creds, nil
+}
+
+// repositoryCredential maps repositories matching a pattern to a credentials Secret in the
+// namespace of the resolver
+type repositoryCredential struct {
+	pattern string
+	secret  string
+}
+
+// parseRepositoryCredentials parses the "pattern=secret" entries of REPOSITORY_CREDENTIALS.
+// Invalid entries are logged and skipped.
+func parseRepositoryCredentials(entries []string) []repositoryCredential {
+	var credentials []repositoryCredential
+	for _, entry := range entries {
+		pattern, secret, ok := strings.Cut(entry, "=")
+		pattern, secret = strings.TrimSpace(pattern), strings.TrimSpace(secret)
+		if !ok || pattern == "" || secret == "" {
+			logger.Warnf("Ignoring invalid %s entry %q, expected pattern=secret", EnvRepoCredentials, entry)
+			continue
+		}
+		credentials = append(credentials, repositoryCredential{pattern: pattern, secret: secret})
+	}
+	return credentials
+}
+
+// repositoryName returns the host and path of a repository URL without the scheme, user
+// or .git suffix, which REPOSITORY_CREDENTIALS patterns are matched against.
+// Example: git@github.com:acme/templates.git -> github.com/acme/templates
+func repositoryName(repoURL string) (string, error) {
+	endpoint, err := transport.NewEndpoint(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid repository URL %s: %w", repoURL, err)
+	}
+	return endpoint.Host + "/" + strings.TrimSuffix(strings.Trim(endpoint.Path, "/"), ".git"), nil
+}
+
+// repositoryCredentials returns the credentials configured for a repository in
+// REPOSITORY_CREDENTIALS, read from a Secret in the namespace of the resolver, or nil when
+// no pattern matches. The first matching pattern wins.
+func (r *resolver) repositoryCredentials(ctx context.Context, repoURL string) (*GitCredentials, error) {
+	if len(repositoryCredentials) == 0 || r.kubeClient == nil {
+		return nil, nil
+	}
+	name, err := repositoryName(repoURL)
+	if err != nil {
+		debugContextf(ctx, "Not looking up credentials: %v", err)
+		return nil, nil
+	}
+	for _, credential := range repositoryCredentials {
+		if !allowlisted(name, []string{credential.pattern}) {
+			continue
+		}
+		namespace := os.Getenv(system.NamespaceEnvKey)
+		if namespace == "" {
+			return nil, fmt.Errorf("cannot read credentials for %s: %s is not set", name, system.NamespaceEnvKey)
+		}
+		debugContextf(ctx, "Repository %s matches credentials pattern %s", name, credential.pattern)
+		return r.readGitCredentials(ctx, namespace, credential.secret)
+	}
+	return nil, nil
+}
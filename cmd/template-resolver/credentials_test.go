@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tektoncd/pipeline/pkg/resolution/common"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLoadGitCredentials(t *testing.T) {
+	r := &resolver{
+		kubeClient: fake.NewSimpleClientset(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "deploy-key", Namespace: "team-a"},
+				Data:       map[string][]byte{"ssh-privatekey": []byte("key")},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "forge-token", Namespace: "team-a"},
+				Data:       map[string][]byte{"username": []byte("bot"), "password": []byte("secret"), "token": []byte("tok")},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "empty", Namespace: "team-a"},
+				Data:       map[string][]byte{"other": []byte("value")},
+			},
+		),
+	}
+	ctx := common.InjectRequestNamespace(context.Background(), "team-a")
+
+	creds, err := r.loadGitCredentials(ctx, "deploy-key")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("key"), creds.SSHPrivateKey)
+
+	// Tokens take precedence over passwords
+	creds, err = r.loadGitCredentials(ctx, "forge-token")
+	require.NoError(t, err)
+	assert.Equal(t, "bot", creds.Username)
+	assert.Equal(t, "tok", creds.Password)
+
+	_, err = r.loadGitCredentials(ctx, "empty")
+	assert.ErrorContains(t, err, "must contain")
+
+	_, err = r.loadGitCredentials(ctx, "missing")
+	assert.ErrorContains(t, err, "failed to read Git credentials secret team-a/missing")
+
+	// Secrets are only read from the namespace of the request
+	_, err = r.loadGitCredentials(common.InjectRequestNamespace(context.Background(), "team-b"), "deploy-key")
+	assert.Error(t, err)
+
+	_, err = r.loadGitCredentials(context.Background(), "deploy-key")
+	assert.ErrorContains(t, err, "request namespace is unknown")
+
+	_, err = (&resolver{}).loadGitCredentials(ctx, "deploy-key")
+	assert.ErrorContains(t, err, "only supported when running as a Tekton resolver")
+}
+
+func TestParseRepositoryCredentials(t *testing.T) {
+	credentials := parseRepositoryCredentials([]string{"github.com/acme/*=acme-git", " gitlab.example.com/*/* = gitlab-token ", "invalid", "=missing-pattern"})
+	assert.Equal(t, []repositoryCredential{
+		{pattern: "github.com/acme/*", secret: "acme-git"},
+		{pattern: "gitlab.example.com/*/*", secret: "gitlab-token"},
+	}, credentials)
+}
+
+func TestRepositoryName(t *testing.T) {
+	for repoURL, expected := range map[string]string{
+		"https://github.com/acme/templates":       "github.com/acme/templates",
+		"https://github.com/acme/templates.git/":  "github.com/acme/templates",
+		"git@github.com:acme/templates.git":       "github.com/acme/templates",
+		"ssh://git@gitlab.example.com/a/b/c.git":  "gitlab.example.com/a/b/c",
+		"https://user@gitea.example.com/org/repo": "gitea.example.com/org/repo",
+	} {
+		name, err := repositoryName(repoURL)
+		require.NoError(t, err)
+		assert.Equal(t, expected, name, repoURL)
+	}
+}
+
+func TestRepositoryCredentials(t *testing.T) {
+	original := repositoryCredentials
+	defer func() { repositoryCredentials = original }()
+	repositoryCredentials = []repositoryCredential{
+		{pattern: "github.com/acme/*", secret: "acme-git"},
+		{pattern: "github.com/*/*", secret: "github-token"},
+	}
+	t.Setenv("SYSTEM_NAMESPACE", "tekton-pipelines-resolvers")
+
+	r := &resolver{
+		kubeClient: fake.NewSimpleClientset(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "acme-git", Namespace: "tekton-pipelines-resolvers"},
+				Data:       map[string][]byte{"ssh-privatekey": []byte("acme-key")},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "github-token", Namespace: "tekton-pipelines-resolvers"},
+				Data:       map[string][]byte{"token": []byte("tok")},
+			},
+		),
+	}
+	ctx := common.InjectRequestNamespace(context.Background(), "team-a")
+
+	// The first matching pattern wins
+	creds, err := r.repositoryCredentials(ctx, "git@github.com:acme/templates.git")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("acme-key"), creds.SSHPrivateKey)
+
+	creds, err = r.repositoryCredentials(ctx, "https://github.com/other/templates")
+	require.NoError(t, err)
+	assert.Equal(t, "tok", creds.Password)
+
+	creds, err = r.repositoryCredentials(ctx, "https://gitlab.com/acme/templates")
+	require.NoError(t, err)
+	assert.Nil(t, creds)
+
+	// Secrets are read from the namespace of the resolver only
+	t.Setenv("SYSTEM_NAMESPACE", "team-a")
+	_, err = r.repositoryCredentials(ctx, "https://github.com/acme/templates")
+	assert.ErrorContains(t, err, "failed to read Git credentials secret team-a/acme-git")
+
+	creds, err = (&resolver{}).repositoryCredentials(ctx, "https://github.com/acme/templates")
+	require.NoError(t, err)
+	assert.Nil(t, creds)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+const (
+	// cueParamsField is the field the request params are unified into
+	cueParamsField = "params"
+
+	// cueOutputField is the field of a CUE template exported as the resolved resource
+	cueOutputField = "pipeline"
+)
+
+// cuePackagePattern finds the package clause of a CUE file, which the params file must repeat
+var cuePackagePattern = regexp.MustCompile(`(?m)^package\s+([A-Za-z_$][A-Za-z0-9_$]*)\s*$`)
+
+// cueParams returns the CUE file holding the request params under the params field, in the
+// package of the template. Strings, arrays and objects keep their types, so the template can
+// declare a schema for them such as params: { "app-name": string & =~"^[a-z-]+$" }.
+func cueParams(content string, params []pipelinev1.Param) (string, error) {
+	values := engineParamValues(params)
+
+	// JSON is valid CUE
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode params for CUE: %w", err)
+	}
+
+	var file strings.Builder
+	if match := cuePackagePattern.FindStringSubmatch(content); match != nil {
+		file.WriteString("package " + match[1] + "\n\n")
+	}
+	file.WriteString(cueParamsField + ": " + string(encoded) + "\n")
+	return file.String(), nil
+}
+
+// renderCUE unifies the request params with a CUE template using the cue binary at CUE_BINARY
+// and exports its pipeline field as YAML. Params that do not satisfy the constraints of the
+// template fail the request with CUE's error message. Imports are not supported because only
+// the template file itself is fetched.
+func renderCUE(ctx context.Context, content string, params []pipelinev1.Param) (string, error) {
+	paramsFile, err := cueParams(content, params)
+	if err != nil {
+		return "", err
+	}
+
+	debugf("Exporting CUE template with %s", cueBinary)
+	args := []string{"export", "--out", "yaml", "-e", cueOutputField, "template.cue", "params.cue"}
+	output, err := runEngineCommandWithFiles(ctx, cueBinary, args, map[string]string{
+		"template.cue": content,
+		"params.cue":   paramsFile,
+	}, "")
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestCUEParams(t *testing.T) {
+	params := []pipelinev1.Param{
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		{Name: "environments", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{"dev", "prod"}}},
+		{Name: GitCredentialsSecretParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "git-creds"}},
+	}
+
+	file, err := cueParams("pipeline: {}\n", params)
+	require.NoError(t, err)
+	assert.Equal(t, "params: {\"app-name\":\"api\",\"environments\":[\"dev\",\"prod\"]}\n", file)
+
+	// The params file joins the package of the template
+	file, err = cueParams("// Build pipeline\npackage pipelines\n\npipeline: {}\n", params)
+	require.NoError(t, err)
+	assert.Equal(t, "package pipelines\n\nparams: {\"app-name\":\"api\",\"environments\":[\"dev\",\"prod\"]}\n", file)
+}
+
+func TestRenderCUE(t *testing.T) {
+	// The fake binary checks both files were written to its working directory
+	useEngineBinary(t, &cueBinary, `test -f template.cue && grep -q '"app-name":"api"' params.cue || exit 1
+echo "$@"
+`)
+
+	params := []pipelinev1.Param{
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+	}
+	rendered, err := renderCUE(context.Background(), "pipeline: name: params[\"app-name\"]\n", params)
+	require.NoError(t, err)
+	assert.Equal(t, "export --out yaml -e pipeline template.cue params.cue\n", rendered)
+
+	useEngineBinary(t, &cueBinary, "echo 'params.\"app-name\": invalid value \"API\"' >&2\nexit 1\n")
+	_, err = renderCUE(context.Background(), "pipeline: {}\n", params)
+	assert.ErrorContains(t, err, "invalid value")
+}
+
+func TestRenderCUEWithCUE(t *testing.T) {
+	if _, err := exec.LookPath(DefaultCUEBinary); err != nil {
+		t.Skip("cue is not installed")
+	}
+
+	template := `params: {
+	"app-name": string & =~"^[a-z-]+$"
+	environments: [...string]
+}
+pipeline: {
+	kind: "Pipeline"
+	metadata: name: params["app-name"]
+	spec: tasks: [for env in params.environments {name: "deploy-\(env)"}]
+}
+`
+	params := []pipelinev1.Param{
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		{Name: "environments", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{"dev", "prod"}}},
+	}
+	rendered, err := renderCUE(context.Background(), template, params)
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "name: deploy-prod")
+
+	params[0].Value.StringVal = "API"
+	_, err = renderCUE(context.Background(), template, params)
+	assert.Error(t, err)
+}
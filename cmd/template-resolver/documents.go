@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// renderedDocument is one YAML document of a rendered template
+type renderedDocument struct {
+	kind   string
+	name   string
+	object map[string]interface{}
+}
+
+// stepActionParamPattern matches the references to StepAction params in its fields, as
+// $(params.name) or $(params["name"]), with an optional [*] expanding an array param
+var stepActionParamPattern = regexp.MustCompile(`\$\(params(?:\.([A-Za-z0-9_.-]+?)|\[['"]([^'"]+)['"]\])(\[\*\])?\)`)
+
+// splitYAMLDocuments splits rendered YAML on its --- separators, keeping the text of each
+// document as it is. Documents holding only whitespace and comments are dropped.
+func splitYAMLDocuments(content string) []string {
+	var documents []string
+	var current strings.Builder
+	flush := func() {
+		if document := current.String(); !blankYAML(document) {
+			documents = append(documents, document)
+		}
+		current.Reset()
+	}
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if isDocumentSeparator(line) {
+			flush()
+			continue
+		}
+		current.WriteString(line)
+	}
+	flush()
+	return documents
+}
+
+// isDocumentSeparator reports whether a line starts a new YAML document. Separators are at
+// the start of the line, so indented --- lines of block scalars such as scripts are not.
+func isDocumentSeparator(line string) bool {
+	rest, ok := strings.CutPrefix(strings.TrimRight(line, "\r\n"), "---")
+	return ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t')
+}
+
+// blankYAML reports whether a document holds nothing but whitespace and comments
+func blankYAML(document string) bool {
+	for _, line := range strings.Split(document, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+// parseRenderedDocuments decodes the documents of a rendered template, which must all be
+// Tekton Pipelines, Tasks or StepActions with a name
+func parseRenderedDocuments(documents []string) ([]renderedDocument, error) {
+	parsed := make([]renderedDocument, 0, len(documents))
+	for i, document := range documents {
+		var object map[string]interface{}
+		if err := yaml.Unmarshal([]byte(document), &object); err != nil {
+			return nil, fmt.Errorf("rendered document %d is not valid YAML: %w", i+1, newYAMLError(err, document))
+		}
+		kind, _ := object["kind"].(string)
+		switch kind {
+		case "Pipeline", "Task", "StepAction":
+		default:
+			return nil, fmt.Errorf("rendered document %d is a %q, only Pipelines, Tasks and StepActions can be combined", i+1, kind)
+		}
+		metadata, _ := object["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("rendered %s in document %d has no name", kind, i+1)
+		}
+		parsed = append(parsed, renderedDocument{kind: kind, name: name, object: object})
+	}
+	return parsed, nil
+}
+
+// combineDocuments turns a template rendering several YAML documents into the single resource
+// Tekton accepts from a resolver. The Tasks and StepActions that come with a Pipeline, or
+// the StepActions that come with a Task, are inlined where they are referenced by name, as
+// taskSpec and steps. Every document is validated on its own first when validate is set,
+// the combined resource is validated like any other. Output with a single document is
+// returned as it is.
+func combineDocuments(ctx context.Context, rendered string, validate bool) (string, error) {
+	documents := splitYAMLDocuments(rendered)
+	if len(documents) <= 1 {
+		return rendered, nil
+	}
+	debugContextf(ctx, "Combining %d rendered documents", len(documents))
+
+	if validate {
+		for _, document := range documents {
+			if err := validateTektonResource(ctx, document); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	parsed, err := parseRenderedDocuments(documents)
+	if err != nil {
+		return "", err
+	}
+
+	var main *renderedDocument
+	tasks := map[string]map[string]interface{}{}
+	stepActions := map[string]map[string]interface{}{}
+	for i, document := range parsed {
+		spec, _ := document.object["spec"].(map[string]interface{})
+		switch document.kind {
+		case "Pipeline":
+			if main != nil && main.kind == "Pipeline" {
+				return "", fmt.Errorf("rendered template holds Pipelines %q and %q, only one can be returned", main.name, document.name)
+			}
+			main = &parsed[i]
+		case "Task":
+			if _, exists := tasks[document.name]; exists {
+				return "", fmt.Errorf("rendered template holds Task %q twice", document.name)
+			}
+			tasks[document.name] = spec
+		case "StepAction":
+			if _, exists := stepActions[document.name]; exists {
+				return "", fmt.Errorf("rendered template holds StepAction %q twice", document.name)
+			}
+			stepActions[document.name] = spec
+		}
+	}
+	if main == nil {
+		if len(tasks) != 1 {
+			return "", fmt.Errorf("rendered template holds %d Tasks and no Pipeline, only one of them can be returned", len(tasks))
+		}
+		for i := range parsed {
+			if parsed[i].kind == "Task" {
+				main = &parsed[i]
+			}
+		}
+		delete(tasks, main.name)
+	}
+
+	used := map[string]bool{}
+	for name, spec := range tasks {
+		if err := inlineStepActions(spec, stepActions, used); err != nil {
+			return "", fmt.Errorf("Task %q: %w", name, err)
+		}
+	}
+	spec, _ := main.object["spec"].(map[string]interface{})
+	if main.kind == "Task" {
+		if err := inlineStepActions(spec, stepActions, used); err != nil {
+			return "", fmt.Errorf("Task %q: %w", main.name, err)
+		}
+	} else {
+		for _, field := range []string{"tasks", "finally"} {
+			pipelineTasks, _ := spec[field].([]interface{})
+			for _, item := range pipelineTasks {
+				if err := inlinePipelineTask(item, tasks, stepActions, used); err != nil {
+					return "", fmt.Errorf("Pipeline %q: %w", main.name, err)
+				}
+			}
+		}
+	}
+
+	var unused []string
+	for i, document := range parsed {
+		if &parsed[i] != main && !used[document.kind+"/"+document.name] {
+			unused = append(unused, fmt.Sprintf("%s %q", document.kind, document.name))
+		}
+	}
+	if len(unused) > 0 {
+		sort.Strings(unused)
+		return "", fmt.Errorf("rendered %s not referenced by %s %q", strings.Join(unused, ", "), main.kind, main.name)
+	}
+
+	combined, err := yaml.Marshal(main.object)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the combined %s: %w", main.kind, err)
+	}
+	return string(combined), nil
+}
+
+// inlinePipelineTask replaces a reference to one of the rendered Tasks with its spec, and
+// inlines the StepActions used by the steps of an embedded taskSpec
+func inlinePipelineTask(item interface{}, tasks, stepActions map[string]map[string]interface{}, used map[string]bool) error {
+	pipelineTask, _ := item.(map[string]interface{})
+	if taskRef, ok := pipelineTask["taskRef"].(map[string]interface{}); ok {
+		name, _ := taskRef["name"].(string)
+		kind, _ := taskRef["kind"].(string)
+		spec, found := tasks[name]
+		if !found || taskRef["resolver"] != nil || (kind != "" && kind != "Task") {
+			return nil
+		}
+		delete(pipelineTask, "taskRef")
+		pipelineTask["taskSpec"] = copyMap(spec)
+		used["Task/"+name] = true
+		return nil
+	}
+	if taskSpec, ok := pipelineTask["taskSpec"].(map[string]interface{}); ok {
+		if err := inlineStepActions(taskSpec, stepActions, used); err != nil {
+			name, _ := pipelineTask["name"].(string)
+			return fmt.Errorf("task %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// inlineStepActions replaces the steps of a Task spec that reference one of the rendered
+// StepActions with the StepAction's fields, its params substituted with the values the step
+// passes or their defaults. Fields set on the step itself, such as its name, are kept.
+func inlineStepActions(spec map[string]interface{}, stepActions map[string]map[string]interface{}, used map[string]bool) error {
+	steps, _ := spec["steps"].([]interface{})
+	for i, item := range steps {
+		step, _ := item.(map[string]interface{})
+		ref, ok := step["ref"].(map[string]interface{})
+		if !ok || ref["resolver"] != nil {
+			continue
+		}
+		name, _ := ref["name"].(string)
+		action, found := stepActions[name]
+		if !found {
+			continue
+		}
+
+		values, err := stepActionParamValues(action, step)
+		if err != nil {
+			return fmt.Errorf("step %v: %w", step["name"], err)
+		}
+		inlined := map[string]interface{}{}
+		for key, value := range action {
+			switch key {
+			case "params", "description":
+				continue
+			}
+			if inlined[key], err = substituteStepActionParams(value, values); err != nil {
+				return fmt.Errorf("step %v: %w", step["name"], err)
+			}
+		}
+		for key, value := range step {
+			switch key {
+			case "ref", "params":
+				continue
+			}
+			inlined[key] = value
+		}
+		steps[i] = inlined
+		used["StepAction/"+name] = true
+	}
+	return nil
+}
+
+// stepActionParamValues returns the values of the params of a StepAction: the values the
+// step passes, or the defaults the StepAction declares
+func stepActionParamValues(action, step map[string]interface{}) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	declared, _ := action["params"].([]interface{})
+	for _, item := range declared {
+		param, _ := item.(map[string]interface{})
+		if name, ok := param["name"].(string); ok && param["default"] != nil {
+			values[name] = param["default"]
+		}
+	}
+	passed, _ := step["params"].([]interface{})
+	for _, item := range passed {
+		param, _ := item.(map[string]interface{})
+		if name, ok := param["name"].(string); ok {
+			values[name] = param["value"]
+		}
+	}
+	for _, item := range declared {
+		param, _ := item.(map[string]interface{})
+		if name, _ := param["name"].(string); values[name] == nil {
+			return nil, fmt.Errorf("no value for StepAction param %q", name)
+		}
+	}
+	return values, nil
+}
+
+// substituteStepActionParams replaces the param references in the strings of a StepAction
+// field. A list item that is only an array reference such as $(params.args[*]) is expanded
+// into the items of the array.
+func substituteStepActionParams(value interface{}, values map[string]interface{}) (interface{}, error) {
+	switch typed := value.(type) {
+	case string:
+		var err error
+		result := stepActionParamPattern.ReplaceAllStringFunc(typed, func(reference string) string {
+			match := stepActionParamPattern.FindStringSubmatch(reference)
+			name := match[1] + match[2]
+			param, found := values[name]
+			if !found {
+				// Object param keys such as $(params.image.tag) are left to Tekton
+				return reference
+			}
+			text, ok := param.(string)
+			switch {
+			case match[3] != "":
+				err = fmt.Errorf("array param %q can only be used as a list item of its own", name)
+			case !ok:
+				err = fmt.Errorf("param %q is not a string", name)
+			default:
+				return text
+			}
+			return reference
+		})
+		return result, err
+	case []interface{}:
+		result := make([]interface{}, 0, len(typed))
+		for _, item := range typed {
+			if text, ok := item.(string); ok {
+				if match := stepActionParamPattern.FindStringSubmatch(text); match != nil && match[0] == text && match[3] != "" {
+					if array, ok := values[match[1]+match[2]].([]interface{}); ok {
+						result = append(result, array...)
+						continue
+					}
+				}
+			}
+			substituted, err := substituteStepActionParams(item, values)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, substituted)
+		}
+		return result, nil
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			substituted, err := substituteStepActionParams(item, values)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = substituted
+		}
+		return result, nil
+	default:
+		return value, nil
+	}
+}
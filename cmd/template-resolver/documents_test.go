@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestSplitYAMLDocuments(t *testing.T) {
+	content := `# leading comment
+---
+kind: Pipeline
+spec:
+  script: |
+    echo start
+    ---
+    echo end
+--- # second
+kind: Task
+---
+---
+`
+	assert.Equal(t, []string{
+		"kind: Pipeline\nspec:\n  script: |\n    echo start\n    ---\n    echo end\n",
+		"kind: Task\n",
+	}, splitYAMLDocuments(content))
+	assert.Equal(t, []string{"kind: Task"}, splitYAMLDocuments("kind: Task"))
+	assert.False(t, isDocumentSeparator("---foo\n"))
+}
+
+const combinedTemplate = `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: build
+spec:
+  tasks:
+    - name: compile
+      taskRef:
+        name: compile
+    - name: lint
+      taskRef:
+        resolver: hub
+        params:
+          - name: name
+            value: golangci-lint
+  finally:
+    - name: notify
+      taskSpec:
+        steps:
+          - name: send
+            ref:
+              name: notify
+            params:
+              - name: channel
+                value: builds
+---
+apiVersion: tekton.dev/v1
+kind: Task
+metadata:
+  name: compile
+spec:
+  steps:
+    - name: build
+      image: golang:1.24
+      script: go build ./...
+---
+apiVersion: tekton.dev/v1beta1
+kind: StepAction
+metadata:
+  name: notify
+spec:
+  description: Posts a message
+  params:
+    - name: channel
+    - name: args
+      type: array
+      default: ["--quiet"]
+  image: curlimages/curl
+  args: ["--channel=$(params.channel)", "$(params.args[*])"]
+`
+
+func TestCombineDocuments(t *testing.T) {
+	combined, err := combineDocuments(context.Background(), combinedTemplate, true)
+	require.NoError(t, err)
+	require.NoError(t, validateTektonResource(context.Background(), combined))
+
+	var pipeline pipelinev1.Pipeline
+	require.NoError(t, yaml.UnmarshalStrict([]byte(combined), &pipeline))
+	assert.Equal(t, "build", pipeline.Name)
+	require.Len(t, pipeline.Spec.Tasks, 2)
+	assert.Nil(t, pipeline.Spec.Tasks[0].TaskRef)
+	assert.Equal(t, "golang:1.24", pipeline.Spec.Tasks[0].TaskSpec.Steps[0].Image)
+	assert.Equal(t, "hub", string(pipeline.Spec.Tasks[1].TaskRef.Resolver))
+
+	step := pipeline.Spec.Finally[0].TaskSpec.Steps[0]
+	assert.Equal(t, "send", step.Name)
+	assert.Nil(t, step.Ref)
+	assert.Equal(t, "curlimages/curl", step.Image)
+	assert.Equal(t, []string{"--channel=builds", "--quiet"}, step.Args)
+
+	// Single documents are returned untouched
+	single := "kind: ConfigMap\nmetadata:\n  name: x\n"
+	combined, err = combineDocuments(context.Background(), single, true)
+	require.NoError(t, err)
+	assert.Equal(t, single, combined)
+}
+
+func TestCombineDocumentsErrors(t *testing.T) {
+	pipeline := "apiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n  name: %s\nspec:\n  tasks:\n    - name: a\n      taskRef:\n        name: a\n"
+	task := "apiVersion: tekton.dev/v1\nkind: Task\nmetadata:\n  name: %s\nspec:\n  steps:\n    - name: s\n      image: alpine\n"
+	tests := []struct {
+		name     string
+		rendered string
+		expected string
+	}{
+		{"two pipelines", fmt.Sprintf(pipeline, "one") + "---\n" + fmt.Sprintf(pipeline, "two"), `holds Pipelines "one" and "two"`},
+		{"two tasks without pipeline", fmt.Sprintf(task, "a") + "---\n" + fmt.Sprintf(task, "b"), "holds 2 Tasks and no Pipeline"},
+		{"unreferenced task", fmt.Sprintf(pipeline, "p") + "---\n" + fmt.Sprintf(task, "a") + "---\n" + fmt.Sprintf(task, "b"), `rendered Task "b" not referenced by Pipeline "p"`},
+		{"other kind", fmt.Sprintf(pipeline, "p") + "---\nkind: ConfigMap\nmetadata:\n  name: c\n", `rendered document 2 is a "ConfigMap"`},
+		{"invalid document", fmt.Sprintf(pipeline, "p") + "---\napiVersion: tekton.dev/v1\nkind: Task\nmetadata:\n  name: a\nspec:\n  steps: []\n", `rendered Task "a" is invalid`},
+		{"missing step param", fmt.Sprintf(task, "t") + "    - name: n\n      ref:\n        name: act\n---\napiVersion: tekton.dev/v1beta1\nkind: StepAction\nmetadata:\n  name: act\nspec:\n  image: alpine\n  params:\n    - name: msg\n", `no value for StepAction param "msg"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := combineDocuments(context.Background(), tt.rendered, true)
+			assert.ErrorContains(t, err, tt.expected)
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+// Rendering engines selectable with the engine param
+const (
+	EngineGoTemplate = "gotemplate"
+	EngineJsonnet    = "jsonnet"
+	EngineCUE        = "cue"
+	EngineYtt        = "ytt"
+	EngineStarlark   = "starlark"
+)
+
+// renderRequest is the input of a rendering engine
+type renderRequest struct {
+	content string
+	path    string
+	params  []pipelinev1.Param
+
+	// options connect Go templates to the request, other engines ignore them
+	options renderOptions
+}
+
+// templateEngine renders templates written in one template language
+type templateEngine interface {
+	render(ctx context.Context, req renderRequest) (string, error)
+}
+
+// engineFunc adapts the render functions of engines that only need the content and params
+type engineFunc func(ctx context.Context, content string, params []pipelinev1.Param) (string, error)
+
+func (f engineFunc) render(ctx context.Context, req renderRequest) (string, error) {
+	return f(ctx, req.content, req.params)
+}
+
+// engineParamValues returns the values of the request params the engines other than Go
+// templates pass to templates, by param name: strings for string params, []string for
+// arrays and map[string]string for objects. Resolution options are not template input, and
+// credentials must not reach the template, so they are left out.
+func engineParamValues(params []pipelinev1.Param) map[string]interface{} {
+	values := make(map[string]interface{}, len(params))
+	for _, param := range params {
+		if isOptionParam(param.Name) {
+			continue
+		}
+		switch param.Value.Type {
+		case pipelinev1.ParamTypeArray:
+			values[param.Name] = param.Value.ArrayVal
+		case pipelinev1.ParamTypeObject:
+			values[param.Name] = param.Value.ObjectVal
+		default:
+			values[param.Name] = param.Value.StringVal
+		}
+	}
+	return values
+}
+
+// goTemplateEngine renders Go templates, the default engine
+type goTemplateEngine struct{}
+
+func (goTemplateEngine) render(ctx context.Context, req renderRequest) (string, error) {
+	values, err := templateValues(req.options.values, req.params)
+	if err != nil {
+		return "", err
+	}
+	if req.options.coerceTypes {
+		coerceStringParams(values, req.params, helmValueName)
+	}
+
+	var data map[string]interface{}
+	if req.options.helm {
+		data = helmTemplateData(req.path, values)
+	} else {
+		data = goTemplateData(req.params, req.options.structured)
+		if req.options.coerceTypes {
+			coerceStringParams(data, req.params, toCamelCase)
+		}
+		// Plain Go templates only have .Values when the request sends values
+		if req.options.values != nil || hasValuesParam(req.params) {
+			data["Values"] = values
+		}
+	}
+	if req.options.templates != nil {
+		data["Templates"] = req.options.templates
+	}
+	if capture := capturedRender(ctx); capture != nil {
+		capture.content, capture.data = req.content, data
+	}
+	return renderTemplateWithOptions(ctx, req.content, data, req.options)
+}
+
+// templateEngines maps engine names to their implementations
+var templateEngines = map[string]templateEngine{
+	EngineGoTemplate: goTemplateEngine{},
+	EngineJsonnet:    engineFunc(renderJsonnet),
+	EngineCUE:        engineFunc(renderCUE),
+	EngineYtt:        engineFunc(renderYtt),
+	EngineStarlark:   engineFunc(renderStarlark),
+}
+
+// engineExtensions selects the engine of templates requested without the engine param.
+// ytt templates are plain YAML files and need the param.
+var engineExtensions = map[string]string{
+	".jsonnet": EngineJsonnet,
+	".cue":     EngineCUE,
+	".star":    EngineStarlark,
+}
+
+// engineNames returns the names accepted by the engine param, for error messages
+func engineNames() []string {
+	names := make([]string, 0, len(templateEngines))
+	for name := range templateEngines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// detectEngine returns the engine for a template: the requested one, or the one matching the
+// extension of its path, falling back to Go templates
+func detectEngine(requested, path string) (string, error) {
+	if requested != "" {
+		name := strings.ToLower(strings.TrimSpace(requested))
+		if _, ok := templateEngines[name]; !ok {
+			return "", fmt.Errorf("unknown %s %q, must be one of %s", EngineParam, requested, strings.Join(engineNames(), ", "))
+		}
+		return name, nil
+	}
+	if name, ok := engineExtensions[strings.ToLower(filepath.Ext(path))]; ok {
+		return name, nil
+	}
+	return EngineGoTemplate, nil
+}
+
+// runEngineCommand runs the CLI of a rendering engine with stdin as input, in dir when set,
+// and returns its stdout. Errors carry the message the engine printed to stderr, which
+// usually points at the offending line of the template.
+func runEngineCommand(ctx context.Context, binary string, args []string, dir, stdin string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binary, args...) // #nosec G204 -- binary is set by the operator
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("%s failed: %s", filepath.Base(binary), message)
+		}
+		return nil, fmt.Errorf("failed to run %s: %w", binary, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// runEngineCommandWithFiles writes files to a temporary directory and runs the CLI of a
+// rendering engine in it with stdin as input, for engines that read their input from files
+// and to keep engines reading relative paths away from the files of the resolver
+func runEngineCommandWithFiles(ctx context.Context, binary string, args []string, files map[string]string, stdin string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "template-resolver-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work directory: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			debugContextf(ctx, "Failed to remove work directory: %v", err)
+		}
+	}()
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return runEngineCommand(ctx, binary, args, dir, stdin)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+// useEngineBinary points an engine binary setting at a shell script for the duration of a test
+func useEngineBinary(t *testing.T, setting *string, script string) {
+	t.Helper()
+	binary := filepath.Join(t.TempDir(), "engine")
+	require.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\n"+script), 0o755)) // #nosec G306 -- test script
+
+	original := *setting
+	*setting = binary
+	t.Cleanup(func() { *setting = original })
+}
+
+func TestRunEngineCommand(t *testing.T) {
+	var binary string
+	useEngineBinary(t, &binary, "cat\necho \"$1\"\n")
+	output, err := runEngineCommand(context.Background(), binary, []string{"arg"}, "", "input\n")
+	require.NoError(t, err)
+	assert.Equal(t, "input\narg\n", string(output))
+
+	// The working directory is used when set
+	dir := t.TempDir()
+	useEngineBinary(t, &binary, "pwd\n")
+	output, err = runEngineCommand(context.Background(), binary, nil, dir, "")
+	require.NoError(t, err)
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+	assert.Equal(t, resolvedDir+"\n", string(output))
+
+	// Errors include what the engine printed to stderr
+	useEngineBinary(t, &binary, "echo 'line 3: syntax error' >&2\nexit 1\n")
+	_, err = runEngineCommand(context.Background(), binary, nil, "", "")
+	assert.EqualError(t, err, "engine failed: line 3: syntax error")
+
+	_, err = runEngineCommand(context.Background(), filepath.Join(t.TempDir(), "missing"), nil, "", "")
+	assert.ErrorContains(t, err, "failed to run")
+}
+
+func TestEngineParamValues(t *testing.T) {
+	assert.Equal(t, map[string]interface{}{
+		RepositoryParam: "https://github.com/example/repo",
+		"app-name":      "api",
+		"environments":  []string{"dev", "prod"},
+		"labels":        map[string]string{"team": "platform"},
+	}, engineParamValues([]pipelinev1.Param{
+		{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "https://github.com/example/repo"}},
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		{Name: "environments", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{"dev", "prod"}}},
+		{Name: "labels", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeObject, ObjectVal: map[string]string{"team": "platform"}}},
+		// Options and credentials do not reach the template
+		{Name: GitCredentialsSecretParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "git-creds"}},
+		{Name: EngineParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "jsonnet"}},
+	}))
+}
+
+func TestDetectEngine(t *testing.T) {
+	tests := []struct {
+		requested string
+		path      string
+		expected  string
+	}{
+		{"", "pipelines/build.yaml", EngineGoTemplate},
+		{"", "pipelines/build.jsonnet", EngineJsonnet},
+		{"", "Build.JSONNET", EngineJsonnet},
+		{"", "lib/utils.libsonnet", EngineGoTemplate},
+		{"", "pipelines/build.cue", EngineCUE},
+		{"", "pipelines/build.star", EngineStarlark},
+		{"", "pipelines/cue/build.yaml", EngineGoTemplate},
+		{"ytt", "pipelines/build.yaml", EngineYtt},
+		{" Starlark ", "pipelines/build.yaml", EngineStarlark},
+		{"gotemplate", "pipelines/build.jsonnet", EngineGoTemplate},
+	}
+	for _, tt := range tests {
+		engine, err := detectEngine(tt.requested, tt.path)
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, engine, "engine for %q and %s", tt.requested, tt.path)
+	}
+
+	_, err := detectEngine("mustache", "pipeline.yaml")
+	assert.EqualError(t, err, `unknown engine "mustache", must be one of cue, gotemplate, jsonnet, starlark, ytt`)
+}
+
+func TestResolverEngineParam(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:pipeline.yaml": "metadata:\n  name: {{ .AppName }}\n",
+		"repo1:pipeline.txt":  `def main(params): return {"metadata": {"name": params["app-name"]}}`,
+	}}}
+	params := func(path, engine string) []pipelinev1.Param {
+		params := []pipelinev1.Param{
+			{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+			{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: path}},
+			{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		}
+		if engine != "" {
+			params = append(params, pipelinev1.Param{Name: EngineParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: engine}})
+		}
+		return params
+	}
+
+	resource, err := r.Resolve(context.Background(), params("pipeline.yaml", ""))
+	require.NoError(t, err)
+	assert.Equal(t, "metadata:\n  name: api\n", string(resource.Data()))
+
+	// The engine param overrides the extension
+	resource, err = r.Resolve(context.Background(), params("pipeline.txt", EngineStarlark))
+	require.NoError(t, err)
+	assert.Equal(t, "metadata:\n    name: api\n", string(resource.Data()))
+
+	assert.ErrorContains(t, r.ValidateParams(context.Background(), params("pipeline.yaml", "erb")), `unknown engine "erb"`)
+
+	// Helm mode only applies to Go templates
+	helmParams := append(params("pipeline.txt", EngineStarlark), pipelinev1.Param{Name: HelmParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "true"}})
+	_, err = r.Resolve(context.Background(), helmParams)
+	assert.ErrorContains(t, err, "requires the gotemplate engine")
+}
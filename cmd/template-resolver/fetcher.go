@@ -1,35 +1,52 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"os/exec"
-	"path/filepath"
 	"strings"
+	"time"
 )
 
-// FetchTemplate retrieves a template from a Git repository or Gist
-func (g *gitTemplateFetcher) FetchTemplate(repoURL, filePath string) (string, error) {
+// FetchTemplate retrieves a template from a Git repository or one of the other supported
+// sources: GitHub, GitLab, Gitea forges, Gists, OCI registries, S3, Azure Blob, Artifactory/Nexus
+// and local directories
+func (g *gitTemplateFetcher) FetchTemplate(repoURL, revision, filePath string, opts FetchOptions) (*FetchedTemplate, error) {
+	// Handle local directories (standalone mode)
+	if isFileURL(repoURL) {
+		return withoutCommit(fetchFileTemplate(repoURL, revision, filePath))
+	}
+
+	// Handle OCI artifacts and Tekton bundles
+	if isOCIReference(repoURL) {
+		return withoutCommit(fetchOCITemplate(repoURL, revision, filePath))
+	}
+
+	// Handle S3 buckets
+	if isS3URL(repoURL) {
+		return withoutCommit(fetchS3Template(repoURL, revision, filePath))
+	}
+
+	// Handle Azure Blob containers
+	if isAzureBlobURL(repoURL) {
+		return withoutCommit(fetchAzureBlobTemplate(repoURL, revision, filePath))
+	}
+
 	// Handle GitHub Gist URLs
 	if strings.HasPrefix(repoURL, "https://gist.github.com/") {
 		// Convert Gist URL to raw content URL
 		// Example: https://gist.github.com/user/gistid -> https://gist.githubusercontent.com/user/gistid/raw/
 		parts := strings.Split(repoURL, "/")
 		if len(parts) < 5 {
-			return "", fmt.Errorf("invalid Gist URL format: %s", repoURL)
+			return nil, fmt.Errorf("invalid Gist URL format: %s", repoURL)
 		}
 
 		user := parts[3]
 		gistID := parts[4]
 
-		// Create an HTTP client with timeout
-		client := &http.Client{
-			Timeout: httpTimeout,
-		}
+		// Create an HTTP client with timeout that honors the proxy configuration
+		client := newHTTPClient()
 
 		// First try with the filename
 		rawURL := fmt.Sprintf("https://gist.githubusercontent.com/%s/%s/raw/%s", user, gistID, filePath)
@@ -38,13 +55,13 @@ func (g *gitTemplateFetcher) FetchTemplate(repoURL, filePath string) (string, er
 		// First check if we can fetch with the filename
 		resp, err := client.Get(rawURL)
 		if err != nil {
-			return "", fmt.Errorf("failed to fetch gist: %w", err)
+			return nil, fmt.Errorf("failed to fetch gist: %w", err)
 		}
 
 		// If we got a 404, try without the filename (for single-file gists)
 		if resp.StatusCode == http.StatusNotFound {
 			if err := resp.Body.Close(); err != nil { // Close this response before making another request
-				return "", fmt.Errorf("failed to close response body: %w", err)
+				return nil, fmt.Errorf("failed to close response body: %w", err)
 			}
 
 			// Try without filename for single-file gists
@@ -52,7 +69,7 @@ func (g *gitTemplateFetcher) FetchTemplate(repoURL, filePath string) (string, er
 			debugf("File not found with name, trying single-file Gist URL: %s", rawURL)
 			resp, err = client.Get(rawURL)
 			if err != nil {
-				return "", fmt.Errorf("failed to fetch single-file gist: %w", err)
+				return nil, fmt.Errorf("failed to fetch single-file gist: %w", err)
 			}
 		}
 
@@ -63,102 +80,230 @@ func (g *gitTemplateFetcher) FetchTemplate(repoURL, filePath string) (string, er
 		}()
 
 		if resp.StatusCode != http.StatusOK {
-			return "", fmt.Errorf("HTTP error fetching Gist: %s", resp.Status)
+			return nil, fmt.Errorf("HTTP error fetching Gist: %s", resp.Status)
 		}
 
-		content, err := io.ReadAll(resp.Body)
+		content, err := readTemplate(resp.Body)
 		if err != nil {
-			return "", fmt.Errorf("failed to read Gist content: %w", err)
+			return nil, fmt.Errorf("failed to read Gist content: %w", err)
 		}
 
 		debugf("Successfully fetched Gist content (%d bytes)", len(content))
-		return string(content), nil
+		return &FetchedTemplate{Content: content}, nil
+	}
+
+	// GitHub repositories read with a token from a credentials secret are read through the
+	// Contents API, which is much faster than cloning large repositories
+	if owner, repo, ok := githubCredentialsRepo(repoURL, opts); ok {
+		return fetchGitHubCredentialsFile(repoURL, owner, repo, revision, filePath, opts.Credentials)
+	}
+
+	// Files inside submodules are not served by the forge file APIs, and per-request
+	// credentials apply to Git itself, so clone instead
+	if submodulesEnabled(opts.Submodules) || opts.Credentials != nil {
+		return cloneGitFile(repoURL, revision, filePath, opts)
+	}
+
+	// Handle GitLab projects (gitlab.com and configured self-hosted instances)
+	if isGitLabURL(repoURL) {
+		return withoutCommit(fetchGitLabFile(repoURL, revision, filePath))
+	}
+
+	// Handle Gitea-compatible forges (Gitea, Forgejo, Codeberg)
+	if isGiteaURL(repoURL) {
+		return withoutCommit(fetchGiteaFile(repoURL, revision, filePath))
+	}
+
+	// Handle Artifactory generic and Nexus raw repositories
+	if isArtifactRepositoryURL(repoURL) {
+		return withoutCommit(fetchArtifactRepositoryFile(repoURL, revision, filePath))
+	}
+
+	// Handle GitHub repositories through the Contents API when a token or GitHub App is
+	// configured, which also covers private repositories referenced by SSH URL
+	if githubToken != "" || githubApp != nil {
+		if owner, repo, ok := parseGitHubRepo(repoURL); ok {
+			return fetchGitHubContents(owner, repo, revision, filePath)
+		}
 	}
 
 	// Handle normal GitHub repositories
 	if strings.HasPrefix(repoURL, "https://github.com/") {
 		// Convert GitHub URL to raw content URL
 		// Example: https://github.com/example/repo -> https://raw.githubusercontent.com/example/repo/main/
-		repoURL = strings.Replace(repoURL, "https://github.com/", "https://raw.githubusercontent.com/", 1)
-		if !strings.HasSuffix(repoURL, "/") {
-			repoURL += "/"
+		rawURL := strings.Replace(repoURL, "https://github.com/", "https://raw.githubusercontent.com/", 1)
+		if !strings.HasSuffix(rawURL, "/") {
+			rawURL += "/"
 		}
-		repoURL += gitDefaultBranch + "/" // Use configured default branch
+		rawURL += refOrDefault(revision) + "/" // Use requested revision or configured default branch
 
 		// Construct the full URL to the raw file
-		fileURL := repoURL + filePath
-		debugf("Fetching GitHub file from URL: %s", fileURL)
+		fileURL := rawURL + filePath
+		return withoutCommit(fetchGitHubRawFile(g.cache, repoURL, fileURL))
+	}
 
-		// Create an HTTP client with timeout
-		client := &http.Client{
-			Timeout: httpTimeout,
-		}
+	// Handle Git repositories (public or private). Private repositories cloned over SSH
+	// use the key mounted at GIT_SSH_KEY_FILE.
+	return cloneGitFile(repoURL, revision, filePath, opts)
+}
 
-		// Fetch the content
-		resp, err := client.Get(fileURL)
-		if err != nil {
-			return "", fmt.Errorf("failed to fetch GitHub file: %w", err)
-		}
-		defer func() {
-			if closeErr := resp.Body.Close(); closeErr != nil && err == nil {
-				err = fmt.Errorf("failed to close response body: %w", closeErr)
-			}
-		}()
+// ListTemplates returns the files of a repository matching a glob pattern. Only local
+// directories and Git repositories can list their files; Git repositories are cloned, or
+// read from the Git cache, whichever source FetchTemplate reads their files from. GitHub
+// repositories read with a token from a credentials secret are downloaded as a tarball.
+func (g *gitTemplateFetcher) ListTemplates(repoURL, revision, pattern string, opts FetchOptions) (*TemplateListing, error) {
+	if isFileURL(repoURL) {
+		return listFileTemplates(repoURL, pattern)
+	}
+	if owner, repo, ok := githubCredentialsRepo(repoURL, opts); ok {
+		return listGitHubTarball(repoURL, owner, repo, revision, pattern, opts.Credentials)
+	}
+	switch backend := fetchBackend(repoURL, opts); backend {
+	case "oci", "s3", "azure", "gist", "artifact":
+		return nil, fmt.Errorf("%s repositories cannot list their files, glob paths need a Git repository or a local directory", backend)
+	}
+	return listGitFiles(repoURL, revision, pattern, opts)
+}
 
-		if resp.StatusCode != http.StatusOK {
-			return "", fmt.Errorf("HTTP error fetching GitHub file: %s", resp.Status)
+// fetchBackend names the source FetchTemplate reads a template from, the backend label of
+// the fetch and resolution latency metrics. It must follow the order of FetchTemplate.
+func fetchBackend(repoURL string, opts FetchOptions) string {
+	switch {
+	case isFileURL(repoURL):
+		return "file"
+	case isOCIReference(repoURL):
+		return "oci"
+	case isS3URL(repoURL):
+		return "s3"
+	case isAzureBlobURL(repoURL):
+		return "azure"
+	case strings.HasPrefix(repoURL, "https://gist.github.com/"):
+		return "gist"
+	}
+	if _, _, ok := githubCredentialsRepo(repoURL, opts); ok {
+		return "github-api"
+	}
+	switch {
+	case submodulesEnabled(opts.Submodules) || opts.Credentials != nil:
+		return "git"
+	case isGitLabURL(repoURL):
+		return "gitlab"
+	case isGiteaURL(repoURL):
+		return "gitea"
+	case isArtifactRepositoryURL(repoURL):
+		return "artifact"
+	}
+	if githubToken != "" || githubApp != nil {
+		if _, _, ok := parseGitHubRepo(repoURL); ok {
+			return "github-api"
 		}
+	}
+	if strings.HasPrefix(repoURL, "https://github.com/") {
+		return "github-raw"
+	}
+	return "git"
+}
 
-		content, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return "", fmt.Errorf("failed to read GitHub file content: %w", err)
+// withoutCommit wraps the content from sources that do not report a Git commit
+func withoutCommit(content string, err error) (*FetchedTemplate, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &FetchedTemplate{Content: content}, nil
+}
+
+// refOrDefault returns the requested revision, falling back to the configured default branch
+func refOrDefault(revision string) string {
+	if revision == "" {
+		return currentSettings().gitDefaultBranch
+	}
+	return revision
+}
+
+// rawResponseCacheTTL is how long validators and bodies of raw file responses are kept.
+// They outlive CACHE_TTL so expired templates are revalidated instead of downloaded again.
+const rawResponseCacheTTL = 24 * time.Hour
+
+// rawResponseCacheEntry is a cached raw file response with its HTTP validators
+type rawResponseCacheEntry struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Content      string `json:"content"`
+}
+
+// fetchGitHubRawFile downloads a file from raw.githubusercontent.com. When a cache is
+// configured the ETag and Last-Modified of the response are stored with the body, so later
+// requests send If-None-Match/If-Modified-Since and a 304 Not Modified is served from the cache.
+func fetchGitHubRawFile(cache Cache, repoURL, fileURL string) (content string, err error) {
+	debugf("Fetching GitHub file from URL: %s", fileURL)
+
+	ctx := withCacheRepository(context.Background(), repoURL)
+	key := cacheKey("raw", fileURL)
+	var cached *rawResponseCacheEntry
+	if cache != nil {
+		if value, ok, err := cache.Get(ctx, key); err != nil {
+			debugf("Raw response cache lookup failed: %v", err)
+		} else if ok {
+			var entry rawResponseCacheEntry
+			if err := json.Unmarshal(value, &entry); err == nil {
+				cached = &entry
+			}
 		}
+	}
 
-		debugf("Successfully fetched GitHub file content (%d bytes)", len(content))
-		return string(content), nil
+	req, err := http.NewRequest(http.MethodGet, fileURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GitHub request: %w", err)
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
 	}
 
-	// Handle Git repositories (public or private)
-	// If private, the GIT_SSH_COMMAND env var should be set in the deployment
-	// to use the mounted SSH key
-	tempDir, err := os.MkdirTemp("", "template-resolver-*")
+	// Create an HTTP client with timeout that honors the proxy configuration
+	client := newHTTPClient()
+
+	// Fetch the content
+	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp directory: %w", err)
+		return "", fmt.Errorf("failed to fetch GitHub file: %w", err)
 	}
 	defer func() {
-		if removeErr := os.RemoveAll(tempDir); removeErr != nil && err == nil {
-			err = fmt.Errorf("failed to clean up temp directory: %w", removeErr)
+		if closeErr := resp.Body.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close response body: %w", closeErr)
 		}
 	}()
 
-	// Setup git command with output capturing and configurable depth
-	cloneCmd := fmt.Sprintf("--depth=%d", gitCloneDepth)
-	debugf("Cloning Git repository %s with %s", repoURL, cloneCmd)
-	cmd := exec.Command("git", "clone", cloneCmd, repoURL, tempDir)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	// Create a context with timeout for the git command
-	ctx, cancel := context.WithTimeout(context.Background(), resolutionTimeout)
-	defer cancel()
-	cmd = exec.CommandContext(ctx, "git", "clone", cloneCmd, repoURL, tempDir)
-	cmd.Stderr = &stderr
-
-	// Attempt to clone the repository
-	if err := cmd.Run(); err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return "", fmt.Errorf("git clone timed out after %v", resolutionTimeout)
-		}
-		return "", fmt.Errorf("git clone failed: %w, stderr: %s", err, stderr.String())
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		debugf("GitHub file not modified, using cached content (%d bytes)", len(cached.Content))
+		return cached.Content, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP error fetching GitHub file: %s", resp.Status)
 	}
 
-	// Read the requested file from the cloned repo
-	filePath = filepath.Join(tempDir, filePath)
-	content, err := os.ReadFile(filePath)
+	body, err := readTemplate(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file %s: %w", filePath, err)
+		return "", fmt.Errorf("failed to read GitHub file content: %w", err)
+	}
+
+	entry := rawResponseCacheEntry{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Content:      body,
+	}
+	if cache != nil && (entry.ETag != "" || entry.LastModified != "") {
+		if value, err := json.Marshal(entry); err == nil {
+			if err := cache.Set(ctx, key, value, rawResponseCacheTTL); err != nil {
+				debugf("Failed to cache raw response: %v", err)
+			}
+		}
 	}
 
-	debugf("Successfully read file from Git repository (%d bytes)", len(content))
-	return string(content), nil
+	debugf("Successfully fetched GitHub file content (%d bytes)", len(body))
+	return body, nil
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// isArtifactRepositoryURL reports whether the repository is an Artifactory generic or
+// Nexus raw repository on a host matching one of the ARTIFACT_REPOSITORY_HOSTS patterns
+func isArtifactRepositoryURL(repoURL string) bool {
+	u, err := url.Parse(repoURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return false
+	}
+	return hostMatches(u.Host, artifactRepositoryHosts)
+}
+
+// fetchArtifactRepositoryFile downloads a template from an Artifactory or Nexus repository.
+// The file path is appended to the repository URL, for example
+// https://artifactory.example.com/artifactory/pipeline-templates + deploy.yaml or
+// https://nexus.example.com/repository/raw-templates + deploy.yaml.
+// Artifactory API keys are sent as X-JFrog-Art-Api, while a username and password
+// (or Nexus user token) are sent as basic auth.
+func fetchArtifactRepositoryFile(repoURL, revision, filePath string) (content string, err error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid repository URL %s: %w", repoURL, err)
+	}
+	if revision != "" {
+		debugf("Ignoring revision %s for artifact repository, versions are part of the path", revision)
+	}
+	u.Path = path.Join("/", u.Path, strings.TrimPrefix(filePath, "/"))
+	u.RawPath = ""
+	fileURL := u.String()
+	debugf("Fetching artifact repository file from URL: %s", fileURL)
+
+	req, err := http.NewRequest(http.MethodGet, fileURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create artifact repository request: %w", err)
+	}
+	if artifactRepositoryAPIKey != "" {
+		req.Header.Set("X-JFrog-Art-Api", artifactRepositoryAPIKey)
+	} else if artifactRepositoryUsername != "" {
+		req.SetBasicAuth(artifactRepositoryUsername, artifactRepositoryPassword)
+	}
+
+	// Create an HTTP client with timeout that honors the proxy configuration
+	client := newHTTPClient()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch artifact repository file: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close response body: %w", closeErr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP error fetching artifact repository file: %s", resp.Status)
+	}
+
+	body, err := readTemplate(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read artifact repository file content: %w", err)
+	}
+
+	debugf("Successfully fetched artifact repository file (%d bytes)", len(body))
+	return body, nil
+}
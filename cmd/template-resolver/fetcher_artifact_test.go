@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchArtifactRepositoryFile(t *testing.T) {
+	originalHosts, originalKey := artifactRepositoryHosts, artifactRepositoryAPIKey
+	originalUser, originalPassword := artifactRepositoryUsername, artifactRepositoryPassword
+	defer func() {
+		artifactRepositoryHosts, artifactRepositoryAPIKey = originalHosts, originalKey
+		artifactRepositoryUsername, artifactRepositoryPassword = originalUser, originalPassword
+	}()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/artifactory/pipeline-templates/team-a/deploy.yaml":
+			if r.Header.Get("X-JFrog-Art-Api") != "api-key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte("kind: Pipeline\nmetadata:\n  name: artifactory-pipeline"))
+		case "/repository/raw-templates/deploy.yaml":
+			if user, password, ok := r.BasicAuth(); !ok || user != "ci" || password != "user-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte("kind: Pipeline\nmetadata:\n  name: nexus-pipeline"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	artifactRepositoryHosts = []string{serverURL.Host}
+	fetcher := &gitTemplateFetcher{}
+
+	// Artifactory API key
+	artifactRepositoryAPIKey = "api-key"
+	fetched, err := fetcher.FetchTemplate(server.URL+"/artifactory/pipeline-templates/team-a/", "", "/deploy.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: artifactory-pipeline")
+
+	// Nexus user token through basic auth
+	artifactRepositoryAPIKey = ""
+	artifactRepositoryUsername, artifactRepositoryPassword = "ci", "user-token"
+	fetched, err = fetcher.FetchTemplate(server.URL+"/repository/raw-templates", "", "deploy.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: nexus-pipeline")
+
+	_, err = fetcher.FetchTemplate(server.URL+"/repository/raw-templates", "", "missing.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "404")
+
+	assert.False(t, isArtifactRepositoryURL("https://github.com/example/repo"))
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// azureScheme prefixes repository values that point at an Azure Blob container
+	// Example: az://account/container/prefix
+	azureScheme = "az://"
+
+	// azureBlobHostSuffix identifies Azure Blob Storage HTTPS endpoints
+	azureBlobHostSuffix = ".blob.core.windows.net"
+
+	// azureStorageResource is the token audience for Azure Storage
+	azureStorageResource = "https://storage.azure.com/"
+
+	// azureStorageAPIVersion is the Blob service version sent with each request.
+	// Bearer token authentication requires 2017-11-09 or later.
+	azureStorageAPIVersion = "2021-08-06"
+)
+
+// azureIMDSTokenURL is the instance metadata endpoint issuing managed identity tokens
+var azureIMDSTokenURL = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// isAzureBlobURL reports whether the repository points at an Azure Blob container
+func isAzureBlobURL(repoURL string) bool {
+	if strings.HasPrefix(repoURL, azureScheme) {
+		return true
+	}
+	u, err := url.Parse(repoURL)
+	return err == nil && u.Scheme == "https" && strings.HasSuffix(strings.ToLower(u.Host), azureBlobHostSuffix)
+}
+
+// azureBlobURL builds the blob URL for a template within the container referenced by repoURL.
+// Example: az://account/container/prefix + file.yaml -> https://account.blob.core.windows.net/container/prefix/file.yaml
+func azureBlobURL(repoURL, filePath string) (string, error) {
+	var endpoint, containerPath string
+	if strings.HasPrefix(repoURL, azureScheme) {
+		account, rest, _ := strings.Cut(strings.TrimPrefix(repoURL, azureScheme), "/")
+		if account == "" || strings.Trim(rest, "/") == "" {
+			return "", fmt.Errorf("invalid Azure Blob URL, expected az://account/container/prefix: %s", repoURL)
+		}
+		endpoint = fmt.Sprintf("https://%s%s", account, azureBlobHostSuffix)
+		if azureBlobEndpoint != "" {
+			endpoint = strings.TrimSuffix(azureBlobEndpoint, "/") + "/" + account
+		}
+		containerPath = rest
+	} else {
+		u, err := url.Parse(repoURL)
+		if err != nil || strings.Trim(u.Path, "/") == "" {
+			return "", fmt.Errorf("invalid Azure Blob URL, missing container: %s", repoURL)
+		}
+		endpoint = u.Scheme + "://" + u.Host
+		containerPath = u.Path
+	}
+
+	blobPath := path.Join(strings.Trim(containerPath, "/"), strings.TrimPrefix(filePath, "/"))
+	return endpoint + "/" + (&url.URL{Path: blobPath}).EscapedPath(), nil
+}
+
+// fetchAzureBlobTemplate downloads a template blob. A SAS token from AZURE_STORAGE_SAS_TOKEN
+// is used when configured, otherwise a bearer token is obtained through managed identity.
+// The revision, when set, selects a blob version.
+func fetchAzureBlobTemplate(repoURL, revision, filePath string) (content string, err error) {
+	blobURL, err := azureBlobURL(repoURL, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	if revision != "" {
+		query.Set("versionid", revision)
+	}
+	if azureSASToken != "" {
+		sas, err := url.ParseQuery(strings.TrimPrefix(azureSASToken, "?"))
+		if err != nil {
+			return "", fmt.Errorf("invalid Azure SAS token: %w", err)
+		}
+		for key, values := range sas {
+			query[key] = values
+		}
+	}
+	if len(query) > 0 {
+		blobURL += "?" + query.Encode()
+	}
+
+	// Create an HTTP client with timeout that honors the proxy configuration
+	client := newHTTPClient()
+
+	debugf("Fetching Azure blob %s", strings.Split(blobURL, "?")[0])
+	resp, err := azureBlobGet(client, blobURL)
+	if err == nil && azureSASToken == "" && azureTokenRejected(resp) {
+		// A cached token may have been revoked or expired early, so mint a new one and retry
+		debugf("Azure rejected the managed identity token (%s), retrying with a new token", resp.Header.Get("x-ms-error-code"))
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			debugf("Failed to close Azure Blob response body: %v", closeErr)
+		}
+		azureTokens.Invalidate()
+		resp, err = azureBlobGet(client, blobURL)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close response body: %w", closeErr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP error fetching Azure blob: %s (%s)", resp.Status, resp.Header.Get("x-ms-error-code"))
+	}
+
+	body, err := readTemplate(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read Azure blob content: %w", err)
+	}
+
+	debugf("Successfully fetched Azure blob (%d bytes)", len(body))
+	return body, nil
+}
+
+// azureBlobGet sends a blob request, authenticated with a managed identity token unless
+// AZURE_STORAGE_SAS_TOKEN is set. The caller must close the response body.
+func azureBlobGet(client *http.Client, blobURL string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, blobURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure Blob request: %w", err)
+	}
+	req.Header.Set("x-ms-version", azureStorageAPIVersion)
+
+	if azureSASToken == "" {
+		token, err := azureTokens.Token()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Azure blob: %w", err)
+	}
+	return resp, nil
+}
+
+// azureTokenRejected reports whether the Blob service rejected the bearer token itself,
+// rather than the identity lacking access to the blob
+func azureTokenRejected(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return true
+	case http.StatusForbidden:
+		code := resp.Header.Get("x-ms-error-code")
+		return code == "InvalidAuthenticationInfo" || code == "AuthenticationFailed"
+	default:
+		return false
+	}
+}
+
+// azureTokens caches the managed identity token until shortly before it expires
+var azureTokens = &tokenCache{mint: azureManagedIdentityToken}
+
+// azureIMDSTransport connects to the instance metadata service directly, bypassing the proxy
+var azureIMDSTransport = sync.OnceValue(func() http.RoundTripper {
+	return newHTTPTransport(nil)
+})
+
+// azureTokenResponse is the subset of the Entra ID and IMDS token responses we use. IMDS
+// returns expires_in as a string, Entra ID as a number.
+type azureTokenResponse struct {
+	AccessToken string      `json:"access_token"`
+	ExpiresIn   json.Number `json:"expires_in"`
+}
+
+// azureManagedIdentityToken obtains a storage access token and the time it expires. AKS
+// workload identity is used when AZURE_FEDERATED_TOKEN_FILE is present, otherwise the
+// instance metadata service.
+func azureManagedIdentityToken() (string, time.Time, error) {
+	var req *http.Request
+	var err error
+	client := newHTTPClient()
+
+	if tokenFile := os.Getenv("AZURE_FEDERATED_TOKEN_FILE"); tokenFile != "" {
+		assertion, readErr := os.ReadFile(tokenFile)
+		if readErr != nil {
+			return "", time.Time{}, fmt.Errorf("failed to read federated token file: %w", readErr)
+		}
+
+		authority := getEnvWithDefault("AZURE_AUTHORITY_HOST", "https://login.microsoftonline.com/")
+		tokenURL := fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimSuffix(authority, "/"), os.Getenv("AZURE_TENANT_ID"))
+		form := url.Values{
+			"grant_type":            {"client_credentials"},
+			"client_id":             {os.Getenv("AZURE_CLIENT_ID")},
+			"scope":                 {azureStorageResource + ".default"},
+			"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+			"client_assertion":      {strings.TrimSpace(string(assertion))},
+		}
+		req, err = http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to create workload identity token request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		query := url.Values{
+			"api-version": {"2018-02-01"},
+			"resource":    {azureStorageResource},
+		}
+		if clientID := os.Getenv("AZURE_CLIENT_ID"); clientID != "" {
+			query.Set("client_id", clientID)
+		}
+		req, err = http.NewRequest(http.MethodGet, azureIMDSTokenURL+"?"+query.Encode(), nil)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("failed to create managed identity token request: %w", err)
+		}
+		req.Header.Set("Metadata", "true")
+
+		// The metadata service is link-local and must never be reached through a proxy
+		client = &http.Client{Timeout: currentSettings().httpTimeout, Transport: azureIMDSTransport()}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to obtain Azure managed identity token: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			debugf("Failed to close token response body: %v", closeErr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("HTTP error obtaining Azure managed identity token: %s", resp.Status)
+	}
+
+	var token azureTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse Azure token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("token response from Azure did not include an access token")
+	}
+
+	var expires time.Time
+	if seconds, err := token.ExpiresIn.Int64(); err == nil {
+		expires = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+	return token.AccessToken, expires, nil
+}
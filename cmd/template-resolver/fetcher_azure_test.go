@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAzureBlobURL(t *testing.T) {
+	originalEndpoint := azureBlobEndpoint
+	defer func() { azureBlobEndpoint = originalEndpoint }()
+	azureBlobEndpoint = ""
+
+	tests := []struct {
+		repoURL  string
+		filePath string
+		expected string
+		wantErr  bool
+	}{
+		{
+			repoURL:  "az://account/templates",
+			filePath: "pipelines/deploy.yaml",
+			expected: "https://account.blob.core.windows.net/templates/pipelines/deploy.yaml",
+		},
+		{
+			repoURL:  "https://account.blob.core.windows.net/templates/team-a/",
+			filePath: "/deploy pipeline.yaml",
+			expected: "https://account.blob.core.windows.net/templates/team-a/deploy%20pipeline.yaml",
+		},
+		{repoURL: "az://account", filePath: "deploy.yaml", wantErr: true},
+		{repoURL: "https://account.blob.core.windows.net/", filePath: "deploy.yaml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repoURL, func(t *testing.T) {
+			assert.True(t, isAzureBlobURL(tt.repoURL))
+			blobURL, err := azureBlobURL(tt.repoURL, tt.filePath)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, blobURL)
+		})
+	}
+
+	assert.False(t, isAzureBlobURL("https://github.com/example/repo"))
+}
+
+func TestFetchAzureBlobTemplate(t *testing.T) {
+	originalEndpoint, originalIMDS, originalSAS := azureBlobEndpoint, azureIMDSTokenURL, azureSASToken
+	defer func() {
+		azureBlobEndpoint, azureIMDSTokenURL, azureSASToken = originalEndpoint, originalIMDS, originalSAS
+	}()
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata/identity/oauth2/token":
+			assert.Equal(t, "true", r.Header.Get("Metadata"))
+			assert.Equal(t, azureStorageResource, r.URL.Query().Get("resource"))
+			_, _ = w.Write([]byte(`{"access_token":"imds-token","expires_in":"3599"}`))
+		case "/tenant/oauth2/v2.0/token":
+			assert.Equal(t, "federated-assertion", r.FormValue("client_assertion"))
+			_, _ = w.Write([]byte(`{"access_token":"workload-token","expires_in":3599}`))
+		case "/account/templates/deploy.yaml":
+			authorized := r.Header.Get("Authorization") == "Bearer imds-token" ||
+				r.Header.Get("Authorization") == "Bearer workload-token" ||
+				r.URL.Query().Get("sig") == "signature"
+			if !authorized || r.Header.Get("x-ms-version") == "" {
+				w.Header().Set("x-ms-error-code", "AuthenticationFailed")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte("kind: Pipeline\nmetadata:\n  name: azure-" + r.URL.Query().Get("versionid")))
+		default:
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	azureBlobEndpoint = server.URL
+	azureIMDSTokenURL = server.URL + "/metadata/identity/oauth2/token"
+	azureSASToken = ""
+	azureTokens.Invalidate()
+	defer azureTokens.Invalidate()
+	fetcher := &gitTemplateFetcher{}
+
+	// Managed identity through the instance metadata service
+	fetched, err := fetcher.FetchTemplate("az://account/templates", "2024-01-01T00:00:00.0000000Z", "deploy.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: azure-2024-01-01T00:00:00.0000000Z")
+
+	_, err = fetcher.FetchTemplate("az://account/templates", "", "missing.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "BlobNotFound")
+
+	// Workload identity exchanges the federated token for an access token
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("federated-assertion\n"), 0600))
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", tokenFile)
+	t.Setenv("AZURE_AUTHORITY_HOST", server.URL)
+	t.Setenv("AZURE_TENANT_ID", "tenant")
+	azureTokens.Invalidate()
+	fetched, err = fetcher.FetchTemplate("az://account/templates", "", "deploy.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: azure-")
+
+	// SAS tokens are appended to the blob URL instead of using a bearer token
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+	azureIMDSTokenURL = server.URL + "/unavailable"
+	azureSASToken = "?sv=2021-08-06&sig=signature"
+	fetched, err = fetcher.FetchTemplate("az://account/templates", "", "deploy.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: azure-")
+}
+
+func TestFetchAzureBlobTemplateRenewsRejectedToken(t *testing.T) {
+	originalEndpoint, originalIMDS, originalSAS := azureBlobEndpoint, azureIMDSTokenURL, azureSASToken
+	defer func() {
+		azureBlobEndpoint, azureIMDSTokenURL, azureSASToken = originalEndpoint, originalIMDS, originalSAS
+	}()
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+
+	var minted atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata/identity/oauth2/token":
+			n := minted.Add(1)
+			_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":"3599"}`, n)
+		case "/account/templates/deploy.yaml":
+			// The first token is revoked before it expires
+			if r.Header.Get("Authorization") != "Bearer token-2" {
+				w.Header().Set("x-ms-error-code", "InvalidAuthenticationInfo")
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte("kind: Pipeline"))
+		case "/account/templates/forbidden.yaml":
+			w.Header().Set("x-ms-error-code", "AuthorizationPermissionMismatch")
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	azureBlobEndpoint = server.URL
+	azureIMDSTokenURL = server.URL + "/metadata/identity/oauth2/token"
+	azureSASToken = ""
+	azureTokens.Invalidate()
+	defer azureTokens.Invalidate()
+
+	content, err := fetchAzureBlobTemplate("az://account/templates", "", "deploy.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Pipeline", content)
+	assert.Equal(t, int32(2), minted.Load())
+
+	// The renewed token is cached
+	_, err = fetchAzureBlobTemplate("az://account/templates", "", "deploy.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), minted.Load())
+
+	// Missing permissions are not a token problem
+	_, err = fetchAzureBlobTemplate("az://account/templates", "", "forbidden.yaml")
+	assert.ErrorContains(t, err, "AuthorizationPermissionMismatch")
+	assert.Equal(t, int32(2), minted.Load())
+}
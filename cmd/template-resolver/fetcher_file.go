@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileScheme prefixes repository values that point at a local directory
+const fileScheme = "file://"
+
+// isFileURL reports whether the repository points at a local directory
+// Example: file:///home/user/pipeline-templates
+func isFileURL(repoURL string) bool {
+	return strings.HasPrefix(repoURL, fileScheme)
+}
+
+// fileRepositoryRoot returns the directory of a local file repository, which is only enabled
+// in standalone mode (or with ALLOW_FILE_REPOSITORIES)
+func fileRepositoryRoot(repoURL string) (string, error) {
+	if !allowFileRepositories {
+		return "", fmt.Errorf("file:// repositories are only allowed in standalone mode")
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Path == "" || (u.Host != "" && u.Host != "localhost") {
+		return "", fmt.Errorf("invalid file repository URL, expected file:///path/to/templates: %s", repoURL)
+	}
+	return u.Path, nil
+}
+
+// listFileTemplates returns the files of a local directory matching a path.Match pattern.
+// Matching directories are left out, and the files are read with fetchFileTemplate, which
+// refuses symlinks leading out of the directory.
+func listFileTemplates(repoURL, pattern string) (*TemplateListing, error) {
+	dir, err := fileRepositoryRoot(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	repository := os.DirFS(dir)
+	matches, err := fs.Glob(repository, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob pattern %s: %w", pattern, err)
+	}
+	listing := &TemplateListing{Files: map[string]string{}}
+	for _, match := range matches {
+		if info, err := fs.Stat(repository, match); err != nil || info.IsDir() {
+			continue
+		}
+		content, err := fetchFileTemplate(repoURL, "", match)
+		if err != nil {
+			return nil, err
+		}
+		listing.Files[match] = content
+	}
+	return listing, nil
+}
+
+// fetchFileTemplate reads a template from a local directory. It is only enabled in
+// standalone mode (or with ALLOW_FILE_REPOSITORIES) so that requests to the controller
+// cannot read files from the resolver pod. The path is resolved inside the directory and
+// may not escape it, either through ".." segments or symlinks.
+func fetchFileTemplate(repoURL, revision, filePath string) (content string, err error) {
+	dir, err := fileRepositoryRoot(repoURL)
+	if err != nil {
+		return "", err
+	}
+	if revision != "" {
+		debugf("Ignoring revision %s for local file repository", revision)
+	}
+
+	// Reject anything that is not a plain relative path before touching the filesystem
+	cleanPath := filepath.Clean(filepath.FromSlash(filePath))
+	if !filepath.IsLocal(cleanPath) {
+		return "", fmt.Errorf("invalid template path %s: must stay within the repository directory", filePath)
+	}
+
+	// os.Root also refuses symlinks that resolve outside of the directory
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to open template directory %s: %w", dir, err)
+	}
+	defer func() {
+		if closeErr := root.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close template directory: %w", closeErr)
+		}
+	}()
+
+	file, err := root.Open(cleanPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open template %s: %w", filePath, err)
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close template file: %w", closeErr)
+		}
+	}()
+
+	if info, err := file.Stat(); err == nil {
+		if err := checkTemplateSize(info.Size()); err != nil {
+			return "", fmt.Errorf("template %s: %w", filePath, err)
+		}
+	}
+	data, err := readTemplate(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read template %s: %w", filePath, err)
+	}
+
+	debugf("Successfully read local template file (%d bytes)", len(data))
+	return data, nil
+}
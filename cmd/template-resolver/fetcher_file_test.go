@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchFileTemplate(t *testing.T) {
+	originalAllow := allowFileRepositories
+	defer func() { allowFileRepositories = originalAllow }()
+
+	baseDir := t.TempDir()
+	templatesDir := filepath.Join(baseDir, "templates")
+	require.NoError(t, os.MkdirAll(filepath.Join(templatesDir, "pipelines"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(templatesDir, "pipelines", "deploy.yaml"), []byte("kind: Pipeline\nmetadata:\n  name: local-pipeline"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(baseDir, "secret.txt"), []byte("secret"), 0644))
+	require.NoError(t, os.Symlink(filepath.Join(baseDir, "secret.txt"), filepath.Join(templatesDir, "escape.yaml")))
+
+	fetcher := &gitTemplateFetcher{}
+	repoURL := "file://" + templatesDir
+
+	allowFileRepositories = false
+	_, err := fetcher.FetchTemplate(repoURL, "", "pipelines/deploy.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "only allowed in standalone mode")
+
+	allowFileRepositories = true
+	fetched, err := fetcher.FetchTemplate(repoURL, "", "pipelines/deploy.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: local-pipeline")
+
+	fetched, err = fetcher.FetchTemplate(repoURL, "", "pipelines/../pipelines/deploy.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: local-pipeline")
+
+	// Paths escaping the repository directory are rejected
+	for _, filePath := range []string{"../secret.txt", "pipelines/../../secret.txt", "/etc/passwd", "escape.yaml"} {
+		_, err = fetcher.FetchTemplate(repoURL, "", filePath, FetchOptions{})
+		assert.Error(t, err, filePath)
+	}
+
+	_, err = fetcher.FetchTemplate("file://remote-host/templates", "", "deploy.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "invalid file repository URL")
+}
+
+func TestListFileTemplates(t *testing.T) {
+	originalAllow := allowFileRepositories
+	defer func() { allowFileRepositories = originalAllow }()
+	allowFileRepositories = true
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "stages", "nested.yaml"), 0755))
+	for _, name := range []string{"20-test.yaml", "10-build.yaml", "README.md"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "stages", name), []byte("kind: Pipeline"), 0644))
+	}
+
+	// Directories matching the pattern are left out
+	listing, err := (&gitTemplateFetcher{}).ListTemplates("file://"+dir, "", "stages/*.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, &TemplateListing{Files: map[string]string{"stages/10-build.yaml": "kind: Pipeline", "stages/20-test.yaml": "kind: Pipeline"}}, listing)
+
+	_, err = (&gitTemplateFetcher{}).ListTemplates("s3://bucket/templates", "", "stages/*.yaml", FetchOptions{})
+	assert.EqualError(t, err, "s3 repositories cannot list their files, glob paths need a Git repository or a local directory")
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"golang.org/x/crypto/ssh"
+)
+
+// commitHashPattern matches abbreviated or full commit SHAs
+var commitHashPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// cloneGitFile reads a single file from the requested revision of a Git repository with
+// go-git. Repositories are read from the on-disk cache in GIT_CACHE_DIR when it is configured,
+// otherwise they are cloned into memory. An empty revision uses the remote HEAD.
+func cloneGitFile(repoURL, revision, filePath string, fetchOpts FetchOptions) (*FetchedTemplate, error) {
+	auth, err := gitAuth(repoURL, fetchOpts.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	proxyOpts, err := gitProxyOptions(repoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a context with timeout for the clone
+	ctx, cancel := context.WithTimeout(context.Background(), currentSettings().resolutionTimeout)
+	defer cancel()
+
+	var content string
+	var commit plumbing.Hash
+	// The cache is shared by all requests, so it is only used with the resolver's own
+	// credentials. Submodules need a working tree and always use an in-memory clone.
+	if gitCacheDir != "" && fetchOpts.Credentials == nil && !submodulesEnabled(fetchOpts.Submodules) {
+		content, commit, err = readCachedGitFile(ctx, repoURL, revision, filePath, auth, proxyOpts)
+	} else {
+		content, commit, err = readClonedGitFile(ctx, repoURL, revision, filePath, auth, proxyOpts, fetchOpts.Submodules)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// LFS-tracked files are committed as pointers, the content lives on the LFS server
+	if gitLFS {
+		if pointer, ok := parseLFSPointer(content); ok {
+			if content, err = fetchLFSObject(repoURL, pointer, fetchOpts.Credentials); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &FetchedTemplate{Content: content, Commit: commit.String()}, nil
+}
+
+// readClonedGitFile clones a repository into memory, without a temporary directory, and
+// reads the file. When submodules are requested the revision is checked out into an in-memory working tree so
+// files inside submodules can be read as well.
+func readClonedGitFile(ctx context.Context, repoURL, revision, filePath string, auth transport.AuthMethod, proxyOpts transport.ProxyOptions, submodules string) (string, plumbing.Hash, error) {
+	// Submodules are checked out into a working tree, everything else is read from objects
+	withSubmodules := submodulesEnabled(submodules)
+	var worktree billy.Filesystem
+	if withSubmodules {
+		worktree = memfs.New()
+	}
+
+	repo, commit, err := cloneGitRevision(ctx, repoURL, revision, auth, proxyOpts, worktree)
+	if err != nil {
+		return "", plumbing.ZeroHash, err
+	}
+
+	var content string
+	if withSubmodules {
+		content, err = readGitFileWithSubmodules(ctx, repo, commit.Hash, auth, submodules == SubmodulesShallow, filePath)
+	} else {
+		content, err = readGitFile(commit, repoURL, filePath)
+	}
+	return content, commit.Hash, err
+}
+
+// cloneGitRevision clones a repository into memory and returns the commit the revision
+// resolves to. Branches and tags are cloned with GIT_CLONE_DEPTH; commit SHAs need the full
+// history because servers do not generally allow fetching arbitrary commits.
+func cloneGitRevision(ctx context.Context, repoURL, revision string, auth transport.AuthMethod, proxyOpts transport.ProxyOptions, worktree billy.Filesystem) (*git.Repository, *object.Commit, error) {
+	opts := &git.CloneOptions{
+		URL:          repoURL,
+		Auth:         auth,
+		Depth:        currentSettings().gitCloneDepth,
+		NoCheckout:   true,
+		SingleBranch: true,
+		Tags:         git.NoTags,
+		ProxyOptions: proxyOpts,
+	}
+
+	var repo *git.Repository
+	var err error
+	switch {
+	case revision == "":
+		repo, err = cloneIntoMemory(ctx, opts, worktree)
+	case commitHashPattern.MatchString(revision):
+		opts.Depth = 0
+		opts.SingleBranch = false
+		repo, err = cloneIntoMemory(ctx, opts, worktree)
+	default:
+		opts.ReferenceName = plumbing.NewBranchReferenceName(revision)
+		repo, err = cloneIntoMemory(ctx, opts, worktree)
+		if errors.Is(err, git.NoMatchingRefSpecError{}) {
+			debugf("No branch named %s in %s, trying tags", revision, repoURL)
+			opts.ReferenceName = plumbing.NewTagReferenceName(revision)
+			repo, err = cloneIntoMemory(ctx, opts, worktree)
+		}
+	}
+	if err != nil {
+		return nil, nil, gitCloneError(ctx, repoURL, revision, err)
+	}
+
+	commit, err := resolveGitCommit(repo, revision)
+	if err != nil {
+		return nil, nil, err
+	}
+	return repo, commit, nil
+}
+
+// listGitFiles returns the files of the requested revision of a Git repository matching a
+// path.Match pattern and the commit the revision resolved to, read from the Git cache when
+// it is configured like cloneGitFile. Files inside submodules are not listed.
+func listGitFiles(repoURL, revision, pattern string, fetchOpts FetchOptions) (*TemplateListing, error) {
+	auth, err := gitAuth(repoURL, fetchOpts.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	proxyOpts, err := gitProxyOptions(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), currentSettings().resolutionTimeout)
+	defer cancel()
+
+	listing := &TemplateListing{Files: map[string]string{}}
+	list := func(commit *object.Commit) error {
+		iter, err := commit.Files()
+		if err != nil {
+			return fmt.Errorf("failed to list the files of %s at %s: %w", repoURL, commit.Hash, err)
+		}
+		listing.Commit = commit.Hash.String()
+		return iter.ForEach(func(file *object.File) error {
+			if matched, _ := path.Match(pattern, file.Name); !matched {
+				return nil
+			}
+			content, err := readGitFile(commit, repoURL, file.Name)
+			if err != nil {
+				return err
+			}
+			listing.Files[file.Name] = content
+			return nil
+		})
+	}
+	if gitCacheDir != "" && fetchOpts.Credentials == nil {
+		_, err = readCachedGitCommit(ctx, repoURL, revision, auth, proxyOpts, list)
+	} else {
+		var commit *object.Commit
+		if _, commit, err = cloneGitRevision(ctx, repoURL, revision, auth, proxyOpts, nil); err == nil {
+			err = list(commit)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+// readGitFile reads a file from the tree of a commit
+func readGitFile(commit *object.Commit, repoURL, filePath string) (string, error) {
+	file, err := commit.File(strings.TrimPrefix(filePath, "/"))
+	if err != nil {
+		if errors.Is(err, object.ErrFileNotFound) {
+			return "", fmt.Errorf("file %s not found in %s at %s", filePath, repoURL, commit.Hash)
+		}
+		return "", fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+
+	if err := checkTemplateSize(file.Size); err != nil {
+		return "", fmt.Errorf("file %s: %w", filePath, err)
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+
+	debugf("Successfully read file from Git repository at %s (%d bytes)", commit.Hash, len(content))
+	return content, nil
+}
+
+// cloneIntoMemory clones the repository into in-memory storage, once a clone slot is free,
+// retrying transient failures. The worktree may be nil when files are only read from the
+// object store.
+func cloneIntoMemory(ctx context.Context, opts *git.CloneOptions, worktree billy.Filesystem) (*git.Repository, error) {
+	var repo *git.Repository
+	err := retryGitOperation(ctx, opts.URL, func() error {
+		release, err := gitClones.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		debugf("Cloning Git repository %s (ref: %q, depth: %d)", opts.URL, opts.ReferenceName, opts.Depth)
+		repo, err = git.CloneContext(ctx, memory.NewStorage(), worktree, opts)
+		return err
+	})
+	return repo, err
+}
+
+// readGitFileWithSubmodules checks out the commit, initializes its submodules recursively
+// and reads the file from the working tree. Shallow submodules only fetch the pinned commit.
+func readGitFileWithSubmodules(ctx context.Context, repo *git.Repository, hash plumbing.Hash, auth transport.AuthMethod, shallow bool, filePath string) (string, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("failed to open in-memory worktree: %w", err)
+	}
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: hash, Force: true}); err != nil {
+		return "", fmt.Errorf("failed to check out %s: %w", hash, err)
+	}
+
+	submodules, err := worktree.Submodules()
+	if err != nil {
+		return "", fmt.Errorf("failed to read submodules: %w", err)
+	}
+	updateOpts := &git.SubmoduleUpdateOptions{
+		Init:              true,
+		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+		Auth:              auth,
+	}
+	if shallow {
+		updateOpts.Depth = 1
+	}
+	debugf("Initializing %d submodules (shallow: %t)", len(submodules), shallow)
+	if err := submodules.UpdateContext(ctx, updateOpts); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("git submodule update timed out after %v", currentSettings().resolutionTimeout)
+		}
+		return "", fmt.Errorf("failed to initialize submodules: %w", err)
+	}
+
+	if info, err := worktree.Filesystem.Stat(strings.TrimPrefix(filePath, "/")); err == nil {
+		if err := checkTemplateSize(info.Size()); err != nil {
+			return "", fmt.Errorf("file %s: %w", filePath, err)
+		}
+	}
+	content, err := util.ReadFile(worktree.Filesystem, strings.TrimPrefix(filePath, "/"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("file %s not found at %s (including submodules)", filePath, hash)
+		}
+		return "", fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+
+	debugf("Successfully read file from Git repository with submodules at %s (%d bytes)", hash, len(content))
+	return string(content), nil
+}
+
+// submodulesEnabled reports whether the submodule mode asks for submodules to be initialized
+func submodulesEnabled(mode string) bool {
+	return mode == SubmodulesFull || mode == SubmodulesShallow
+}
+
+// parseSubmodulesMode normalizes a submodules param or GIT_SUBMODULES value
+func parseSubmodulesMode(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case SubmodulesNone, SubmodulesFull, SubmodulesShallow:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid submodules value %q, expected %s, %s or %s", value, SubmodulesFull, SubmodulesShallow, SubmodulesNone)
+	}
+}
+
+// resolveGitCommit returns the commit to read templates from: HEAD of the cloned reference,
+// or the requested commit SHA
+func resolveGitCommit(repo *git.Repository, revision string) (*object.Commit, error) {
+	var hash plumbing.Hash
+	if revision != "" && commitHashPattern.MatchString(revision) {
+		resolved, err := repo.ResolveRevision(plumbing.Revision(revision))
+		if err != nil {
+			return nil, fmt.Errorf("revision %s not found: %w", revision, err)
+		}
+		hash = *resolved
+	} else {
+		head, err := repo.Head()
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve HEAD of cloned repository: %w", err)
+		}
+		hash = head.Hash()
+	}
+
+	return peelGitCommit(repo, hash)
+}
+
+// peelGitCommit loads the commit at hash, following annotated tags to the commit they point at
+func peelGitCommit(repo *git.Repository, hash plumbing.Hash) (*object.Commit, error) {
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		// Annotated tags point at a tag object rather than the commit itself
+		tag, tagErr := repo.TagObject(hash)
+		if tagErr != nil {
+			return nil, fmt.Errorf("failed to load commit %s: %w", hash, err)
+		}
+		return tag.Commit()
+	}
+	return commit, nil
+}
+
+// gitCloneError turns go-git errors into messages that say what went wrong
+func gitCloneError(ctx context.Context, repoURL, revision string, err error) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("git clone timed out after %v", currentSettings().resolutionTimeout)
+	case errors.Is(err, transport.ErrAuthenticationRequired), errors.Is(err, transport.ErrAuthorizationFailed):
+		return fmt.Errorf("git authentication failed for %s: %w", repoURL, err)
+	case errors.Is(err, transport.ErrRepositoryNotFound):
+		return fmt.Errorf("git repository %s not found: %w", repoURL, err)
+	case errors.Is(err, transport.ErrEmptyRemoteRepository):
+		return fmt.Errorf("git repository %s is empty: %w", repoURL, err)
+	case errors.Is(err, git.NoMatchingRefSpecError{}):
+		return fmt.Errorf("revision %s not found in %s: %w", revision, repoURL, err)
+	default:
+		return fmt.Errorf("git clone failed: %w", err)
+	}
+}
+
+// gitAuth returns the credentials used to clone repoURL. Per-request credentials from a
+// git-credentials-secret take precedence; otherwise HTTPS GitHub URLs use the installation
+// token of the GitHub App, if one is configured, and SSH repository URLs use the private key
+// mounted at GIT_SSH_KEY_FILE. Other URLs, and SSH URLs without a key, fall back to go-git defaults.
+func gitAuth(repoURL string, creds *GitCredentials) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Git repository URL %s: %w", repoURL, err)
+	}
+	if creds != nil {
+		return gitCredentialsAuth(endpoint, creds)
+	}
+	if githubApp != nil && endpoint.Protocol == "https" && githubHost(endpoint.Host) {
+		token, err := githubApp.Token()
+		if err != nil {
+			return nil, err
+		}
+		// GitHub expects installation tokens with this username
+		return &githttp.BasicAuth{Username: "x-access-token", Password: token}, nil
+	}
+	if endpoint.Protocol != "ssh" || gitSSHKeyFile == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(gitSSHKeyFile); err != nil {
+		debugf("SSH key %s not available, cloning without it: %v", gitSSHKeyFile, err)
+		return nil, nil
+	}
+
+	auth, err := gitssh.NewPublicKeysFromFile(sshUser(endpoint), gitSSHKeyFile, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH key %s: %w", gitSSHKeyFile, err)
+	}
+	if auth.HostKeyCallback, err = sshHostKeyCallback(); err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+// gitUsername returns the username of credentials for HTTP basic auth, git when the secret
+// only holds a token, since forges accept any username alongside a token
+func gitUsername(creds *GitCredentials) string {
+	if creds.Username == "" {
+		return "git"
+	}
+	return creds.Username
+}
+
+// gitCredentialsAuth builds the auth method for per-request credentials matching the
+// protocol of the repository URL
+func gitCredentialsAuth(endpoint *transport.Endpoint, creds *GitCredentials) (transport.AuthMethod, error) {
+	switch endpoint.Protocol {
+	case "ssh":
+		if len(creds.SSHPrivateKey) == 0 {
+			return nil, fmt.Errorf("credentials secret has no %s for SSH repository %s", secretKeySSHPrivateKey, endpoint.String())
+		}
+		auth, err := gitssh.NewPublicKeys(sshUser(endpoint), creds.SSHPrivateKey, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SSH key from credentials secret: %w", err)
+		}
+		if auth.HostKeyCallback, err = sshHostKeyCallback(); err != nil {
+			return nil, err
+		}
+		return auth, nil
+	case "http", "https":
+		if creds.Password == "" {
+			return nil, fmt.Errorf("credentials secret has no %s or %s for repository %s", secretKeyToken, secretKeyPassword, endpoint.String())
+		}
+		return &githttp.BasicAuth{Username: gitUsername(creds), Password: creds.Password}, nil
+	default:
+		return nil, fmt.Errorf("credentials secrets are not supported for %s repositories", endpoint.Protocol)
+	}
+}
+
+// sshUser returns the user from an SSH repository URL, defaulting to git
+func sshUser(endpoint *transport.Endpoint) string {
+	if endpoint.User == "" {
+		return "git"
+	}
+	return endpoint.User
+}
+
+// sshHostKeyCallback verifies host keys against GIT_SSH_KNOWN_HOSTS when configured
+func sshHostKeyCallback() (ssh.HostKeyCallback, error) {
+	if gitSSHKnownHosts == "" {
+		// Matches the previous StrictHostKeyChecking=no behaviour
+		return ssh.InsecureIgnoreHostKey(), nil // #nosec G106 -- opt in to verification with GIT_SSH_KNOWN_HOSTS
+	}
+	callback, err := gitssh.NewKnownHostsCallback(gitSSHKnownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH known hosts %s: %w", gitSSHKnownHosts, err)
+	}
+	return callback, nil
+}
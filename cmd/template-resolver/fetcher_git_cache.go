@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// gitCacheBranchesRefSpec fetches every branch of a repository into the cache
+const gitCacheBranchesRefSpec = "+refs/heads/*:refs/remotes/origin/*"
+
+// gitCacheLocks holds a *sync.Mutex per cached repository path. go-git does not support
+// concurrent writes to a repository on disk, so fetches and reads of one repository are serialized.
+var gitCacheLocks sync.Map
+
+// gitCachePath returns the directory of the bare clone of a repository inside GIT_CACHE_DIR
+func gitCachePath(repoURL string) string {
+	sum := sha256.Sum256([]byte(repoURL))
+	return filepath.Join(gitCacheDir, hex.EncodeToString(sum[:]))
+}
+
+// lockGitCache locks the cached clone at path and returns the function that unlocks it
+func lockGitCache(path string) func() {
+	lock, _ := gitCacheLocks.LoadOrStore(path, &sync.Mutex{})
+	mutex := lock.(*sync.Mutex)
+	mutex.Lock()
+	return mutex.Unlock
+}
+
+// openGitCache opens the cached bare clone at path, creating it with an origin remote
+// pointing at repoURL if it does not exist yet. A cache that cannot be opened is recreated.
+func openGitCache(path, repoURL string) (*git.Repository, error) {
+	repo, err := git.PlainOpen(path)
+	if err == nil {
+		if _, err = repo.Remote(git.DefaultRemoteName); err == nil {
+			return repo, nil
+		}
+	}
+	if !errors.Is(err, git.ErrRepositoryNotExists) {
+		debugf("Recreating unusable Git cache %s: %v", path, err)
+	}
+
+	if err := os.RemoveAll(path); err != nil {
+		return nil, fmt.Errorf("failed to remove Git cache %s: %w", path, err)
+	}
+	repo, err = git.PlainInit(path, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Git cache %s: %w", path, err)
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{repoURL}}); err != nil {
+		return nil, fmt.Errorf("failed to configure Git cache %s: %w", path, err)
+	}
+	return repo, nil
+}
+
+// fetchGitCache updates the cached clone with the given refspecs, once a clone slot is
+// free, retrying transient failures. Only objects that are not already in the cache are
+// downloaded.
+func fetchGitCache(ctx context.Context, repo *git.Repository, auth transport.AuthMethod, proxyOpts transport.ProxyOptions, refSpecs ...string) error {
+	specs := make([]config.RefSpec, 0, len(refSpecs))
+	for _, refSpec := range refSpecs {
+		specs = append(specs, config.RefSpec(refSpec))
+	}
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return err
+	}
+	return retryGitOperation(ctx, remote.Config().URLs[0], func() error {
+		release, err := gitClones.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		err = repo.FetchContext(ctx, &git.FetchOptions{
+			RemoteName:   git.DefaultRemoteName,
+			RefSpecs:     specs,
+			Auth:         auth,
+			Force:        true,
+			Tags:         git.NoTags,
+			ProxyOptions: proxyOpts,
+		})
+		if errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return nil
+		}
+		return err
+	})
+}
+
+// readCachedGitFile reads a file from a persistent bare clone of the repository in
+// GIT_CACHE_DIR. The requested branch, tag or remote HEAD is fetched on every call so
+// updates are picked up, while commit SHAs that are already cached are read without
+// contacting the remote. Cached clones keep the full history so fetches stay incremental.
+func readCachedGitFile(ctx context.Context, repoURL, revision, filePath string, auth transport.AuthMethod, proxyOpts transport.ProxyOptions) (string, plumbing.Hash, error) {
+	var content string
+	hash, err := readCachedGitCommit(ctx, repoURL, revision, auth, proxyOpts, func(commit *object.Commit) error {
+		var err error
+		content, err = readGitFile(commit, repoURL, filePath)
+		return err
+	})
+	return content, hash, err
+}
+
+// readCachedGitCommit fetches the revision into the Git cache like readCachedGitFile and
+// calls read with its commit while the cache is locked
+func readCachedGitCommit(ctx context.Context, repoURL, revision string, auth transport.AuthMethod, proxyOpts transport.ProxyOptions, read func(*object.Commit) error) (plumbing.Hash, error) {
+	path := gitCachePath(repoURL)
+	unlock := lockGitCache(path)
+	defer unlock()
+
+	repo, err := openGitCache(path, repoURL)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	debugf("Using Git cache %s for %s", path, repoURL)
+
+	var hash plumbing.Hash
+	switch {
+	case revision == "":
+		ref := plumbing.NewRemoteHEADReferenceName(git.DefaultRemoteName)
+		if err := fetchGitCache(ctx, repo, auth, proxyOpts, "+HEAD:"+ref.String()); err != nil {
+			return plumbing.ZeroHash, gitCloneError(ctx, repoURL, revision, err)
+		}
+		hash, err = resolveGitCacheReference(repo, ref)
+	case commitHashPattern.MatchString(revision):
+		resolved, resolveErr := repo.ResolveRevision(plumbing.Revision(revision))
+		if resolveErr != nil {
+			debugf("Commit %s not in Git cache, fetching all branches of %s", revision, repoURL)
+			if err := fetchGitCache(ctx, repo, auth, proxyOpts, gitCacheBranchesRefSpec); err != nil {
+				return plumbing.ZeroHash, gitCloneError(ctx, repoURL, revision, err)
+			}
+			if resolved, resolveErr = repo.ResolveRevision(plumbing.Revision(revision)); resolveErr != nil {
+				return plumbing.ZeroHash, fmt.Errorf("revision %s not found: %w", revision, resolveErr)
+			}
+		}
+		hash = *resolved
+	default:
+		ref := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, revision)
+		err = fetchGitCache(ctx, repo, auth, proxyOpts, "+"+plumbing.NewBranchReferenceName(revision).String()+":"+ref.String())
+		if errors.Is(err, git.NoMatchingRefSpecError{}) {
+			debugf("No branch named %s in %s, trying tags", revision, repoURL)
+			ref = plumbing.NewTagReferenceName(revision)
+			err = fetchGitCache(ctx, repo, auth, proxyOpts, "+"+ref.String()+":"+ref.String())
+		}
+		if err != nil {
+			return plumbing.ZeroHash, gitCloneError(ctx, repoURL, revision, err)
+		}
+		hash, err = resolveGitCacheReference(repo, ref)
+	}
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	commit, err := peelGitCommit(repo, hash)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return commit.Hash, read(commit)
+}
+
+// resolveGitCacheReference returns the hash a fetched reference in the cache points at
+func resolveGitCacheReference(repo *git.Repository, name plumbing.ReferenceName) (plumbing.Hash, error) {
+	ref, err := repo.Reference(name, true)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to resolve %s in Git cache: %w", name, err)
+	}
+	return ref.Hash(), nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloneGitFileWithCache(t *testing.T) {
+	originalCacheDir := gitCacheDir
+	defer func() { gitCacheDir = originalCacheDir }()
+	gitCacheDir = t.TempDir()
+
+	repoDir, firstCommit := newTestGitRepository(t)
+
+	tests := []struct {
+		name        string
+		revision    string
+		expected    string
+		commit      string
+		expectedErr string
+	}{
+		{name: "default branch", expected: "name: second"},
+		{name: "branch", revision: "release", expected: "name: first", commit: firstCommit.String()},
+		{name: "lightweight tag", revision: "v1", expected: "name: first", commit: firstCommit.String()},
+		{name: "annotated tag", revision: "v2", expected: "name: first", commit: firstCommit.String()},
+		{name: "commit SHA", revision: firstCommit.String()[:10], expected: "name: first", commit: firstCommit.String()},
+		{name: "missing revision", revision: "does-not-exist", expectedErr: "revision does-not-exist not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetched, err := cloneGitFile(repoDir, tt.revision, "pipelines/deploy.yaml", FetchOptions{})
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Contains(t, fetched.Content, tt.expected)
+			if tt.commit != "" {
+				assert.Equal(t, tt.commit, fetched.Commit)
+			}
+		})
+	}
+
+	// All requests share a single cached clone of the repository
+	entries, err := os.ReadDir(gitCacheDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, filepath.Base(gitCachePath(repoDir)), entries[0].Name())
+
+	// New commits are fetched into the existing cache
+	repo, err := git.PlainOpen(repoDir)
+	require.NoError(t, err)
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "pipelines", "deploy.yaml"), []byte("metadata:\n  name: third"), 0644))
+	_, err = worktree.Add("pipelines/deploy.yaml")
+	require.NoError(t, err)
+	third, err := worktree.Commit("Update third", &git.CommitOptions{
+		Author: &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+
+	fetched, err := cloneGitFile(repoDir, "", "pipelines/deploy.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: third")
+	assert.Equal(t, third.String(), fetched.Commit)
+}
+
+func TestOpenGitCacheRecreatesCorruptCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "repo")
+	require.NoError(t, os.MkdirAll(path, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(path, "HEAD"), []byte("garbage"), 0644))
+
+	repo, err := openGitCache(path, "https://example.com/org/repo.git")
+	require.NoError(t, err)
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://example.com/org/repo.git"}, remote.Config().URLs)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// cloneLimiter bounds how many Git clones and fetches run at once. A burst of resolutions
+// would otherwise start as many clones as there are requests and exhaust CPU, memory and
+// disk; with the limiter, clones beyond the limit wait in line for a slot.
+type cloneLimiter struct {
+	slots   chan struct{}
+	waiting atomic.Int32
+}
+
+// gitClones limits the clones of all requests, unlimited until setCloneConcurrency is called
+var gitClones *cloneLimiter
+
+// setCloneConcurrency limits the number of concurrent clones and fetches to limit,
+// or removes the limit when it is not positive
+func setCloneConcurrency(limit int) {
+	if limit <= 0 {
+		gitClones = nil
+		return
+	}
+	gitClones = &cloneLimiter{slots: make(chan struct{}, limit)}
+}
+
+// acquire waits for a free slot until ctx is done. The returned function releases the slot.
+func (l *cloneLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	default:
+	}
+
+	waiting := l.waiting.Add(1)
+	defer l.waiting.Add(-1)
+	debugf("Waiting for a clone slot, %d clones running and %d waiting", cap(l.slots), waiting)
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("gave up waiting behind %d running clones (%s): %w", cap(l.slots), EnvGitCloneLimit, ctx.Err())
+	}
+}
+
+func (l *cloneLimiter) release() {
+	<-l.slots
+}
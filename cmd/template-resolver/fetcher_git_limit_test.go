@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloneLimiter(t *testing.T) {
+	original := gitClones
+	defer func() { gitClones = original }()
+
+	setCloneConcurrency(0)
+	assert.Nil(t, gitClones)
+	release, err := gitClones.acquire(context.Background())
+	require.NoError(t, err, "no limit without a concurrency")
+	release()
+
+	setCloneConcurrency(2)
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := gitClones.acquire(context.Background())
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer release()
+			current := running.Add(1)
+			for {
+				observed := peak.Load()
+				if current <= observed || peak.CompareAndSwap(observed, current) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			running.Add(-1)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), peak.Load(), "queued clones run once a slot is free")
+}
+
+func TestCloneLimiterTimeout(t *testing.T) {
+	original := gitClones
+	defer func() { gitClones = original }()
+	setCloneConcurrency(1)
+
+	release, err := gitClones.acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = gitClones.acquire(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, EnvGitCloneLimit)
+}
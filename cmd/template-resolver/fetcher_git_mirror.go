@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// startGitMirroring warms the Git cache with the GIT_MIRROR_REPOSITORIES in the background,
+// once at startup and then every interval (never again when interval is 0), so the first
+// request for a mirrored repository does not pay for a cold clone
+func startGitMirroring(repoURLs []string, interval time.Duration) {
+	if len(repoURLs) == 0 {
+		return
+	}
+	if gitCacheDir == "" {
+		logger.Warnf("%s is set but %s is not, repositories are not mirrored", EnvGitMirrorRepos, EnvGitCacheDir)
+		return
+	}
+
+	go func() {
+		mirrorGitRepositories(repoURLs)
+		if interval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			mirrorGitRepositories(repoURLs)
+		}
+	}()
+}
+
+// mirrorGitRepositories updates the cached clones of the repositories one at a time,
+// logging failures so one unreachable repository does not stop the others
+func mirrorGitRepositories(repoURLs []string) {
+	for _, repoURL := range repoURLs {
+		start := time.Now()
+		if err := mirrorGitRepository(repoURL); err != nil {
+			logger.Warnf("Failed to mirror %s: %v", repoURL, err)
+			continue
+		}
+		debugf("Mirrored %s in %v", repoURL, time.Since(start))
+	}
+}
+
+// mirrorGitRepository fetches the remote HEAD and all branches of a repository into its
+// cached clone. Tags are fetched on demand when a request uses them.
+func mirrorGitRepository(repoURL string) error {
+	auth, err := gitAuth(repoURL, nil)
+	if err != nil {
+		return err
+	}
+	proxyOpts, err := gitProxyOptions(repoURL)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), currentSettings().resolutionTimeout)
+	defer cancel()
+
+	path := gitCachePath(repoURL)
+	unlock := lockGitCache(path)
+	defer unlock()
+
+	repo, err := openGitCache(path, repoURL)
+	if err != nil {
+		return err
+	}
+	headRef := plumbing.NewRemoteHEADReferenceName(git.DefaultRemoteName)
+	if err := fetchGitCache(ctx, repo, auth, proxyOpts, "+HEAD:"+headRef.String(), gitCacheBranchesRefSpec); err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", repoURL, err)
+	}
+	return nil
+}
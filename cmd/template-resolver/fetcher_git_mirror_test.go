@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrorGitRepository(t *testing.T) {
+	originalCacheDir := gitCacheDir
+	defer func() { gitCacheDir = originalCacheDir }()
+	gitCacheDir = t.TempDir()
+
+	repoDir, firstCommit := newTestGitRepository(t)
+	require.NoError(t, mirrorGitRepository(repoDir))
+
+	// Every branch and the remote HEAD are in the cache before any request
+	repo, err := git.PlainOpen(gitCachePath(repoDir))
+	require.NoError(t, err)
+	release, err := repo.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, "release"), true)
+	require.NoError(t, err)
+	assert.Equal(t, firstCommit, release.Hash())
+	_, err = repo.Reference(plumbing.NewRemoteHEADReferenceName(git.DefaultRemoteName), true)
+	require.NoError(t, err)
+
+	// Commits on mirrored branches are read without fetching
+	fetched, err := cloneGitFile(repoDir, firstCommit.String(), "pipelines/deploy.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: first")
+
+	// Mirroring again only updates the existing clone
+	require.NoError(t, mirrorGitRepository(repoDir))
+	entries, err := os.ReadDir(gitCacheDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.Error(t, mirrorGitRepository(t.TempDir()))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// retryGitOperation runs a clone or fetch of a repository, and runs it again up to
+// GIT_RETRIES times when it fails in a way another attempt may not, such as a reset
+// connection or a server error. Failures that would fail again, such as rejected
+// credentials or a missing repository or revision, are returned at once. Attempts are
+// spaced by an exponential backoff with jitter, and no retry is made that would start after
+// the deadline of ctx.
+func retryGitOperation(ctx context.Context, repoURL string, operation func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := operation()
+		if err == nil || attempt >= gitRetries || ctx.Err() != nil || !retryableGitError(err) {
+			return err
+		}
+		wait := retryBackoff(gitRetryBackoff, attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+		debugf("Retrying Git operation on %s in %v after: %v", repoURL, wait, err)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryableGitError reports whether a clone or fetch failed transiently. Authentication
+// failures, host key mismatches and missing repositories or revisions are permanent, as are
+// cancellations; network and server errors are assumed to be transient.
+func retryableGitError(err error) bool {
+	var keyErr *knownhosts.KeyError
+	var revokedErr *knownhosts.RevokedError
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, transport.ErrAuthenticationRequired), errors.Is(err, transport.ErrAuthorizationFailed),
+		errors.Is(err, transport.ErrInvalidAuthMethod), errors.Is(err, transport.ErrRepositoryNotFound),
+		errors.Is(err, transport.ErrEmptyRemoteRepository), errors.Is(err, transport.ErrEmptyUploadPackRequest),
+		errors.Is(err, git.NoMatchingRefSpecError{}), errors.Is(err, plumbing.ErrReferenceNotFound),
+		errors.Is(err, plumbing.ErrObjectNotFound), errors.Is(err, git.ErrRepositoryAlreadyExists),
+		errors.As(err, &keyErr), errors.As(err, &revokedErr):
+		return false
+	}
+	// The SSH client reports rejected keys in its handshake error
+	return !strings.Contains(err.Error(), "unable to authenticate")
+}
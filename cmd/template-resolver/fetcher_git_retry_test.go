@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestRetryableGitError(t *testing.T) {
+	retryable := []error{
+		io.ErrUnexpectedEOF,
+		fmt.Errorf("read tcp: %w", syscall.ECONNRESET),
+		errors.New("unexpected client error: unexpected requesting \"https://example.com/info/refs\" status code: 502"),
+	}
+	for _, err := range retryable {
+		assert.True(t, retryableGitError(err), err.Error())
+	}
+
+	permanent := []error{
+		transport.ErrAuthenticationRequired,
+		fmt.Errorf("clone: %w", transport.ErrAuthorizationFailed),
+		transport.ErrRepositoryNotFound,
+		transport.ErrEmptyRemoteRepository,
+		git.NoMatchingRefSpecError{},
+		context.DeadlineExceeded,
+		&knownhosts.KeyError{},
+		errors.New("ssh: handshake failed: ssh: unable to authenticate, attempted methods [none publickey], no supported methods remain"),
+	}
+	for _, err := range permanent {
+		assert.False(t, retryableGitError(err), "%T", err)
+	}
+}
+
+func TestRetryGitOperation(t *testing.T) {
+	originalRetries, originalBackoff := gitRetries, gitRetryBackoff
+	defer func() { gitRetries, gitRetryBackoff = originalRetries, originalBackoff }()
+	gitRetries, gitRetryBackoff = 2, time.Millisecond
+
+	run := func(ctx context.Context, errs ...error) (int, error) {
+		attempts := 0
+		err := retryGitOperation(ctx, "https://example.com/repo.git", func() error {
+			attempts++
+			if attempts <= len(errs) {
+				return errs[attempts-1]
+			}
+			return nil
+		})
+		return attempts, err
+	}
+	ctx := context.Background()
+
+	// Transient failures are retried until an attempt succeeds
+	attempts, err := run(ctx, io.ErrUnexpectedEOF, syscall.ECONNRESET)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	// The error of the last attempt is returned
+	attempts, err = run(ctx, io.ErrUnexpectedEOF, io.ErrUnexpectedEOF, syscall.ECONNRESET)
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, 3, attempts)
+
+	// Authentication failures fail at once
+	attempts, err = run(ctx, io.ErrUnexpectedEOF, transport.ErrAuthenticationRequired)
+	assert.ErrorIs(t, err, transport.ErrAuthenticationRequired)
+	assert.Equal(t, 2, attempts)
+
+	// No retry is made when its backoff would not end before the deadline
+	gitRetryBackoff = time.Minute
+	deadlineCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	attempts, err = run(deadlineCtx, io.ErrUnexpectedEOF, io.ErrUnexpectedEOF)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, 1, attempts)
+
+	gitRetries = 0
+	attempts, _ = run(ctx, io.ErrUnexpectedEOF)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestCloneGitFileMissingRepositoryNotRetried(t *testing.T) {
+	originalBackoff := gitRetryBackoff
+	defer func() { gitRetryBackoff = originalBackoff }()
+	gitRetryBackoff = time.Minute
+
+	started := time.Now()
+	_, err := cloneGitFile(filepath.Join(t.TempDir(), "missing"), "", "pipeline.yaml", FetchOptions{})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, transport.ErrRepositoryNotFound)
+	assert.Less(t, time.Since(started), 10*time.Second)
+}
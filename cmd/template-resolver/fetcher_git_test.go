@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// newTestGitRepository creates a repository with a template committed on the default branch,
+// a "release" branch and tags pointing at the first commit
+func newTestGitRepository(t *testing.T) (string, plumbing.Hash) {
+	t.Helper()
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+
+	signature := &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()}
+	commitTemplate := func(name string) plumbing.Hash {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "pipelines"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "pipelines", "deploy.yaml"), []byte("metadata:\n  name: "+name), 0644))
+		_, err := worktree.Add("pipelines/deploy.yaml")
+		require.NoError(t, err)
+		hash, err := worktree.Commit("Update "+name, &git.CommitOptions{Author: signature})
+		require.NoError(t, err)
+		return hash
+	}
+
+	first := commitTemplate("first")
+	_, err = repo.CreateTag("v1", first, nil)
+	require.NoError(t, err)
+	_, err = repo.CreateTag("v2", first, &git.CreateTagOptions{Tagger: signature, Message: "v2"})
+	require.NoError(t, err)
+	require.NoError(t, repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("release"), first)))
+	commitTemplate("second")
+
+	return dir, first
+}
+
+func TestCloneGitFile(t *testing.T) {
+	repoDir, firstCommit := newTestGitRepository(t)
+
+	tests := []struct {
+		name        string
+		revision    string
+		filePath    string
+		expected    string
+		commit      string
+		expectedErr string
+	}{
+		{name: "default branch", filePath: "pipelines/deploy.yaml", expected: "name: second"},
+		{name: "branch", revision: "release", filePath: "pipelines/deploy.yaml", expected: "name: first", commit: firstCommit.String()},
+		{name: "lightweight tag", revision: "v1", filePath: "pipelines/deploy.yaml", expected: "name: first", commit: firstCommit.String()},
+		{name: "annotated tag", revision: "v2", filePath: "pipelines/deploy.yaml", expected: "name: first", commit: firstCommit.String()},
+		{name: "commit SHA", revision: firstCommit.String()[:10], filePath: "/pipelines/deploy.yaml", expected: "name: first", commit: firstCommit.String()},
+		{name: "missing revision", revision: "does-not-exist", filePath: "pipelines/deploy.yaml", expectedErr: "revision does-not-exist not found"},
+		{name: "missing file", filePath: "pipelines/missing.yaml", expectedErr: "file pipelines/missing.yaml not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetched, err := cloneGitFile(repoDir, tt.revision, tt.filePath, FetchOptions{})
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Contains(t, fetched.Content, tt.expected)
+			assert.Len(t, fetched.Commit, 40)
+			if tt.commit != "" {
+				assert.Equal(t, tt.commit, fetched.Commit)
+			}
+		})
+	}
+}
+
+func TestGitAuth(t *testing.T) {
+	originalKeyFile := gitSSHKeyFile
+	defer func() { gitSSHKeyFile = originalKeyFile }()
+
+	gitSSHKeyFile = filepath.Join(t.TempDir(), "missing-key")
+
+	// HTTPS URLs and SSH URLs without a mounted key use the go-git defaults
+	for _, repoURL := range []string{"https://example.com/org/repo.git", "git@example.com:org/repo.git"} {
+		auth, err := gitAuth(repoURL, nil)
+		require.NoError(t, err, repoURL)
+		assert.Nil(t, auth, repoURL)
+	}
+
+	// An unreadable key is reported instead of silently cloning anonymously
+	gitSSHKeyFile = filepath.Join(t.TempDir(), "ssh-privatekey")
+	require.NoError(t, os.WriteFile(gitSSHKeyFile, []byte("not a key"), 0600))
+	_, err := gitAuth("ssh://git@example.com/org/repo.git", nil)
+	assert.ErrorContains(t, err, "failed to load SSH key")
+}
+
+func TestCloneGitFileWithSubmodules(t *testing.T) {
+	partialsDir, _ := newTestGitRepository(t)
+
+	// Create a repository that includes the first one as a submodule under partials/
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+
+	partialsRepo, err := git.PlainOpen(partialsDir)
+	require.NoError(t, err)
+	partialsHead, err := partialsRepo.Head()
+	require.NoError(t, err)
+
+	gitmodules := "[submodule \"partials\"]\n\tpath = partials\n\turl = " + partialsDir + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitmodules"), []byte(gitmodules), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pipeline.yaml"), []byte("kind: Pipeline"), 0644))
+	_, err = worktree.Add(".gitmodules")
+	require.NoError(t, err)
+	_, err = worktree.Add("pipeline.yaml")
+	require.NoError(t, err)
+
+	idx, err := repo.Storer.Index()
+	require.NoError(t, err)
+	idx.Entries = append(idx.Entries, &index.Entry{Name: "partials", Mode: filemode.Submodule, Hash: partialsHead.Hash()})
+	require.NoError(t, repo.Storer.SetIndex(idx))
+	_, err = worktree.Commit("Add partials submodule", &git.CommitOptions{
+		Author: &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+
+	// Without submodules the file inside the submodule is not part of the clone
+	_, err = cloneGitFile(dir, "", "partials/pipelines/deploy.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "not found")
+
+	for _, mode := range []string{SubmodulesFull, SubmodulesShallow} {
+		fetched, err := cloneGitFile(dir, "", "partials/pipelines/deploy.yaml", FetchOptions{Submodules: mode})
+		require.NoError(t, err, mode)
+		assert.Contains(t, fetched.Content, "name: second", mode)
+
+		fetched, err = cloneGitFile(dir, "", "pipeline.yaml", FetchOptions{Submodules: mode})
+		require.NoError(t, err, mode)
+		assert.Equal(t, "kind: Pipeline", fetched.Content, mode)
+	}
+}
+
+func TestParseSubmodulesMode(t *testing.T) {
+	for value, expected := range map[string]string{"true": SubmodulesFull, " Shallow ": SubmodulesShallow, "false": SubmodulesNone} {
+		mode, err := parseSubmodulesMode(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, mode)
+	}
+
+	_, err := parseSubmodulesMode("recursive")
+	assert.Error(t, err)
+}
+
+func TestGitCredentialsAuth(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pemBlock, err := ssh.MarshalPrivateKey(privateKey, "")
+	require.NoError(t, err)
+	sshCreds := &GitCredentials{SSHPrivateKey: pem.EncodeToMemory(pemBlock)}
+	tokenCreds := &GitCredentials{Password: "token"}
+
+	auth, err := gitAuth("git@example.com:org/repo.git", sshCreds)
+	require.NoError(t, err)
+	publicKeys, ok := auth.(*gitssh.PublicKeys)
+	require.True(t, ok)
+	assert.Equal(t, "git", publicKeys.User)
+
+	auth, err = gitAuth("https://example.com/org/repo.git", tokenCreds)
+	require.NoError(t, err)
+	assert.Equal(t, &githttp.BasicAuth{Username: "git", Password: "token"}, auth)
+
+	// Credentials must match the protocol of the repository URL
+	_, err = gitAuth("https://example.com/org/repo.git", sshCreds)
+	assert.ErrorContains(t, err, "has no token or password")
+	_, err = gitAuth("ssh://git@example.com/org/repo.git", tokenCreds)
+	assert.ErrorContains(t, err, "has no ssh-privatekey")
+}
+
+func TestListGitFiles(t *testing.T) {
+	repoDir, firstCommit := newTestGitRepository(t)
+
+	// The files are read at the commit the revision resolved to
+	listing, err := listGitFiles(repoDir, "release", "pipelines/*.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, &TemplateListing{Files: map[string]string{"pipelines/deploy.yaml": "metadata:\n  name: first"}, Commit: firstCommit.String()}, listing)
+
+	listing, err = listGitFiles(repoDir, "", "*.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, listing.Files)
+	assert.NotEmpty(t, listing.Commit)
+
+	_, err = listGitFiles(repoDir, "does-not-exist", "pipelines/*.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "revision does-not-exist not found")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// isGiteaURL reports whether the repository is hosted on a Gitea-compatible forge
+// (Gitea, Forgejo, Codeberg) whose host matches one of the GITEA_HOSTS patterns
+func isGiteaURL(repoURL string) bool {
+	u, err := url.Parse(repoURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return false
+	}
+	return hostMatches(u.Host, giteaHosts)
+}
+
+// hostMatches reports whether host matches any of the patterns, which may contain
+// shell-style wildcards. Example: *.forge.internal matches git.forge.internal
+func hostMatches(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range patterns {
+		if matched, err := path.Match(strings.ToLower(pattern), host); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// giteaRawURL builds the raw file URL for a repository on a Gitea-compatible forge.
+// Example: https://codeberg.org/owner/repo -> https://codeberg.org/api/v1/repos/owner/repo/raw/path/to/file.yaml?ref=main
+func giteaRawURL(repoURL, revision, filePath string) (string, error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid repository URL %s: %w", repoURL, err)
+	}
+
+	parts := strings.Split(strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("invalid repository URL, expected https://host/owner/repo: %s", repoURL)
+	}
+
+	rawPath := path.Join("/api/v1/repos", parts[0], parts[1], "raw", strings.TrimPrefix(filePath, "/"))
+	rawURL := url.URL{
+		Scheme:   u.Scheme,
+		Host:     u.Host,
+		Path:     rawPath,
+		RawQuery: url.Values{"ref": {refOrDefault(revision)}}.Encode(),
+	}
+	return rawURL.String(), nil
+}
+
+// fetchGiteaFile retrieves a single file from a Gitea-compatible forge over HTTP
+// instead of cloning. GITEA_TOKEN is sent for private repositories.
+func fetchGiteaFile(repoURL, revision, filePath string) (content string, err error) {
+	fileURL, err := giteaRawURL(repoURL, revision, filePath)
+	if err != nil {
+		return "", err
+	}
+	debugf("Fetching Gitea file from URL: %s", fileURL)
+
+	req, err := http.NewRequest(http.MethodGet, fileURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create Gitea request: %w", err)
+	}
+	if giteaToken != "" {
+		req.Header.Set("Authorization", "token "+giteaToken)
+	}
+
+	// Create an HTTP client with timeout that honors the proxy configuration
+	client := newHTTPClient()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch Gitea file: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close response body: %w", closeErr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP error fetching Gitea file: %s", resp.Status)
+	}
+
+	body, err := readTemplate(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read Gitea file content: %w", err)
+	}
+
+	debugf("Successfully fetched Gitea file content (%d bytes)", len(body))
+	return body, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostMatches(t *testing.T) {
+	patterns := []string{"codeberg.org", "*.forge.internal", "git.example.com:3000"}
+
+	assert.True(t, hostMatches("codeberg.org", patterns))
+	assert.True(t, hostMatches("Git.Forge.Internal", patterns))
+	assert.True(t, hostMatches("git.example.com:3000", patterns))
+	assert.False(t, hostMatches("forge.internal", patterns))
+	assert.False(t, hostMatches("git.example.com", patterns))
+	assert.False(t, hostMatches("github.com", nil))
+}
+
+func TestGiteaRawURL(t *testing.T) {
+	originalBranch := gitDefaultBranch
+	defer func() { gitDefaultBranch = originalBranch }()
+	gitDefaultBranch = "main"
+
+	rawURL, err := giteaRawURL("https://codeberg.org/owner/repo.git", "", "templates/pipeline.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "https://codeberg.org/api/v1/repos/owner/repo/raw/templates/pipeline.yaml?ref=main", rawURL)
+
+	rawURL, err = giteaRawURL("https://codeberg.org/owner/repo", "release/v1", "/pipeline.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "https://codeberg.org/api/v1/repos/owner/repo/raw/pipeline.yaml?ref=release%2Fv1", rawURL)
+
+	_, err = giteaRawURL("https://codeberg.org/owner", "", "pipeline.yaml")
+	assert.Error(t, err)
+}
+
+func TestFetchGiteaFile(t *testing.T) {
+	originalHosts, originalToken := giteaHosts, giteaToken
+	defer func() { giteaHosts, giteaToken = originalHosts, originalToken }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/repos/owner/repo/raw/templates/pipeline.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "token forge-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, err := w.Write([]byte("kind: Pipeline\nmetadata:\n  name: gitea-" + r.URL.Query().Get("ref")))
+		if err != nil {
+			t.Logf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	giteaHosts = []string{serverURL.Host}
+	giteaToken = "forge-token"
+
+	fetcher := &gitTemplateFetcher{}
+	fetched, err := fetcher.FetchTemplate(server.URL+"/owner/repo", "v1.0.0", "templates/pipeline.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: gitea-v1.0.0")
+
+	_, err = fetcher.FetchTemplate(server.URL+"/owner/repo", "", "missing.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "404")
+}
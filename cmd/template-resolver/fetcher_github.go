@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxGitHubAPIAttempts bounds how many times a rate limited request is retried
+const maxGitHubAPIAttempts = 3
+
+// parseGitHubRepo extracts the owner and repository name from HTTPS or SSH GitHub URLs.
+// Example: https://github.com/example/repo or git@github.com:example/repo.git -> example, repo
+func parseGitHubRepo(repoURL string) (owner, repo string, ok bool) {
+	var repoPath string
+	switch {
+	case strings.HasPrefix(repoURL, "https://github.com/"):
+		repoPath = strings.TrimPrefix(repoURL, "https://github.com/")
+	case strings.HasPrefix(repoURL, "git@github.com:"):
+		repoPath = strings.TrimPrefix(repoURL, "git@github.com:")
+	case strings.HasPrefix(repoURL, "ssh://git@github.com/"):
+		repoPath = strings.TrimPrefix(repoURL, "ssh://git@github.com/")
+	default:
+		return "", "", false
+	}
+
+	parts := strings.Split(strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// fetchGitHubContents retrieves a single file through the GitHub Contents API using
+// GITHUB_TOKEN, which allows reading private repositories without cloning them. The ref is
+// first resolved to a commit SHA so the content and the reported commit always match.
+func fetchGitHubContents(owner, repo, revision, filePath string) (*FetchedTemplate, error) {
+	token, err := githubAuthToken()
+	if err != nil {
+		return nil, err
+	}
+	return fetchGitHubFile(token, owner, repo, revision, filePath)
+}
+
+// fetchGitHubFile retrieves a single file through the GitHub Contents API authenticated with
+// token, at the commit the ref resolves to
+func fetchGitHubFile(token, owner, repo, revision, filePath string) (*FetchedTemplate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), currentSettings().resolutionTimeout)
+	defer cancel()
+
+	// Create an HTTP client with timeout that honors the proxy configuration
+	client := newHTTPClient()
+
+	ref := refOrDefault(revision)
+	commit, err := githubCommitSHA(ctx, client, token, owner, repo, ref)
+	if err != nil {
+		// The commit is only needed for provenance, so the template can still be fetched by ref
+		debugf("Failed to resolve %s to a commit, fetching without a digest: %v", ref, err)
+	} else {
+		ref = commit
+	}
+
+	// Example: https://api.github.com/repos/example/repo/contents/path/to/file.yaml?ref=main
+	var escapedPath []string
+	for _, segment := range strings.Split(strings.TrimPrefix(filePath, "/"), "/") {
+		escapedPath = append(escapedPath, url.PathEscape(segment))
+	}
+	fileURL := fmt.Sprintf("%s/repos/%s/%s/contents/%s?ref=%s",
+		strings.TrimSuffix(githubAPIURL, "/"), url.PathEscape(owner), url.PathEscape(repo),
+		strings.Join(escapedPath, "/"), url.QueryEscape(ref))
+	debugf("Fetching GitHub file from Contents API: %s", fileURL)
+
+	resp, err := githubAPIGet(ctx, client, token, fileURL, "application/vnd.github.raw")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch GitHub file: %w", err)
+	}
+	content, err := readGitHubContentsResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &FetchedTemplate{Content: content, Commit: commit}, nil
+}
+
+// githubCommitSHA resolves a branch, tag or abbreviated SHA to a full commit SHA
+func githubCommitSHA(ctx context.Context, client *http.Client, token, owner, repo, ref string) (sha string, err error) {
+	// Example: https://api.github.com/repos/example/repo/commits/main
+	commitURL := fmt.Sprintf("%s/repos/%s/%s/commits/%s",
+		strings.TrimSuffix(githubAPIURL, "/"), url.PathEscape(owner), url.PathEscape(repo), url.PathEscape(ref))
+
+	resp, err := githubAPIGet(ctx, client, token, commitURL, "application/vnd.github.sha")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close response body: %w", closeErr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP error resolving GitHub commit: %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read GitHub commit: %w", err)
+	}
+
+	sha = strings.TrimSpace(string(body))
+	if !commitHashPattern.MatchString(sha) {
+		return "", fmt.Errorf("unexpected GitHub commit response for %s", ref)
+	}
+	return sha, nil
+}
+
+// githubAPIGet sends a GET request authenticated with token to the GitHub API, waiting for
+// and retrying rate limited requests unless the wait would outlast ctx. The caller must
+// close the response body.
+func githubAPIGet(ctx context.Context, client *http.Client, token, apiURL, accept string) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GitHub API request: %w", err)
+		}
+		req.Header.Set("Accept", accept)
+		req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "" {
+			debugf("GitHub API rate limit remaining: %s", remaining)
+		}
+
+		if wait, limited := githubRateLimitWait(resp); limited {
+			if closeErr := resp.Body.Close(); closeErr != nil {
+				return nil, fmt.Errorf("failed to close response body: %w", closeErr)
+			}
+			if attempt >= maxGitHubAPIAttempts || wait > githubRateLimitMaxWait {
+				return nil, fmt.Errorf("GitHub API rate limit exceeded, retry after %v", wait.Round(time.Second))
+			}
+			// Fail now rather than wait for a retry that could not finish in time
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+				return nil, fmt.Errorf("GitHub API rate limit exceeded, retry after %v is past the resolution deadline", wait.Round(time.Second))
+			}
+			debugf("GitHub API rate limited, waiting %v before retrying (attempt %d/%d)", wait, attempt, maxGitHubAPIAttempts)
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+			continue
+		}
+		return resp, nil
+	}
+}
+
+// readGitHubContentsResponse reads a Contents API response body and closes it
+func readGitHubContentsResponse(resp *http.Response) (content string, err error) {
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close response body: %w", closeErr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP error fetching GitHub file from API: %s", resp.Status)
+	}
+
+	body, err := readTemplate(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read GitHub file content: %w", err)
+	}
+
+	debugf("Successfully fetched GitHub file from API (%d bytes)", len(body))
+	return body, nil
+}
+
+// githubRateLimitWait reports whether a response was rate limited and how long to wait.
+// GitHub signals primary limits with X-RateLimit-Remaining: 0 and a reset timestamp,
+// and secondary limits with a Retry-After header.
+func githubRateLimitWait(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			wait := time.Until(time.Unix(reset, 0))
+			if wait < 0 {
+				wait = 0
+			}
+			return wait, true
+		}
+		return githubRateLimitMaxWait + time.Second, true
+	}
+
+	// 429 without any hints is still a rate limit
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return time.Second, true
+	}
+	return 0, false
+}
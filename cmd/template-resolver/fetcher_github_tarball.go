@@ -0,0 +1,154 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// githubCredentialsRepo reports whether a repository is read from GitHub with a token from a
+// credentials secret, rather than cloned, and returns its owner and name
+func githubCredentialsRepo(repoURL string, opts FetchOptions) (owner, repo string, ok bool) {
+	if submodulesEnabled(opts.Submodules) || opts.Credentials == nil || opts.Credentials.Password == "" {
+		return "", "", false
+	}
+	return parseGitHubRepo(repoURL)
+}
+
+// fetchGitHubCredentialsFile reads a single file of a GitHub repository through the Contents
+// API with the token of a credentials secret, which is much faster than cloning a large
+// repository and needs no Git
+func fetchGitHubCredentialsFile(repoURL, owner, repo, revision, filePath string, creds *GitCredentials) (*FetchedTemplate, error) {
+	fetched, err := fetchGitHubFile(creds.Password, owner, repo, revision, filePath)
+	if err != nil {
+		return nil, err
+	}
+	if fetched.Content, err = resolveTarballLFS(repoURL, filePath, fetched.Content, creds); err != nil {
+		return nil, err
+	}
+	return fetched, nil
+}
+
+// listGitHubTarball returns the files of a GitHub repository matching a glob pattern. The
+// tarball of the resolved commit is downloaded once and streamed, keeping only the matching
+// files, so a glob path costs a single download however many templates it matches.
+func listGitHubTarball(repoURL, owner, repo, revision, pattern string, creds *GitCredentials) (*TemplateListing, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), currentSettings().resolutionTimeout)
+	defer cancel()
+
+	// Create an HTTP client with timeout that honors the proxy configuration
+	client := newHTTPClient()
+
+	ref := refOrDefault(revision)
+	commit, err := githubCommitSHA(ctx, client, creds.Password, owner, repo, ref)
+	if err != nil {
+		// The commit is only needed for provenance, so the files can still be listed by ref
+		debugf("Failed to resolve %s to a commit, listing without a digest: %v", ref, err)
+	} else {
+		ref = commit
+	}
+
+	// Example: https://api.github.com/repos/example/repo/tarball/main, which redirects to
+	// codeload.github.com with a short-lived token in the URL
+	tarballURL := fmt.Sprintf("%s/repos/%s/%s/tarball/%s",
+		strings.TrimSuffix(githubAPIURL, "/"), url.PathEscape(owner), url.PathEscape(repo), url.PathEscape(ref))
+	debugf("Downloading GitHub tarball %s", tarballURL)
+
+	resp, err := githubAPIGet(ctx, client, creds.Password, tarballURL, "application/vnd.github+json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download GitHub tarball: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			debugf("Failed to close GitHub tarball body: %v", closeErr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP error downloading GitHub tarball: %s", resp.Status)
+	}
+
+	files, err := readTarballFiles(resp.Body, pattern)
+	if err != nil {
+		return nil, err
+	}
+	for name, content := range files {
+		if files[name], err = resolveTarballLFS(repoURL, name, content, creds); err != nil {
+			return nil, err
+		}
+	}
+
+	debugf("Listed %d files matching %s from GitHub tarball", len(files), pattern)
+	return &TemplateListing{Files: files, Commit: commit}, nil
+}
+
+// resolveTarballLFS replaces a Git LFS pointer by its object. The Contents API and tarballs
+// hold the pointer, not the object, just like a clone.
+func resolveTarballLFS(repoURL, filePath, content string, creds *GitCredentials) (string, error) {
+	if !gitLFS {
+		return content, nil
+	}
+	pointer, ok := parseLFSPointer(content)
+	if !ok {
+		return content, nil
+	}
+	content, err := fetchLFSObject(repoURL, pointer, creds)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch Git LFS object for %s: %w", filePath, err)
+	}
+	return content, nil
+}
+
+// readTarballFiles extracts the files matching a glob pattern from a gzipped repository
+// tarball, whose entries are all under a single top-level directory such as
+// example-repo-1a2b3c4/
+func readTarballFiles(r io.Reader, pattern string) (map[string]string, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository tarball: %w", err)
+	}
+	defer func() {
+		if closeErr := gz.Close(); closeErr != nil {
+			debugf("Failed to close gzip reader: %v", closeErr)
+		}
+	}()
+
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read repository tarball: %w", err)
+		}
+		_, name, ok := strings.Cut(header.Name, "/")
+		if !ok {
+			continue
+		}
+		if matched, _ := path.Match(pattern, name); !matched {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeReg:
+			if err := checkTemplateSize(header.Size); err != nil {
+				return nil, fmt.Errorf("template %s: %w", name, err)
+			}
+			content, err := readTemplate(tr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s from repository tarball: %w", name, err)
+			}
+			files[name] = content
+		case tar.TypeSymlink:
+			return nil, fmt.Errorf("template %s is a symbolic link, which is not supported for tarball downloads", name)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// repositoryTarball builds a gzipped tarball laid out like GitHub's, with every entry under
+// a single top-level directory
+func repositoryTarball(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "example-private-0123456/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name: "example-private-0123456/" + name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content)),
+		}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name: "example-private-0123456/link.yaml", Typeflag: tar.TypeSymlink, Linkname: "pipeline.yaml",
+	}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestFetchGitHubCredentialsFile(t *testing.T) {
+	originalURL, originalToken := githubAPIURL, githubToken
+	defer func() { githubAPIURL, githubToken = originalURL, originalToken }()
+
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	files := map[string]string{
+		"pipeline.yaml":           "kind: Pipeline\nmetadata:\n  name: root",
+		"templates/pipeline.yaml": "kind: Pipeline\nmetadata:\n  name: nested",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer team-token", r.Header.Get("Authorization"))
+		switch {
+		case r.URL.Path == "/repos/example/private/commits/main":
+			_, _ = w.Write([]byte(commit))
+		case strings.HasPrefix(r.URL.Path, "/repos/example/private/contents/"):
+			assert.Equal(t, commit, r.URL.Query().Get("ref"))
+			content, ok := files[strings.TrimPrefix(r.URL.Path, "/repos/example/private/contents/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(content))
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	githubAPIURL = server.URL
+	githubToken = ""
+
+	fetcher := &gitTemplateFetcher{}
+	opts := FetchOptions{Credentials: &GitCredentials{Password: "team-token"}}
+
+	fetched, err := fetcher.FetchTemplate("https://github.com/example/private", "main", "/templates/pipeline.yaml", opts)
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: nested")
+	assert.Equal(t, commit, fetched.Commit)
+
+	fetched, err = fetcher.FetchTemplate("git@github.com:example/private.git", "main", "pipeline.yaml", opts)
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: root")
+
+	_, err = fetcher.FetchTemplate("https://github.com/example/private", "main", "missing.yaml", opts)
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestListGitHubTarball(t *testing.T) {
+	originalURL, originalToken := githubAPIURL, githubToken
+	defer func() { githubAPIURL, githubToken = originalURL, originalToken }()
+
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	tarball := repositoryTarball(t, map[string]string{
+		"pipelines/build.yaml":  "kind: Pipeline\nmetadata:\n  name: build",
+		"pipelines/deploy.yaml": "kind: Pipeline\nmetadata:\n  name: deploy",
+		"tasks/lint.yaml":       "kind: Task",
+	})
+	downloads := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/example/private/commits/main":
+			assert.Equal(t, "Bearer team-token", r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(commit))
+		case "/repos/example/private/tarball/" + commit:
+			assert.Equal(t, "Bearer team-token", r.Header.Get("Authorization"))
+			// GitHub redirects to codeload with a short-lived token
+			http.Redirect(w, r, server.URL+"/codeload/example/private/legacy.tar.gz/"+commit, http.StatusFound)
+		case "/codeload/example/private/legacy.tar.gz/" + commit:
+			downloads++
+			_, _ = w.Write(tarball)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	githubAPIURL = server.URL
+	githubToken = ""
+
+	fetcher := &gitTemplateFetcher{}
+	opts := FetchOptions{Credentials: &GitCredentials{Password: "team-token"}}
+
+	// Every matching file is read from a single download
+	listing, err := fetcher.ListTemplates("https://github.com/example/private", "main", "pipelines/*.yaml", opts)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"pipelines/build.yaml":  "kind: Pipeline\nmetadata:\n  name: build",
+		"pipelines/deploy.yaml": "kind: Pipeline\nmetadata:\n  name: deploy",
+	}, listing.Files)
+	assert.Equal(t, commit, listing.Commit)
+	assert.Equal(t, 1, downloads)
+
+	_, err = fetcher.ListTemplates("https://github.com/example/private", "main", "*.yaml", opts)
+	assert.ErrorContains(t, err, "link.yaml is a symbolic link")
+
+	_, err = fetcher.ListTemplates("https://github.com/example/unknown", "main", "*.yaml", opts)
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestReadTarballFilesTooLarge(t *testing.T) {
+	original := maxTemplateSize
+	defer func() { maxTemplateSize = original }()
+	maxTemplateSize = 8
+
+	tarball := repositoryTarball(t, map[string]string{"pipeline.yaml": "kind: Pipeline"})
+	_, err := readTarballFiles(bytes.NewReader(tarball), "pipeline.yaml")
+	assert.ErrorContains(t, err, "over the 8 byte limit")
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGitHubRepo(t *testing.T) {
+	tests := []struct {
+		repoURL string
+		owner   string
+		repo    string
+		ok      bool
+	}{
+		{repoURL: "https://github.com/example/repo", owner: "example", repo: "repo", ok: true},
+		{repoURL: "https://github.com/example/repo.git", owner: "example", repo: "repo", ok: true},
+		{repoURL: "git@github.com:example/repo.git", owner: "example", repo: "repo", ok: true},
+		{repoURL: "ssh://git@github.com/example/repo", owner: "example", repo: "repo", ok: true},
+		{repoURL: "https://github.com/example", ok: false},
+		{repoURL: "https://gitlab.com/example/repo", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repoURL, func(t *testing.T) {
+			owner, repo, ok := parseGitHubRepo(tt.repoURL)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.owner, owner)
+			assert.Equal(t, tt.repo, repo)
+		})
+	}
+}
+
+func TestFetchGitHubContents(t *testing.T) {
+	originalURL, originalToken, originalWait := githubAPIURL, githubToken, githubRateLimitMaxWait
+	defer func() {
+		githubAPIURL, githubToken, githubRateLimitMaxWait = originalURL, originalToken, originalWait
+	}()
+
+	const privateCommit = "0123456789abcdef0123456789abcdef01234567"
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/repos/example/private/commits/v2":
+			assert.Equal(t, "application/vnd.github.sha", r.Header.Get("Accept"))
+			_, _ = w.Write([]byte(privateCommit))
+		case "/repos/example/private/contents/templates/pipeline.yaml":
+			assert.Equal(t, "application/vnd.github.raw", r.Header.Get("Accept"))
+			// Contents are read at the resolved commit
+			assert.Equal(t, privateCommit, r.URL.Query().Get("ref"))
+			_, err := w.Write([]byte("kind: Pipeline\nmetadata:\n  name: private-v2"))
+			if err != nil {
+				t.Logf("Failed to write response: %v", err)
+			}
+		case "/repos/example/limited/contents/pipeline.yaml":
+			// First contents request is rate limited, the retry succeeds.
+			// The commit lookup before it is request 1 and is not found.
+			if requests == 2 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, err := w.Write([]byte("kind: Pipeline"))
+			if err != nil {
+				t.Logf("Failed to write response: %v", err)
+			}
+		case "/repos/example/exhausted/contents/pipeline.yaml":
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	githubAPIURL = server.URL
+	githubToken = "secret-token"
+	githubRateLimitMaxWait = time.Second
+
+	fetcher := &gitTemplateFetcher{}
+
+	fetched, err := fetcher.FetchTemplate("git@github.com:example/private.git", "v2", "templates/pipeline.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: private-v2")
+	assert.Equal(t, privateCommit, fetched.Commit)
+
+	requests = 0
+	fetched, err = fetcher.FetchTemplate("https://github.com/example/limited", "", "pipeline.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Pipeline", fetched.Content)
+	assert.Empty(t, fetched.Commit)
+	assert.Equal(t, 3, requests)
+
+	_, err = fetcher.FetchTemplate("https://github.com/example/exhausted", "", "pipeline.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "rate limit exceeded")
+
+	_, err = fetcher.FetchTemplate("https://github.com/example/private", "", "missing.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "404")
+}
+
+func TestGitHubAPIGetRateLimitWait(t *testing.T) {
+	original := githubRateLimitMaxWait
+	defer func() { githubRateLimitMaxWait = original }()
+	githubRateLimitMaxWait = time.Minute
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	// A wait past the deadline fails at once instead of sleeping through it
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err := githubAPIGet(ctx, server.Client(), "token", server.URL, "application/vnd.github.raw")
+	assert.EqualError(t, err, "GitHub API rate limit exceeded, retry after 30s is past the resolution deadline")
+	assert.Less(t, time.Since(start), time.Second)
+
+	// A cancelled request stops waiting
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start = time.Now()
+	_, err = githubAPIGet(ctx, server.Client(), "token", server.URL, "application/vnd.github.raw")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
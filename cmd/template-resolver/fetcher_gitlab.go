@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// isGitLabURL reports whether the repository URL points at gitlab.com or a
+// self-hosted GitLab instance matching one of the GITLAB_HOSTS patterns
+func isGitLabURL(repoURL string) bool {
+	u, err := url.Parse(repoURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, "gitlab.com") || hostMatches(u.Host, gitlabHosts)
+}
+
+// gitlabProjectID derives the project ID used by the GitLab API from a repository URL.
+// Example: https://gitlab.com/group/subgroup/project.git -> group%2Fsubgroup%2Fproject
+// A single numeric path segment (https://gitlab.com/12345) is used as a numeric project ID.
+func gitlabProjectID(u *url.URL) (string, error) {
+	projectPath := strings.Trim(u.Path, "/")
+	projectPath = strings.TrimSuffix(projectPath, ".git")
+	if projectPath == "" {
+		return "", fmt.Errorf("invalid GitLab repository URL, missing project path: %s", u.String())
+	}
+
+	if _, err := strconv.Atoi(projectPath); err == nil {
+		return projectPath, nil
+	}
+	return url.PathEscape(projectPath), nil
+}
+
+// fetchGitLabFile retrieves a single file through the GitLab repository files API
+// instead of cloning the project. Private projects require GITLAB_TOKEN to be set.
+func fetchGitLabFile(repoURL, revision, filePath string) (content string, err error) {
+	u, err := url.Parse(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid GitLab repository URL %s: %w", repoURL, err)
+	}
+
+	projectID, err := gitlabProjectID(u)
+	if err != nil {
+		return "", err
+	}
+
+	// Example: https://gitlab.com/api/v4/projects/group%2Fproject/repository/files/path%2Fto%2Ffile.yaml/raw?ref=main
+	fileURL := fmt.Sprintf("%s://%s/api/v4/projects/%s/repository/files/%s/raw?ref=%s",
+		u.Scheme, u.Host, projectID, url.PathEscape(strings.TrimPrefix(filePath, "/")), url.QueryEscape(refOrDefault(revision)))
+	debugf("Fetching GitLab file from URL: %s", fileURL)
+
+	req, err := http.NewRequest(http.MethodGet, fileURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create GitLab request: %w", err)
+	}
+	if gitlabToken != "" {
+		req.Header.Set("PRIVATE-TOKEN", gitlabToken)
+	}
+
+	// Create an HTTP client with timeout that honors the proxy configuration
+	client := newHTTPClient()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch GitLab file: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close response body: %w", closeErr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP error fetching GitLab file: %s", resp.Status)
+	}
+
+	body, err := readTemplate(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read GitLab file content: %w", err)
+	}
+
+	debugf("Successfully fetched GitLab file content (%d bytes)", len(body))
+	return body, nil
+}
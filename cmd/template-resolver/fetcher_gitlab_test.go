@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsGitLabURL(t *testing.T) {
+	originalHosts := gitlabHosts
+	defer func() { gitlabHosts = originalHosts }()
+	gitlabHosts = []string{"gitlab.example.com"}
+
+	assert.True(t, isGitLabURL("https://gitlab.com/group/project"))
+	assert.True(t, isGitLabURL("https://GitLab.example.com/group/project"))
+	assert.False(t, isGitLabURL("https://github.com/example/repo"))
+	assert.False(t, isGitLabURL("git@gitlab.com:group/project.git"))
+}
+
+func TestGitLabProjectID(t *testing.T) {
+	tests := []struct {
+		repoURL  string
+		expected string
+		wantErr  bool
+	}{
+		{repoURL: "https://gitlab.com/group/project", expected: "group%2Fproject"},
+		{repoURL: "https://gitlab.com/group/subgroup/project.git", expected: "group%2Fsubgroup%2Fproject"},
+		{repoURL: "https://gitlab.com/12345", expected: "12345"},
+		{repoURL: "https://gitlab.com/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repoURL, func(t *testing.T) {
+			u, err := url.Parse(tt.repoURL)
+			require.NoError(t, err)
+
+			projectID, err := gitlabProjectID(u)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, projectID)
+		})
+	}
+}
+
+func TestFetchGitLabFile(t *testing.T) {
+	originalHosts, originalToken, originalBranch := gitlabHosts, gitlabToken, gitDefaultBranch
+	defer func() {
+		gitlabHosts, gitlabToken, gitDefaultBranch = originalHosts, originalToken, originalBranch
+	}()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v4/projects/group%2Fproject/repository/files/templates%2Fpipeline.yaml/raw" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("PRIVATE-TOKEN") != "secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, err := w.Write([]byte("kind: Pipeline\nmetadata:\n  name: gitlab-" + r.URL.Query().Get("ref")))
+		if err != nil {
+			t.Logf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	gitlabHosts = []string{serverURL.Host}
+	gitlabToken = "secret-token"
+	gitDefaultBranch = "main"
+
+	fetcher := &gitTemplateFetcher{}
+
+	// Default branch is used when no revision is requested
+	fetched, err := fetcher.FetchTemplate(server.URL+"/group/project", "", "templates/pipeline.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: gitlab-main")
+
+	// Explicit revision is passed as the ref
+	fetched, err = fetcher.FetchTemplate(server.URL+"/group/project.git", "v1.2.0", "templates/pipeline.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: gitlab-v1.2.0")
+
+	// Missing files surface the HTTP status
+	_, err = fetcher.FetchTemplate(server.URL+"/group/project", "", "missing.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "404")
+
+	// Requests without a valid token are rejected
+	gitlabToken = ""
+	_, err = fetcher.FetchTemplate(server.URL+"/group/project", "", "templates/pipeline.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "401")
+}
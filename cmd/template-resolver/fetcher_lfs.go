@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+const (
+	// lfsPointerVersion is the first line of every Git LFS pointer file
+	lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+
+	// lfsMaxPointerSize is the largest file treated as a pointer, as in the LFS spec
+	lfsMaxPointerSize = 1024
+
+	// lfsMediaType is used for LFS batch API requests and responses
+	lfsMediaType = "application/vnd.git-lfs+json"
+)
+
+// lfsPointer identifies an object stored on a Git LFS server
+type lfsPointer struct {
+	OID  string `json:"oid"`
+	Size int64  `json:"size"`
+}
+
+// lfsBatchRequest is the body of a Git LFS batch API request
+type lfsBatchRequest struct {
+	Operation string       `json:"operation"`
+	Transfers []string     `json:"transfers"`
+	Objects   []lfsPointer `json:"objects"`
+	HashAlgo  string       `json:"hash_algo"`
+}
+
+// lfsBatchResponse is the subset of the Git LFS batch API response we use
+type lfsBatchResponse struct {
+	Objects []struct {
+		lfsPointer
+		Actions struct {
+			Download *struct {
+				Href   string            `json:"href"`
+				Header map[string]string `json:"header"`
+			} `json:"download"`
+		} `json:"actions"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"objects"`
+}
+
+// parseLFSPointer reports whether content is a Git LFS pointer file and returns the object it points at
+// Example:
+//
+//	version https://git-lfs.github.com/spec/v1
+//	oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
+//	size 12345
+func parseLFSPointer(content string) (lfsPointer, bool) {
+	if len(content) > lfsMaxPointerSize || !strings.HasPrefix(content, lfsPointerVersion+"\n") {
+		return lfsPointer{}, false
+	}
+
+	var pointer lfsPointer
+	for _, line := range strings.Split(content, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "oid":
+			pointer.OID = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return lfsPointer{}, false
+			}
+			pointer.Size = size
+		}
+	}
+	if len(pointer.OID) != sha256.Size*2 {
+		return lfsPointer{}, false
+	}
+	return pointer, true
+}
+
+// lfsEndpoint derives the Git LFS server URL from a repository URL. SSH remotes are
+// mapped to the HTTPS endpoint of the same host.
+// Example: git@github.com:org/repo.git -> https://github.com/org/repo.git/info/lfs
+func lfsEndpoint(repoURL string) (string, error) {
+	endpoint, err := transport.NewEndpoint(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid Git repository URL %s: %w", repoURL, err)
+	}
+
+	var base string
+	switch endpoint.Protocol {
+	case "http", "https":
+		base = strings.TrimSuffix(repoURL, "/")
+	case "ssh":
+		base = "https://" + endpoint.Host + "/" + strings.Trim(endpoint.Path, "/")
+	default:
+		return "", fmt.Errorf("git LFS is not supported for %s repositories", endpoint.Protocol)
+	}
+	if !strings.HasSuffix(base, ".git") {
+		base += ".git"
+	}
+	return base + "/info/lfs", nil
+}
+
+// fetchLFSObject downloads the object behind an LFS pointer through the batch API and
+// verifies its size and checksum. Token or password credentials are sent as basic auth.
+func fetchLFSObject(repoURL string, pointer lfsPointer, creds *GitCredentials) (content string, err error) {
+	if err := checkTemplateSize(pointer.Size); err != nil {
+		return "", fmt.Errorf("LFS object %s: %w", pointer.OID, err)
+	}
+	endpoint, err := lfsEndpoint(repoURL)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(lfsBatchRequest{
+		Operation: "download",
+		Transfers: []string{"basic"},
+		Objects:   []lfsPointer{pointer},
+		HashAlgo:  "sha256",
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode LFS batch request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create LFS batch request: %w", err)
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+	if creds != nil && creds.Password != "" {
+		req.SetBasicAuth(gitUsername(creds), creds.Password)
+	}
+
+	client := newHTTPClient()
+	debugf("Requesting LFS object %s from %s", pointer.OID, endpoint)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request LFS object: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			debugf("Failed to close LFS batch response body: %v", closeErr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP error from LFS batch API: %s", resp.Status)
+	}
+
+	var batch lfsBatchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return "", fmt.Errorf("failed to parse LFS batch response: %w", err)
+	}
+	if len(batch.Objects) != 1 {
+		return "", fmt.Errorf("LFS batch response contained %d objects, expected 1", len(batch.Objects))
+	}
+	object := batch.Objects[0]
+	if object.Error != nil {
+		return "", fmt.Errorf("LFS object %s unavailable: %s (%d)", pointer.OID, object.Error.Message, object.Error.Code)
+	}
+	if object.Actions.Download == nil {
+		return "", fmt.Errorf("LFS batch response has no download action for object %s", pointer.OID)
+	}
+
+	downloadReq, err := http.NewRequest(http.MethodGet, object.Actions.Download.Href, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create LFS download request: %w", err)
+	}
+	for key, value := range object.Actions.Download.Header {
+		downloadReq.Header.Set(key, value)
+	}
+
+	downloadResp, err := client.Do(downloadReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to download LFS object: %w", err)
+	}
+	defer func() {
+		if closeErr := downloadResp.Body.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close response body: %w", closeErr)
+		}
+	}()
+
+	if downloadResp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("HTTP error downloading LFS object: %s", downloadResp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(downloadResp.Body, pointer.Size+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read LFS object: %w", err)
+	}
+	if int64(len(data)) != pointer.Size {
+		return "", fmt.Errorf("LFS object %s has size %d, expected %d", pointer.OID, len(data), pointer.Size)
+	}
+	checksum := sha256.Sum256(data)
+	if hex.EncodeToString(checksum[:]) != pointer.OID {
+		return "", fmt.Errorf("LFS object %s failed checksum verification", pointer.OID)
+	}
+
+	debugf("Successfully downloaded LFS object %s (%d bytes)", pointer.OID, len(data))
+	return string(data), nil
+}
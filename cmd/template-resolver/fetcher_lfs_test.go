@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lfsPointerFor builds the pointer file Git LFS commits in place of content
+func lfsPointerFor(content string) (string, lfsPointer) {
+	checksum := sha256.Sum256([]byte(content))
+	pointer := lfsPointer{OID: hex.EncodeToString(checksum[:]), Size: int64(len(content))}
+	return fmt.Sprintf("%s\noid sha256:%s\nsize %d\n", lfsPointerVersion, pointer.OID, pointer.Size), pointer
+}
+
+func TestParseLFSPointer(t *testing.T) {
+	pointerFile, expected := lfsPointerFor("kind: Pipeline")
+
+	pointer, ok := parseLFSPointer(pointerFile)
+	require.True(t, ok)
+	assert.Equal(t, expected, pointer)
+
+	for _, content := range []string{
+		"kind: Pipeline",
+		lfsPointerVersion + "\noid sha256:abc\nsize 10\n",
+		lfsPointerVersion + "\noid sha256:" + expected.OID + "\nsize ten\n",
+	} {
+		_, ok := parseLFSPointer(content)
+		assert.False(t, ok, content)
+	}
+}
+
+func TestLFSEndpoint(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/org/repo":             "https://github.com/org/repo.git/info/lfs",
+		"https://gitlab.example.com/g/repo.git/":  "https://gitlab.example.com/g/repo.git/info/lfs",
+		"git@github.com:org/repo.git":             "https://github.com/org/repo.git/info/lfs",
+		"ssh://git@git.example.com:2222/org/repo": "https://git.example.com/org/repo.git/info/lfs",
+	}
+	for repoURL, expected := range tests {
+		endpoint, err := lfsEndpoint(repoURL)
+		require.NoError(t, err, repoURL)
+		assert.Equal(t, expected, endpoint, repoURL)
+	}
+
+	_, err := lfsEndpoint("/local/repository")
+	assert.Error(t, err)
+}
+
+func TestFetchLFSObject(t *testing.T) {
+	content := "apiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n  name: large-pipeline\n"
+	_, pointer := lfsPointerFor(content)
+	_, corruptPointer := lfsPointerFor("something else entirely")
+	corruptPointer.Size = int64(len(content))
+
+	creds := &GitCredentials{Username: "bot", Password: "token"}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/org/repo.git/info/lfs/objects/batch":
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, lfsMediaType, r.Header.Get("Accept"))
+			username, password, _ := r.BasicAuth()
+			assert.Equal(t, gitUsername(creds), username)
+			assert.Equal(t, creds.Password, password)
+
+			var batch lfsBatchRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+			require.Len(t, batch.Objects, 1)
+			assert.Equal(t, "download", batch.Operation)
+
+			w.Header().Set("Content-Type", lfsMediaType)
+			if batch.Objects[0].OID == "0000000000000000000000000000000000000000000000000000000000000000" {
+				_, _ = fmt.Fprintf(w, `{"objects":[{"oid":%q,"size":1,"error":{"code":404,"message":"Object does not exist"}}]}`, batch.Objects[0].OID)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"objects":[{"oid":%q,"size":%d,"actions":{"download":{"href":%q,"header":{"X-Download-Token":"signed"}}}}]}`,
+				batch.Objects[0].OID, batch.Objects[0].Size, server.URL+"/objects/"+batch.Objects[0].OID)
+		case "/objects/" + pointer.OID, "/objects/" + corruptPointer.OID:
+			assert.Equal(t, "signed", r.Header.Get("X-Download-Token"))
+			_, _ = w.Write([]byte(content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	fetched, err := fetchLFSObject(server.URL+"/org/repo", pointer, creds)
+	require.NoError(t, err)
+	assert.Equal(t, content, fetched)
+
+	_, err = fetchLFSObject(server.URL+"/org/repo", corruptPointer, creds)
+	assert.ErrorContains(t, err, "failed checksum verification")
+
+	_, err = fetchLFSObject(server.URL+"/org/repo", lfsPointer{OID: "0000000000000000000000000000000000000000000000000000000000000000", Size: 1}, creds)
+	assert.ErrorContains(t, err, "Object does not exist")
+
+	// Secrets holding only a token authenticate as git, like clones
+	creds = &GitCredentials{Password: "token"}
+	assert.Equal(t, "git", gitUsername(creds))
+	fetched, err = fetchLFSObject(server.URL+"/org/repo", pointer, creds)
+	require.NoError(t, err)
+	assert.Equal(t, content, fetched)
+}
+
+func TestCloneGitFileLFSPointer(t *testing.T) {
+	originalLFS := gitLFS
+	defer func() { gitLFS = originalLFS }()
+
+	pointerFile, _ := lfsPointerFor("kind: Pipeline")
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "large.yaml"), []byte(pointerFile), 0644))
+	_, err = worktree.Add("large.yaml")
+	require.NoError(t, err)
+	_, err = worktree.Commit("Add LFS pointer", &git.CommitOptions{
+		Author: &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+
+	// Pointers are returned as-is unless LFS is enabled
+	gitLFS = false
+	fetched, err := cloneGitFile(dir, "", "large.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, pointerFile, fetched.Content)
+
+	gitLFS = true
+	_, err = cloneGitFile(dir, "", "large.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "git LFS is not supported for file repositories")
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/credentials"
+)
+
+const (
+	// ociScheme prefixes repository values that point at an OCI registry
+	ociScheme = "oci://"
+
+	// tektonBundleNameAnnotation names the resource stored in a Tekton bundle layer
+	tektonBundleNameAnnotation = "dev.tekton.image.name"
+)
+
+// isOCIReference reports whether the repository is an OCI artifact reference
+// Example: oci://registry.example.com/templates/pipeline:v1
+func isOCIReference(repoURL string) bool {
+	return strings.HasPrefix(repoURL, ociScheme)
+}
+
+// fetchOCITemplate pulls a template out of an OCI artifact. ORAS-style artifacts are
+// matched on the layer title annotation, Tekton bundles on the resource name annotation.
+// The tag or digest comes from the reference, falling back to the revision and then "latest".
+func fetchOCITemplate(repoURL, revision, filePath string) (string, error) {
+	repo, err := remote.NewRepository(strings.TrimPrefix(repoURL, ociScheme))
+	if err != nil {
+		return "", fmt.Errorf("invalid OCI reference %s: %w", repoURL, err)
+	}
+	repo.PlainHTTP = ociPlainHTTP
+
+	store, err := credentials.NewStoreFromDocker(credentials.StoreOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to load registry credentials: %w", err)
+	}
+	repo.Client = &auth.Client{
+		Client:     newHTTPClient(),
+		Cache:      auth.NewCache(),
+		Credential: credentials.Credential(store),
+	}
+
+	reference := repo.Reference.Reference
+	if reference == "" {
+		reference = revision
+	}
+	if reference == "" {
+		reference = "latest"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), currentSettings().resolutionTimeout)
+	defer cancel()
+
+	debugf("Fetching OCI manifest %s:%s", repo.Reference.Repository, reference)
+	_, manifestBytes, err := oras.FetchBytes(ctx, repo, reference, oras.DefaultFetchBytesOptions)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch OCI manifest: %w", err)
+	}
+
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return "", fmt.Errorf("failed to parse OCI manifest: %w", err)
+	}
+
+	filePath = strings.TrimPrefix(filePath, "/")
+	for _, layer := range manifest.Layers {
+		if title := layer.Annotations[ocispec.AnnotationTitle]; title == filePath || (title != "" && title == path.Base(filePath)) {
+			if err := checkTemplateSize(layer.Size); err != nil {
+				return "", fmt.Errorf("OCI layer %s: %w", layer.Digest, err)
+			}
+			data, err := fetchOCILayer(ctx, repo, layer, readTemplate)
+			if err != nil {
+				return "", fmt.Errorf("failed to fetch OCI layer %s: %w", layer.Digest, err)
+			}
+			debugf("Successfully fetched OCI artifact file (%d bytes)", len(data))
+			return data, nil
+		}
+
+		if layer.Annotations[tektonBundleNameAnnotation] == filePath {
+			resource, err := fetchOCILayer(ctx, repo, layer, func(r io.Reader) (string, error) {
+				return readBundleLayer(layer.MediaType, r)
+			})
+			if err != nil {
+				return "", fmt.Errorf("failed to read Tekton bundle layer %s: %w", layer.Digest, err)
+			}
+			debugf("Successfully fetched Tekton bundle resource (%d bytes)", len(resource))
+			return resource, nil
+		}
+	}
+
+	return "", fmt.Errorf("template %s not found in OCI artifact %s", filePath, repoURL)
+}
+
+// fetchOCILayer streams a layer through read instead of buffering it whole, then checks
+// the digest of the layer once the rest of it has been read
+func fetchOCILayer(ctx context.Context, repo *remote.Repository, layer ocispec.Descriptor, read func(io.Reader) (string, error)) (string, error) {
+	body, err := repo.Fetch(ctx, layer)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if closeErr := body.Close(); closeErr != nil {
+			debugf("Failed to close OCI layer body: %v", closeErr)
+		}
+	}()
+
+	verifier := content.NewVerifyReader(body, layer)
+	data, err := read(verifier)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(io.Discard, verifier); err != nil {
+		return "", err
+	}
+	if err := verifier.Verify(); err != nil {
+		return "", err
+	}
+	return data, nil
+}
+
+// readBundleLayer returns the single file stored in a Tekton bundle layer tarball
+func readBundleLayer(mediaType string, reader io.Reader) (string, error) {
+	if strings.HasSuffix(mediaType, "gzip") {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return "", err
+		}
+		defer func() {
+			if closeErr := gz.Close(); closeErr != nil {
+				debugf("Failed to close gzip reader: %v", closeErr)
+			}
+		}()
+		reader = gz
+	}
+
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return "", fmt.Errorf("layer does not contain any files")
+		}
+		if err != nil {
+			return "", err
+		}
+		if header.Typeflag == tar.TypeReg {
+			if err := checkTemplateSize(header.Size); err != nil {
+				return "", err
+			}
+			return readTemplate(tr)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRegistry serves a single manifest and its blobs using the OCI distribution API
+func newTestRegistry(t *testing.T, repository, tag string, layers map[*ocispec.Descriptor][]byte) *httptest.Server {
+	blobs := map[digest.Digest][]byte{}
+	manifest := ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    ocispec.DescriptorEmptyJSON,
+	}
+	blobs[ocispec.DescriptorEmptyJSON.Digest] = ocispec.DescriptorEmptyJSON.Data
+	for desc, data := range layers {
+		desc.Digest = digest.FromBytes(data)
+		desc.Size = int64(len(data))
+		blobs[desc.Digest] = data
+		manifest.Layers = append(manifest.Layers, *desc)
+	}
+	manifestBytes, err := json.Marshal(manifest)
+	require.NoError(t, err)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/v2/"+repository+"/manifests/"+tag:
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(manifestBytes).String())
+			if _, err := w.Write(manifestBytes); err != nil {
+				t.Logf("Failed to write response: %v", err)
+			}
+		case strings.HasPrefix(r.URL.Path, "/v2/"+repository+"/blobs/"):
+			data, ok := blobs[digest.Digest(strings.TrimPrefix(r.URL.Path, "/v2/"+repository+"/blobs/"))]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if _, err := w.Write(data); err != nil {
+				t.Logf("Failed to write response: %v", err)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestFetchOCITemplate(t *testing.T) {
+	originalPlainHTTP := ociPlainHTTP
+	defer func() { ociPlainHTTP = originalPlainHTTP }()
+	ociPlainHTTP = true
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	// Tekton bundles store each resource as a tarball layer
+	var bundleLayer bytes.Buffer
+	tw := tar.NewWriter(&bundleLayer)
+	bundleContent := []byte("kind: Pipeline\nmetadata:\n  name: bundled-pipeline")
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "deploy", Mode: 0644, Size: int64(len(bundleContent)), Typeflag: tar.TypeReg}))
+	_, err := tw.Write(bundleContent)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	server := newTestRegistry(t, "templates/pipeline", "v1", map[*ocispec.Descriptor][]byte{
+		{
+			MediaType:   "application/vnd.oci.image.layer.v1.tar",
+			Annotations: map[string]string{ocispec.AnnotationTitle: "pipeline.yaml"},
+		}: []byte("kind: Pipeline\nmetadata:\n  name: oras-pipeline"),
+		{
+			MediaType:   "application/vnd.oci.image.layer.v1.tar",
+			Annotations: map[string]string{tektonBundleNameAnnotation: "deploy"},
+		}: bundleLayer.Bytes(),
+	})
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+	fetcher := &gitTemplateFetcher{}
+
+	fetched, err := fetcher.FetchTemplate("oci://"+registry+"/templates/pipeline:v1", "", "pipeline.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: oras-pipeline")
+
+	// The revision is used as the tag when the reference does not include one
+	fetched, err = fetcher.FetchTemplate("oci://"+registry+"/templates/pipeline", "v1", "deploy", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: bundled-pipeline")
+
+	_, err = fetcher.FetchTemplate("oci://"+registry+"/templates/pipeline:v1", "", "missing.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "not found in OCI artifact")
+
+	_, err = fetcher.FetchTemplate("oci://"+registry+"/templates/pipeline:v2", "", "pipeline.yaml", FetchOptions{})
+	assert.Error(t, err)
+}
+
+func TestFetchOCITemplateVerifiesDigest(t *testing.T) {
+	originalPlainHTTP := ociPlainHTTP
+	defer func() { ociPlainHTTP = originalPlainHTTP }()
+	ociPlainHTTP = true
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	registry := newTestRegistry(t, "templates/pipeline", "v1", map[*ocispec.Descriptor][]byte{
+		{
+			MediaType:   "application/vnd.oci.image.layer.v1.tar",
+			Annotations: map[string]string{ocispec.AnnotationTitle: "pipeline.yaml"},
+		}: []byte("kind: Pipeline"),
+	})
+	defer registry.Close()
+
+	// Layers are streamed, and content that does not match the digest is still rejected
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/blobs/") && r.URL.Path != "/v2/templates/pipeline/blobs/"+ocispec.DescriptorEmptyJSON.Digest.String() {
+			_, _ = w.Write([]byte("kind: Tampered"))
+			return
+		}
+		resp, err := http.Get(registry.URL + r.URL.Path)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		for key, values := range resp.Header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	defer server.Close()
+
+	fetcher := &gitTemplateFetcher{}
+	_, err := fetcher.FetchTemplate("oci://"+strings.TrimPrefix(server.URL, "http://")+"/templates/pipeline:v1", "", "pipeline.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "mismatch")
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// s3Scheme prefixes repository values that point at an S3 bucket
+const s3Scheme = "s3://"
+
+// s3ExpiredCredentialCodes are the S3 error codes of requests signed with credentials that
+// expired, or were revoked, before the credentials cache refreshed them
+var s3ExpiredCredentialCodes = map[string]bool{
+	"ExpiredToken":          true,
+	"ExpiredTokenException": true,
+	"TokenRefreshRequired":  true,
+}
+
+// awsConfig is loaded once and shared by all S3 fetches, so the credentials cache of the
+// default chain reuses IRSA and instance profile credentials and refreshes them before they
+// expire, instead of every fetch exchanging the web identity token again
+var awsConfig struct {
+	mu  sync.Mutex
+	cfg *aws.Config
+}
+
+// isS3URL reports whether the repository points at an S3 bucket
+// Example: s3://pipeline-templates/team-a
+func isS3URL(repoURL string) bool {
+	return strings.HasPrefix(repoURL, s3Scheme)
+}
+
+// fetchS3Template reads a template object from S3. The path in the repository URL is
+// used as a key prefix and the revision, when set, selects an object version.
+// Credentials come from the default AWS chain, which covers IRSA web identity tokens,
+// instance profiles and static environment credentials. A request rejected because its
+// credentials expired is retried once with refreshed credentials.
+func fetchS3Template(repoURL, revision, filePath string) (content string, err error) {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid S3 repository URL, expected s3://bucket/prefix: %s", repoURL)
+	}
+	bucket := u.Host
+	key := path.Join(strings.Trim(u.Path, "/"), strings.TrimPrefix(filePath, "/"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), currentSettings().resolutionTimeout)
+	defer cancel()
+
+	cfg, err := loadAWSConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		// Custom endpoints (VPC endpoints, MinIO) generally require path-style addressing
+		if s3Endpoint != "" {
+			o.BaseEndpoint = aws.String(s3Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if revision != "" {
+		input.VersionId = aws.String(revision)
+	}
+
+	debugf("Fetching S3 object s3://%s/%s", bucket, key)
+	out, err := client.GetObject(ctx, input)
+	if err != nil && s3CredentialsExpired(err) {
+		debugf("S3 rejected expired credentials, retrying with refreshed credentials: %v", err)
+		if credentials, ok := cfg.Credentials.(*aws.CredentialsCache); ok {
+			credentials.Invalidate()
+		}
+		out, err = client.GetObject(ctx, input)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch S3 object s3://%s/%s: %w", bucket, key, err)
+	}
+	defer func() {
+		if closeErr := out.Body.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close S3 object body: %w", closeErr)
+		}
+	}()
+
+	if out.ContentLength != nil {
+		if err := checkTemplateSize(*out.ContentLength); err != nil {
+			return "", fmt.Errorf("S3 object s3://%s/%s: %w", bucket, key, err)
+		}
+	}
+	body, err := readTemplate(out.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read S3 object content: %w", err)
+	}
+
+	debugf("Successfully fetched S3 object (%d bytes)", len(body))
+	return body, nil
+}
+
+// loadAWSConfig returns the shared AWS configuration, loading it on first use. A failed
+// load is not kept, so the next fetch tries again.
+func loadAWSConfig(ctx context.Context) (aws.Config, error) {
+	awsConfig.mu.Lock()
+	defer awsConfig.mu.Unlock()
+	if awsConfig.cfg != nil {
+		return *awsConfig.cfg, nil
+	}
+
+	// The SDK needs its own buildable client to apply AWS_CA_BUNDLE. It is created once
+	// with the shared configuration, so its connections are pooled like newHTTPClient's.
+	httpClient := awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		tr.Proxy = proxyFromConfig
+		tr.MaxIdleConnsPerHost = httpMaxIdlePerHost
+	})
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithHTTPClient(httpClient))
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	awsConfig.cfg = &cfg
+	return cfg, nil
+}
+
+// s3CredentialsExpired reports whether S3 rejected a request because its credentials expired
+func s3CredentialsExpired(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && s3ExpiredCredentialCodes[apiErr.ErrorCode()]
+}
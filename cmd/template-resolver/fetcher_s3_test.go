@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchS3Template(t *testing.T) {
+	originalEndpoint := s3Endpoint
+	defer func() { s3Endpoint = originalEndpoint }()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-access-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret-key")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_CONFIG_FILE", t.TempDir()+"/config")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", t.TempDir()+"/credentials")
+	awsConfig.cfg = nil
+	defer func() { awsConfig.cfg = nil }()
+
+	var expired atomic.Bool
+	expired.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/pipeline-templates/expired.yaml" && expired.CompareAndSwap(true, false) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>ExpiredToken</Code><Message>The provided token has expired.</Message></Error>`))
+			return
+		}
+		if r.URL.Path == "/pipeline-templates/expired.yaml" {
+			_, _ = w.Write([]byte("kind: Task"))
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/pipeline-templates/team-a/pipelines/deploy.yaml" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+			return
+		}
+		_, err := w.Write([]byte("kind: Pipeline\nmetadata:\n  name: s3-" + r.URL.Query().Get("versionId")))
+		if err != nil {
+			t.Logf("Failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+	s3Endpoint = server.URL
+
+	fetcher := &gitTemplateFetcher{}
+
+	fetched, err := fetcher.FetchTemplate("s3://pipeline-templates/team-a", "", "pipelines/deploy.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: s3-")
+
+	fetched, err = fetcher.FetchTemplate("s3://pipeline-templates/team-a/", "v42", "/pipelines/deploy.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, fetched.Content, "name: s3-v42")
+
+	_, err = fetcher.FetchTemplate("s3://pipeline-templates/team-a", "", "missing.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "NoSuchKey")
+
+	// Requests rejected with expired credentials are retried once
+	fetched, err = fetcher.FetchTemplate("s3://pipeline-templates", "", "expired.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Task", fetched.Content)
+	assert.False(t, expired.Load())
+
+	_, err = fetcher.FetchTemplate("s3:///no-bucket", "", "missing.yaml", FetchOptions{})
+	assert.ErrorContains(t, err, "invalid S3 repository URL")
+}
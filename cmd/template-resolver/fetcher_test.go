@@ -66,22 +66,22 @@ func TestGitFetcherFetchTemplate(t *testing.T) {
 	}
 	
 	// Test GitHub URL
-	content, err := fetcher.FetchTemplate(server.URL+"/example/repo", "path/to/template.yaml")
+	fetched, err := fetcher.FetchTemplate(server.URL+"/example/repo", "", "path/to/template.yaml", FetchOptions{})
 	assert.NoError(t, err)
-	assert.Contains(t, content, "name: test-pipeline")
+	assert.Contains(t, fetched.Content, "name: test-pipeline")
 	
 	// Test Gist URL with filename
-	content, err = fetcher.FetchTemplate("https://gist.github.com/user/gistid", "path/to/template.yaml")
+	fetched, err = fetcher.FetchTemplate("https://gist.github.com/user/gistid", "", "path/to/template.yaml", FetchOptions{})
 	assert.NoError(t, err)
-	assert.Contains(t, content, "name: gist-template")
+	assert.Contains(t, fetched.Content, "name: gist-template")
 	
 	// Test Gist URL without filename (single-file gist)
-	content, err = fetcher.FetchTemplate("https://gist.github.com/user/gistid", "single-file.yaml")
+	fetched, err = fetcher.FetchTemplate("https://gist.github.com/user/gistid", "", "single-file.yaml", FetchOptions{})
 	assert.NoError(t, err)
-	assert.Contains(t, content, "name: gist-single-file")
+	assert.Contains(t, fetched.Content, "name: gist-single-file")
 	
 	// Test invalid Gist URL
-	_, err = fetcher.FetchTemplate("https://gist.github.com/invalid", "file.yaml")
+	_, err = fetcher.FetchTemplate("https://gist.github.com/invalid", "", "file.yaml", FetchOptions{})
 	assert.Error(t, err)
 }
 
@@ -92,7 +92,7 @@ type testTemplateFetcher struct {
 }
 
 // FetchTemplate implements TemplateFetcher for testing
-func (t *testTemplateFetcher) FetchTemplate(repoURL, filePath string) (string, error) {
+func (t *testTemplateFetcher) FetchTemplate(repoURL, revision, filePath string, opts FetchOptions) (*FetchedTemplate, error) {
 	if strings.HasPrefix(repoURL, t.server.URL) {
 		// Convert to raw GitHub URL for our test server
 		fileURL := strings.Replace(repoURL, t.server.URL, t.server.URL, 1)
@@ -103,7 +103,7 @@ func (t *testTemplateFetcher) FetchTemplate(repoURL, filePath string) (string, e
 		
 		resp, err := http.Get(fileURL)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		defer func() {
 			closeErr := resp.Body.Close()
@@ -113,18 +113,18 @@ func (t *testTemplateFetcher) FetchTemplate(repoURL, filePath string) (string, e
 		}()
 		
 		if resp.StatusCode != http.StatusOK {
-			return "", fmt.Errorf("HTTP error: %s", resp.Status)
+			return nil, fmt.Errorf("HTTP error: %s", resp.Status)
 		}
 		
 		content, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		
-		return string(content), nil
+		return &FetchedTemplate{Content: string(content)}, nil
 	} else if strings.HasPrefix(repoURL, "https://gist.github.com/") {
 		if repoURL == "https://gist.github.com/invalid" {
-			return "", fmt.Errorf("invalid Gist URL format: %s", repoURL)
+			return nil, fmt.Errorf("invalid Gist URL format: %s", repoURL)
 		}
 		
 		// For gist URLs, use our mock server but with the right path structure
@@ -137,7 +137,7 @@ func (t *testTemplateFetcher) FetchTemplate(repoURL, filePath string) (string, e
 		
 		resp, err := http.Get(rawURL)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		defer func() {
 			closeErr := resp.Body.Close()
@@ -147,30 +147,79 @@ func (t *testTemplateFetcher) FetchTemplate(repoURL, filePath string) (string, e
 		}()
 		
 		if resp.StatusCode != http.StatusOK {
-			return "", fmt.Errorf("HTTP error: %s", resp.Status)
+			return nil, fmt.Errorf("HTTP error: %s", resp.Status)
 		}
 		
 		content, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		
-		return string(content), nil
+		return &FetchedTemplate{Content: string(content)}, nil
 	}
 	
 	// For Git repositories, create a fake repo with the template
 	templateDir := filepath.Join(t.tempDir, filePath)
 	err := os.MkdirAll(filepath.Dir(templateDir), 0755)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	
 	// Write a test template file
 	template := "apiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n  name: git-template"
 	err = os.WriteFile(templateDir, []byte(template), 0644)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	
-	return template, nil
-}
\ No newline at end of file
+	return &FetchedTemplate{Content: template}, nil
+}
+func TestFetchGitHubRawFileConditionalGet(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("kind: Pipeline"))
+	}))
+	defer server.Close()
+
+	cache := newMemoryCache()
+	for i := 0; i < 2; i++ {
+		content, err := fetchGitHubRawFile(cache, "https://github.com/example/repo", server.URL+"/example/repo/main/pipeline.yaml")
+		require.NoError(t, err)
+		assert.Equal(t, "kind: Pipeline", content)
+	}
+	assert.Equal(t, 2, requests)
+
+	// Without a cache requests are unconditional
+	content, err := fetchGitHubRawFile(nil, "https://github.com/example/repo", server.URL+"/example/repo/main/pipeline.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Pipeline", content)
+}
+
+func TestFetchBackend(t *testing.T) {
+	originalToken := githubToken
+	defer func() { githubToken = originalToken }()
+	githubToken = ""
+
+	assert.Equal(t, "file", fetchBackend("file:///templates", FetchOptions{}))
+	assert.Equal(t, "oci", fetchBackend("oci://registry.example.com/templates:v1", FetchOptions{}))
+	assert.Equal(t, "s3", fetchBackend("s3://pipeline-templates/team-a", FetchOptions{}))
+	assert.Equal(t, "azure", fetchBackend("az://account/container", FetchOptions{}))
+	assert.Equal(t, "gist", fetchBackend("https://gist.github.com/user/abc123", FetchOptions{}))
+	assert.Equal(t, "gitlab", fetchBackend("https://gitlab.com/org/repo", FetchOptions{}))
+	assert.Equal(t, "gitea", fetchBackend("https://codeberg.org/org/repo", FetchOptions{}))
+	assert.Equal(t, "github-raw", fetchBackend("https://github.com/org/repo", FetchOptions{}))
+	assert.Equal(t, "git", fetchBackend("git@github.com:org/repo.git", FetchOptions{}))
+	assert.Equal(t, "git", fetchBackend("https://git.example.com/repo.git", FetchOptions{}))
+
+	// Credentials and submodules change how GitHub repositories are read
+	assert.Equal(t, "github-api", fetchBackend("https://github.com/org/repo", FetchOptions{Credentials: &GitCredentials{Password: "token"}}))
+	assert.Equal(t, "git", fetchBackend("https://github.com/org/repo", FetchOptions{Submodules: SubmodulesFull}))
+	githubToken = "token"
+	assert.Equal(t, "github-api", fetchBackend("git@github.com:org/repo.git", FetchOptions{}))
+}
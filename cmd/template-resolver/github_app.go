@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// githubAppJWTLifetime is how long the JWTs authenticating as the App are valid; GitHub
+// accepts at most 10 minutes
+const githubAppJWTLifetime = 9 * time.Minute
+
+// githubApp mints installation tokens when the resolver authenticates as a GitHub App,
+// nil when it does not
+var githubApp *githubAppTokenSource
+
+// githubAppTokenSource mints installation access tokens of a GitHub App and reuses them
+// until shortly before they expire
+type githubAppTokenSource struct {
+	appID          string
+	installationID string
+	key            *rsa.PrivateKey
+	tokens         tokenCache
+}
+
+// loadGitHubApp creates the token source of the GitHub App configured with GITHUB_APP_ID,
+// GITHUB_APP_INSTALLATION_ID and GITHUB_APP_PRIVATE_KEY_FILE, or returns nil when no App is
+// configured
+func loadGitHubApp(appID, installationID, keyFile string) (*githubAppTokenSource, error) {
+	if appID == "" {
+		return nil, nil
+	}
+	if installationID == "" || keyFile == "" {
+		return nil, fmt.Errorf("%s requires %s and %s", EnvGitHubAppID, EnvGitHubInstallID, EnvGitHubAppKeyFile)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+	}
+	key, err := parseRSAPrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub App private key %s: %w", keyFile, err)
+	}
+	source := &githubAppTokenSource{appID: appID, installationID: installationID, key: key}
+	source.tokens.mint = source.mintToken
+	return source, nil
+}
+
+// parseRSAPrivateKey parses a PEM encoded RSA key in the PKCS #1 format GitHub generates,
+// or in PKCS #8
+func parseRSAPrivateKey(keyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("expected an RSA key, got %T", parsed)
+	}
+	return key, nil
+}
+
+// Token returns an installation token, minting a new one shortly before the current one
+// expires
+func (s *githubAppTokenSource) Token() (string, error) {
+	return s.tokens.Token()
+}
+
+// mintToken exchanges a JWT signed with the App's private key for an installation token
+func (s *githubAppTokenSource) mintToken() (token string, expires time.Time, err error) {
+	jwt, err := s.signJWT(time.Now())
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	// Example: https://api.github.com/app/installations/12345/access_tokens
+	tokenURL := fmt.Sprintf("%s/app/installations/%s/access_tokens",
+		strings.TrimSuffix(githubAPIURL, "/"), url.PathEscape(s.installationID))
+	req, err := http.NewRequest(http.MethodPost, tokenURL, nil)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create GitHub App token request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+
+	resp, err := newHTTPClient().Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to request GitHub App installation token: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close response body: %w", closeErr)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusCreated {
+		return "", time.Time{}, fmt.Errorf("HTTP error minting GitHub App installation token: %s", resp.Status)
+	}
+	var body struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse GitHub App installation token: %w", err)
+	}
+	if body.Token == "" {
+		return "", time.Time{}, fmt.Errorf("GitHub App installation token response has no token")
+	}
+	debugf("Minted GitHub App installation token expiring at %s", body.ExpiresAt.Format(time.RFC3339))
+	return body.Token, body.ExpiresAt, nil
+}
+
+// signJWT creates the RS256 JWT authenticating as the App. It is issued a minute in the
+// past to allow for clock drift, as GitHub recommends.
+func (s *githubAppTokenSource) signJWT(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(githubAppJWTLifetime).Unix(),
+		"iss": s.appID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// githubAuthToken returns the token sent to the GitHub API: an installation token when the
+// resolver authenticates as a GitHub App, GITHUB_TOKEN otherwise
+func githubAuthToken() (string, error) {
+	if githubApp != nil {
+		return githubApp.Token()
+	}
+	return githubToken, nil
+}
+
+// githubHost reports whether host serves the Git repositories of the GitHub instance of
+// GITHUB_API_URL, so clones from it can use the App's installation token.
+// Example: https://github.example.com/api/v3 -> github.example.com
+func githubHost(host string) bool {
+	if host == "github.com" {
+		return true
+	}
+	apiURL, err := url.Parse(githubAPIURL)
+	return err == nil && apiURL.Host != "api.github.com" && apiURL.Hostname() == host
+}
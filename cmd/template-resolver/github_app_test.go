@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// githubAppServer fakes the installation token endpoint of GitHub, checking the JWT signed
+// with key and handing out tokens valid for lifetime
+func githubAppServer(t *testing.T, key *rsa.PrivateKey, lifetime time.Duration, minted *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/app/installations/42/access_tokens":
+			jwt, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			require.True(t, ok)
+			parts := strings.Split(jwt, ".")
+			require.Len(t, parts, 3)
+			signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+			require.NoError(t, err)
+			digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			if rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature) != nil {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+			require.NoError(t, err)
+			assert.Contains(t, string(claims), `"iss":"1234"`)
+
+			n := minted.Add(1)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"token":      fmt.Sprintf("installation-token-%d", n),
+				"expires_at": time.Now().Add(lifetime).UTC().Format(time.RFC3339),
+			})
+		case r.URL.Path == "/repos/acme/templates/commits/main":
+			w.WriteHeader(http.StatusNotFound)
+		case r.URL.Path == "/repos/acme/templates/contents/pipeline.yaml":
+			if r.Header.Get("Authorization") != "Bearer installation-token-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte("kind: Pipeline"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func writeGitHubAppKey(t *testing.T) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "app.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+	return key, keyFile
+}
+
+func TestGitHubAppToken(t *testing.T) {
+	originalApp, originalURL := githubApp, githubAPIURL
+	defer func() { githubApp, githubAPIURL = originalApp, originalURL }()
+
+	key, keyFile := writeGitHubAppKey(t)
+	var minted atomic.Int32
+	server := githubAppServer(t, key, time.Hour, &minted)
+	defer server.Close()
+	githubAPIURL = server.URL
+
+	app, err := loadGitHubApp("1234", "42", keyFile)
+	require.NoError(t, err)
+	githubApp = app
+
+	// Tokens are reused until shortly before they expire
+	token, err := githubAuthToken()
+	require.NoError(t, err)
+	assert.Equal(t, "installation-token-1", token)
+	token, err = githubAuthToken()
+	require.NoError(t, err)
+	assert.Equal(t, "installation-token-1", token)
+	assert.Equal(t, int32(1), minted.Load())
+
+	fetched, err := fetchGitHubContents("acme", "templates", "", "pipeline.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Pipeline", fetched.Content)
+
+	auth, err := gitAuth("https://github.com/acme/templates.git", nil)
+	require.NoError(t, err)
+	assert.Equal(t, &githttp.BasicAuth{Username: "x-access-token", Password: "installation-token-1"}, auth)
+	auth, err = gitAuth("https://gitlab.com/acme/templates.git", nil)
+	require.NoError(t, err)
+	assert.Nil(t, auth)
+
+	app.tokens.expires = time.Now().Add(tokenRefreshMargin - time.Second)
+	token, err = githubAuthToken()
+	require.NoError(t, err)
+	assert.Equal(t, "installation-token-2", token)
+}
+
+func TestGitHubAppTokenRejected(t *testing.T) {
+	originalURL := githubAPIURL
+	defer func() { githubAPIURL = originalURL }()
+
+	_, keyFile := writeGitHubAppKey(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	var minted atomic.Int32
+	server := githubAppServer(t, otherKey, time.Hour, &minted)
+	defer server.Close()
+	githubAPIURL = server.URL
+
+	app, err := loadGitHubApp("1234", "42", keyFile)
+	require.NoError(t, err)
+	_, err = app.Token()
+	assert.ErrorContains(t, err, "HTTP error minting GitHub App installation token: 401")
+}
+
+func TestLoadGitHubApp(t *testing.T) {
+	app, err := loadGitHubApp("", "", "")
+	require.NoError(t, err)
+	assert.Nil(t, app)
+
+	_, err = loadGitHubApp("1234", "", "")
+	assert.ErrorContains(t, err, "GITHUB_APP_ID requires GITHUB_APP_INSTALLATION_ID and GITHUB_APP_PRIVATE_KEY_FILE")
+
+	invalid := filepath.Join(t.TempDir(), "invalid.pem")
+	require.NoError(t, os.WriteFile(invalid, []byte("not a key"), 0o600))
+	_, err = loadGitHubApp("1234", "42", invalid)
+	assert.ErrorContains(t, err, "no PEM data found")
+}
+
+func TestGitHubHost(t *testing.T) {
+	originalURL := githubAPIURL
+	defer func() { githubAPIURL = originalURL }()
+
+	githubAPIURL = DefaultGitHubAPIURL
+	assert.True(t, githubHost("github.com"))
+	assert.False(t, githubHost("api.github.com"))
+	assert.False(t, githubHost("github.example.com"))
+
+	githubAPIURL = "https://github.example.com/api/v3"
+	assert.True(t, githubHost("github.example.com"))
+}
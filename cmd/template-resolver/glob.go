@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"github.com/tektoncd/pipeline/pkg/resolution/resolver/framework"
+	"sigs.k8s.io/yaml"
+)
+
+// maxGlobTemplates limits how many files a glob path can render
+const maxGlobTemplates = 50
+
+// listedTemplatesKey holds the files listed for a glob path in the context of the
+// resolutions of the files, so they are read from the listing instead of fetched again
+type listedTemplatesKey struct{}
+
+// listedTemplates are the files listed for a glob path, from a repository at a revision
+type listedTemplates struct {
+	repository string
+	revision   string
+	listing    *TemplateListing
+}
+
+// listedTemplate returns a file listed for a glob path when ctx holds the listing of the
+// repository and revision it is read from
+func listedTemplate(ctx context.Context, repository, revision, templatePath string) (*FetchedTemplate, bool) {
+	listed, ok := ctx.Value(listedTemplatesKey{}).(listedTemplates)
+	if !ok || listed.repository != repository || listed.revision != revision {
+		return nil, false
+	}
+	content, ok := listed.listing.Files[templatePath]
+	if !ok {
+		return nil, false
+	}
+	return &FetchedTemplate{Content: content, Commit: listed.listing.Commit}, true
+}
+
+// isGlobPath reports whether a template path holds a glob, such as pipelines/stages/*.yaml
+func isGlobPath(templatePath string) bool {
+	return strings.ContainsAny(templatePath, "*?[")
+}
+
+// resolveGlob resolves a glob path: the matching files are rendered and merged by
+// renderGlob, and the result is finished like the result of a single template. Results are
+// not cached, since files matching the glob can be added at any time.
+func (r *resolver) resolveGlob(ctx context.Context, request provenanceRequest, kustomization string, declare bool, opts FetchOptions) (framework.ResolvedResource, error) {
+	rendered, fetched, err := r.renderGlob(ctx, request.repository, request.revision, request.path, request.params, opts)
+	if err != nil {
+		return nil, err
+	}
+	if rendered, err = r.finishRender(ctx, rendered, request.repository, request.revision, kustomization, request.params, declare, opts); err != nil {
+		return nil, err
+	}
+
+	data := []byte(rendered)
+	annotations := addRenderAnnotations(cacheHintAnnotations(request.revision, false), fetched, request.revision, false)
+	if !isNestedResolution(ctx) {
+		request.fetched, request.rendered = fetched, data
+		if annotations, err = addProvenanceAnnotations(ctx, annotations, request); err != nil {
+			return nil, err
+		}
+	}
+	return &templateResource{
+		data:        data,
+		source:      &pipelinev1.RefSource{URI: request.repository, EntryPoint: request.path, Digest: sourceDigest(fetched, data)},
+		annotations: annotations,
+		fetched:     fetched,
+	}, nil
+}
+
+// renderGlob renders every file matching a glob path with the params of the request, in
+// path order. The files are listed and read once, at the commit the revision resolves to,
+// and each is resolved like a template of its own at that commit, with its own schema and
+// values, so partials and bases come from the same commit. For a ResolutionRequest the
+// documents they render are merged by mergeGlobDocuments; for another template the results
+// are concatenated, so files rendering a few tasks each are spliced in together. The
+// returned template holds the contents of the files one after another, and the commit they
+// were read at.
+func (r *resolver) renderGlob(ctx context.Context, repository, revision, pattern string, params []pipelinev1.Param, opts FetchOptions) (string, *FetchedTemplate, error) {
+	lister, ok := r.fetcher.(TemplateLister)
+	if !ok {
+		return "", nil, fmt.Errorf("template path %s is a glob, but templates cannot be listed", pattern)
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	if _, err := path.Match(pattern, ""); err != nil {
+		return "", nil, fmt.Errorf("invalid glob path %s: %w", pattern, err)
+	}
+	chain := append(slices.Clone(resolutionChain(ctx)), templateLocation(repository, revision, pattern))
+	if len(chain) >= maxNestedDepth {
+		return "", nil, fmt.Errorf("templates are nested more than %d levels deep: %s", maxNestedDepth, strings.Join(chain, " -> "))
+	}
+
+	started := time.Now()
+	listing, err := lister.ListTemplates(repository, revision, pattern, opts)
+	observeFetch(repository, opts, started)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to list the templates matching %s: %w", pattern, err)
+	}
+	files := slices.Sorted(maps.Keys(listing.Files))
+	switch {
+	case len(files) == 0:
+		return "", nil, fmt.Errorf("no templates match %s", pattern)
+	case len(files) > maxGlobTemplates:
+		return "", nil, fmt.Errorf("%d templates match %s, at most %d can be rendered", len(files), pattern, maxGlobTemplates)
+	}
+	debugContextf(ctx, "Rendering the templates matching %s: %s", pattern, strings.Join(files, ", "))
+
+	// The kustomization applies to the merged result, not to each file
+	base := slices.DeleteFunc(slices.Clone(params), func(param pipelinev1.Param) bool {
+		return param.Name == PathParam || param.Name == KustomizationParam || param.Name == RevisionParam
+	})
+	if listing.Commit != "" {
+		revision = listing.Commit
+	}
+	if revision != "" {
+		base = append(base, pipelinev1.Param{Name: RevisionParam, Value: *pipelinev1.NewStructuredValues(revision)})
+	}
+	nested := isNestedResolution(ctx)
+	fileCtx := context.WithValue(ctx, nestedResolutionKey{}, chain)
+	fileCtx = context.WithValue(fileCtx, listedTemplatesKey{}, listedTemplates{repository: repository, revision: revision, listing: listing})
+	var results, sources []string
+	for _, file := range files {
+		fileParams := append(slices.Clone(base), pipelinev1.Param{Name: PathParam, Value: *pipelinev1.NewStructuredValues(file)})
+		resource, err := r.Resolve(fileCtx, fileParams)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to resolve template %s: %w", file, err)
+		}
+		results = append(results, string(resource.Data()))
+		sources = append(sources, listing.Files[file])
+	}
+	fetched := &FetchedTemplate{Content: strings.Join(sources, ""), Commit: listing.Commit}
+
+	if nested {
+		for i, result := range results {
+			results[i] = strings.TrimRight(result, "\n")
+		}
+		return strings.Join(results, "\n"), fetched, nil
+	}
+	merged, err := mergeGlobDocuments(ctx, results)
+	if err != nil {
+		return "", nil, err
+	}
+	return merged, fetched, nil
+}
+
+// mergeGlobDocuments joins the documents rendered by the files matching a glob path, in
+// order, so they can be combined like the documents of a single template. Pipelines
+// rendered by several files are merged into the first one with mergePipeline, so each file
+// can contribute the tasks of a stage.
+func mergeGlobDocuments(ctx context.Context, results []string) (string, error) {
+	var documents []string
+	for _, result := range results {
+		documents = append(documents, splitYAMLDocuments(result)...)
+	}
+
+	var pipeline map[string]interface{}
+	var first int
+	var combined bool
+	merged := documents[:0]
+	for _, document := range documents {
+		var object map[string]interface{}
+		if err := yaml.Unmarshal([]byte(document), &object); err != nil || object["kind"] != "Pipeline" {
+			// Other documents are combined, and invalid ones reported, by combineDocuments
+			merged = append(merged, document)
+			continue
+		}
+		if pipeline == nil {
+			pipeline, first = object, len(merged)
+			merged = append(merged, document)
+			continue
+		}
+		if err := mergePipeline(pipeline, object); err != nil {
+			return "", err
+		}
+		combined = true
+	}
+
+	if combined {
+		debugContextf(ctx, "Merging the Pipelines rendered by the templates into one")
+		encoded, err := yaml.Marshal(pipeline)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode the merged Pipeline: %w", err)
+		}
+		merged[first] = string(encoded)
+	}
+	return joinYAMLDocuments(merged), nil
+}
+
+// mergePipeline merges a Pipeline rendered by another file into the one rendered first. The
+// lists of its spec, such as tasks, finally, params, workspaces and results, are appended,
+// and its labels and annotations added. Items declared by both with the same name must be
+// identical, and other fields are kept from the first Pipeline.
+func mergePipeline(into, from map[string]interface{}) error {
+	intoMetadata, _ := into["metadata"].(map[string]interface{})
+	fromMetadata, _ := from["metadata"].(map[string]interface{})
+	for _, field := range []string{"labels", "annotations"} {
+		values, _ := fromMetadata[field].(map[string]interface{})
+		if len(values) == 0 || intoMetadata == nil {
+			continue
+		}
+		existing, _ := intoMetadata[field].(map[string]interface{})
+		if existing == nil {
+			existing = map[string]interface{}{}
+			intoMetadata[field] = existing
+		}
+		for key, value := range values {
+			if _, ok := existing[key]; !ok {
+				existing[key] = value
+			}
+		}
+	}
+
+	fromSpec, _ := from["spec"].(map[string]interface{})
+	if len(fromSpec) == 0 {
+		return nil
+	}
+	intoSpec, _ := into["spec"].(map[string]interface{})
+	if intoSpec == nil {
+		intoSpec = map[string]interface{}{}
+		into["spec"] = intoSpec
+	}
+	keys := make([]string, 0, len(fromSpec))
+	for key := range fromSpec {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		existing, ok := intoSpec[key]
+		if !ok {
+			intoSpec[key] = fromSpec[key]
+			continue
+		}
+		existingItems, isList := existing.([]interface{})
+		items, ok := fromSpec[key].([]interface{})
+		if !isList || !ok {
+			continue
+		}
+		for _, item := range items {
+			name := listItemName(item)
+			i := slices.IndexFunc(existingItems, func(existingItem interface{}) bool {
+				return name != "" && listItemName(existingItem) == name
+			})
+			switch {
+			case i < 0:
+				existingItems = append(existingItems, item)
+			case !reflect.DeepEqual(existingItems[i], item):
+				return fmt.Errorf("templates declare different %s named %q in the Pipeline", key, name)
+			}
+		}
+		intoSpec[key] = existingItems
+	}
+	return nil
+}
+
+// listItemName returns the name of an item of a list in a Pipeline spec, empty when it has none
+func listItemName(item interface{}) string {
+	object, _ := item.(map[string]interface{})
+	name, _ := object["name"].(string)
+	return name
+}
+
+// joinYAMLDocuments joins YAML documents with --- separators
+func joinYAMLDocuments(documents []string) string {
+	var joined strings.Builder
+	for i, document := range documents {
+		if i > 0 {
+			joined.WriteString("---\n")
+		}
+		joined.WriteString(document)
+		if !strings.HasSuffix(document, "\n") {
+			joined.WriteString("\n")
+		}
+	}
+	return joined.String()
+}
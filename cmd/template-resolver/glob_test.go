@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// listingFetcher serves the templates of a notFoundFetcher, lists them for glob paths at
+// commit, and records the revisions and paths fetched
+type listingFetcher struct {
+	notFoundFetcher
+	commit  string
+	fetched []string
+}
+
+func (f *listingFetcher) FetchTemplate(repo, revision, path string, opts FetchOptions) (*FetchedTemplate, error) {
+	f.fetched = append(f.fetched, revision+":"+path)
+	return f.notFoundFetcher.FetchTemplate(repo, revision, path, opts)
+}
+
+func (f *listingFetcher) ListTemplates(repo, revision, pattern string, opts FetchOptions) (*TemplateListing, error) {
+	listing := &TemplateListing{Files: map[string]string{}, Commit: f.commit}
+	for key, content := range f.templates {
+		if name, ok := strings.CutPrefix(key, repo+":"); ok {
+			if matched, _ := path.Match(pattern, name); matched {
+				listing.Files[name] = content
+			}
+		}
+	}
+	return listing, nil
+}
+
+func TestResolverGlobPath(t *testing.T) {
+	fetcher := &listingFetcher{commit: "4b825dc642cb6eb9a060e54bf8d69288fbee4904", notFoundFetcher: notFoundFetcher{templates: map[string]string{
+		"repo1:stages/00-pipeline.yaml": `---
+params:
+  - name: app-name
+    required: true
+---
+apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: {{ .AppName }}
+  labels:
+    app: {{ .AppName }}
+spec:
+  params:
+    - name: app-name
+  workspaces:
+    - name: source
+`,
+		"repo1:stages/10-build.yaml": `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: {{ .AppName }}
+  labels:
+    stage: build
+spec:
+  tasks:
+    - name: build
+      taskRef:
+        name: build
+      workspaces:
+        - name: source
+          workspace: source
+---
+apiVersion: tekton.dev/v1
+kind: Task
+metadata:
+  name: build
+spec:
+  workspaces:
+    - name: source
+  steps:
+    - name: build
+      image: golang
+`,
+		"repo1:stages/20-test.yaml": `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: {{ .AppName }}
+spec:
+  params:
+    - name: app-name
+  tasks:
+    - name: test
+      runAfter: [build]
+      taskRef:
+        name: go-test
+`,
+		"repo1:stages/README.md":     "Stages of the pipeline",
+		"repo1:conflict/a.yaml":      "apiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n  name: a\nspec:\n  params:\n    - name: env\n",
+		"repo1:conflict/b.yaml":      "apiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n  name: a\nspec:\n  params:\n    - name: env\n      default: dev\n",
+		"repo1:library.yaml":         "---\ntemplates:\n  - name: tasks\n    path: library/*.yaml\n---\napiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n  name: library\nspec:\n  tasks:\n{{ .Templates.tasks | indent 4 }}\n",
+		"repo1:library/lint.yaml":    "- name: lint\n  taskRef:\n    name: golangci-lint",
+		"repo1:library/format.yaml":  "- name: format\n  taskRef:\n    name: gofmt\n",
+		"repo1:deploy/prod.yaml":     "apiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n  name: prod\nspec:\n  tasks:\n{{ include \"partials/deploy\" . | indent 4 }}\n",
+		"repo1:partials/deploy.yaml": "- name: deploy\n  taskRef:\n    name: deploy",
+	}}}
+	r := &resolver{fetcher: fetcher}
+	resolve := func(path string) (string, error) {
+		resource, err := r.Resolve(context.Background(), []pipelinev1.Param{
+			{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("repo1")},
+			{Name: PathParam, Value: *pipelinev1.NewStructuredValues(path)},
+			{Name: "app-name", Value: *pipelinev1.NewStructuredValues("api")},
+		})
+		if err != nil {
+			return "", err
+		}
+		return string(resource.Data()), nil
+	}
+
+	// The Pipelines of the files are merged in path order, and the Tasks they come with inlined
+	rendered, err := resolve("stages/*.yaml")
+	require.NoError(t, err)
+	var pipeline pipelinev1.Pipeline
+	require.NoError(t, yaml.Unmarshal([]byte(rendered), &pipeline))
+	assert.Equal(t, "api", pipeline.Name)
+	assert.Equal(t, map[string]string{"app": "api", "stage": "build"}, pipeline.Labels)
+	assert.Equal(t, pipelinev1.ParamSpecs{{Name: "app-name"}}, pipeline.Spec.Params)
+	require.Len(t, pipeline.Spec.Tasks, 2)
+	assert.Equal(t, "build", pipeline.Spec.Tasks[0].Name)
+	assert.NotNil(t, pipeline.Spec.Tasks[0].TaskSpec)
+	assert.Equal(t, "test", pipeline.Spec.Tasks[1].Name)
+	// The listed files are not fetched again
+	assert.Empty(t, fetcher.fetched)
+
+	// Other files are read at the commit the files were listed at
+	rendered, err = resolve("deploy/*.yaml")
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "name: deploy")
+	assert.Equal(t, []string{fetcher.commit + ":partials/deploy.yaml"}, fetcher.fetched)
+
+	// Files resolved for another template are concatenated
+	rendered, err = resolve("library.yaml")
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "  tasks:\n    - name: format\n      taskRef:\n        name: gofmt\n    - name: lint\n")
+
+	_, err = resolve("conflict/*.yaml")
+	assert.EqualError(t, err, `templates declare different params named "env" in the Pipeline`)
+	_, err = resolve("missing/*.yaml")
+	assert.EqualError(t, err, "no templates match missing/*.yaml")
+	_, err = resolve("stages/[.yaml")
+	assert.ErrorContains(t, err, "invalid glob path stages/[.yaml")
+
+	r.fetcher = &notFoundFetcher{}
+	_, err = resolve("stages/*.yaml")
+	assert.EqualError(t, err, "template path stages/*.yaml is a glob, but templates cannot be listed")
+}
+
+func TestResolverGlobMetrics(t *testing.T) {
+	repository := "https://github.com/metrics/glob"
+	withMetricsRepositories(t, repository)
+	r := &resolver{fetcher: &listingFetcher{notFoundFetcher: notFoundFetcher{templates: map[string]string{
+		repository + ":stages/build.yaml": "apiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n  name: app\nspec:\n  tasks:\n    - name: build\n      taskRef:\n        name: build\n",
+		repository + ":stages/test.yaml":  "apiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n  name: app\nspec:\n  tasks:\n    - name: test\n      taskRef:\n        name: test\n",
+	}}}}
+	_, err := r.Resolve(context.Background(), []pipelinev1.Param{
+		{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues(repository)},
+		{Name: PathParam, Value: *pipelinev1.NewStructuredValues("stages/*.yaml")},
+	})
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	registerMetrics(mux)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	labels := `{backend="github-raw",repository="` + repository + `"}`
+	// The request lists the files once and is one resolution, however many files it renders
+	assert.Contains(t, recorder.Body.String(), "template_resolver_fetch_duration_seconds_count"+labels+" 1")
+	assert.Contains(t, recorder.Body.String(), "template_resolver_resolution_duration_seconds_count"+labels+" 1")
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"thrivemarket.com/template-resolver/pkg/goldentest"
+)
+
+// goldenCommand is the subcommand comparing a rendered local template with a golden file
+const goldenCommand = "test"
+
+// runGoldenCommand renders a local template with a values file and params and compares the
+// result with a golden file, writing a diff to out when they differ. It reports whether they
+// match. With -update, the golden file is written instead.
+func runGoldenCommand(ctx context.Context, resolver *resolver, args []string, out io.Writer) (bool, error) {
+	usage := "usage: template-resolver test -golden file [-values file] [-param name=value]... [-root dir] [-update] template"
+	fs := flag.NewFlagSet(goldenCommand, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	golden := fs.String("golden", "", "File holding the expected output of the template")
+	valuesFile := fs.String("values", "", "YAML values file the template is rendered with")
+	root := fs.String("root", "", "Repository directory partials and files are read from (default: the directory of the template)")
+	update := fs.Bool("update", false, "Write the rendered output to the golden file")
+	_ = fs.Bool("debug", debugMode, "Enable debug logging")
+	var params paramFlags
+	fs.Var(&params, "param", "Param of the request as name=value, repeatable")
+	if err := fs.Parse(args); err != nil {
+		return false, fmt.Errorf("%w\n%s", err, usage)
+	}
+	if fs.NArg() != 1 || *golden == "" {
+		return false, fmt.Errorf("%s", usage)
+	}
+
+	rendered, err := resolver.renderLocalTemplate(ctx, fs.Arg(0), *root, *valuesFile, params)
+	if err != nil {
+		return false, err
+	}
+	diff, err := goldentest.CompareGolden(*golden, rendered, *update)
+	if err != nil {
+		return false, err
+	}
+	if diff != "" {
+		_, err = io.WriteString(out, diff)
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunGoldenCommand(t *testing.T) {
+	originalAllow := allowFileRepositories
+	defer func() { allowFileRepositories = originalAllow }()
+	allowFileRepositories = true
+
+	dir := t.TempDir()
+	template := filepath.Join(dir, "task.yaml")
+	require.NoError(t, os.WriteFile(template, []byte(`apiVersion: tekton.dev/v1
+kind: Task
+metadata:
+  name: {{ .Values.app }}
+spec:
+  steps:
+    - name: build
+      image: {{ .Image }}
+`), 0o600))
+	valuesFile := filepath.Join(dir, "values.yaml")
+	require.NoError(t, os.WriteFile(valuesFile, []byte("app: api\n"), 0o600))
+	golden := filepath.Join(dir, "testdata", "task.golden.yaml")
+
+	r := NewResolver()
+	r.cache = newMemoryCache()
+	ctx := context.Background()
+	args := func(extra ...string) []string {
+		return append(append([]string{"-golden", golden, "-values", valuesFile}, extra...), template)
+	}
+
+	var out bytes.Buffer
+	_, err := runGoldenCommand(ctx, r, args("-param", "image=alpine"), &out)
+	assert.ErrorContains(t, err, "failed to read golden file")
+
+	passed, err := runGoldenCommand(ctx, r, args("-param", "image=alpine", "-update"), &out)
+	require.NoError(t, err)
+	assert.True(t, passed)
+	content, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "image: alpine\n")
+
+	passed, err = runGoldenCommand(ctx, r, args("-param", "image=alpine"), &out)
+	require.NoError(t, err)
+	assert.True(t, passed)
+	assert.Empty(t, out.String())
+
+	passed, err = runGoldenCommand(ctx, r, args("-param", "image=busybox"), &out)
+	require.NoError(t, err)
+	assert.False(t, passed)
+	assert.Contains(t, out.String(), "-      image: alpine\n+      image: busybox\n")
+
+	_, err = runGoldenCommand(ctx, r, []string{template}, &out)
+	assert.ErrorContains(t, err, "usage: template-resolver test")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/Masterminds/sprig/v3"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// helmValueName converts a param name to the lowerCamelCase used for Helm values,
+// e.g. app-name becomes appName
+func helmValueName(paramName string) string {
+	name := []rune(toCamelCase(paramName))
+	if len(name) > 0 {
+		name[0] = unicode.ToLower(name[0])
+	}
+	return string(name)
+}
+
+// helmValue converts a param value to what Helm would read from a values file: strings
+// stay strings, objects become maps and array items holding YAML objects, such as Tekton
+// tasks, become maps so they can be rendered with toYaml
+func helmValue(value pipelinev1.ParamValue) interface{} {
+	switch value.Type {
+	case pipelinev1.ParamTypeArray:
+		items := make([]interface{}, 0, len(value.ArrayVal))
+		for _, item := range value.ArrayVal {
+			var object map[string]interface{}
+			if err := yaml.Unmarshal([]byte(item), &object); err == nil && object != nil {
+				items = append(items, object)
+			} else {
+				items = append(items, item)
+			}
+		}
+		return items
+	case pipelinev1.ParamTypeObject:
+		return objectParamValue(value.ObjectVal)
+	default:
+		return value.StringVal
+	}
+}
+
+// helmValues returns the params the way a Helm values file holds them, with lowerCamelCase
+// names
+func helmValues(params []pipelinev1.Param) map[string]interface{} {
+	values := make(map[string]interface{})
+	for _, param := range params {
+		if isOptionParam(param.Name) {
+			continue
+		}
+		values[helmValueName(param.Name)] = helmValue(param.Value)
+	}
+	return values
+}
+
+// helmTemplateData exposes the params the way Helm charts expect them: under .Values with
+// lowerCamelCase names, with .Template describing the template file
+func helmTemplateData(templatePath string, values map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"Values": values,
+		"Template": map[string]interface{}{
+			"Name":     templatePath,
+			"BasePath": path.Dir(templatePath),
+		},
+	}
+}
+
+// helmFuncMap adds the Sprig functions and the functions Helm defines itself to the
+// functions of the resolver. Sprig functions replace resolver functions of the same name,
+// so chart templates behave as they do in Helm, except env, which stays restricted to
+// TEMPLATE_ENV_ALLOWLIST. expandenv would bypass the allowlist and is not available.
+func helmFuncMap(funcs template.FuncMap) template.FuncMap {
+	result := template.FuncMap{}
+	for name, fn := range funcs {
+		result[name] = fn
+	}
+	for name, fn := range sprig.TxtFuncMap() {
+		result[name] = fn
+	}
+	delete(result, "expandenv")
+	result["env"] = funcs["env"]
+
+	result["toYaml"] = helmToYAML
+	result["fromYaml"] = helmFromYAML
+	result["fromJson"] = helmFromJSON
+	result["required"] = helmRequired
+	limitSequenceFuncs(result)
+	return result
+}
+
+// helmToYAML renders a value as YAML with two-space indentation, like Helm's toYaml
+func helmToYAML(value interface{}) string {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		// Helm swallows errors here, the template shows an empty value
+		return ""
+	}
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+// helmFromYAML parses a YAML object. Like Helm, errors are returned in the Error key.
+// Fields of object params that were already parsed are returned as they are.
+func helmFromYAML(value interface{}) map[string]interface{} {
+	if object, ok := value.(map[string]interface{}); ok {
+		return object
+	}
+	s, _ := value.(string)
+	result := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(s), &result); err != nil {
+		result["Error"] = err.Error()
+	}
+	return result
+}
+
+// helmFromJSON parses a JSON object. Like Helm, errors are returned in the Error key.
+// Fields of object params that were already parsed are returned as they are.
+func helmFromJSON(value interface{}) map[string]interface{} {
+	if object, ok := value.(map[string]interface{}); ok {
+		return object
+	}
+	s, _ := value.(string)
+	result := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(s), &result); err != nil {
+		result["Error"] = err.Error()
+	}
+	return result
+}
+
+// helmRequired fails the render with message when value is missing or an empty string
+func helmRequired(message string, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, fmt.Errorf("%s", message)
+	}
+	if s, ok := value.(string); ok && s == "" {
+		return nil, fmt.Errorf("%s", message)
+	}
+	return value, nil
+}
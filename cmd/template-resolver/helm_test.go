@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestHelmTemplateData(t *testing.T) {
+	data := helmTemplateData("charts/pipeline/templates/pipeline.yaml", helmValues([]pipelinev1.Param{
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		{Name: "build-tasks", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{`{"name": "lint"}`, "plain"}}},
+		{Name: "labels", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeObject, ObjectVal: map[string]string{"team": "platform", "owners": `["alice", "bob"]`}}},
+		{Name: HelmParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "true"}},
+	}))
+
+	assert.Equal(t, map[string]interface{}{
+		"appName":    "api",
+		"buildTasks": []interface{}{map[string]interface{}{"name": "lint"}, "plain"},
+		"labels":     map[string]interface{}{"team": "platform", "owners": []interface{}{"alice", "bob"}},
+	}, data["Values"])
+	assert.Equal(t, map[string]interface{}{
+		"Name":     "charts/pipeline/templates/pipeline.yaml",
+		"BasePath": "charts/pipeline/templates",
+	}, data["Template"])
+}
+
+func TestHelmTemplateFunctions(t *testing.T) {
+	data := map[string]interface{}{
+		"Values": map[string]interface{}{
+			"appName": "api",
+			"tasks":   []interface{}{map[string]interface{}{"name": "lint", "taskRef": map[string]interface{}{"name": "golangci-lint"}}},
+		},
+	}
+	render := func(content string) (string, error) {
+		return renderTemplateWithOptions(context.Background(), content, data, renderOptions{helm: true})
+	}
+
+	result, err := render(`name: {{ .Values.appName | upper | quote }}
+tasks:
+{{- toYaml .Values.tasks | nindent 2 }}
+image: {{ .Values.image | default "golang:1.24" }}`)
+	require.NoError(t, err)
+	assert.Equal(t, "name: \"API\"\ntasks:\n  - name: lint\n    taskRef:\n      name: golangci-lint\nimage: golang:1.24", result)
+
+	// Sprig functions replace the resolver functions of the same name
+	result, err = render(`{{ last (list "a" "b") }}`)
+	require.NoError(t, err)
+	assert.Equal(t, "b", result)
+
+	result, err = render(`{{ (fromJson "{\"replicas\": 2}").replicas }} {{ (fromYaml "a: [").Error | empty | not }}`)
+	require.NoError(t, err)
+	assert.Equal(t, "2 true", result)
+
+	_, err = render(`{{ required "values.registry is required" .Values.registry }}`)
+	assert.ErrorContains(t, err, "values.registry is required")
+
+	// The environment stays restricted to the allowlist
+	_, err = render(`{{ env "HOME" }}`)
+	assert.ErrorContains(t, err, "not in TEMPLATE_ENV_ALLOWLIST")
+	_, err = render(`{{ expandenv "$HOME" }}`)
+	assert.ErrorContains(t, err, `function "expandenv" not defined`)
+
+	// Without Helm mode the resolver functions are used
+	_, err = renderTemplate(`{{ upper "a" }}`, data)
+	assert.Error(t, err)
+}
+
+func TestResolverHelmMode(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:templates/pipeline.yaml": "metadata:\n  name: {{ .Values.appName }}-{{ .Values.environment | default \"dev\" }}\n",
+	}}}
+	params := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+		{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "templates/pipeline.yaml"}},
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		{Name: HelmParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "true"}},
+	}
+	require.NoError(t, r.ValidateParams(context.Background(), params))
+
+	resource, err := r.Resolve(context.Background(), params)
+	require.NoError(t, err)
+	assert.Equal(t, "metadata:\n  name: api-dev\n", string(resource.Data()))
+
+	params[3].Value.StringVal = "yes please"
+	assert.ErrorContains(t, r.ValidateParams(context.Background(), params), "invalid helm param")
+}
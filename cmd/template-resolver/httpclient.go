@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Transport settings shared by every HTTP client. HTTP_TIMEOUT still bounds each request as
+// a whole, these only bound its individual phases.
+const (
+	httpDialTimeout         = 10 * time.Second
+	httpKeepAlive           = 30 * time.Second
+	httpTLSHandshakeTimeout = 10 * time.Second
+	httpIdleConnTimeout     = 90 * time.Second
+	httpMaxIdleConns        = 100
+)
+
+// sharedTransport is the transport of every client returned by newHTTPClient. Sharing it
+// pools connections across fetches, so templates from the same host reuse kept-alive
+// connections instead of dialing and handshaking for every request. It is created on first
+// use, after the configuration has been loaded.
+var sharedTransport = sync.OnceValue(func() http.RoundTripper {
+	return &retryTransport{
+		base:    &netrcTransport{base: newHTTPTransport(proxyFromConfig)},
+		retries: httpRetries,
+		backoff: httpRetryBackoff,
+	}
+})
+
+// newHTTPTransport returns a transport with the resolver's dial, TLS and connection pool
+// settings that connects through proxy, or directly when proxy is nil
+func newHTTPTransport(proxy func(*http.Request) (*url.URL, error)) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   httpDialTimeout,
+		KeepAlive: httpKeepAlive,
+	}
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          httpMaxIdleConns,
+		MaxIdleConnsPerHost:   httpMaxIdlePerHost,
+		IdleConnTimeout:       httpIdleConnTimeout,
+		TLSHandshakeTimeout:   httpTLSHandshakeTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// newHTTPClient returns an HTTP client with the configured timeout that connects through
+// the configured proxy, sends credentials from the .netrc file and retries idempotent
+// requests that fail transiently. Clients are cheap, and all of them share one pooled
+// transport.
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout:   currentSettings().httpTimeout,
+		Transport: sharedTransport(),
+	}
+}
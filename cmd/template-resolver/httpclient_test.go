@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPClientSharesTransport(t *testing.T) {
+	first, second := newHTTPClient(), newHTTPClient()
+	assert.Same(t, first.Transport, second.Transport)
+	assert.Equal(t, httpTimeout, first.Timeout)
+
+	transport := newHTTPTransport(proxyFromConfig)
+	assert.Equal(t, httpMaxIdlePerHost, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, httpTLSHandshakeTimeout, transport.TLSHandshakeTimeout)
+	assert.NotNil(t, transport.Proxy)
+	assert.Nil(t, newHTTPTransport(nil).Proxy)
+}
+
+func TestNewHTTPClientReusesConnections(t *testing.T) {
+	var connections atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("kind: Pipeline"))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	for range 5 {
+		resp, err := newHTTPClient().Get(server.URL)
+		require.NoError(t, err)
+		_, err = readTemplate(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+	assert.Equal(t, int32(1), connections.Load())
+}
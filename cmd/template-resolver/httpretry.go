@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// retryTransport retries idempotent requests that failed with a network error or a 502, 503
+// or 504 response, such as raw GitHub and Gist fetches hitting a transient outage. Attempts
+// are spaced by an exponential backoff with jitter. Each attempt gets an equal share of
+// HTTP_TIMEOUT to receive its response headers, and HTTP_TIMEOUT still bounds the request
+// with all of its attempts, so no retry is made that could not complete in time.
+type retryTransport struct {
+	base http.RoundTripper
+
+	// retries is the number of attempts made after the first one
+	retries int
+
+	// backoff is the wait before the first retry, doubled for each further retry
+	backoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.retries <= 0 || !retryableRequest(req) {
+		return t.base.RoundTrip(req)
+	}
+	ctx := req.Context()
+	attemptTimeout := currentSettings().httpTimeout / time.Duration(t.retries+1)
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.attempt(req, attemptTimeout)
+		if attempt == t.retries || ctx.Err() != nil || !retryableResponse(resp, err) {
+			return resp, err
+		}
+		wait := retryBackoff(t.backoff, attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return resp, err
+		}
+
+		reason := fmt.Sprint(err)
+		if resp != nil {
+			reason = resp.Status
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			_ = resp.Body.Close()
+		}
+		debugf("Retrying %s %s%s in %v after %s", req.Method, req.URL.Host, req.URL.Path, wait, reason)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		if req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+	}
+}
+
+// attempt sends a request, cancelling it when its response headers take longer than
+// timeout. The body of the response can still be read after that.
+func (t *retryTransport) attempt(req *http.Request, timeout time.Duration) (*http.Response, error) {
+	if timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(timeout, cancel)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() && err != nil {
+		err = fmt.Errorf("no response within %v: %w", timeout, err)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnCloseBody releases the context of an attempt once its response body is closed
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// retryableRequest reports whether a request can be sent again: its method is idempotent
+// and its body, if any, can be read again
+func retryableRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// retryableResponse reports whether an attempt failed in a way another attempt may not:
+// a network error, such as a reset connection, or a gateway error
+func retryableResponse(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryBackoff returns the wait before a retry: backoff doubled for each earlier retry,
+// with random jitter taking up to half of it off so clients do not retry in lockstep
+func retryBackoff(backoff time.Duration, retry int) time.Duration {
+	if backoff <= 0 {
+		return 0
+	}
+	wait := backoff << min(retry, 16)
+	return wait - rand.N(wait/2+1)
+}
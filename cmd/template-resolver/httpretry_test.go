@@ -0,0 +1,159 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRetryTestClient returns a client retrying like the shared transport, without waiting
+// between attempts
+func newRetryTestClient(retries int) *http.Client {
+	return &http.Client{
+		Timeout:   httpTimeout,
+		Transport: &retryTransport{base: http.DefaultTransport, retries: retries, backoff: time.Millisecond},
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	var requests atomic.Int32
+	statuses := map[string][]int{
+		"/flaky":   {http.StatusBadGateway, http.StatusServiceUnavailable},
+		"/down":    {http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+		"/missing": {http.StatusNotFound},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt := int(requests.Add(1)) - 1
+		if codes := statuses[r.URL.Path]; attempt < len(codes) {
+			w.WriteHeader(codes[attempt])
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(append([]byte("ok "), body...))
+	}))
+	defer server.Close()
+	client := newRetryTestClient(2)
+
+	get := func(path string) *http.Response {
+		requests.Store(0)
+		resp, err := client.Get(server.URL + path)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		return resp
+	}
+
+	// Gateway errors are retried until an attempt succeeds
+	resp := get("/flaky")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "ok ", string(body))
+	assert.Equal(t, int32(3), requests.Load())
+
+	// The response of the last attempt is returned
+	assert.Equal(t, http.StatusServiceUnavailable, get("/down").StatusCode)
+	assert.Equal(t, int32(3), requests.Load())
+
+	// Other errors are not retried
+	assert.Equal(t, http.StatusNotFound, get("/missing").StatusCode)
+	assert.Equal(t, int32(1), requests.Load())
+
+	// Neither are requests that are not idempotent
+	requests.Store(0)
+	resp, err = client.Post(server.URL+"/flaky", "text/plain", strings.NewReader("data"))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, int32(1), requests.Load())
+
+	// Without retries the first response is returned
+	requests.Store(0)
+	resp, err = newRetryTestClient(0).Get(server.URL + "/flaky")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
+
+func TestRetryTransportNetworkErrors(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// Drop the connection without a response, like a reset by a proxy
+			conn, _, err := w.(http.Hijacker).Hijack()
+			require.NoError(t, err)
+			_ = conn.Close()
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	resp, err := newRetryTestClient(2).Get(server.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestRetryTransportBudgets(t *testing.T) {
+	original := httpTimeout
+	defer func() { httpTimeout = original }()
+	httpTimeout = 600 * time.Millisecond
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// Slower than the share of HTTP_TIMEOUT of an attempt
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+			return
+		}
+		// Headers in time, the body can take longer than an attempt
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(250 * time.Millisecond)
+		_, _ = w.Write([]byte("slow body"))
+	}))
+	defer server.Close()
+
+	resp, err := newRetryTestClient(2).Get(server.URL)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "slow body", string(body))
+	assert.Equal(t, int32(2), requests.Load())
+
+	// No retry is made when its backoff would not end before HTTP_TIMEOUT
+	requests.Store(0)
+	client := &http.Client{
+		Timeout:   httpTimeout,
+		Transport: &retryTransport{base: http.DefaultTransport, retries: 2, backoff: time.Minute},
+	}
+	started := time.Now()
+	_, err = client.Get(server.URL)
+	assert.ErrorContains(t, err, "no response within 200ms")
+	assert.Less(t, time.Since(started), httpTimeout)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestRetryBackoff(t *testing.T) {
+	assert.Equal(t, time.Duration(0), retryBackoff(0, 3))
+	for retry := 0; retry < 4; retry++ {
+		full := 100 * time.Millisecond << retry
+		for i := 0; i < 20; i++ {
+			wait := retryBackoff(100*time.Millisecond, retry)
+			assert.GreaterOrEqual(t, wait, full/2)
+			assert.LessOrEqual(t, wait, full)
+		}
+	}
+}
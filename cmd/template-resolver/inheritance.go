@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// maxBaseDepth limits how many templates a chain of base templates can hold, counting the
+// template requested by the ResolutionRequest
+const maxBaseDepth = 5
+
+// templateOverlay is a template extending a base template. Overlays are parsed after their
+// base, so the templates they define replace the blocks of the same name in the base.
+type templateOverlay struct {
+	// name is the path of the template, under which errors in it are reported
+	name    string
+	content string
+}
+
+// applyBase follows the base declared in the schema of a template, and the bases of the
+// base, to the template at the root of the chain. It returns the content of that template,
+// which is what gets rendered, the templates extending it from the root down to the
+// requested one, and their schemas merged. Bases are read from the same repository and
+// revision, with paths relative to the repository root, failing on cycles and past
+// maxBaseDepth. Templates without a base are returned as they are.
+func (r *resolver) applyBase(ctx context.Context, repository, revision, templatePath, content string, schema *paramSchema, opts FetchOptions) (string, *paramSchema, []templateOverlay, error) {
+	if schema == nil || schema.Base == "" {
+		return content, schema, nil, nil
+	}
+
+	chain := []string{templatePath}
+	overlays := []templateOverlay{{name: templatePath, content: content}}
+	for schema.Base != "" {
+		basePath := strings.TrimPrefix(path.Clean(schema.Base), "/")
+		if slices.Contains(chain, basePath) {
+			return "", nil, nil, fmt.Errorf("base template %s forms a cycle: %s -> %s", basePath, strings.Join(chain, " -> "), basePath)
+		}
+		chain = append(chain, basePath)
+		if len(chain) > maxBaseDepth {
+			return "", nil, nil, fmt.Errorf("templates extend more than %d levels deep: %s", maxBaseDepth, strings.Join(chain, " -> "))
+		}
+
+		debugContextf(ctx, "Template %s extends %s", chain[len(chain)-2], templateLocation(repository, revision, basePath))
+		fetched, err := r.fetchTemplate(ctx, repository, revision, basePath, opts)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("failed to fetch base template %s: %w", basePath, err)
+		}
+		baseContent, baseSchema, err := r.templateParamSchema(ctx, repository, revision, basePath, fetched.Content, opts)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("base template %s: %w", basePath, err)
+		}
+		schema = mergeBaseSchema(baseSchema, schema)
+		overlays = slices.Insert(overlays, 0, templateOverlay{name: basePath, content: baseContent})
+	}
+	return overlays[0].content, schema, overlays[1:], nil
+}
+
+// mergeBaseSchema merges the schema of a template into the schema of its base. Params and
+// templates the template declares replace those of the same name in the base, and the
+// base of the merged schema is the base of the base.
+func mergeBaseSchema(base, schema *paramSchema) *paramSchema {
+	merged := &paramSchema{}
+	if base != nil {
+		merged.Base = base.Base
+		merged.Params = slices.Clone(base.Params)
+		merged.Templates = slices.Clone(base.Templates)
+	}
+	for _, spec := range schema.Params {
+		i := slices.IndexFunc(merged.Params, func(declared paramSpec) bool { return declared.Name == spec.Name })
+		if i < 0 {
+			merged.Params = append(merged.Params, spec)
+		} else {
+			merged.Params[i] = spec
+		}
+	}
+	for _, dependency := range schema.Templates {
+		i := slices.IndexFunc(merged.Templates, func(declared templateDependency) bool { return declared.Name == dependency.Name })
+		if i < 0 {
+			merged.Templates = append(merged.Templates, dependency)
+		} else {
+			merged.Templates[i] = dependency
+		}
+	}
+	return merged
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestMergeBaseSchema(t *testing.T) {
+	base := &paramSchema{
+		Base:      "lib/root.yaml",
+		Params:    []paramSpec{{Name: "app-name", Required: true}, {Name: "image", Default: pipelinev1.NewStructuredValues("golang")}},
+		Templates: []templateDependency{{Name: "lint", Path: "lib/lint.yaml"}},
+	}
+	schema := &paramSchema{
+		Base:      "base.yaml",
+		Params:    []paramSpec{{Name: "image", Default: pipelinev1.NewStructuredValues("node")}, {Name: "port"}},
+		Templates: []templateDependency{{Name: "lint", Path: "lib/eslint.yaml"}},
+	}
+	assert.Equal(t, &paramSchema{
+		Base:      "lib/root.yaml",
+		Params:    []paramSpec{{Name: "app-name", Required: true}, {Name: "image", Default: pipelinev1.NewStructuredValues("node")}, {Name: "port"}},
+		Templates: []templateDependency{{Name: "lint", Path: "lib/eslint.yaml"}},
+	}, mergeBaseSchema(base, schema))
+
+	// A base without a schema leaves the schema of the template
+	assert.Equal(t, &paramSchema{Params: schema.Params, Templates: schema.Templates}, mergeBaseSchema(nil, schema))
+}
+
+func TestResolverBaseTemplate(t *testing.T) {
+	r := &resolver{fetcher: &notFoundFetcher{templates: map[string]string{
+		"repo1:base.yaml": `---
+params:
+  - name: app-name
+    required: true
+---
+apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: {{ .AppName }}
+spec:
+  tasks:
+    - name: build
+      taskRef:
+        name: build
+{{- block "tasks" . }}{{ end }}
+{{- block "finally" . }}
+  finally:
+    - name: notify
+      taskRef:
+        name: notify
+{{- end }}
+`,
+		"repo1:services/api.yaml": `---
+base: base.yaml
+---
+{{ define "tasks" }}
+    - name: test
+      runAfter: [build]
+      taskRef:
+        name: go-test
+{{- end }}
+`,
+		"repo1:services/api-canary.yaml": `---
+base: /services/api.yaml
+params:
+  - name: channel
+    default: "#canary"
+---
+{{ define "finally" }}
+  finally:
+    - name: notify
+      taskRef:
+        name: notify
+      params:
+        - name: channel
+          value: "{{ .Channel }}"
+{{- end }}
+`,
+		"repo1:cycle-1.yaml":    "---\nbase: cycle-2.yaml\n---\n",
+		"repo1:cycle-2.yaml":    "---\nbase: cycle-1.yaml\n---\n",
+		"repo1:missing.yaml":    "---\nbase: lib/missing.yaml\n---\n",
+		"repo1:chain-1.yaml":    "---\nbase: chain-2.yaml\n---\n",
+		"repo1:chain-2.yaml":    "---\nbase: chain-3.yaml\n---\n",
+		"repo1:chain-3.yaml":    "---\nbase: chain-4.yaml\n---\n",
+		"repo1:chain-4.yaml":    "---\nbase: chain-5.yaml\n---\n",
+		"repo1:chain-5.yaml":    "---\nbase: chain-6.yaml\n---\n",
+		"repo1:chain-6.yaml":    "done",
+		"repo1:base.jsonnet":    "{}",
+		"repo1:extends.jsonnet": "---\nbase: base.jsonnet\n---\n",
+	}}}
+	resolve := func(path string, params ...pipelinev1.Param) (string, error) {
+		resource, err := r.Resolve(context.Background(), append([]pipelinev1.Param{
+			{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("repo1")},
+			{Name: PathParam, Value: *pipelinev1.NewStructuredValues(path)},
+		}, params...))
+		if err != nil {
+			return "", err
+		}
+		return string(resource.Data()), nil
+	}
+	appName := pipelinev1.Param{Name: "app-name", Value: *pipelinev1.NewStructuredValues("api")}
+
+	rendered, err := resolve("services/api.yaml", appName)
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: api
+spec:
+  tasks:
+    - name: build
+      taskRef:
+        name: build
+    - name: test
+      runAfter: [build]
+      taskRef:
+        name: go-test
+  finally:
+    - name: notify
+      taskRef:
+        name: notify
+`, rendered)
+
+	// Blocks are overridden through every level, and the params of the base still apply
+	rendered, err = resolve("services/api-canary.yaml", appName)
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "        name: go-test\n  finally:\n")
+	assert.Contains(t, rendered, `value: "#canary"`)
+	_, err = resolve("services/api-canary.yaml")
+	assert.ErrorContains(t, err, `missing required param "app-name"`)
+
+	_, err = resolve("cycle-1.yaml")
+	assert.EqualError(t, err, "base template cycle-1.yaml forms a cycle: cycle-1.yaml -> cycle-2.yaml -> cycle-1.yaml")
+	_, err = resolve("missing.yaml")
+	assert.ErrorContains(t, err, "failed to fetch base template lib/missing.yaml")
+	_, err = resolve("chain-1.yaml")
+	assert.ErrorContains(t, err, "templates extend more than 5 levels deep")
+	_, err = resolve("extends.jsonnet")
+	assert.EqualError(t, err, "only gotemplate templates can extend a base template, not jsonnet")
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// jsonnetArgs returns the jsonnet command line arguments passing the request params as
+// external variables: strings with --ext-str, arrays and objects as JSON with --ext-code,
+// so templates read them with std.extVar('app-name'). The program is read from stdin.
+func jsonnetArgs(params []pipelinev1.Param) ([]string, error) {
+	values := engineParamValues(params)
+	var args []string
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if value, ok := values[name].(string); ok {
+			args = append(args, "--ext-str", name+"="+value)
+			continue
+		}
+		encoded, err := json.Marshal(values[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode param %s for Jsonnet: %w", name, err)
+		}
+		args = append(args, "--ext-code", name+"="+string(encoded))
+	}
+	return append(args, "-"), nil
+}
+
+// jsonnetImportPattern matches the import, importstr and importbin expressions of a Jsonnet
+// program with the string literal they import: verbatim, double or single quoted, or a
+// text block, which is never allowed
+var jsonnetImportPattern = regexp.MustCompile(`\bimport(?:str|bin)?\s*(?:@'((?:[^']|'')*)'|@"((?:[^"]|"")*)"|"((?:[^"\\]|\\.)*)"|'((?:[^'\\]|\\.)*)'|(\|\|\|))`)
+
+// checkJsonnetImports rejects imports that could reach files of the resolver: absolute
+// paths, paths leaving the work directory and paths hidden in escapes or text blocks.
+// Other imports are looked up in the empty work directory the template runs in, so they
+// fail too, but with the error of the jsonnet binary.
+func checkJsonnetImports(content string) error {
+	for _, match := range jsonnetImportPattern.FindAllStringSubmatch(content, -1) {
+		verbatim := match[1] + match[2]
+		quoted := match[3] + match[4]
+		switch {
+		case match[5] != "":
+			return fmt.Errorf("cannot import a text block, imports are not supported in Jsonnet templates")
+		case strings.Contains(quoted, `\`):
+			return fmt.Errorf("cannot import a path with escapes in %s, imports are not supported in Jsonnet templates", match[0])
+		}
+		importPath := verbatim + quoted
+		if path.IsAbs(importPath) || slices.Contains(strings.Split(importPath, "/"), "..") {
+			return fmt.Errorf("cannot import %q, imports are not supported in Jsonnet templates", importPath)
+		}
+	}
+	return nil
+}
+
+// renderJsonnet evaluates a Jsonnet template with the jsonnet binary at JSONNET_BINARY and
+// returns the result as YAML, like templates rendered by the other engines. Imports are not
+// supported because only the template file itself is fetched: the binary runs in an empty
+// work directory, which is also its only library path, and imports of absolute paths or
+// paths leaving it are rejected before it runs, so templates cannot read the files of the
+// resolver.
+func renderJsonnet(ctx context.Context, content string, params []pipelinev1.Param) (string, error) {
+	if err := checkJsonnetImports(content); err != nil {
+		return "", err
+	}
+	args, err := jsonnetArgs(params)
+	if err != nil {
+		return "", err
+	}
+	args = append(args[:len(args)-1], "--jpath", ".", "-")
+
+	debugf("Evaluating Jsonnet template with %s", jsonnetBinary)
+	output, err := runEngineCommandWithFiles(ctx, jsonnetBinary, args, nil, content)
+	if err != nil {
+		return "", err
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return "", fmt.Errorf("failed to parse Jsonnet output: %w", err)
+	}
+	rendered, err := yaml.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert Jsonnet output to YAML: %w", err)
+	}
+	return string(rendered), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestJsonnetArgs(t *testing.T) {
+	args, err := jsonnetArgs([]pipelinev1.Param{
+		{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "https://github.com/example/repo"}},
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		{Name: "environments", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{"dev", "prod"}}},
+		{Name: "labels", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeObject, ObjectVal: map[string]string{"team": "platform"}}},
+		{Name: GitCredentialsSecretParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "git-creds"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"--ext-str", "app-name=api",
+		"--ext-code", `environments=["dev","prod"]`,
+		"--ext-code", `labels={"team":"platform"}`,
+		"--ext-str", "repository=https://github.com/example/repo",
+		"-",
+	}, args)
+}
+
+func TestRenderJsonnet(t *testing.T) {
+	// The fake binary checks the program arrives on stdin and prints a pipeline as JSON
+	useEngineBinary(t, &jsonnetBinary, `grep -q "std.extVar" || exit 1
+echo '{"apiVersion": "tekton.dev/v1", "kind": "Pipeline", "metadata": {"name": "'"$2"'"}}'
+`)
+
+	params := []pipelinev1.Param{
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+	}
+	rendered, err := renderJsonnet(context.Background(), "{ name: std.extVar('app-name') }", params)
+	require.NoError(t, err)
+	assert.Equal(t, "apiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n    name: app-name=api\n", rendered)
+
+	useEngineBinary(t, &jsonnetBinary, "echo 'RUNTIME ERROR: Undefined external variable: app' >&2\nexit 1\n")
+	_, err = renderJsonnet(context.Background(), "std.extVar('app')", nil)
+	assert.ErrorContains(t, err, "Undefined external variable: app")
+}
+
+func TestRenderJsonnetImports(t *testing.T) {
+	// The binary runs in an empty directory, which is its only library path
+	useEngineBinary(t, &jsonnetBinary, `[ -z "$(ls -A)" ] || exit 1
+for arg; do last2=$last; last=$arg; done
+[ "$last2" = "." ] || exit 1
+echo '{}'
+`)
+	_, err := renderJsonnet(context.Background(), "local lib = import 'lib.libsonnet'; {}", nil)
+	require.NoError(t, err)
+
+	for program, message := range map[string]string{
+		`importstr "/var/run/secrets/kubernetes.io/serviceaccount/token"`: `cannot import "/var/run/secrets/kubernetes.io/serviceaccount/token"`,
+		`import '../../etc/config.jsonnet'`:                               `cannot import "../../etc/config.jsonnet"`,
+		`importbin @"/etc/passwd"`:                                        `cannot import "/etc/passwd"`,
+		`importstr "\u002fetc/passwd"`:                                    "cannot import a path with escapes",
+		"importstr |||\n  /etc/passwd\n|||":                               "cannot import a text block",
+	} {
+		_, err := renderJsonnet(context.Background(), program, nil)
+		assert.ErrorContains(t, err, message, program)
+	}
+}
+
+func TestRenderJsonnetWithJsonnet(t *testing.T) {
+	if _, err := exec.LookPath(DefaultJsonnetBinary); err != nil {
+		t.Skip("jsonnet is not installed")
+	}
+
+	params := []pipelinev1.Param{
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		{Name: "environments", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{"dev", "prod"}}},
+	}
+	rendered, err := renderJsonnet(context.Background(), `{
+  kind: 'Pipeline',
+  metadata: { name: std.extVar('app-name') },
+  spec: { tasks: [{ name: 'deploy-' + env } for env in std.extVar('environments')] },
+}`, params)
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "name: deploy-prod")
+}
+
+func TestResolverJsonnetTemplate(t *testing.T) {
+	useEngineBinary(t, &jsonnetBinary, `cat >/dev/null
+echo '{"kind": "Pipeline", "metadata": {"name": "from-jsonnet"}}'
+`)
+
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{"repo1:pipeline.jsonnet": "{}"}}}
+	resource, err := r.Resolve(context.Background(), []pipelinev1.Param{
+		{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+		{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "pipeline.jsonnet"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Pipeline\nmetadata:\n    name: from-jsonnet\n", string(resource.Data()))
+	assert.Equal(t, "pipeline.jsonnet", resource.RefSource().EntryPoint)
+}
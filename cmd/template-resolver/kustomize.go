@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// kustomizationFileName is read from the directory named by the kustomization param
+	kustomizationFileName = "kustomization.yaml"
+
+	// kustomizeResourceName is the file holding the rendered template, the only resource of
+	// the kustomization
+	kustomizeResourceName = "resolved-template.yaml"
+)
+
+// kustomizationPatchFiles returns the patch files a kustomization references, relative to its
+// directory. Inline patches need no files.
+func kustomizationPatchFiles(kustomization *types.Kustomization) []string {
+	var files []string
+	for _, patch := range kustomization.Patches {
+		if patch.Path != "" {
+			files = append(files, patch.Path)
+		}
+	}
+	for _, patch := range kustomization.PatchesJson6902 {
+		if patch.Path != "" {
+			files = append(files, patch.Path)
+		}
+	}
+	for _, patch := range kustomization.PatchesStrategicMerge {
+		// Entries are either a file name or an inline patch
+		if !strings.Contains(string(patch), "\n") {
+			files = append(files, string(patch))
+		}
+	}
+	return files
+}
+
+// applyKustomization runs the kustomization in dir of the template repository over a
+// rendered template, so environment-specific patches can live next to the template instead
+// of being templated inline. The rendered template replaces the resources of the
+// kustomization; its patches and transformers such as namePrefix or commonLabels are applied.
+func (r *resolver) applyKustomization(ctx context.Context, repository, revision, dir, rendered string, opts FetchOptions) (string, error) {
+	dir = path.Clean(strings.Trim(dir, "/"))
+	fetch := func(name string) ([]byte, error) {
+		fetched, err := r.fetchTemplate(ctx, repository, revision, path.Join(dir, name), opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s of kustomization %s: %w", name, dir, err)
+		}
+		return []byte(fetched.Content), nil
+	}
+
+	content, err := fetch(kustomizationFileName)
+	if err != nil {
+		return "", err
+	}
+	var kustomization types.Kustomization
+	if err := yaml.Unmarshal(content, &kustomization); err != nil {
+		return "", fmt.Errorf("failed to parse kustomization %s: %w", dir, err)
+	}
+	if len(kustomization.Bases) > 0 || len(kustomization.Components) > 0 {
+		return "", fmt.Errorf("kustomization %s uses bases or components, which are not supported", dir)
+	}
+	kustomization.Resources = []string{kustomizeResourceName}
+
+	fs := filesys.MakeFsInMemory()
+	root := path.Join("/", dir)
+	for _, name := range kustomizationPatchFiles(&kustomization) {
+		// Files outside the kustomization directory are rejected by kustomize itself
+		if strings.HasPrefix(path.Clean(name), "..") {
+			continue
+		}
+		patch, err := fetch(name)
+		if err != nil {
+			return "", err
+		}
+		if err := fs.WriteFile(path.Join(root, name), patch); err != nil {
+			return "", fmt.Errorf("failed to stage patch %s: %w", name, err)
+		}
+	}
+
+	content, err = yaml.Marshal(&kustomization)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode kustomization %s: %w", dir, err)
+	}
+	if err := fs.WriteFile(path.Join(root, kustomizationFileName), content); err != nil {
+		return "", fmt.Errorf("failed to stage kustomization: %w", err)
+	}
+	if err := fs.WriteFile(path.Join(root, kustomizeResourceName), []byte(rendered)); err != nil {
+		return "", fmt.Errorf("failed to stage rendered template: %w", err)
+	}
+
+	debugContextf(ctx, "Applying kustomization %s to the rendered template", dir)
+	resources, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(fs, root)
+	if err != nil {
+		return "", fmt.Errorf("failed to apply kustomization %s: %w", dir, err)
+	}
+	result, err := resources.AsYaml()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode kustomized template: %w", err)
+	}
+	return string(result), nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"sigs.k8s.io/kustomize/api/types"
+)
+
+const kustomizeTestPipeline = `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: build
+spec:
+  params:
+  - name: environment
+    type: string
+    default: dev
+  tasks:
+  - name: build
+    taskRef:
+      name: golang-build
+`
+
+// failingFetcher fails every fetch, like a repository without the requested files
+type failingFetcher struct{}
+
+func (f *failingFetcher) FetchTemplate(repo, revision, path string, opts FetchOptions) (*FetchedTemplate, error) {
+	return nil, fmt.Errorf("file %s not found", path)
+}
+
+func TestKustomizationPatchFiles(t *testing.T) {
+	kustomization := &types.Kustomization{
+		Patches:               []types.Patch{{Path: "timeout.yaml"}, {Patch: "- op: remove\n  path: /spec/tasks/0"}},
+		PatchesJson6902:       []types.Patch{{Path: "json/tasks.yaml"}},
+		PatchesStrategicMerge: []types.PatchStrategicMerge{"labels.yaml", "metadata:\n  name: build\n"},
+	}
+	assert.Equal(t, []string{"timeout.yaml", "json/tasks.yaml", "labels.yaml"}, kustomizationPatchFiles(kustomization))
+}
+
+func TestApplyKustomization(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:overlays/prod/kustomization.yaml": `namePrefix: prod-
+labels:
+- pairs:
+    environment: prod
+patches:
+- path: default-environment.yaml
+  target:
+    kind: Pipeline
+`,
+		"repo1:overlays/prod/default-environment.yaml": `- op: replace
+  path: /spec/params/0/default
+  value: prod
+`,
+		"repo1:overlays/base/kustomization.yaml": "components:\n- ../components/labels\n",
+	}}}
+
+	result, err := r.applyKustomization(context.Background(), "repo1", "", "/overlays/prod/", kustomizeTestPipeline, FetchOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, result, "name: prod-build")
+	assert.Contains(t, result, "environment: prod")
+	assert.Contains(t, result, "default: prod")
+	assert.Contains(t, result, "name: golang-build")
+
+	_, err = (&resolver{fetcher: &failingFetcher{}}).applyKustomization(context.Background(), "repo1", "", "overlays/missing", kustomizeTestPipeline, FetchOptions{})
+	assert.ErrorContains(t, err, "failed to fetch kustomization.yaml of kustomization overlays/missing")
+
+	_, err = r.applyKustomization(context.Background(), "repo1", "", "overlays/base", kustomizeTestPipeline, FetchOptions{})
+	assert.ErrorContains(t, err, "not supported")
+}
+
+func TestResolverKustomization(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:pipeline.yaml":                    kustomizeTestPipeline,
+		"repo1:overlays/prod/kustomization.yaml": "namePrefix: prod-\n",
+	}}, cache: newMemoryCache()}
+
+	resource, err := r.Resolve(context.Background(), []pipelinev1.Param{
+		{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+		{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "pipeline.yaml"}},
+		{Name: KustomizationParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "overlays/prod"}},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, string(resource.Data()), "name: prod-build")
+}
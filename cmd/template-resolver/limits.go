@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// maxIncludeDepth caps include and tpl calls nested in each other, like Helm. A recursive
+// include would otherwise grow the stack until the process crashes.
+const maxIncludeDepth = 1000
+
+// maxRangeIterations caps ranges over integers and the sequences generated by until,
+// untilStep and seq. A range that writes nothing cannot be stopped by cancelling its render.
+const maxRangeIterations = 100000
+
+// rangeGuardFunc is the function guardRanges appends to the pipeline of every range action.
+// It is named after the action, so errors read "error calling range".
+const rangeGuardFunc = "range"
+
+// restrictedFuncs are blocked when RESTRICTED_TEMPLATES is set: they read the resolver's
+// environment, the cluster or the network rather than the params of the request
+var restrictedFuncs = []string{"env", "lookup", "getHostByName"}
+
+// restrictedEngines are rejected when RESTRICTED_TEMPLATES is set: they run the binary of
+// the engine, which can read the files of the resolver. Starlark templates run in process
+// without load(), so they keep to their params like Go templates.
+var restrictedEngines = []string{EngineJsonnet, EngineCUE, EngineYtt}
+
+// checkRestrictedEngine fails for the engines RESTRICTED_TEMPLATES blocks
+func checkRestrictedEngine(engineName string) error {
+	if restrictedTemplates && slices.Contains(restrictedEngines, engineName) {
+		return fmt.Errorf("the %s engine is not allowed when %s is set", engineName, EnvRestrictTemplates)
+	}
+	return nil
+}
+
+// templateTooLargeError reports a template over MAX_TEMPLATE_SIZE
+type templateTooLargeError struct {
+	// size is the size of the template when known before reading it, 0 otherwise
+	size int64
+}
+
+func (e *templateTooLargeError) Error() string {
+	if e.size > 0 {
+		return fmt.Sprintf("template is %d bytes, over the %d byte limit set by %s", e.size, maxTemplateSize, EnvMaxTemplateSize)
+	}
+	return fmt.Sprintf("template is over the %d byte limit set by %s", maxTemplateSize, EnvMaxTemplateSize)
+}
+
+// checkTemplateSize fails for templates whose size, known before reading them, is over
+// MAX_TEMPLATE_SIZE, so they are not downloaded at all
+func checkTemplateSize(size int64) error {
+	if maxTemplateSize > 0 && size > maxTemplateSize {
+		return &templateTooLargeError{size: size}
+	}
+	return nil
+}
+
+// readTemplate reads a template, failing once more than MAX_TEMPLATE_SIZE bytes were read
+// instead of holding a pathologically large file in memory. The content is streamed into
+// the string it is returned as, so it is held once rather than copied from a byte slice.
+func readTemplate(r io.Reader) (string, error) {
+	if maxTemplateSize > 0 {
+		r = io.LimitReader(r, maxTemplateSize+1)
+	}
+	var content strings.Builder
+	if _, err := io.Copy(&content, r); err != nil {
+		return "", err
+	}
+	if maxTemplateSize > 0 && int64(content.Len()) > maxTemplateSize {
+		return "", &templateTooLargeError{}
+	}
+	return content.String(), nil
+}
+
+// renderTimeoutError reports a template that ran past RENDER_TIMEOUT
+type renderTimeoutError struct{}
+
+func (renderTimeoutError) Error() string {
+	return fmt.Sprintf("template rendering did not finish within %s set by %s, check for unbounded ranges or recursive includes", renderTimeout, EnvRenderTimeout)
+}
+
+// renderGuard lets the functions of a template stop a runaway render: nested include and
+// tpl calls give up once the render is cancelled or nested too deep
+type renderGuard struct {
+	ctx   context.Context
+	depth int
+}
+
+// enter is called before an include or tpl call, which must call leave when it returns
+func (g *renderGuard) enter() error {
+	if g.ctx.Err() != nil {
+		return context.Cause(g.ctx)
+	}
+	if g.depth >= maxIncludeDepth {
+		return fmt.Errorf("include and tpl calls nested over %d levels deep, is a template including itself?", maxIncludeDepth)
+	}
+	g.depth++
+	return nil
+}
+
+func (g *renderGuard) leave() {
+	g.depth--
+}
+
+// guardRanges passes the value of every range action of the templates associated with tmpl
+// through rangeValue, so a render stops at its next range once it is cancelled, and ranges
+// over integers are capped. Ranges that are already guarded are left as they are, since
+// templates cloned for tpl share their parse trees.
+func (g *renderGuard) guardRanges(tmpl *template.Template) {
+	tmpl.Funcs(template.FuncMap{rangeGuardFunc: g.rangeValue})
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			guardRangeNodes(t.Tree, t.Tree.Root)
+		}
+	}
+}
+
+// guardRangeNodes appends rangeGuardFunc to the pipelines of the range actions under node
+func guardRangeNodes(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			guardRangeNodes(tree, child)
+		}
+	case *parse.IfNode:
+		guardRangeNodes(tree, n.List)
+		guardRangeNodes(tree, n.ElseList)
+	case *parse.WithNode:
+		guardRangeNodes(tree, n.List)
+		guardRangeNodes(tree, n.ElseList)
+	case *parse.RangeNode:
+		guardRangeNodes(tree, n.List)
+		guardRangeNodes(tree, n.ElseList)
+		last := n.Pipe.Cmds[len(n.Pipe.Cmds)-1]
+		if identifier, ok := last.Args[0].(*parse.IdentifierNode); ok && identifier.Ident == rangeGuardFunc {
+			return
+		}
+		guard := parse.NewIdentifier(rangeGuardFunc).SetTree(tree).SetPos(n.Pipe.Pos)
+		n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pipe.Pos, Args: []parse.Node{guard}})
+	}
+}
+
+// rangeValue is called with the value of every range action. It stops the render once it
+// is cancelled, and fails for ranges over integers past maxRangeIterations.
+func (g *renderGuard) rangeValue(value interface{}) (interface{}, error) {
+	if g.ctx.Err() != nil {
+		return nil, context.Cause(g.ctx)
+	}
+	v := reflect.ValueOf(value)
+	switch {
+	case v.CanInt() && v.Int() > maxRangeIterations, v.CanUint() && v.Uint() > maxRangeIterations:
+		return nil, fmt.Errorf("range over %v is over the limit of %d iterations", value, maxRangeIterations)
+	}
+	return value, nil
+}
+
+// limitSequenceFuncs caps the sequences the Sprig functions until, untilStep and seq
+// generate at maxRangeIterations items, so a template cannot allocate a huge one to range over
+func limitSequenceFuncs(funcs template.FuncMap) {
+	check := func(name string, start, stop, step int) error {
+		if step != 0 && (stop-start)/step > maxRangeIterations {
+			return fmt.Errorf("%s: sequence is over the limit of %d items", name, maxRangeIterations)
+		}
+		return nil
+	}
+	if until, ok := funcs["until"].(func(int) []int); ok {
+		funcs["until"] = func(count int) ([]int, error) {
+			step := 1
+			if count < 0 {
+				step = -1
+			}
+			if err := check("until", 0, count, step); err != nil {
+				return nil, err
+			}
+			return until(count), nil
+		}
+	}
+	if untilStep, ok := funcs["untilStep"].(func(int, int, int) []int); ok {
+		funcs["untilStep"] = func(start, stop, step int) ([]int, error) {
+			if err := check("untilStep", start, stop, step); err != nil {
+				return nil, err
+			}
+			return untilStep(start, stop, step), nil
+		}
+	}
+	if seq, ok := funcs["seq"].(func(...int) string); ok {
+		funcs["seq"] = func(params ...int) (string, error) {
+			// seq takes an end, a start and an end, or a start, a step and an end
+			start, step, end := 1, 1, 0
+			switch len(params) {
+			case 1:
+				end = params[0]
+			case 2:
+				start, end = params[0], params[1]
+			case 3:
+				start, step, end = params[0], params[1], params[2]
+			}
+			if step == 1 && end < start {
+				step = -1
+			}
+			if err := check("seq", start, end, step); err != nil {
+				return "", err
+			}
+			return seq(params...), nil
+		}
+	}
+}
+
+// contextWriter buffers template output and fails writes once ctx is done, which aborts
+// the execution of the template
+type contextWriter struct {
+	ctx context.Context
+	buf strings.Builder
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	if w.ctx.Err() != nil {
+		return 0, context.Cause(w.ctx)
+	}
+	return w.buf.Write(p)
+}
+
+// executeTemplate executes tmpl under ctx, giving up after RENDER_TIMEOUT. text/template
+// cannot be interrupted, so the execution runs in its own goroutine, which is no longer
+// waited for once ctx is done. It stops by itself at its next write, include, tpl or range,
+// and ranges over integers are capped by guardRanges, so it cannot keep running.
+func executeTemplate(ctx context.Context, guard *renderGuard, tmpl *template.Template, data interface{}) (string, error) {
+	if renderTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, renderTimeout, renderTimeoutError{})
+		defer cancel()
+	}
+	guard.ctx = ctx
+	guard.guardRanges(tmpl)
+
+	type result struct {
+		output string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		w := &contextWriter{ctx: ctx}
+		err := tmpl.Execute(w, data)
+		done <- result{w.buf.String(), err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil && ctx.Err() != nil {
+			return "", renderCancelled(ctx)
+		}
+		return r.output, r.err
+	case <-ctx.Done():
+		return "", renderCancelled(ctx)
+	}
+}
+
+// renderCancelled returns the error of a render stopped because ctx is done
+func renderCancelled(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	if errors.Is(cause, renderTimeoutError{}) {
+		return cause
+	}
+	return fmt.Errorf("template rendering cancelled: %w", cause)
+}
+
+// restrictFuncs replaces the functions blocked in restricted mode with ones failing with a
+// clear error, rather than removing them and failing at parse time with "not defined"
+func restrictFuncs(funcs template.FuncMap) {
+	for _, name := range restrictedFuncs {
+		if _, ok := funcs[name]; !ok {
+			continue
+		}
+		funcs[name] = func(...interface{}) (interface{}, error) {
+			return nil, fmt.Errorf("%s is not available, templates are restricted by %s", name, EnvRestrictTemplates)
+		}
+	}
+}
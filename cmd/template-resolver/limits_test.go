@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestReadTemplate(t *testing.T) {
+	original := maxTemplateSize
+	defer func() { maxTemplateSize = original }()
+	maxTemplateSize = 10
+
+	data, err := readTemplate(strings.NewReader("kind: Task"))
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Task", data)
+
+	_, err = readTemplate(strings.NewReader("kind: Pipeline"))
+	var tooLarge *templateTooLargeError
+	require.True(t, errors.As(err, &tooLarge))
+	assert.Equal(t, "template is over the 10 byte limit set by MAX_TEMPLATE_SIZE", err.Error())
+
+	maxTemplateSize = 0
+	data, err = readTemplate(strings.NewReader("kind: Pipeline"))
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Pipeline", data)
+}
+
+func TestCheckTemplateSize(t *testing.T) {
+	original := maxTemplateSize
+	defer func() { maxTemplateSize = original }()
+	maxTemplateSize = 1024
+
+	assert.NoError(t, checkTemplateSize(1024))
+	err := checkTemplateSize(4096)
+	require.Error(t, err)
+	assert.Equal(t, "template is 4096 bytes, over the 1024 byte limit set by MAX_TEMPLATE_SIZE", err.Error())
+
+	maxTemplateSize = 0
+	assert.NoError(t, checkTemplateSize(1<<40))
+}
+
+func TestTemplateSizeLimitInFetchers(t *testing.T) {
+	originalSize, originalAllow := maxTemplateSize, allowFileRepositories
+	defer func() { maxTemplateSize, allowFileRepositories = originalSize, originalAllow }()
+	maxTemplateSize = 16
+	allowFileRepositories = true
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "large.yaml"), []byte(strings.Repeat("a", 64)), 0o600))
+	_, err := fetchFileTemplate("file://"+dir, "", "large.yaml")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "template is 64 bytes, over the 16 byte limit")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("a", 64)))
+	}))
+	defer server.Close()
+	_, err = fetchArtifactRepositoryFile(server.URL+"/artifactory/templates", "", "large.yaml")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "over the 16 byte limit")
+}
+
+func TestRenderTimeout(t *testing.T) {
+	original := renderTimeout
+	defer func() { renderTimeout = original }()
+	renderTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	_, err := renderTemplate(`{{ range 100000 }}{{ range 100000 }}x{{ end }}{{ end }}`, nil)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, renderTimeoutError{})
+	assert.Contains(t, err.Error(), "did not finish within 50ms set by RENDER_TIMEOUT")
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = renderTemplateWithOptions(ctx, `{{ range 100000 }}{{ range 100000 }}x{{ end }}{{ end }}`, nil, renderOptions{})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Contains(t, err.Error(), "template rendering cancelled")
+
+	result, err := renderTemplate(`name: {{ .name }}`, map[string]interface{}{"name": "build"})
+	require.NoError(t, err)
+	assert.Equal(t, "name: build", result)
+}
+
+func TestRangeLimits(t *testing.T) {
+	original := renderTimeout
+	defer func() { renderTimeout = original }()
+	renderTimeout = 50 * time.Millisecond
+
+	// A range writing nothing stops once the render is cancelled, instead of running on
+	goroutines := runtime.NumGoroutine()
+	_, err := renderTemplate(`{{ range 100000 }}{{ range 100000 }}{{ end }}{{ end }}`, nil)
+	assert.ErrorIs(t, err, renderTimeoutError{})
+	assert.Eventually(t, func() bool { return runtime.NumGoroutine() <= goroutines }, 5*time.Second, 10*time.Millisecond)
+
+	_, err = renderTemplate(`{{ range 1000000000 }}{{ end }}`, nil)
+	assert.ErrorContains(t, err, "range over 1000000000 is over the limit of 100000 iterations")
+	_, err = renderTemplate(`{{ tpl "{{ range 1000000000 }}{{ end }}" . }}`, nil)
+	assert.ErrorContains(t, err, "range over 1000000000 is over the limit of 100000 iterations")
+	_, err = renderTemplateWithOptions(context.Background(), `{{ range until 1000000000 }}{{ end }}`, nil, renderOptions{helm: true})
+	assert.ErrorContains(t, err, "until: sequence is over the limit of 100000 items")
+	_, err = renderTemplateWithOptions(context.Background(), `{{ seq 1 1000000000 }}`, nil, renderOptions{helm: true})
+	assert.ErrorContains(t, err, "seq: sequence is over the limit of 100000 items")
+
+	// Ranges within the limits render as before
+	result, err := renderTemplate(`{{ range $i := 3 }}{{ $i }}{{ end }}{{ range .items }}{{ . }}{{ else }}none{{ end }}`, map[string]interface{}{"items": []string{"a", "b"}})
+	require.NoError(t, err)
+	assert.Equal(t, "012ab", result)
+	result, err = renderTemplate(`{{ range .missing }}{{ . }}{{ else }}none{{ end }}`, map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Equal(t, "none", result)
+	result, err = renderTemplateWithOptions(context.Background(), `{{ range untilStep 0 10 5 }}{{ . }}{{ end }} {{ seq 3 }}`, nil, renderOptions{helm: true})
+	require.NoError(t, err)
+	assert.Equal(t, "05 1 2 3", result)
+}
+
+func TestRecursiveIncludeFails(t *testing.T) {
+	_, err := renderTemplate(`{{ define "loop" }}{{ include "loop" . }}{{ end }}{{ include "loop" . }}`, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "nested over 1000 levels deep")
+
+	_, err = renderTemplate(`{{ tpl "{{ tpl . . }}" "{{ tpl . . }}" }}`, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "nested over 1000 levels deep")
+}
+
+func TestRestrictedTemplates(t *testing.T) {
+	originalRestricted, originalAllowlist := restrictedTemplates, templateEnvAllowlist
+	defer func() { restrictedTemplates, templateEnvAllowlist = originalRestricted, originalAllowlist }()
+	t.Setenv("REGISTRY_HOST", "registry.example.com")
+	templateEnvAllowlist = []string{"REGISTRY_HOST"}
+
+	result, err := renderTemplate(`image: {{ env "REGISTRY_HOST" }}/app`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "image: registry.example.com/app", result)
+
+	restrictedTemplates = true
+	_, err = renderTemplate(`image: {{ env "REGISTRY_HOST" }}/app`, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "env is not available, templates are restricted by RESTRICTED_TEMPLATES")
+
+	_, err = renderTemplate(`{{ lookup "ConfigMap" "settings" }}`, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "lookup is not available")
+
+	_, err = renderTemplateWithOptions(context.Background(), `{{ getHostByName "example.com" }}`, nil, renderOptions{helm: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "getHostByName is not available")
+
+	result, err = renderTemplate(`name: {{ "build" | toString }}`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "name: build", result)
+
+	// Engines running a binary that could read the resolver's files are rejected
+	for _, engine := range []string{EngineJsonnet, EngineCUE, EngineYtt} {
+		assert.EqualError(t, checkRestrictedEngine(engine), "the "+engine+" engine is not allowed when RESTRICTED_TEMPLATES is set")
+	}
+	assert.NoError(t, checkRestrictedEngine(EngineGoTemplate))
+	assert.NoError(t, checkRestrictedEngine(EngineStarlark))
+	useEngineBinary(t, &jsonnetBinary, "echo '{}'\n")
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{"repo1:pipeline.jsonnet": `importstr "config.json"`}}}
+	_, err = r.Resolve(context.Background(), []pipelinev1.Param{
+		{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("repo1")},
+		{Name: PathParam, Value: *pipelinev1.NewStructuredValues("pipeline.jsonnet")},
+	})
+	assert.EqualError(t, err, "the jsonnet engine is not allowed when RESTRICTED_TEMPLATES is set")
+}
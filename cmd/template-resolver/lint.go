@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	"sigs.k8s.io/yaml"
+)
+
+// Severities of lint diagnostics
+const (
+	LintSeverityError   = "error"
+	LintSeverityWarning = "warning"
+)
+
+// missingValueMarker is what a Go template prints for a value missing from its data,
+// usually a param the request did not set
+const missingValueMarker = "<no value>"
+
+// lintDiagnostic is one problem found in a template
+type lintDiagnostic struct {
+	Severity string `json:"severity" description:"error or warning"`
+	Message  string `json:"message"`
+	// Field is the path of the offending field in the rendered resource, when known
+	Field string `json:"field,omitempty" description:"Path of the offending field in the rendered resource"`
+	// Line is the line of the rendered resource the diagnostic refers to, when known
+	Line int `json:"line,omitempty" description:"Line of the rendered resource the diagnostic refers to"`
+}
+
+// lintResult is the outcome of linting a template. It is valid when no diagnostic is an error.
+type lintResult struct {
+	Valid       bool             `json:"valid" description:"Whether no diagnostic is an error"`
+	Diagnostics []lintDiagnostic `json:"diagnostics"`
+	// Rendered holds the rendered template when rendering succeeded
+	Rendered string `json:"rendered,omitempty" description:"The rendered template, when rendering succeeded"`
+}
+
+// renderCaptureKey holds the renderCapture of a resolution in its context
+type renderCaptureKey struct{}
+
+// renderCapture records what the Go template of a resolution was rendered with, so lint can
+// check the template against its data and debug mode can show it. Resolutions with a
+// capture skip the render cache.
+type renderCapture struct {
+	content  string
+	data     map[string]interface{}
+	declared []string
+	// frontmatterLines is the number of lines of the frontmatter stripped from the content
+	frontmatterLines int
+	// sensitive are the values read from a Secret, which are never returned
+	sensitive []string
+}
+
+// withRenderCapture returns a context recording the render of the resolution made with it
+func withRenderCapture(ctx context.Context) (context.Context, *renderCapture) {
+	capture := &renderCapture{}
+	return context.WithValue(ctx, renderCaptureKey{}, capture), capture
+}
+
+// capturedRender returns the capture of the resolution, nil when the render is not recorded.
+// The templates resolved for another template are not recorded.
+func capturedRender(ctx context.Context) *renderCapture {
+	capture, _ := ctx.Value(renderCaptureKey{}).(*renderCapture)
+	if capture == nil || isNestedResolution(ctx) {
+		return nil
+	}
+	return capture
+}
+
+func (l *lintResult) add(severity, message, field string, line int) {
+	l.Diagnostics = append(l.Diagnostics, lintDiagnostic{Severity: severity, Message: message, Field: field, Line: line})
+	if severity == LintSeverityError {
+		l.Valid = false
+	}
+}
+
+// addFieldErrors adds a diagnostic for each path of a Tekton validation error
+func (l *lintResult) addFieldErrors(fieldErr *apis.FieldError) {
+	for _, e := range fieldErr.WrappedErrors() {
+		severity := LintSeverityError
+		if e.Level == apis.WarningLevel {
+			severity = LintSeverityWarning
+		}
+		message := e.Message
+		if e.Details != "" {
+			message += ": " + e.Details
+		}
+		if len(e.Paths) == 0 {
+			l.add(severity, message, "", 0)
+		}
+		for _, path := range e.Paths {
+			l.add(severity, message, path, 0)
+		}
+	}
+}
+
+// lint fetches and renders a template with the given params and runs every check the
+// resolver knows, reporting the problems instead of failing at the first one. Tekton
+// validation runs even when VALIDATE_RENDERED_RESOURCES is disabled.
+func (r *resolver) lint(ctx context.Context, params []pipelinev1.Param) lintResult {
+	result := lintResult{Valid: true, Diagnostics: []lintDiagnostic{}}
+	ctx, capture := withRenderCapture(ctx)
+
+	if err := r.ValidateParams(ctx, params); err != nil {
+		result.add(LintSeverityError, fmt.Sprintf("invalid parameters: %v", err), "", 0)
+		return result
+	}
+
+	resource, err := r.Resolve(ctx, params)
+	if err != nil {
+		var validationErr *tektonValidationError
+		if errors.As(err, &validationErr) {
+			result.addFieldErrors(validationErr.fieldErr)
+			result.addReferenceDiagnostics(capture)
+		} else {
+			result.add(LintSeverityError, err.Error(), "", 0)
+		}
+		return result
+	}
+	result.Rendered = string(resource.Data())
+
+	// Resolve only fails on errors, collect the warnings too
+	diagnostics, err := tektonDiagnostics(ctx, result.Rendered)
+	if err != nil {
+		result.add(LintSeverityError, err.Error(), "", 0)
+		return result
+	}
+	if diagnostics != nil {
+		result.addFieldErrors(diagnostics.fieldErr)
+	}
+
+	if err := strictTektonDecode(result.Rendered); err != nil {
+		result.add(LintSeverityWarning, err.Error(), "", 0)
+	}
+	for i, line := range strings.Split(result.Rendered, "\n") {
+		if strings.Contains(line, missingValueMarker) {
+			result.add(LintSeverityWarning, "template references a value that is not set", "", i+1)
+		}
+	}
+	result.addReferenceDiagnostics(capture)
+	return result
+}
+
+// addReferenceDiagnostics adds a warning for each field of the template data a Go template
+// uses that is neither a param or value of the request nor declared by its param schema,
+// including those in branches the render did not take
+func (l *lintResult) addReferenceDiagnostics(capture *renderCapture) {
+	if capture.data == nil {
+		return
+	}
+	undefined, err := undefinedDataReferences(capture.content, capture.data, capture.declared)
+	if err != nil {
+		return
+	}
+	for _, reference := range undefined {
+		l.add(LintSeverityWarning, fmt.Sprintf("template line %d references %s, which is not a declared param or a provided value", reference.Line+capture.frontmatterLines, reference), "", 0)
+	}
+}
+
+// strictTektonDecode reports fields of a rendered Tekton resource that its Go type does not
+// have, such as misspelled field names, which Tekton silently drops
+func strictTektonDecode(rendered string) error {
+	var typeMeta metav1.TypeMeta
+	if err := yaml.Unmarshal([]byte(rendered), &typeMeta); err != nil {
+		return nil
+	}
+	resource := newTektonResource(typeMeta.APIVersion, typeMeta.Kind)
+	if resource == nil {
+		return nil
+	}
+	if err := yaml.UnmarshalStrict([]byte(rendered), resource); err != nil {
+		return fmt.Errorf("rendered %s has fields Tekton ignores: %w", typeMeta.Kind, err)
+	}
+	return nil
+}
+
+// lintHandler renders a template and returns its diagnostics as JSON without resolving it
+// for Tekton, so template repositories can check their templates in CI.
+// Example request body: {"parameters": [{"name": "repository", "value": "..."}, ...]}
+func lintHandler(resolver *resolver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		var request resolveRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize)).Decode(&request); err != nil {
+			writeRequestBodyError(w, err, "Failed to parse request: %v")
+			return
+		}
+
+		result := resolver.lint(r.Context(), request.Parameters)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			logger.Errorf("Error writing response: %v", err)
+		}
+	}
+}
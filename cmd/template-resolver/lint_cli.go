@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// lintCommand is the subcommand linting local templates instead of serving requests
+const lintCommand = "lint"
+
+// lintFileResult is the lint result of one template file of the lint command
+type lintFileResult struct {
+	Template string `json:"template"`
+	lintResult
+}
+
+// failed reports whether the lint command fails for the template: on errors, and on
+// warnings unless they are allowed
+func (l lintFileResult) failed(allowWarnings bool) bool {
+	return !l.Valid || (!allowWarnings && len(l.Diagnostics) > 0)
+}
+
+// runLintCommand lints local templates rendered with a values file and params, as POST /lint
+// does, and writes their diagnostics to out. It reports whether every template passed, so
+// template repositories can fail their CI on problems.
+func runLintCommand(ctx context.Context, resolver *resolver, args []string, out io.Writer) (bool, error) {
+	usage := "usage: template-resolver lint [-values file] [-param name=value]... [-root dir] [-format text|json] [-allow-warnings] template..."
+	fs := flag.NewFlagSet(lintCommand, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	valuesFile := fs.String("values", "", "YAML values file the templates are rendered with")
+	root := fs.String("root", "", "Repository directory partials and files are read from (default: the directory of each template)")
+	format := fs.String("format", "text", "Output format, text or json")
+	allowWarnings := fs.Bool("allow-warnings", false, "Only fail on errors")
+	_ = fs.Bool("debug", debugMode, "Enable debug logging")
+	var params paramFlags
+	fs.Var(&params, "param", "Param of the request as name=value, repeatable")
+	if err := fs.Parse(args); err != nil {
+		return false, fmt.Errorf("%w\n%s", err, usage)
+	}
+	if fs.NArg() == 0 {
+		return false, fmt.Errorf("%s", usage)
+	}
+	if *format != "text" && *format != "json" {
+		return false, fmt.Errorf("invalid format %q, must be text or json", *format)
+	}
+
+	passed := true
+	results := make([]lintFileResult, 0, fs.NArg())
+	for _, templateFile := range fs.Args() {
+		resolveParams, err := renderCommandParams(templateFile, *root, *valuesFile, params)
+		if err != nil {
+			return false, err
+		}
+		result := lintFileResult{Template: templateFile, lintResult: resolver.lint(ctx, resolveParams)}
+		if result.failed(*allowWarnings) {
+			passed = false
+		}
+		results = append(results, result)
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return passed, encoder.Encode(results)
+	}
+	for _, result := range results {
+		if err := writeLintText(out, result); err != nil {
+			return false, err
+		}
+	}
+	return passed, nil
+}
+
+// writeLintText writes the diagnostics of a template as one line each, prefixed with the
+// template file like compiler output
+func writeLintText(out io.Writer, result lintFileResult) error {
+	if len(result.Diagnostics) == 0 {
+		_, err := fmt.Fprintf(out, "%s: ok\n", result.Template)
+		return err
+	}
+	for _, diagnostic := range result.Diagnostics {
+		location := ""
+		if diagnostic.Line > 0 {
+			location = fmt.Sprintf(" (rendered line %d)", diagnostic.Line)
+		}
+		if diagnostic.Field != "" {
+			location = fmt.Sprintf(" (%s)", diagnostic.Field)
+		}
+		if _, err := fmt.Fprintf(out, "%s: %s: %s%s\n", result.Template, diagnostic.Severity, diagnostic.Message, location); err != nil {
+			return err
+		}
+	}
+	return nil
+}
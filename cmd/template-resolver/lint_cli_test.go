@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunLintCommand(t *testing.T) {
+	originalAllow := allowFileRepositories
+	defer func() { allowFileRepositories = originalAllow }()
+	allowFileRepositories = true
+
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.yaml")
+	require.NoError(t, os.WriteFile(valid, []byte(`apiVersion: tekton.dev/v1
+kind: Task
+metadata:
+  name: {{ .Values.app }}
+spec:
+  steps:
+    - name: build
+      image: {{ .Image }}
+`), 0o600))
+	warnings := filepath.Join(dir, "warnings.yaml")
+	require.NoError(t, os.WriteFile(warnings, []byte(`apiVersion: tekton.dev/v1
+kind: Task
+metadata:
+  name: {{ .Values.app }}
+spec:
+  steps:
+    - name: build
+      image: {{ .Image }}
+{{- if .Verbose }}
+      args: ["-v"]
+{{- end }}
+`), 0o600))
+	invalid := filepath.Join(dir, "invalid.yaml")
+	require.NoError(t, os.WriteFile(invalid, []byte("apiVersion: tekton.dev/v1\nkind: Task\nmetadata:\n  name: {{ .Values.app }}\nspec: {}\n"), 0o600))
+	valuesFile := filepath.Join(dir, "values.yaml")
+	require.NoError(t, os.WriteFile(valuesFile, []byte("app: api\n"), 0o600))
+
+	r := NewResolver()
+	r.cache = newMemoryCache()
+	ctx := context.Background()
+	flags := []string{"-values", valuesFile, "-param", "image=alpine"}
+
+	var out bytes.Buffer
+	passed, err := runLintCommand(ctx, r, append(flags, valid), &out)
+	require.NoError(t, err)
+	assert.True(t, passed)
+	assert.Equal(t, valid+": ok\n", out.String())
+
+	// Warnings fail the command unless they are allowed
+	out.Reset()
+	passed, err = runLintCommand(ctx, r, append(flags, valid, warnings), &out)
+	require.NoError(t, err)
+	assert.False(t, passed)
+	assert.Contains(t, out.String(), warnings+": warning: template line 9 references .Verbose, which is not a declared param or a provided value\n")
+
+	out.Reset()
+	passed, err = runLintCommand(ctx, r, append([]string{"-allow-warnings"}, append(flags, warnings)...), &out)
+	require.NoError(t, err)
+	assert.True(t, passed)
+
+	out.Reset()
+	passed, err = runLintCommand(ctx, r, append([]string{"-format", "json", "-allow-warnings"}, append(flags, valid, invalid)...), &out)
+	require.NoError(t, err)
+	assert.False(t, passed)
+	var results []lintFileResult
+	require.NoError(t, json.Unmarshal(out.Bytes(), &results))
+	require.Len(t, results, 2)
+	assert.Equal(t, valid, results[0].Template)
+	assert.True(t, results[0].Valid)
+	assert.False(t, results[1].Valid)
+	assert.Equal(t, []lintDiagnostic{{Severity: LintSeverityError, Message: "missing field(s)", Field: "spec.steps"}}, results[1].Diagnostics)
+
+	_, err = runLintCommand(ctx, r, flags, &out)
+	assert.ErrorContains(t, err, "usage: template-resolver lint")
+
+	_, err = runLintCommand(ctx, r, []string{"-format", "xml", valid}, &out)
+	assert.ErrorContains(t, err, `invalid format "xml"`)
+}
+
+func TestWriteLintText(t *testing.T) {
+	var out bytes.Buffer
+	require.NoError(t, writeLintText(&out, lintFileResult{Template: "task.yaml", lintResult: lintResult{Diagnostics: []lintDiagnostic{
+		{Severity: LintSeverityError, Message: "missing field(s)", Field: "spec.steps"},
+		{Severity: LintSeverityWarning, Message: "template references a value that is not set", Line: 4},
+	}}}))
+	assert.Equal(t, "task.yaml: error: missing field(s) (spec.steps)\ntask.yaml: warning: template references a value that is not set (rendered line 4)\n", out.String())
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func lintParams(path string) []pipelinev1.Param {
+	return []pipelinev1.Param{
+		{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+		{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: path}},
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+	}
+}
+
+func TestResolverLint(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:valid.yaml": `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: {{ .AppName }}
+spec:
+  tasks:
+    - name: build
+      taskRef:
+        name: build
+`,
+		"repo1:warnings.yaml": `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: {{ .AppName }}
+  labels:
+    team: {{ .Team }}
+spec:
+  taks: []
+  tasks:
+    - name: build
+      taskRef:
+        name: build
+`,
+		"repo1:invalid.yaml": `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: {{ .AppName }}
+spec:
+  tasks:
+    - name: build
+    - name: test
+`,
+		"repo1:broken.yaml": "{{ .AppName",
+	}}}
+	ctx := context.Background()
+
+	result := r.lint(ctx, lintParams("valid.yaml"))
+	assert.True(t, result.Valid)
+	assert.Empty(t, result.Diagnostics)
+	assert.Contains(t, result.Rendered, "name: api")
+
+	result = r.lint(ctx, lintParams("warnings.yaml"))
+	assert.True(t, result.Valid)
+	require.Len(t, result.Diagnostics, 3)
+	assert.Equal(t, LintSeverityWarning, result.Diagnostics[0].Severity)
+	assert.Contains(t, result.Diagnostics[0].Message, `unknown field "taks"`)
+	assert.Equal(t, lintDiagnostic{Severity: LintSeverityWarning, Message: "template references a value that is not set", Line: 6}, result.Diagnostics[1])
+	assert.Equal(t, lintDiagnostic{Severity: LintSeverityWarning, Message: "template line 6 references .Team, which is not a declared param or a provided value"}, result.Diagnostics[2])
+
+	result = r.lint(ctx, lintParams("invalid.yaml"))
+	assert.False(t, result.Valid)
+	assert.Empty(t, result.Rendered)
+	fields := []string{}
+	for _, diagnostic := range result.Diagnostics {
+		assert.Equal(t, LintSeverityError, diagnostic.Severity)
+		fields = append(fields, diagnostic.Field)
+	}
+	assert.Contains(t, fields, "spec.tasks[0].taskRef")
+	assert.Contains(t, fields, "spec.tasks[1].taskSpec")
+
+	result = r.lint(ctx, lintParams("broken.yaml"))
+	assert.False(t, result.Valid)
+	require.Len(t, result.Diagnostics, 1)
+	assert.Contains(t, result.Diagnostics[0].Message, "failed to render template")
+
+	result = r.lint(ctx, lintParams("")[:1])
+	assert.False(t, result.Valid)
+	assert.Contains(t, result.Diagnostics[0].Message, "invalid parameters")
+}
+
+func TestResolverLintDataReferences(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:pipeline.yaml": `---
+params:
+  - name: team
+---
+apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: {{ .AppName }}
+  labels:
+    team: {{ with .Team }}{{ . }}{{ else }}none{{ end }}
+    image: {{ .Values.image }}
+{{- if .Deploy }}
+    region: {{ .Values.region }}
+{{- end }}
+spec:
+  tasks:
+    - name: build
+      taskRef:
+        name: build
+`,
+	}}}
+	params := append(lintParams("pipeline.yaml"), pipelinev1.Param{Name: ValuesParam, Value: *pipelinev1.NewStructuredValues("image: api:1.0\n")})
+
+	// The declared team param is known although it is not set, the branch that did not render is
+	// checked as well
+	result := r.lint(context.Background(), params)
+	assert.True(t, result.Valid)
+	assert.Equal(t, []lintDiagnostic{
+		{Severity: LintSeverityWarning, Message: "template line 12 references .Deploy, which is not a declared param or a provided value"},
+		{Severity: LintSeverityWarning, Message: "template line 13 references .Values.region, which is not a declared param or a provided value"},
+	}, result.Diagnostics)
+}
+
+func TestLintHandler(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:task.yaml": "apiVersion: tekton.dev/v1\nkind: Task\nmetadata:\n  name: {{ .AppName }}\nspec: {}\n",
+	}}}
+	handler := lintHandler(r)
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/lint", strings.NewReader(
+		`{"parameters": [{"name": "repository", "value": "repo1"}, {"name": "path", "value": "task.yaml"}, {"name": "app-name", "value": "api"}]}`)))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	var result lintResult
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	assert.False(t, result.Valid)
+	assert.Equal(t, []lintDiagnostic{{Severity: LintSeverityError, Message: "missing field(s)", Field: "spec.steps"}}, result.Diagnostics)
+
+	recorder = httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/lint", strings.NewReader("not json")))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodPost, "/lint", strings.NewReader(
+		`{"parameters": [{"name": "padding", "value": "`+strings.Repeat("x", maxRequestBodySize)+`"}]}`)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/lint", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
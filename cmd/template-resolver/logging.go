@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Log formats selectable with LOG_FORMAT
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+)
+
+// logger writes the logs of the resolver, replaced in main once LOG_FORMAT is known
+var logger = newLogger(DefaultLogFormat, os.Stderr)
+
+// newLogger creates a logger writing to w in the given format. Debug messages are written
+// while debug mode is set, which can change at runtime through the resolver ConfigMap.
+func newLogger(format string, w io.Writer) *zap.SugaredLogger {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = "timestamp"
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	var encoder zapcore.Encoder
+	if format == LogFormatConsole {
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	} else {
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	}
+
+	level := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return l >= zapcore.InfoLevel || currentSettings().debug
+	})
+	return zap.New(zapcore.NewCore(encoder, zapcore.AddSync(w), level)).Sugar()
+}
+
+// parseLogFormat validates the LOG_FORMAT setting, falling back to JSON
+func parseLogFormat(format string) string {
+	switch format {
+	case LogFormatJSON, LogFormatConsole:
+		return format
+	default:
+		logger.Warnf("Invalid value for %s, using default: %s", EnvLogFormat, DefaultLogFormat)
+		return DefaultLogFormat
+	}
+}
+
+type loggerKey struct{}
+
+// withLogFields returns a context whose logger adds the given key-value pairs to every
+// message, such as the request ID or the repository and path being resolved
+func withLogFields(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	return context.WithValue(ctx, loggerKey{}, contextLogger(ctx).With(keysAndValues...))
+}
+
+// contextLogger returns the logger of ctx, with the fields of the request it belongs to
+func contextLogger(ctx context.Context) *zap.SugaredLogger {
+	if l, ok := ctx.Value(loggerKey{}).(*zap.SugaredLogger); ok {
+		return l
+	}
+	return logger
+}
+
+// debugf prints debug messages only when debug mode is enabled
+func debugf(format string, args ...interface{}) {
+	logger.Debugf(format, args...)
+}
+
+// debugContextf prints debug messages like debugf, with the fields of the request ctx
+// belongs to, so the steps of concurrent resolutions can be told apart
+func debugContextf(ctx context.Context, format string, args ...interface{}) {
+	contextLogger(ctx).Debugf(format, args...)
+}
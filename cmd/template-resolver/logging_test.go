@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLog makes the logger write JSON to a buffer for the rest of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	original := logger
+	logger = newLogger(LogFormatJSON, &buf)
+	t.Cleanup(func() { logger = original })
+	return &buf
+}
+
+func TestNewLogger(t *testing.T) {
+	original := debugMode
+	defer func() { debugMode = original }()
+
+	var buf bytes.Buffer
+	l := newLogger(LogFormatJSON, &buf)
+	debugMode = false
+	l.Debugf("hidden")
+	l.Warnw("Failed to mirror", "repository", "https://github.com/org/repo")
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), `"level":"warn"`)
+	assert.Contains(t, buf.String(), `"msg":"Failed to mirror","repository":"https://github.com/org/repo"`)
+
+	// Debug messages follow debugMode, which the resolver ConfigMap can change at runtime
+	debugMode = true
+	l.Debugf("shown")
+	assert.Contains(t, buf.String(), `"msg":"shown"`)
+
+	buf.Reset()
+	newLogger(LogFormatConsole, &buf).Infow("Starting", "port", 8080)
+	assert.Regexp(t, `\tINFO\tStarting\t\{"port": 8080\}\n$`, buf.String())
+}
+
+func TestParseLogFormat(t *testing.T) {
+	captureLog(t)
+	assert.Equal(t, LogFormatConsole, parseLogFormat("console"))
+	assert.Equal(t, LogFormatJSON, parseLogFormat("json"))
+	assert.Equal(t, LogFormatJSON, parseLogFormat("logfmt"))
+}
+
+func TestDebugContextf(t *testing.T) {
+	logs := captureLog(t)
+	original := debugMode
+	defer func() { debugMode = original }()
+	debugMode = true
+
+	ctx := withLogFields(context.Background(), "request_id", "abc")
+	ctx = withLogFields(ctx, "repository", "repo1", "path", "pipeline.yaml")
+	debugContextf(ctx, "Fetching %s", "pipeline.yaml")
+	require.Contains(t, logs.String(), `"msg":"Fetching pipeline.yaml","request_id":"abc","repository":"repo1","path":"pipeline.yaml"`)
+
+	logs.Reset()
+	debugContextf(context.Background(), "Fetching %s", "task.yaml")
+	assert.Contains(t, logs.String(), `"msg":"Fetching task.yaml"}`)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/tektoncd/pipeline/pkg/resolution/common"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Kinds supported by the lookup template function
+const (
+	LookupKindConfigMap = "ConfigMap"
+	LookupKindSecret    = "Secret"
+)
+
+// lookupFunc returns the data of a ConfigMap or Secret for the lookup template function
+type lookupFunc func(kind, name string) (map[string]interface{}, error)
+
+// allowlisted reports whether value matches one of the path.Match patterns
+func allowlisted(value string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, value); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupSecretKeys returns the TEMPLATE_LOOKUP_SECRETS patterns ("name/key") of the keys
+// of the Secret name that templates may read
+func lookupSecretKeys(name string) []string {
+	var keys []string
+	for _, pattern := range templateLookupSecrets {
+		if secretName, _, ok := strings.Cut(pattern, "/"); ok && secretName == name {
+			keys = append(keys, pattern)
+		}
+	}
+	return keys
+}
+
+// lookup returns the lookup template function for one resolution. Only ConfigMaps matching
+// TEMPLATE_LOOKUP_CONFIGMAPS and Secret keys matching TEMPLATE_LOOKUP_SECRETS ("name/key")
+// in the namespace of the ResolutionRequest can be read. Like Helm's lookup, a missing
+// object returns an empty map. The values read from Secrets are added to the values ctx
+// redacts from the logs, so ctx should come from withRedaction.
+func (r *resolver) lookup(ctx context.Context) lookupFunc {
+	return func(kind, name string) (map[string]interface{}, error) {
+		if r.kubeClient == nil {
+			return nil, fmt.Errorf("lookup is only supported when running as a Tekton resolver")
+		}
+		namespace := common.RequestNamespace(ctx)
+		if namespace == "" {
+			return nil, fmt.Errorf("cannot look up %s %s: request namespace is unknown", kind, name)
+		}
+
+		data := map[string]interface{}{}
+		switch kind {
+		case LookupKindConfigMap:
+			if !allowlisted(name, templateLookupConfigMaps) {
+				return nil, fmt.Errorf("lookup of ConfigMap %s is not allowed by %s", name, EnvTemplateLookupConfigMaps)
+			}
+			configMap, err := r.kubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return data, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read ConfigMap %s/%s: %w", namespace, name, err)
+			}
+			for key, value := range configMap.Data {
+				data[key] = value
+			}
+
+		case LookupKindSecret:
+			keys := lookupSecretKeys(name)
+			if len(keys) == 0 {
+				return nil, fmt.Errorf("lookup of Secret %s is not allowed by %s", name, EnvTemplateLookupSecrets)
+			}
+			secret, err := r.kubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return data, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read Secret %s/%s: %w", namespace, name, err)
+			}
+			var values []string
+			for key, value := range secret.Data {
+				if allowlisted(name+"/"+key, keys) {
+					data[key] = string(value)
+					values = append(values, string(value))
+				}
+			}
+			// The values end up in the rendered template, which is logged in debug mode
+			withRedactedValues(ctx, values)
+
+		default:
+			return nil, fmt.Errorf("lookup does not support kind %q, use %s or %s", kind, LookupKindConfigMap, LookupKindSecret)
+		}
+
+		debugContextf(ctx, "Looked up %s %s/%s with %d keys", kind, namespace, name, len(data))
+		return data, nil
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tektoncd/pipeline/pkg/resolution/common"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLookup(t *testing.T) {
+	originalConfigMaps, originalSecrets := templateLookupConfigMaps, templateLookupSecrets
+	defer func() { templateLookupConfigMaps, templateLookupSecrets = originalConfigMaps, originalSecrets }()
+	templateLookupConfigMaps = []string{"cluster-*"}
+	templateLookupSecrets = []string{"registry/host", "registry/user*"}
+
+	r := &resolver{
+		kubeClient: fake.NewSimpleClientset(
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "cluster-settings", Namespace: "team-a"},
+				Data:       map[string]string{"environment": "staging"},
+			},
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "cluster-settings", Namespace: "team-b"},
+				Data:       map[string]string{"environment": "production"},
+			},
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "private", Namespace: "team-a"},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "team-a"},
+				Data:       map[string][]byte{"host": []byte("registry.example.com"), "username": []byte("bot"), "password": []byte("secret")},
+			},
+		),
+	}
+	lookup := r.lookup(common.InjectRequestNamespace(context.Background(), "team-a"))
+
+	// Objects are read from the request namespace
+	data, err := lookup(LookupKindConfigMap, "cluster-settings")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"environment": "staging"}, data)
+
+	// Missing objects are empty, like Helm
+	data, err = lookup(LookupKindConfigMap, "cluster-missing")
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	// Only allowlisted Secret keys are returned
+	data, err = lookup(LookupKindSecret, "registry")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"host": "registry.example.com", "username": "bot"}, data)
+
+	_, err = lookup(LookupKindConfigMap, "private")
+	assert.ErrorContains(t, err, "not allowed by TEMPLATE_LOOKUP_CONFIGMAPS")
+	_, err = lookup(LookupKindSecret, "other")
+	assert.ErrorContains(t, err, "not allowed by TEMPLATE_LOOKUP_SECRETS")
+	_, err = lookup("Pod", "cluster-settings")
+	assert.ErrorContains(t, err, `does not support kind "Pod"`)
+
+	// The function is available to templates
+	result, err := renderTemplateWithOptions(context.Background(), `env: {{ (lookup "ConfigMap" "cluster-settings").environment }}`, nil, renderOptions{lookup: lookup})
+	require.NoError(t, err)
+	assert.Equal(t, "env: staging", result)
+
+	// Standalone mode has no Kubernetes client
+	_, err = (&resolver{}).lookup(context.Background())(LookupKindConfigMap, "cluster-settings")
+	assert.ErrorContains(t, err, "only supported when running as a Tekton resolver")
+	_, err = renderTemplate(`{{ lookup "ConfigMap" "cluster-settings" }}`, nil)
+	assert.ErrorContains(t, err, "lookup is not available")
+}
+
+func TestLookupSecretRedaction(t *testing.T) {
+	originalSecrets, originalDebug := templateLookupSecrets, debugMode
+	defer func() { templateLookupSecrets, debugMode = originalSecrets, originalDebug }()
+	templateLookupSecrets = []string{"registry/password"}
+	debugMode = true
+	logs := captureLog(t)
+
+	r := &resolver{
+		kubeClient: fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "team-a"},
+			Data:       map[string][]byte{"password": []byte("hunter2-registry")},
+		}),
+	}
+	ctx := withRedaction(common.InjectRequestNamespace(context.Background(), "team-a"))
+	result, err := renderTemplateWithOptions(ctx, `password: {{ (lookup "Secret" "registry").password }}`, nil, renderOptions{lookup: r.lookup(ctx)})
+	require.NoError(t, err)
+	assert.Equal(t, "password: hunter2-registry", result)
+
+	// The rendered template is logged after the lookup, with the value redacted
+	assert.Contains(t, logs.String(), "password: [REDACTED]")
+	assert.NotContains(t, logs.String(), "hunter2-registry")
+}
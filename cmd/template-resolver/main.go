@@ -3,11 +3,10 @@ package main
 import (
 	"context"
 	"flag"
-	"log"
 	"os"
 	"strconv"
 
-	"github.com/tektoncd/pipeline/pkg/resolution/resolver/framework"
+	"golang.org/x/net/http/httpproxy"
 	"knative.dev/pkg/injection/sharedmain"
 )
 
@@ -17,6 +16,15 @@ func main() {
 	isStandalone := false
 	standalonePort := 8080
 
+	// The render, lint and test subcommands work on local templates and exit
+	command := ""
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case renderCommand, lintCommand, goldenCommand:
+			command = os.Args[1]
+		}
+	}
+
 	// Pre-scan args for standalone flag without using the flag package
 	for i, arg := range os.Args {
 		if arg == "-standalone" || arg == "--standalone" {
@@ -35,16 +43,135 @@ func main() {
 		debugMode = true
 	}
 
+	// Log in the configured format from here on
+	logger = newLogger(parseLogFormat(getEnvWithDefault(EnvLogFormat, DefaultLogFormat)), os.Stderr)
+	defer func() { _ = logger.Sync() }()
+
 	// Load configuration from environment variables
+	resolverName = getEnvWithDefault(EnvResolverName, DefaultResolverName)
+	resolverType = getEnvWithDefault(EnvResolverType, DefaultResolverType)
+	if err := validateResolverType(resolverType); err != nil {
+		logger.Fatalf("Invalid %s: %v", EnvResolverType, err)
+	}
+	resolverTypeAliases = getEnvWithDefaultList(EnvResolverAliases, nil)
+	for _, alias := range resolverTypeAliases {
+		if err := validateResolverType(alias); err != nil {
+			logger.Fatalf("Invalid %s: %v", EnvResolverAliases, err)
+		}
+	}
 	httpTimeout = getEnvWithDefaultDuration(EnvHTTPTimeout, DefaultHTTPTimeout)
+	httpMaxIdlePerHost = getEnvWithDefaultInt(EnvHTTPIdlePerHost, DefaultHTTPIdlePerHost)
+	httpRetries = getEnvWithDefaultInt(EnvHTTPRetries, DefaultHTTPRetries)
+	httpRetryBackoff = getEnvWithDefaultDuration(EnvHTTPRetryBackoff, DefaultHTTPRetryBackoff)
 	resolutionTimeout = getEnvWithDefaultDuration(EnvResolutionTimeout, DefaultResolutionTimeout)
 	gitCloneDepth = getEnvWithDefaultInt(EnvGitCloneDepth, DefaultGitCloneDepth)
+	setCloneConcurrency(getEnvWithDefaultInt(EnvGitCloneLimit, DefaultGitCloneLimit))
 	gitDefaultBranch = getEnvWithDefault(EnvGitBranch, DefaultGitBranch)
+	gitSSHKeyFile = getEnvWithDefault(EnvGitSSHKeyFile, DefaultGitSSHKeyFile)
+	gitSSHKnownHosts = getEnvWithDefault(EnvGitSSHKnownHosts, "")
+	if mode, err := parseSubmodulesMode(getEnvWithDefault(EnvGitSubmodules, DefaultGitSubmodules)); err == nil {
+		gitSubmodules = mode
+	} else {
+		logger.Warnf("Invalid value for %s, using default: %s", EnvGitSubmodules, DefaultGitSubmodules)
+	}
+	gitLFS = getEnvWithDefaultBool(EnvGitLFS, false)
+	gitCacheDir = getEnvWithDefault(EnvGitCacheDir, "")
+	gitMirrorRepositories = getEnvWithDefaultList(EnvGitMirrorRepos, nil)
+	gitMirrorInterval = getEnvWithDefaultDuration(EnvGitMirrorInterval, DefaultGitMirrorInterval)
+	gitRetries = getEnvWithDefaultInt(EnvGitRetries, DefaultGitRetries)
+	gitRetryBackoff = getEnvWithDefaultDuration(EnvGitRetryBackoff, DefaultGitRetryBackoff)
+	startupCheckRepositories = getEnvWithDefaultList(EnvCheckRepos, nil)
+	repositoryCredentials = parseRepositoryCredentials(getEnvWithDefaultList(EnvRepoCredentials, nil))
+	gitlabToken = getEnvWithDefault(EnvGitLabToken, "")
+	gitlabHosts = getEnvWithDefaultList(EnvGitLabHosts, nil)
+	githubToken = getEnvWithDefault(EnvGitHubToken, "")
+	githubAPIURL = getEnvWithDefault(EnvGitHubAPIURL, DefaultGitHubAPIURL)
+	githubRateLimitMaxWait = getEnvWithDefaultDuration(EnvGitHubMaxWait, DefaultGitHubMaxWait)
+	app, err := loadGitHubApp(getEnvWithDefault(EnvGitHubAppID, ""), getEnvWithDefault(EnvGitHubInstallID, ""), getEnvWithDefault(EnvGitHubAppKeyFile, ""))
+	if err != nil {
+		logger.Fatalf("Failed to configure GitHub App authentication: %v", err)
+	}
+	githubApp = app
+	ociPlainHTTP = getEnvWithDefaultBool(EnvOCIPlainHTTP, false)
+	s3Endpoint = getEnvWithDefault(EnvS3Endpoint, "")
+	azureBlobEndpoint = getEnvWithDefault(EnvAzureBlobEndpoint, "")
+	azureSASToken = getEnvWithDefault(EnvAzureSASToken, "")
+
+	giteaHosts = getEnvWithDefaultList(EnvGiteaHosts, DefaultGiteaHosts)
+	giteaToken = getEnvWithDefault(EnvGiteaToken, "")
+	artifactRepositoryHosts = getEnvWithDefaultList(EnvArtifactHosts, nil)
+	artifactRepositoryAPIKey = getEnvWithDefault(EnvArtifactAPIKey, "")
+	artifactRepositoryUsername = getEnvWithDefault(EnvArtifactUsername, "")
+	artifactRepositoryPassword = getEnvWithDefault(EnvArtifactPassword, "")
+
+	// Explicit proxy settings take precedence over the standard proxy environment variables
+	proxyEnv := httpproxy.FromEnvironment()
+	httpProxy = getEnvWithDefault(EnvHTTPProxy, proxyEnv.HTTPProxy)
+	httpsProxy = getEnvWithDefault(EnvHTTPSProxy, proxyEnv.HTTPSProxy)
+	noProxy = getEnvWithDefault(EnvNoProxy, proxyEnv.NoProxy)
+	netrcFile = getEnvWithDefault(EnvNetrc, defaultNetrcFile())
+
+	cacheBackend = getEnvWithDefault(EnvCacheBackend, DefaultCacheBackend)
+	cacheTTL = getEnvWithDefaultDuration(EnvCacheTTL, DefaultCacheTTL)
+	cacheMaxBytes = int64(getEnvWithDefaultInt(EnvCacheMaxBytes, DefaultCacheMaxBytes))
+	redisAddr = getEnvWithDefault(EnvRedisAddr, "")
+	redisPassword = getEnvWithDefault(EnvRedisPassword, "")
+	redisDB = getEnvWithDefaultInt(EnvRedisDB, 0)
+	adminPort = getEnvWithDefaultInt(EnvAdminPort, 0)
+	templateEnvAllowlist = getEnvWithDefaultList(EnvTemplateEnvAllow, nil)
+	templateLookupConfigMaps = getEnvWithDefaultList(EnvTemplateLookupConfigMaps, nil)
+	templateLookupSecrets = getEnvWithDefaultList(EnvTemplateLookupSecrets, nil)
+	renderNormalizeWhitespace = getEnvWithDefaultBool(EnvNormalizeSpace, false)
+	jsonnetBinary = getEnvWithDefault(EnvJsonnetBinary, DefaultJsonnetBinary)
+	cueBinary = getEnvWithDefault(EnvCUEBinary, DefaultCUEBinary)
+	yttBinary = getEnvWithDefault(EnvYttBinary, DefaultYttBinary)
+	validateRendered = getEnvWithDefaultBool(EnvValidateRendered, true)
+	declareWorkspaces = getEnvWithDefaultBool(EnvDeclareWorkspaces, true)
+	paramSchemaSidecars = getEnvWithDefaultBool(EnvParamSchemaFiles, false)
+	templateValuesFiles = getEnvWithDefaultBool(EnvValuesFiles, false)
+	coerceParamTypes = getEnvWithDefaultBool(EnvCoerceTypes, false)
+	structuredParamHeuristics = getEnvWithDefaultBool(EnvParamHeuristics, true)
+	strictYAML = getEnvWithDefaultBool(EnvStrictYAML, false)
+	declareParams = getEnvWithDefaultBool(EnvDeclareParams, false)
+	provenanceEnabled = getEnvWithDefaultBool(EnvProvenance, false)
+	if provenanceSigner, err = loadSigningKey(getEnvWithDefault(EnvProvenanceKey, "")); err != nil {
+		logger.Fatalf("Failed to configure provenance signing: %v", err)
+	}
+	rekorURL = getEnvWithDefault(EnvRekorURL, "")
+	if rekorURL != "" && provenanceSigner == nil {
+		logger.Warnf("%s is ignored without %s", EnvRekorURL, EnvProvenanceKey)
+	}
+	apiToken = loadAPIToken(getEnvWithDefault(EnvAPIToken, ""), getEnvWithDefault(EnvAPITokenFile, ""))
+	apiBasicAuthUsername = getEnvWithDefault(EnvAPIBasicUsername, "")
+	apiBasicAuthPassword = getEnvWithDefault(EnvAPIBasicPassword, "")
+	shutdownTimeout = getEnvWithDefaultDuration(EnvShutdownTimeout, DefaultShutdownTimeout)
+	rateLimitGlobal = getEnvWithDefaultInt(EnvRateLimitGlobal, 0)
+	rateLimitPerClient = getEnvWithDefaultInt(EnvRateLimitClient, 0)
+	rateLimitBurst = getEnvWithDefaultInt(EnvRateLimitBurst, DefaultRateLimitBurst)
+	pprofEnabled = getEnvWithDefaultBool(EnvPprof, false)
+	corsAllowedOrigins = getEnvWithDefaultList(EnvCORSOrigins, nil)
+	maxTemplateSize = int64(getEnvWithDefaultInt(EnvMaxTemplateSize, DefaultMaxTemplateSize))
+	renderTimeout = getEnvWithDefaultDuration(EnvRenderTimeout, DefaultRenderTimeout)
+	restrictedTemplates = getEnvWithDefaultBool(EnvRestrictTemplates, false)
+	webhookPort = getEnvWithDefaultInt(EnvWebhookPort, 0)
+	webhookCertFile = getEnvWithDefault(EnvWebhookCertFile, DefaultWebhookCertFile)
+	webhookKeyFile = getEnvWithDefault(EnvWebhookKeyFile, DefaultWebhookKeyFile)
+	webhookRepositories = getEnvWithDefaultList(EnvWebhookRepos, nil)
+	webhookDryRun = getEnvWithDefaultBool(EnvWebhookDryRun, false)
+	watchTemplates = parseWatchedTemplates(getEnvWithDefaultList(EnvWatchTemplates, nil))
+	watchInterval = getEnvWithDefaultDuration(EnvWatchInterval, DefaultWatchInterval)
+	watchWebhookSecret = getEnvWithDefault(EnvWatchSecret, "")
+
+	// Local file repositories are meant for template development in standalone mode
+	allowFileRepositories = getEnvWithDefaultBool(EnvAllowFileRepos, isStandalone || command != "")
+
+	// Settings from the resolver ConfigMap are applied on top of the environment
+	captureEnvSettings()
 
 	if debugMode {
-		log.Println("Debug mode enabled")
-		log.Printf("Configuration: HTTP Timeout=%v, Resolution Timeout=%v, Git Clone Depth=%d, Git Default Branch=%s",
-			httpTimeout, resolutionTimeout, gitCloneDepth, gitDefaultBranch)
+		logger.Info("Debug mode enabled")
+		logger.Infof("Configuration: HTTP Timeout=%v, Resolution Timeout=%v, Git Clone Depth=%d, Git Default Branch=%s, GitLab Hosts=%v",
+			httpTimeout, resolutionTimeout, gitCloneDepth, gitDefaultBranch, gitlabHosts)
 	}
 
 	// Create a new resolver instance
@@ -52,7 +179,46 @@ func main() {
 
 	// Initialize the resolver
 	if err := resolver.Initialize(context.Background()); err != nil {
-		log.Fatalf("Failed to initialize resolver: %v", err)
+		logger.Fatalf("Failed to initialize resolver: %v", err)
+	}
+
+	switch command {
+	case renderCommand:
+		if err := runRenderCommand(context.Background(), resolver, os.Args[2:], os.Stdout); err != nil {
+			logger.Fatalf("Failed to render template: %v", err)
+		}
+		return
+	case lintCommand:
+		passed, err := runLintCommand(context.Background(), resolver, os.Args[2:], os.Stdout)
+		if err != nil {
+			logger.Fatalf("Failed to lint templates: %v", err)
+		}
+		if !passed {
+			_ = logger.Sync()
+			os.Exit(1)
+		}
+		return
+	case goldenCommand:
+		passed, err := runGoldenCommand(context.Background(), resolver, os.Args[2:], os.Stdout)
+		if err != nil {
+			logger.Fatalf("Failed to test template: %v", err)
+		}
+		if !passed {
+			_ = logger.Sync()
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Warm the Git cache so the first requests after a deploy do not clone from scratch
+	startGitMirroring(gitMirrorRepositories, gitMirrorInterval)
+
+	// Keep watched templates cached and report those broken by a push
+	startTemplateWatcher(resolver, watchTemplates, watchInterval)
+
+	// Review PipelineRuns at admission so users see resolution errors at kubectl apply
+	if webhookPort > 0 {
+		go runWebhookServer(resolver, webhookPort)
 	}
 
 	// Choose between standalone mode and Knative mode
@@ -63,15 +229,20 @@ func main() {
 		_ = fs.Int("port", standalonePort, "Port to listen on in standalone mode")
 		_ = fs.Bool("standalone", true, "Run in standalone mode without Knative")
 		if err := fs.Parse(os.Args[1:]); err != nil {
-			log.Fatalf("Error parsing flags: %v", err)
+			logger.Fatalf("Error parsing flags: %v", err)
 		}
 
 		runStandalone(resolver, standalonePort)
 	} else {
+		// Standalone mode serves admin endpoints itself, the controller needs a separate port
+		if adminPort > 0 {
+			go runAdminServer(resolver, adminPort)
+		} else if pprofEnabled {
+			logger.Warnf("%s is set but %s is not, profiles are only served by the admin server", EnvPprof, EnvAdminPort)
+		}
+
 		// In Knative mode, let Knative handle all flag parsing
 		// Don't register our own flags, let Knative control them
-		sharedmain.Main("controller",
-			framework.NewController(context.Background(), resolver),
-		)
+		sharedmain.Main("controller", resolverControllers(context.Background(), resolver)...)
 	}
 }
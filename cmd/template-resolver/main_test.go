@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"strings"
 	"testing"
 	
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
 )
 
@@ -49,6 +51,24 @@ func TestResolverValidation(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "shallow submodules",
+			params: []pipelinev1.Param{
+				{Name: "repository", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "https://github.com/example/repo"}},
+				{Name: "path", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "path/to/template.yaml"}},
+				{Name: "submodules", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "shallow"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid submodules",
+			params: []pipelinev1.Param{
+				{Name: "repository", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "https://github.com/example/repo"}},
+				{Name: "path", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "path/to/template.yaml"}},
+				{Name: "submodules", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "recursive"}},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -70,6 +90,50 @@ func TestResolverFunctionsGetNameAndSelector(t *testing.T) {
 	
 	selector := r.GetSelector(ctx)
 	assert.Equal(t, "template", selector["resolution.tekton.dev/type"])
+
+	// Instances serving another catalog have their own name and selector
+	originalName, originalType := resolverName, resolverType
+	resolverName, resolverType = "Platform Templates", "platform-template"
+	defer func() { resolverName, resolverType = originalName, originalType }()
+	assert.Equal(t, "Platform Templates", r.GetName(ctx))
+	assert.Equal(t, map[string]string{"resolution.tekton.dev/type": "platform-template"}, r.GetSelector(ctx))
+}
+
+func TestValidateResolverType(t *testing.T) {
+	assert.NoError(t, validateResolverType("template"))
+	assert.NoError(t, validateResolverType("team.templates_v2"))
+	assert.ErrorContains(t, validateResolverType(""), "cannot be empty")
+	assert.ErrorContains(t, validateResolverType("team templates"), `invalid resolver type "team templates"`)
+	assert.Error(t, validateResolverType(strings.Repeat("t", 64)))
+}
+
+func TestAliasResolver(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{"repo1:pipeline.yaml": "name: {{ .Name }}\n"}}}
+	alias := &aliasResolver{resolver: r, resolverType: "tmpl"}
+	ctx := context.Background()
+
+	assert.Equal(t, "Template (tmpl)", alias.GetName(ctx))
+	assert.Equal(t, map[string]string{"resolution.tekton.dev/type": "tmpl"}, alias.GetSelector(ctx))
+	assert.Equal(t, ResolverConfigName, alias.GetConfigName(ctx))
+
+	resource, err := alias.Resolve(ctx, []pipelinev1.Param{
+		{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("repo1")},
+		{Name: PathParam, Value: *pipelinev1.NewStructuredValues("pipeline.yaml")},
+		{Name: "name", Value: *pipelinev1.NewStructuredValues("api")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "name: api\n", string(resource.Data()))
+}
+
+func TestResolverControllers(t *testing.T) {
+	r := NewResolver()
+	assert.Len(t, resolverControllers(context.Background(), r), 1)
+
+	// Each alias gets a controller, aliases of the resolver type itself are ignored
+	original := resolverTypeAliases
+	resolverTypeAliases = []string{"tmpl", "template", "team-template", "tmpl"}
+	defer func() { resolverTypeAliases = original }()
+	assert.Len(t, resolverControllers(context.Background(), r), 3)
 }
 
 func TestResolverInitialize(t *testing.T) {
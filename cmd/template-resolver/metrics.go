@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsNamespace prefixes the names of the resolver's Prometheus metrics
+const metricsNamespace = "template_resolver"
+
+// unknownRepository labels cache entries stored outside of the resolution of a repository
+const unknownRepository = "unknown"
+
+// otherRepository labels the metrics of the repositories the resolver is not configured for
+const otherRepository = "other"
+
+// Reasons cache entries are evicted for, the reason label of the evictions metric
+const (
+	evictionExpired     = "expired"
+	evictionInvalidated = "invalidated"
+	evictionSize        = "size"
+)
+
+// metricsRegistry holds the resolver's metrics, served on /metrics of the standalone server
+// and the admin server. The Knative controller exports its own metrics separately.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "cache",
+		Name:      "lookups_total",
+		Help:      "Cache lookups by cache, repository and result, hit or miss.",
+	}, []string{"cache", "repository", "result"})
+
+	cacheEntries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "cache",
+		Name:      "entries",
+		Help:      "Entries held by the memory cache by cache and repository.",
+	}, []string{"cache", "repository"})
+
+	cacheBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "cache",
+		Name:      "bytes",
+		Help:      "Size of the values held by the memory cache by cache and repository.",
+	}, []string{"cache", "repository"})
+
+	cacheEvictions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "cache",
+		Name:      "evictions_total",
+		Help:      "Cache entries evicted by cache, repository and reason, expired, invalidated or size.",
+	}, []string{"cache", "repository", "reason"})
+
+	fetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "fetch_duration_seconds",
+		Help:      "Time taken to fetch templates that were not cached, by backend and repository.",
+		Buckets:   latencyBuckets,
+	}, []string{"backend", "repository"})
+
+	resolutionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "resolution_duration_seconds",
+		Help:      "Time taken to resolve templates, successfully or not, by backend and repository.",
+		Buckets:   latencyBuckets,
+	}, []string{"backend", "repository"})
+
+	watchedTemplateValid = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "watched_template_valid",
+		Help:      "Whether the last change of a watched template passed lint, 1, or not, 0, by hashed repository, path and revision.",
+	}, []string{"repository_hash", "path", "revision"})
+)
+
+// latencyBuckets spans fetches and resolutions from 10ms, served from a cache, to 40s, cloning
+// a large repository
+var latencyBuckets = prometheus.ExponentialBuckets(0.01, 2, 13)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		cacheLookups, cacheEntries, cacheBytes, cacheEvictions,
+		fetchDuration, resolutionDuration, watchedTemplateValid,
+	)
+}
+
+// registerMetrics serves the resolver's metrics in the Prometheus format under /metrics
+func registerMetrics(mux *http.ServeMux) {
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+}
+
+type cacheRepositoryKey struct{}
+
+// withCacheRepository attributes the cache lookups and entries made with the returned
+// context to a repository, labeled by metricsRepository
+func withCacheRepository(ctx context.Context, repository string) context.Context {
+	return context.WithValue(ctx, cacheRepositoryKey{}, metricsRepository(repository))
+}
+
+// cacheRepository returns the repository label cache lookups and entries made with ctx are
+// attributed to
+func cacheRepository(ctx context.Context) string {
+	if repository, ok := ctx.Value(cacheRepositoryKey{}).(string); ok && repository != "" {
+		return repository
+	}
+	return unknownRepository
+}
+
+// repositoryLabel returns a repository URL without the credentials, query or fragment it
+// may have, so they are not exposed in metric labels
+func repositoryLabel(repository string) string {
+	parsed, err := url.Parse(repository)
+	if err != nil || parsed.Scheme == "" {
+		// SCP-like SSH URLs such as git@github.com:org/repo carry no password
+		return repository
+	}
+	parsed.User = nil
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+	return parsed.String()
+}
+
+// metricsRepository returns the repository label of the metrics of a repository. Requests
+// choose their repository, so only the repositories the resolver is configured for are
+// labeled by their repositoryLabel: those of GIT_MIRROR_REPOSITORIES,
+// STARTUP_CHECK_REPOSITORIES and WATCH_TEMPLATES, and those matching a pattern of
+// REPOSITORY_CREDENTIALS or WEBHOOK_ALLOWED_REPOSITORIES. Other repositories share the
+// label "other", which keeps the number of series bounded.
+func metricsRepository(repository string) string {
+	name, err := repositoryName(repository)
+	if err != nil {
+		return otherRepository
+	}
+	configured := func(repoURL string) bool {
+		configuredName, err := repositoryName(repoURL)
+		return err == nil && configuredName == name
+	}
+	if slices.ContainsFunc(gitMirrorRepositories, configured) || slices.ContainsFunc(startupCheckRepositories, configured) ||
+		slices.ContainsFunc(watchTemplates, func(template watchedTemplate) bool { return configured(template.repository) }) ||
+		slices.ContainsFunc(repositoryCredentials, func(credential repositoryCredential) bool { return allowlisted(name, []string{credential.pattern}) }) ||
+		allowlisted(name, webhookRepositories) {
+		return repositoryLabel(repository)
+	}
+	return otherRepository
+}
+
+// cacheName returns the cache label of a key, the prefix cacheKey built it with: template
+// for fetched templates, rendered for rendered results and raw for raw file responses
+func cacheName(key string) string {
+	name, _, _ := strings.Cut(key, ":")
+	return name
+}
+
+// recordCacheLookup counts a cache lookup as a hit or a miss
+func recordCacheLookup(ctx context.Context, key string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheLookups.WithLabelValues(cacheName(key), cacheRepository(ctx), result).Inc()
+}
+
+// recordCacheEntry adds an entry of the memory cache to its gauges, or removes it when
+// delta is -1
+func recordCacheEntry(repository, key string, size, delta int) {
+	name := cacheName(key)
+	cacheEntries.WithLabelValues(name, repository).Add(float64(delta))
+	cacheBytes.WithLabelValues(name, repository).Add(float64(delta * size))
+}
+
+// recordCacheEvictions counts entries evicted from the cache
+func recordCacheEvictions(repository, key, reason string, count int) {
+	if count > 0 {
+		cacheEvictions.WithLabelValues(cacheName(key), repository, reason).Add(float64(count))
+	}
+}
+
+// repositoryHash returns the first 12 hex digits of the SHA-256 of a repository URL without
+// its credentials, which labels the watched template metric without revealing repository names
+func repositoryHash(repository string) string {
+	sum := sha256.Sum256([]byte(repositoryLabel(repository)))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// observeFetch records how long fetching a template from a repository took
+func observeFetch(repository string, opts FetchOptions, started time.Time) {
+	fetchDuration.WithLabelValues(fetchBackend(repository, opts), metricsRepository(repository)).Observe(time.Since(started).Seconds())
+}
+
+// observeResolution records how long resolving a template from a repository took
+func observeResolution(repository string, opts FetchOptions, started time.Time) {
+	resolutionDuration.WithLabelValues(fetchBackend(repository, opts), metricsRepository(repository)).Observe(time.Since(started).Seconds())
+}
+
+// recordWatchedTemplate records whether a watched template passed lint
+func recordWatchedTemplate(template watchedTemplate, valid bool) {
+	value := 0.0
+	if valid {
+		value = 1
+	}
+	watchedTemplateValid.WithLabelValues(repositoryHash(template.repository), template.path, template.revision).Set(value)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+// maxNestedDepth limits how deeply templates can be built from other templates, counting
+// the template requested by the ResolutionRequest
+const maxNestedDepth = 5
+
+// paramReferencePattern matches the $(params.<name>) references in dependency params
+var paramReferencePattern = regexp.MustCompile(`\$\(params\.([A-Za-z0-9_-]+)\)`)
+
+// templateDependency declares another template a template is built from. The dependency is
+// resolved like a ResolutionRequest with the given params, and its rendered result is
+// available to Go templates as .Templates.<name>.
+type templateDependency struct {
+	Name string `json:"name"`
+	// Repository defaults to the repository of the template
+	Repository string `json:"repository,omitempty"`
+	Path       string `json:"path"`
+	// Revision defaults to the revision of the template for the same repository, and to the
+	// default branch for other repositories
+	Revision string `json:"revision,omitempty"`
+	// Params can use $(params.<name>) to pass on the params of the template
+	Params []pipelinev1.Param `json:"params,omitempty"`
+}
+
+// nestedResolutionKey holds the templates being resolved in the context of a nested
+// resolution, from the requested template down to the one depending on it
+type nestedResolutionKey struct{}
+
+// resolutionChain returns the templates whose dependencies are being resolved, empty for
+// the template of a ResolutionRequest
+func resolutionChain(ctx context.Context) []string {
+	chain, _ := ctx.Value(nestedResolutionKey{}).([]string)
+	return chain
+}
+
+// isNestedResolution reports whether the template is resolved as the dependency of another
+// template, whose rendered result is spliced into the other template rather than returned
+func isNestedResolution(ctx context.Context) bool {
+	return len(resolutionChain(ctx)) > 0
+}
+
+// templateLocation identifies a template in error messages and the resolution chain
+func templateLocation(repository, revision, templatePath string) string {
+	if revision == "" {
+		return repository + ":" + templatePath
+	}
+	return repository + "@" + revision + ":" + templatePath
+}
+
+// resolveDependencies resolves the templates a template declares it is built from, and
+// returns their rendered results by name. Dependencies are resolved recursively, failing on
+// cycles and past maxNestedDepth.
+func (r *resolver) resolveDependencies(ctx context.Context, dependencies []templateDependency, repository, revision, templatePath string, params []pipelinev1.Param) (map[string]interface{}, error) {
+	if len(dependencies) == 0 {
+		return nil, nil
+	}
+	chain := append(slices.Clone(resolutionChain(ctx)), templateLocation(repository, revision, templatePath))
+	if len(chain) >= maxNestedDepth {
+		return nil, fmt.Errorf("templates are nested more than %d levels deep: %s", maxNestedDepth, strings.Join(chain, " -> "))
+	}
+
+	results := make(map[string]interface{}, len(dependencies))
+	for _, dependency := range dependencies {
+		childParams, location, err := dependencyParams(dependency, repository, revision, params)
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %w", dependency.Name, err)
+		}
+		if slices.Contains(chain, location) {
+			return nil, fmt.Errorf("template %q forms a cycle: %s -> %s", dependency.Name, strings.Join(chain, " -> "), location)
+		}
+
+		debugContextf(ctx, "Resolving template %q from %s", dependency.Name, location)
+		resource, err := r.Resolve(context.WithValue(ctx, nestedResolutionKey{}, chain), childParams)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve template %q: %w", dependency.Name, err)
+		}
+		results[dependency.Name] = string(resource.Data())
+	}
+	return results, nil
+}
+
+// dependencyParams returns the params resolving a dependency and its location. Dependencies
+// in the same repository are read with the Git credentials secret of the template. The params
+// a dependency declares are template input only: resolution options, such as a Git
+// credentials secret or values from a Secret, would let a template read Secrets of the
+// caller on behalf of another repository, and its location is set by its own fields.
+func dependencyParams(dependency templateDependency, repository, revision string, params []pipelinev1.Param) ([]pipelinev1.Param, string, error) {
+	childRepository, childRevision := dependency.Repository, dependency.Revision
+	sameRepository := childRepository == "" || childRepository == repository
+	if sameRepository {
+		childRepository = repository
+		if childRevision == "" {
+			childRevision = revision
+		}
+	}
+
+	result := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues(childRepository)},
+		{Name: PathParam, Value: *pipelinev1.NewStructuredValues(dependency.Path)},
+	}
+	if childRevision != "" {
+		result = append(result, pipelinev1.Param{Name: RevisionParam, Value: *pipelinev1.NewStructuredValues(childRevision)})
+	}
+	for _, param := range params {
+		if param.Name == GitCredentialsSecretParam && sameRepository {
+			result = append(result, param)
+		}
+	}
+
+	given := make(map[string]pipelinev1.ParamValue, len(params))
+	for _, param := range params {
+		given[param.Name] = param.Value
+	}
+	for _, param := range dependency.Params {
+		switch {
+		case isOptionParam(param.Name):
+			return nil, "", fmt.Errorf("param %q is a resolution option, which dependencies cannot set", param.Name)
+		case param.Name == RepositoryParam || param.Name == PathParam || param.Name == RevisionParam:
+			return nil, "", fmt.Errorf("param %q is set by the %s of the dependency", param.Name, param.Name)
+		}
+		value, err := substituteParamReferences(param.Value, given)
+		if err != nil {
+			return nil, "", fmt.Errorf("param %q: %w", param.Name, err)
+		}
+		result = append(result, pipelinev1.Param{Name: param.Name, Value: value})
+	}
+	return result, templateLocation(childRepository, childRevision, dependency.Path), nil
+}
+
+// substituteParamReferences replaces the $(params.<name>) references in the value of a
+// dependency param with the params of the template. A string that is only a reference takes
+// the value of the param whatever its type, so arrays and objects can be passed on.
+func substituteParamReferences(value pipelinev1.ParamValue, params map[string]pipelinev1.ParamValue) (pipelinev1.ParamValue, error) {
+	var err error
+	replace := func(text string) string {
+		return paramReferencePattern.ReplaceAllStringFunc(text, func(reference string) string {
+			name := paramReferencePattern.FindStringSubmatch(reference)[1]
+			param, ok := params[name]
+			switch {
+			case !ok:
+				err = fmt.Errorf("references param %q, which is not set", name)
+			case param.Type != pipelinev1.ParamTypeString:
+				err = fmt.Errorf("references %s param %q inside a string", param.Type, name)
+			default:
+				return param.StringVal
+			}
+			return reference
+		})
+	}
+
+	switch value.Type {
+	case pipelinev1.ParamTypeArray:
+		items := make([]string, len(value.ArrayVal))
+		for i, item := range value.ArrayVal {
+			items[i] = replace(item)
+		}
+		return pipelinev1.ParamValue{Type: value.Type, ArrayVal: items}, err
+	case pipelinev1.ParamTypeObject:
+		object := make(map[string]string, len(value.ObjectVal))
+		for key, item := range value.ObjectVal {
+			object[key] = replace(item)
+		}
+		return pipelinev1.ParamValue{Type: value.Type, ObjectVal: object}, err
+	default:
+		if match := paramReferencePattern.FindStringSubmatch(value.StringVal); match != nil && match[0] == value.StringVal {
+			param, ok := params[match[1]]
+			if !ok {
+				return value, fmt.Errorf("references param %q, which is not set", match[1])
+			}
+			return param, nil
+		}
+		return pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: replace(value.StringVal)}, err
+	}
+}
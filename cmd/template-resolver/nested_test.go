@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestSubstituteParamReferences(t *testing.T) {
+	params := map[string]pipelinev1.ParamValue{
+		"app-name": *pipelinev1.NewStructuredValues("api"),
+		"regions":  *pipelinev1.NewStructuredValues("us-east-1", "eu-west-1"),
+	}
+
+	value, err := substituteParamReferences(*pipelinev1.NewStructuredValues("$(params.app-name)-build"), params)
+	require.NoError(t, err)
+	assert.Equal(t, *pipelinev1.NewStructuredValues("api-build"), value)
+
+	// A whole reference passes on the value whatever its type
+	value, err = substituteParamReferences(*pipelinev1.NewStructuredValues("$(params.regions)"), params)
+	require.NoError(t, err)
+	assert.Equal(t, params["regions"], value)
+
+	value, err = substituteParamReferences(*pipelinev1.NewObject(map[string]string{"name": "$(params.app-name)"}), params)
+	require.NoError(t, err)
+	assert.Equal(t, *pipelinev1.NewObject(map[string]string{"name": "api"}), value)
+
+	_, err = substituteParamReferences(*pipelinev1.NewStructuredValues("$(params.missing)"), params)
+	assert.ErrorContains(t, err, `references param "missing", which is not set`)
+	_, err = substituteParamReferences(*pipelinev1.NewStructuredValues("in $(params.regions)"), params)
+	assert.ErrorContains(t, err, `references array param "regions" inside a string`)
+}
+
+func TestDependencyParams(t *testing.T) {
+	params := []pipelinev1.Param{
+		{Name: GitCredentialsSecretParam, Value: *pipelinev1.NewStructuredValues("git-creds")},
+		{Name: "app-name", Value: *pipelinev1.NewStructuredValues("api")},
+	}
+
+	childParams, location, err := dependencyParams(templateDependency{
+		Name:   "build",
+		Path:   "lib/build.yaml",
+		Params: []pipelinev1.Param{{Name: "name", Value: *pipelinev1.NewStructuredValues("$(params.app-name)")}},
+	}, "repo1", "v1", params)
+	require.NoError(t, err)
+	assert.Equal(t, "repo1@v1:lib/build.yaml", location)
+	assert.Equal(t, []pipelinev1.Param{
+		{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("repo1")},
+		{Name: PathParam, Value: *pipelinev1.NewStructuredValues("lib/build.yaml")},
+		{Name: RevisionParam, Value: *pipelinev1.NewStructuredValues("v1")},
+		{Name: GitCredentialsSecretParam, Value: *pipelinev1.NewStructuredValues("git-creds")},
+		{Name: "name", Value: *pipelinev1.NewStructuredValues("api")},
+	}, childParams)
+
+	// Other repositories use their default branch and not the credentials of the template
+	childParams, location, err = dependencyParams(templateDependency{Name: "lint", Repository: "repo2", Path: "lint.yaml"}, "repo1", "v1", params)
+	require.NoError(t, err)
+	assert.Equal(t, "repo2:lint.yaml", location)
+	assert.Len(t, childParams, 2)
+
+	// Dependencies cannot set resolution options, so a template in another repository cannot
+	// be read with the credentials or Secrets of the caller
+	for _, name := range []string{GitCredentialsSecretParam, ValuesFromSecretParam, BindingParam, RepositoryParam} {
+		_, _, err = dependencyParams(templateDependency{
+			Name:       "lint",
+			Repository: "https://attacker.example.com/templates.git",
+			Path:       "lint.yaml",
+			Params:     []pipelinev1.Param{{Name: name, Value: *pipelinev1.NewStructuredValues("$(params.git-credentials-secret)")}},
+		}, "repo1", "v1", params)
+		assert.ErrorContains(t, err, fmt.Sprintf("param %q", name))
+	}
+}
+
+func TestResolverNestedTemplates(t *testing.T) {
+	r := &resolver{fetcher: &notFoundFetcher{templates: map[string]string{
+		"repo1:pipeline.yaml": `---
+params:
+  - name: app-name
+templates:
+  - name: build
+    path: lib/build.yaml
+    params:
+      - name: task-name
+        value: $(params.app-name)-build
+  - name: lint
+    repository: repo2
+    path: lint.yaml
+---
+apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: {{ .AppName }}
+spec:
+  tasks:
+{{ .Templates.build | indent 4 }}
+{{ .Templates.lint | indent 4 }}
+`,
+		"repo1:lib/build.yaml": `---
+templates:
+  - name: step
+    path: lib/step.yaml
+---
+- name: {{ .TaskName }}
+  taskSpec:
+    steps:
+{{ .Templates.step | indent 6 }}`,
+		"repo1:lib/step.yaml": "- name: build\n  image: golang:1.24",
+		"repo2:lint.yaml":     "- name: lint\n  taskRef:\n    name: golangci-lint",
+		"repo1:cycle.yaml":    "---\ntemplates:\n  - name: self\n    path: cycle.yaml\n---\n{{ .Templates.self }}",
+		"repo1:chain-1.yaml":  "---\ntemplates:\n  - name: next\n    path: chain-2.yaml\n---\n{{ .Templates.next }}",
+		"repo1:chain-2.yaml":  "---\ntemplates:\n  - name: next\n    path: chain-3.yaml\n---\n{{ .Templates.next }}",
+		"repo1:chain-3.yaml":  "---\ntemplates:\n  - name: next\n    path: chain-4.yaml\n---\n{{ .Templates.next }}",
+		"repo1:chain-4.yaml":  "---\ntemplates:\n  - name: next\n    path: chain-5.yaml\n---\n{{ .Templates.next }}",
+		"repo1:chain-5.yaml":  "---\ntemplates:\n  - name: next\n    path: chain-6.yaml\n---\n{{ .Templates.next }}",
+		"repo1:chain-6.yaml":  "done",
+	}}}
+	resolve := func(path string) (string, error) {
+		resource, err := r.Resolve(context.Background(), []pipelinev1.Param{
+			{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("repo1")},
+			{Name: PathParam, Value: *pipelinev1.NewStructuredValues(path)},
+			{Name: "app-name", Value: *pipelinev1.NewStructuredValues("api")},
+		})
+		if err != nil {
+			return "", err
+		}
+		return string(resource.Data()), nil
+	}
+
+	rendered, err := resolve("pipeline.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: api
+spec:
+  tasks:
+    - name: api-build
+      taskSpec:
+        steps:
+          - name: build
+            image: golang:1.24
+    - name: lint
+      taskRef:
+        name: golangci-lint
+`, rendered)
+
+	_, err = resolve("cycle.yaml")
+	assert.ErrorContains(t, err, `template "self" forms a cycle: repo1:cycle.yaml -> repo1:cycle.yaml`)
+
+	_, err = resolve("chain-1.yaml")
+	assert.ErrorContains(t, err, "templates are nested more than 5 levels deep")
+}
+
+func TestParseParamSchemaTemplates(t *testing.T) {
+	schema, err := parseParamSchema([]byte("templates:\n  - name: build\n    path: lib/build.yaml\n    params:\n      - name: regions\n        value: [us-east-1]\n"))
+	require.NoError(t, err)
+	require.Len(t, schema.Templates, 1)
+	assert.Equal(t, pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{"us-east-1"}}, schema.Templates[0].Params[0].Value)
+
+	_, err = parseParamSchema([]byte("templates:\n  - path: lib/build.yaml\n"))
+	assert.ErrorContains(t, err, "templates[0] has no name")
+	_, err = parseParamSchema([]byte("templates:\n  - name: build\n"))
+	assert.ErrorContains(t, err, `template "build" has no path`)
+	_, err = parseParamSchema([]byte("templates:\n  - name: build\n    path: a.yaml\n  - name: build\n    path: b.yaml\n"))
+	assert.ErrorContains(t, err, `template "build" is declared twice`)
+}
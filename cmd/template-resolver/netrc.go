@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// netrcMachine holds the credentials of one machine entry of a .netrc file
+type netrcMachine struct {
+	login    string
+	password string
+}
+
+// netrcCredentials holds the parsed .netrc file. The file is parsed again when its
+// modification time changes, so rotated Secrets are picked up without a restart.
+var netrcCredentials struct {
+	mu       sync.Mutex
+	path     string
+	modified time.Time
+	machines map[string]netrcMachine
+}
+
+// defaultNetrcFile returns ~/.netrc, where curl and Git look for it as well
+func defaultNetrcFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// parseNetrc parses the machine and default entries of a .netrc file. The default entry
+// is stored under the empty machine name, and macdef macros are skipped.
+func parseNetrc(data string) map[string]netrcMachine {
+	machines := map[string]netrcMachine{}
+	var name string
+	var current *netrcMachine
+	save := func() {
+		if current != nil {
+			if _, ok := machines[name]; !ok {
+				machines[name] = *current
+			}
+		}
+	}
+
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			if strings.HasPrefix(fields[j], "#") {
+				break
+			}
+			switch fields[j] {
+			case "machine", "default":
+				save()
+				current = &netrcMachine{}
+				name = ""
+				if fields[j] == "machine" && j+1 < len(fields) {
+					j++
+					name = fields[j]
+				}
+			case "login", "password":
+				if current == nil || j+1 >= len(fields) {
+					continue
+				}
+				if fields[j] == "login" {
+					current.login = fields[j+1]
+				} else {
+					current.password = fields[j+1]
+				}
+				j++
+			case "macdef":
+				// Macros run until the next blank line
+				save()
+				current = nil
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			}
+		}
+	}
+	save()
+	return machines
+}
+
+// netrcLookup returns the credentials of host from the .netrc file at netrcFile, falling
+// back to its default entry
+func netrcLookup(host string) (netrcMachine, bool) {
+	if netrcFile == "" {
+		return netrcMachine{}, false
+	}
+	info, err := os.Stat(netrcFile)
+	if err != nil {
+		return netrcMachine{}, false
+	}
+
+	netrcCredentials.mu.Lock()
+	defer netrcCredentials.mu.Unlock()
+	if netrcCredentials.path != netrcFile || !netrcCredentials.modified.Equal(info.ModTime()) {
+		data, err := os.ReadFile(netrcFile)
+		if err != nil {
+			logger.Warnf("Failed to read %s: %v", netrcFile, err)
+			return netrcMachine{}, false
+		}
+		netrcCredentials.path = netrcFile
+		netrcCredentials.modified = info.ModTime()
+		netrcCredentials.machines = parseNetrc(string(data))
+		debugf("Loaded %d entries from %s", len(netrcCredentials.machines), netrcFile)
+	}
+
+	if machine, ok := netrcCredentials.machines[host]; ok {
+		return machine, true
+	}
+	machine, ok := netrcCredentials.machines[""]
+	return machine, ok
+}
+
+// netrcTransport adds basic auth from the .netrc file to HTTPS requests that carry no
+// credentials of their own, like curl --netrc. Plain HTTP requests are sent unchanged so
+// the credentials never cross the network unencrypted.
+type netrcTransport struct {
+	base http.RoundTripper
+}
+
+func (t *netrcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" || req.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+	machine, ok := netrcLookup(req.URL.Hostname())
+	if !ok || (machine.login == "" && machine.password == "") {
+		return t.base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the request they are given
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(machine.login, machine.password)
+	debugf("Sending credentials from %s to %s", netrcFile, req.URL.Host)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNetrc(t *testing.T) {
+	machines := parseNetrc(`# credentials rendered from a Secret
+machine artifacts.example.com
+  login ci
+  password s3cret
+
+macdef init
+machine ignored.example.com login nobody password nothing
+
+machine git.example.com login bot password token # trailing comment
+machine git.example.com login second password entry
+default login anonymous password guest
+`)
+	assert.Equal(t, map[string]netrcMachine{
+		"artifacts.example.com": {login: "ci", password: "s3cret"},
+		"git.example.com":       {login: "bot", password: "token"},
+		"":                      {login: "anonymous", password: "guest"},
+	}, machines)
+}
+
+func TestNetrcTransport(t *testing.T) {
+	original := netrcFile
+	defer func() { netrcFile = original }()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		_, _ = w.Write([]byte(user + ":" + password + ":" + r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	netrcFile = filepath.Join(t.TempDir(), ".netrc")
+	require.NoError(t, os.WriteFile(netrcFile, []byte("machine "+serverURL.Hostname()+" login ci password s3cret\n"), 0o600))
+	client := &http.Client{Transport: &netrcTransport{base: server.Client().Transport}}
+
+	get := func(target string, header string) string {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		require.NoError(t, err)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+		body, err := readTemplate(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	assert.Equal(t, "ci:s3cret:Basic Y2k6czNjcmV0", get(server.URL, ""))
+
+	// Credentials of the request itself take precedence
+	assert.Equal(t, "::Bearer token", get(server.URL, "Bearer token"))
+
+	// A rotated file is read again
+	require.NoError(t, os.WriteFile(netrcFile, []byte("default login other password rotated\n"), 0o600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(netrcFile, later, later))
+	assert.Equal(t, "other:rotated:Basic b3RoZXI6cm90YXRlZA==", get(server.URL, ""))
+
+	// Without a file requests are sent unchanged
+	netrcFile = filepath.Join(t.TempDir(), "missing")
+	assert.Equal(t, "::", get(server.URL, ""))
+}
+
+func TestNetrcTransportSkipsPlainHTTP(t *testing.T) {
+	original := netrcFile
+	defer func() { netrcFile = original }()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	netrcFile = filepath.Join(t.TempDir(), ".netrc")
+	require.NoError(t, os.WriteFile(netrcFile, []byte("default login ci password s3cret\n"), 0o600))
+
+	resp, err := newHTTPClient().Get(server.URL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+}
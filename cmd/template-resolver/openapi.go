@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+// swaggerUIVersion is the version of swagger-ui-dist loaded by the API docs page
+const swaggerUIVersion = "5.17.14"
+
+// schemaOverrides are the schemas of types with custom JSON encodings, which cannot be
+// derived from their fields
+var schemaOverrides = map[reflect.Type]map[string]interface{}{
+	reflect.TypeOf(pipelinev1.ParamValue{}): {
+		"description": "A string, an array of strings or an object with string values",
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}},
+		},
+	},
+}
+
+// schemaGenerator derives OpenAPI schemas from Go types, adding the structs it meets to the
+// component schemas so they are referenced rather than repeated
+type schemaGenerator struct {
+	components map[string]interface{}
+}
+
+// schemaName is the component name of a struct type, its Go name starting with a capital
+func schemaName(t reflect.Type) string {
+	return strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+}
+
+// schema returns the schema of t, or a reference to it for structs
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	if override, ok := schemaOverrides[t]; ok {
+		return override
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, ok := g.components[name]; !ok {
+			// Register the name before the fields, so recursive types terminate
+			g.components[name] = nil
+			g.components[name] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		// Interfaces hold any JSON value
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema describes the JSON encoding of a struct: fields are named by their json tag,
+// documented by their description tag, and required unless they are omitempty
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.schema(field.Type)
+		if description := field.Tag.Get("description"); description != "" {
+			// Siblings of $ref are ignored before OpenAPI 3.1, so wrap references
+			if _, isRef := property["$ref"]; isRef {
+				property = map[string]interface{}{"allOf": []interface{}{property}}
+			} else {
+				property = copyMap(property)
+			}
+			property["description"] = description
+		}
+		properties[name] = property
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// openAPIOperation describes one endpoint of the standalone API
+type openAPIOperation struct {
+	path        string
+	summary     string
+	description string
+	request     interface{}
+	// response is the JSON response, or nil for endpoints returning a rendered template
+	response interface{}
+	// statuses are the error statuses of the endpoint besides 401
+	statuses []int
+}
+
+// standaloneOperations are the endpoints documented by the OpenAPI specification
+var standaloneOperations = []openAPIOperation{
+	{
+		path:        "/resolve",
+		summary:     "Resolve a template",
+		description: "Fetches and renders a template with the given params, as the Tekton resolver does. In debug mode, ?debug=data returns the data of the Go template as JSON instead.",
+		request:     resolveRequest{},
+		statuses:    []int{http.StatusBadRequest, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	{
+		path:        "/lint",
+		summary:     "Lint a template",
+		description: "Renders a template and reports every problem found instead of failing at the first one.",
+		request:     resolveRequest{},
+		response:    lintResult{},
+		statuses:    []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusTooManyRequests},
+	},
+	{
+		path:        "/render",
+		summary:     "Render an inline template",
+		description: "Renders a Go template sent in the request with the given data, without fetching anything.",
+		request:     renderInlineRequest{},
+		statuses:    []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity, http.StatusTooManyRequests},
+	},
+	{
+		path:        "/cache/invalidate",
+		summary:     "Invalidate cached templates",
+		description: "Evicts the cached templates of a repository, or of one template of it.",
+		request:     cacheInvalidateRequest{},
+		response:    cacheInvalidateResponse{},
+		statuses:    []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusInternalServerError},
+	},
+}
+
+// openAPISpec builds the OpenAPI document of the standalone API from the Go types of its
+// requests and responses
+func openAPISpec() map[string]interface{} {
+	g := &schemaGenerator{components: map[string]interface{}{}}
+	errorSchema := g.schema(reflect.TypeOf(errorResponse{}))
+
+	paths := map[string]interface{}{}
+	for _, op := range standaloneOperations {
+		responses := map[string]interface{}{}
+		if op.response != nil {
+			responses["200"] = map[string]interface{}{
+				"description": "Success",
+				"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(op.response))}},
+			}
+		} else {
+			responses["200"] = map[string]interface{}{
+				"description": "The rendered template",
+				"content":     map[string]interface{}{"application/yaml": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}},
+			}
+		}
+		for _, status := range append([]int{http.StatusUnauthorized}, op.statuses...) {
+			responses[fmt.Sprint(status)] = map[string]interface{}{
+				"description": http.StatusText(status),
+				"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": errorSchema}},
+			}
+		}
+
+		paths[op.path] = map[string]interface{}{
+			"post": map[string]interface{}{
+				"summary":     op.summary,
+				"description": op.description,
+				"requestBody": map[string]interface{}{
+					"required": true,
+					"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(op.request))}},
+				},
+				"responses": responses,
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Template Resolver API",
+			"description": "Standalone API of the Tekton template resolver",
+			"version":     resolverVersion(),
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"basicAuth":  map[string]interface{}{"type": "http", "scheme": "basic"},
+			},
+		},
+		// Credentials are only required when API_TOKEN or basic auth is configured
+		"security": []interface{}{
+			map[string]interface{}{},
+			map[string]interface{}{"bearerAuth": []string{}},
+			map[string]interface{}{"basicAuth": []string{}},
+		},
+	}
+}
+
+// openAPIDocument is the encoded specification, which does not change while running
+var openAPIDocument = sync.OnceValues(func() ([]byte, error) {
+	return json.MarshalIndent(openAPISpec(), "", "  ")
+})
+
+// openAPIHandler serves the OpenAPI specification of the standalone API
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	document, err := openAPIDocument()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "Failed to encode the OpenAPI specification: %v", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(document); err != nil {
+		logger.Errorf("Error writing response: %v", err)
+	}
+}
+
+// apiDocsPage loads Swagger UI from a CDN and points it at the specification
+var apiDocsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Template Resolver API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui-bundle.js"></script>
+  <script>
+    window.onload = () => { window.ui = SwaggerUIBundle({url: "openapi.json", dom_id: "#swagger-ui"}); };
+  </script>
+</body>
+</html>
+`
+
+// apiDocsHandler serves Swagger UI for the standalone API
+func apiDocsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := fmt.Fprint(w, apiDocsPage); err != nil {
+		logger.Errorf("Error writing response: %v", err)
+	}
+}
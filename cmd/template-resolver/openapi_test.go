@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	spec := openAPISpec()
+	assert.Equal(t, "3.0.3", spec["openapi"])
+
+	paths := spec["paths"].(map[string]interface{})
+	for _, op := range standaloneOperations {
+		assert.Contains(t, paths, op.path)
+	}
+
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"repository": map[string]interface{}{
+				"type":        "string",
+				"description": "Repository whose cached templates are evicted, exactly as in the repository param",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Template to evict, all templates of the repository when empty",
+			},
+		},
+		"required": []string{"repository"},
+	}, schemas["CacheInvalidateRequest"])
+
+	// Nested structs are referenced, and types with custom encodings use their overrides
+	param := schemas["Param"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"type": "string"}, param["name"])
+	assert.Contains(t, param["value"], "oneOf")
+	envelope := schemas["ErrorResponse"].(map[string]interface{})["properties"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"$ref": "#/components/schemas/ErrorDetail"}, envelope["error"])
+	assert.Contains(t, schemas, "LintDiagnostic")
+	assert.Contains(t, schemas, "RenderInlineRequest")
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	openAPIHandler(recorder, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	var spec map[string]interface{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &spec))
+	assert.Contains(t, spec["paths"], "/resolve")
+
+	recorder = httptest.NewRecorder()
+	apiDocsHandler(recorder, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `url: "openapi.json"`)
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// pipelineParamReference matches a reference to a Pipeline param as $(params.name) or
+// $(params["name"]), with an optional [*] or [0] making it an array, or a .key making it an
+// object
+var pipelineParamReference = regexp.MustCompile(`\$\(params(?:\.([a-zA-Z_][-a-zA-Z0-9_]*)|\[['"]([^'"\]]+)['"]\])(\[(?:\*|[0-9]+)\]|\.([-a-zA-Z0-9_]+))?\)`)
+
+// paramUsage collects the references of the tasks of a Pipeline to one of its params
+type paramUsage struct {
+	paramType pipelinev1.ParamType
+
+	// keys are the keys of an object param its references use
+	keys []string
+}
+
+// addParamDeclarations declares the params the tasks and finally tasks of a rendered
+// Pipeline reference as $(params.name) but the Pipeline does not, which Tekton rejects at
+// admission. Params referenced as $(params.name[*]) are declared as arrays, those referenced
+// as $(params.name.key) as objects with those keys, and the others as strings. A request
+// param of the same name and type becomes the default. References of embedded task specs
+// to their own params, or to the params their pipeline task passes, are not Pipeline params.
+// Other resources, and Pipelines declaring all of their params, are returned as they are.
+func addParamDeclarations(ctx context.Context, rendered string, params []pipelinev1.Param) (string, error) {
+	documents := splitYAMLDocuments(rendered)
+	if len(documents) != 1 {
+		return rendered, nil
+	}
+	var pipeline map[string]interface{}
+	if err := yaml.Unmarshal([]byte(documents[0]), &pipeline); err != nil {
+		// Invalid YAML is reported by the validation
+		return rendered, nil
+	}
+	spec, _ := pipeline["spec"].(map[string]interface{})
+	if kind, _ := pipeline["kind"].(string); kind != "Pipeline" || spec == nil {
+		return rendered, nil
+	}
+
+	declarations, _ := spec["params"].([]interface{})
+	declared := map[string]bool{}
+	for _, item := range declarations {
+		if declaration, ok := item.(map[string]interface{}); ok {
+			if name, ok := declaration["name"].(string); ok {
+				declared[name] = true
+			}
+		}
+	}
+
+	var missing []string
+	usages := map[string]*paramUsage{}
+	for _, field := range []string{"tasks", "finally"} {
+		tasks, _ := spec[field].([]interface{})
+		for _, item := range tasks {
+			task, _ := item.(map[string]interface{})
+			for _, match := range pipelineTaskParamReferences(task) {
+				name := match[1] + match[2]
+				if declared[name] {
+					continue
+				}
+				usage, seen := usages[name]
+				if !seen {
+					usage = &paramUsage{paramType: pipelinev1.ParamTypeString}
+					usages[name] = usage
+					missing = append(missing, name)
+				}
+				switch {
+				case strings.HasPrefix(match[3], "["):
+					usage.paramType = pipelinev1.ParamTypeArray
+				case match[4] != "":
+					usage.paramType = pipelinev1.ParamTypeObject
+					if !slices.Contains(usage.keys, match[4]) {
+						usage.keys = append(usage.keys, match[4])
+					}
+				}
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return rendered, nil
+	}
+	debugContextf(ctx, "Declaring the params referenced by the tasks of the Pipeline: %s", strings.Join(missing, ", "))
+
+	for _, name := range missing {
+		declarations = append(declarations, paramDeclaration(name, usages[name], params))
+	}
+	spec["params"] = declarations
+
+	declaredPipeline, err := yaml.Marshal(pipeline)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the Pipeline with its params: %w", err)
+	}
+	return string(declaredPipeline), nil
+}
+
+// pipelineTaskParamReferences returns the matches of pipelineParamReference for the Pipeline
+// params a pipeline task references: in any of its fields but its embedded task spec, and
+// in the task spec for the params it neither declares nor receives from the pipeline task
+func pipelineTaskParamReferences(task map[string]interface{}) [][]string {
+	fields := make(map[string]interface{}, len(task))
+	for key, value := range task {
+		if key != "taskSpec" {
+			fields[key] = value
+		}
+	}
+	var references [][]string
+	for _, text := range stringValues(fields) {
+		references = append(references, pipelineParamReference.FindAllStringSubmatch(text, -1)...)
+	}
+	taskSpec, _ := task["taskSpec"].(map[string]interface{})
+	if taskSpec == nil {
+		return references
+	}
+
+	local := map[string]bool{}
+	for _, field := range []interface{}{taskSpec["params"], task["params"]} {
+		items, _ := field.([]interface{})
+		for _, item := range items {
+			param, _ := item.(map[string]interface{})
+			if name, ok := param["name"].(string); ok {
+				local[name] = true
+			}
+		}
+	}
+	for _, text := range stringValues(taskSpec) {
+		for _, match := range pipelineParamReference.FindAllStringSubmatch(text, -1) {
+			if !local[match[1]+match[2]] {
+				references = append(references, match)
+			}
+		}
+	}
+	return references
+}
+
+// stringValues returns the strings held by a decoded YAML value, in maps in key order
+func stringValues(value interface{}) []string {
+	switch typed := value.(type) {
+	case string:
+		return []string{typed}
+	case []interface{}:
+		var values []string
+		for _, item := range typed {
+			values = append(values, stringValues(item)...)
+		}
+		return values
+	case map[string]interface{}:
+		var values []string
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			values = append(values, stringValues(typed[key])...)
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// paramDeclaration declares a Pipeline param of the type its references imply, with the
+// value of the request param of the same name and type as its default. The params locating
+// the template and configuring the resolution are never defaults.
+func paramDeclaration(name string, usage *paramUsage, params []pipelinev1.Param) map[string]interface{} {
+	declaration := map[string]interface{}{"name": name, "type": string(usage.paramType)}
+	if usage.paramType == pipelinev1.ParamTypeObject {
+		properties := map[string]interface{}{}
+		for _, key := range usage.keys {
+			properties[key] = map[string]interface{}{"type": string(pipelinev1.ParamTypeString)}
+		}
+		declaration["properties"] = properties
+	}
+
+	for _, param := range params {
+		if param.Name != name || param.Value.Type != usage.paramType || isOptionParam(name) ||
+			name == RepositoryParam || name == PathParam || name == RevisionParam {
+			continue
+		}
+		switch param.Value.Type {
+		case pipelinev1.ParamTypeArray:
+			declaration["default"] = param.Value.ArrayVal
+		case pipelinev1.ParamTypeObject:
+			declaration["default"] = param.Value.ObjectVal
+			properties := declaration["properties"].(map[string]interface{})
+			for key := range param.Value.ObjectVal {
+				properties[key] = map[string]interface{}{"type": string(pipelinev1.ParamTypeString)}
+			}
+		default:
+			declaration["default"] = param.Value.StringVal
+		}
+	}
+	return declaration
+}
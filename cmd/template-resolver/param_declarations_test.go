@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestAddParamDeclarations(t *testing.T) {
+	rendered := `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: build
+spec:
+  params:
+    - name: revision
+  tasks:
+    - name: clone
+      taskRef:
+        name: git-clone
+      params:
+        - name: url
+          value: $(params.git-url)
+        - name: revision
+          value: $(params.revision)
+        - name: flags
+          value: ["$(params.clone-flags[*])"]
+    - name: build
+      taskSpec:
+        params:
+          - name: image
+        steps:
+          - name: build
+            image: $(params.image)
+            script: echo $(params.target) $(params["registry"].host) $(params.registry.path)
+      params:
+        - name: target
+          value: $(params.app-name)
+  finally:
+    - name: notify
+      taskRef:
+        name: slack
+      params:
+        - name: channel
+          value: $(params.channel)
+`
+	params := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("https://github.com/org/templates")},
+		{Name: "app-name", Value: *pipelinev1.NewStructuredValues("api")},
+		{Name: "clone-flags", Value: *pipelinev1.NewStructuredValues("--depth", "1")},
+		{Name: "channel", Value: *pipelinev1.NewStructuredValues("#builds", "#deploys")},
+	}
+	declared, err := addParamDeclarations(context.Background(), rendered, params)
+	require.NoError(t, err)
+
+	// Params the embedded task spec declares or receives are not Pipeline params, and
+	// request params only become defaults when their type matches
+	var pipeline pipelinev1.Pipeline
+	require.NoError(t, yaml.Unmarshal([]byte(declared), &pipeline))
+	assert.Equal(t, pipelinev1.ParamSpecs{
+		{Name: "revision"},
+		{Name: "git-url", Type: pipelinev1.ParamTypeString},
+		{Name: "clone-flags", Type: pipelinev1.ParamTypeArray, Default: pipelinev1.NewStructuredValues("--depth", "1")},
+		{Name: "app-name", Type: pipelinev1.ParamTypeString, Default: pipelinev1.NewStructuredValues("api")},
+		{Name: "registry", Type: pipelinev1.ParamTypeObject, Properties: map[string]pipelinev1.PropertySpec{
+			"host": {Type: pipelinev1.ParamTypeString},
+			"path": {Type: pipelinev1.ParamTypeString},
+		}},
+		{Name: "channel", Type: pipelinev1.ParamTypeString},
+	}, pipeline.Spec.Params)
+
+	unchanged, err := addParamDeclarations(context.Background(), declared, params)
+	require.NoError(t, err)
+	assert.Equal(t, declared, unchanged)
+}
+
+func TestResolverDeclaresParams(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:pipeline.yaml": `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: build
+spec:
+  tasks:
+{{ .ExtraTasks | indent 4 }}
+`,
+	}}}
+	params := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("repo1")},
+		{Name: PathParam, Value: *pipelinev1.NewStructuredValues("pipeline.yaml")},
+		{Name: "extra-tasks", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{
+			`{"name": "lint", "taskRef": {"name": "golangci-lint"}, "params": [{"name": "version", "value": "$(params.lint-version)"}]}`,
+		}}},
+		{Name: "lint-version", Value: *pipelinev1.NewStructuredValues("v1.61")},
+	}
+
+	// Undeclared params fail Tekton's validation unless they are declared
+	_, err := r.Resolve(context.Background(), params)
+	assert.ErrorContains(t, err, "lint-version")
+
+	params = append(params, pipelinev1.Param{Name: DeclareParamsParam, Value: *pipelinev1.NewStructuredValues("true")})
+	resource, err := r.Resolve(context.Background(), params)
+	require.NoError(t, err)
+	assert.Contains(t, string(resource.Data()), "params:\n  - default: v1.61\n    name: lint-version\n    type: string\n")
+
+	params[len(params)-1].Value = *pipelinev1.NewStructuredValues("yes")
+	assert.EqualError(t, r.ValidateParams(context.Background(), params), `invalid declare-params param "yes", must be true or false`)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// frontmatterDelimiter opens and closes the frontmatter block at the top of a template
+	frontmatterDelimiter = "---"
+
+	// paramSchemaSidecarSuffix replaces the extension of a template to name its sidecar
+	// schema file, e.g. deploy.yaml is described by deploy.params.yaml
+	paramSchemaSidecarSuffix = ".params.yaml"
+)
+
+// paramSpec declares a param a template expects
+type paramSpec struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Type is string, array or object, string when empty
+	Type     pipelinev1.ParamType   `json:"type,omitempty"`
+	Default  *pipelinev1.ParamValue `json:"default,omitempty"`
+	Required bool                   `json:"required,omitempty"`
+	// Enum lists the values allowed for a string param
+	Enum []string `json:"enum,omitempty"`
+	// Structured marks a string or array param holding a list of Tekton tasks or steps
+	Structured bool `json:"structured,omitempty"`
+	// Finally marks a structured param holding tasks for the finally section of a Pipeline,
+	// which cannot set runAfter
+	Finally bool `json:"finally,omitempty"`
+}
+
+// paramSchema declares the params of a template, the templates it is built from and the
+// base template it extends, in its frontmatter or sidecar file
+type paramSchema struct {
+	Params    []paramSpec          `json:"params,omitempty"`
+	Templates []templateDependency `json:"templates,omitempty"`
+	// Base is the path of a template of the same repository and revision whose blocks the
+	// template overrides
+	Base string `json:"base,omitempty"`
+}
+
+// parseParamSchema parses a param schema and checks that its declarations are usable
+func parseParamSchema(content []byte) (*paramSchema, error) {
+	var schema paramSchema
+	if err := yaml.UnmarshalStrict(content, &schema); err != nil {
+		return nil, err
+	}
+	for i, spec := range schema.Params {
+		if spec.Name == "" {
+			return nil, fmt.Errorf("params[%d] has no name", i)
+		}
+		switch spec.Type {
+		case "":
+			schema.Params[i].Type = pipelinev1.ParamTypeString
+		case pipelinev1.ParamTypeString, pipelinev1.ParamTypeArray, pipelinev1.ParamTypeObject:
+		default:
+			return nil, fmt.Errorf("param %q has unknown type %q, must be string, array or object", spec.Name, spec.Type)
+		}
+		if (spec.Structured || spec.Finally) && schema.Params[i].Type == pipelinev1.ParamTypeObject {
+			return nil, fmt.Errorf("param %q is an object and cannot be structured", spec.Name)
+		}
+		if spec.Default != nil && spec.Default.Type != schema.Params[i].Type {
+			return nil, fmt.Errorf("default of param %q has type %s, not %s", spec.Name, spec.Default.Type, schema.Params[i].Type)
+		}
+	}
+	names := map[string]bool{}
+	for i, dependency := range schema.Templates {
+		switch {
+		case dependency.Name == "":
+			return nil, fmt.Errorf("templates[%d] has no name", i)
+		case dependency.Path == "":
+			return nil, fmt.Errorf("template %q has no path", dependency.Name)
+		case names[dependency.Name]:
+			return nil, fmt.Errorf("template %q is declared twice", dependency.Name)
+		}
+		names[dependency.Name] = true
+	}
+	return &schema, nil
+}
+
+// splitFrontmatter separates a param schema declared in a frontmatter block from the
+// template that follows it. The block sits between two --- lines at the very top of the
+// template and holds only a params list, the templates it is built from and its base; a
+// template starting with an ordinary YAML document is returned unchanged.
+func splitFrontmatter(content string) (string, *paramSchema, error) {
+	if !strings.HasPrefix(content, frontmatterDelimiter+"\n") {
+		return content, nil, nil
+	}
+	rest := content[len(frontmatterDelimiter)+1:]
+	end := strings.Index(rest, "\n"+frontmatterDelimiter+"\n")
+	if end < 0 {
+		return content, nil, nil
+	}
+	block := rest[:end+1]
+
+	// Only a block holding nothing but params, templates and a base is frontmatter
+	var keys map[string]interface{}
+	if err := yaml.Unmarshal([]byte(block), &keys); err != nil || len(keys) == 0 {
+		return content, nil, nil
+	}
+	for key, value := range keys {
+		if (key != "params" && key != "templates" && key != "base") || value == nil {
+			return content, nil, nil
+		}
+	}
+	schema, err := parseParamSchema([]byte(block))
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid frontmatter: %w", err)
+	}
+	return rest[end+len(frontmatterDelimiter)+2:], schema, nil
+}
+
+// paramSchemaSidecarPath returns the path of the sidecar schema file of a template
+func paramSchemaSidecarPath(templatePath string) string {
+	return strings.TrimSuffix(templatePath, path.Ext(templatePath)) + paramSchemaSidecarSuffix
+}
+
+// templateParamSchema returns the template without its frontmatter and the param schema of
+// the template, declared in its frontmatter or, when PARAM_SCHEMA_SIDECARS is enabled, in
+// a sidecar file next to it. Templates without a schema return a nil schema.
+func (r *resolver) templateParamSchema(ctx context.Context, repository, revision, templatePath, content string, opts FetchOptions) (string, *paramSchema, error) {
+	content, schema, err := splitFrontmatter(content)
+	if err != nil || schema != nil || !paramSchemaSidecars {
+		return content, schema, err
+	}
+
+	sidecar := paramSchemaSidecarPath(templatePath)
+	fetched, err := r.fetchTemplate(ctx, repository, revision, sidecar, opts)
+	if err != nil {
+		debugContextf(ctx, "No param schema at %s: %v", sidecar, err)
+		return content, nil, nil
+	}
+	if schema, err = parseParamSchema([]byte(fetched.Content)); err != nil {
+		return "", nil, fmt.Errorf("invalid param schema %s: %w", sidecar, err)
+	}
+	return content, schema, nil
+}
+
+// applyParamSchema checks the request params against the schema of a template and adds
+// the defaults of the params that were not set. All violations are reported at once.
+func applyParamSchema(schema *paramSchema, params []pipelinev1.Param) ([]pipelinev1.Param, error) {
+	if schema == nil {
+		return params, nil
+	}
+
+	given := make(map[string]pipelinev1.ParamValue, len(params))
+	for _, param := range params {
+		given[param.Name] = param.Value
+	}
+
+	var problems []string
+	result := append([]pipelinev1.Param{}, params...)
+	for _, spec := range schema.Params {
+		value, ok := given[spec.Name]
+		if !ok {
+			switch {
+			case spec.Default != nil:
+				debugf("Using default for param %s", spec.Name)
+				result = append(result, pipelinev1.Param{Name: spec.Name, Value: *spec.Default})
+			case spec.Required:
+				problems = append(problems, fmt.Sprintf("missing required param %q", spec.Name))
+			}
+			continue
+		}
+
+		if value.Type != spec.Type {
+			problems = append(problems, fmt.Sprintf("param %q must be of type %s, got %s", spec.Name, spec.Type, value.Type))
+			continue
+		}
+		if len(spec.Enum) > 0 && spec.Type == pipelinev1.ParamTypeString && !slices.Contains(spec.Enum, value.StringVal) {
+			problems = append(problems, fmt.Sprintf("param %q must be one of %s, got %q", spec.Name, strings.Join(spec.Enum, ", "), value.StringVal))
+		}
+		if spec.Finally {
+			problems = append(problems, finallyTaskProblems(spec.Name, value)...)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("params do not match the template schema: %s", strings.Join(problems, "; "))
+	}
+	return result, nil
+}
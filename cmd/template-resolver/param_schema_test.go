@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestSplitFrontmatter(t *testing.T) {
+	content, schema, err := splitFrontmatter(`---
+params:
+  - name: app-name
+    required: true
+  - name: environment
+    default: dev
+    enum: [dev, prod]
+  - name: regions
+    type: array
+    default: [us-east-1]
+---
+kind: Pipeline
+`)
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Pipeline\n", content)
+	require.NotNil(t, schema)
+	require.Len(t, schema.Params, 3)
+	assert.Equal(t, paramSpec{Name: "app-name", Type: pipelinev1.ParamTypeString, Required: true}, schema.Params[0])
+	assert.Equal(t, []string{"dev", "prod"}, schema.Params[1].Enum)
+	assert.Equal(t, &pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{"us-east-1"}}, schema.Params[2].Default)
+
+	// Ordinary YAML documents are not frontmatter
+	for _, template := range []string{
+		"kind: Pipeline\n",
+		"---\nkind: Pipeline\n---\nkind: Task\n",
+		"---\nparams:\n  - name: a\nkind: Pipeline\n---\nkind: Task\n",
+		"---\nparams:\n  - name: a\n",
+	} {
+		content, schema, err := splitFrontmatter(template)
+		require.NoError(t, err)
+		assert.Nil(t, schema)
+		assert.Equal(t, template, content)
+	}
+
+	_, _, err = splitFrontmatter("---\nparams:\n  - name: a\n    type: number\n---\nkind: Pipeline\n")
+	assert.ErrorContains(t, err, `invalid frontmatter: param "a" has unknown type "number"`)
+
+	_, _, err = splitFrontmatter("---\nparams:\n  - name: a\n    type: array\n    default: b\n---\nkind: Pipeline\n")
+	assert.ErrorContains(t, err, `default of param "a" has type string, not array`)
+
+	_, _, err = splitFrontmatter("---\nparams:\n  - name: a\n    requried: true\n---\nkind: Pipeline\n")
+	assert.ErrorContains(t, err, `unknown field "requried"`)
+}
+
+func TestApplyParamSchema(t *testing.T) {
+	schema := &paramSchema{Params: []paramSpec{
+		{Name: "app-name", Type: pipelinev1.ParamTypeString, Required: true},
+		{Name: "environment", Type: pipelinev1.ParamTypeString, Default: &pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "dev"}, Enum: []string{"dev", "prod"}},
+		{Name: "regions", Type: pipelinev1.ParamTypeArray},
+	}}
+
+	params, err := applyParamSchema(schema, []pipelinev1.Param{
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []pipelinev1.Param{
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		{Name: "environment", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "dev"}},
+	}, params)
+
+	_, err = applyParamSchema(schema, []pipelinev1.Param{
+		{Name: "environment", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "staging"}},
+		{Name: "regions", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "us-east-1"}},
+	})
+	assert.EqualError(t, err, `params do not match the template schema: missing required param "app-name"; `+
+		`param "environment" must be one of dev, prod, got "staging"; param "regions" must be of type array, got string`)
+
+	params = []pipelinev1.Param{{Name: "anything", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString}}}
+	result, err := applyParamSchema(nil, params)
+	require.NoError(t, err)
+	assert.Equal(t, params, result)
+}
+
+func TestResolverParamSchema(t *testing.T) {
+	templates := map[string]string{
+		"repo1:frontmatter.yaml":    "---\nparams:\n  - name: environment\n    default: dev\n---\nname: {{ .Environment }}\n",
+		"repo1:sidecar.yaml":        "name: {{ .Environment }}\n",
+		"repo1:sidecar.params.yaml": "params:\n  - name: environment\n    required: true\n",
+	}
+	r := &resolver{fetcher: &mockFetcher{templates: templates}}
+	resolve := func(path string, extra ...pipelinev1.Param) (string, error) {
+		params := append([]pipelinev1.Param{
+			{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+			{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: path}},
+		}, extra...)
+		resource, err := r.Resolve(context.Background(), params)
+		if err != nil {
+			return "", err
+		}
+		return string(resource.Data()), nil
+	}
+	prod := pipelinev1.Param{Name: "environment", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "prod"}}
+
+	rendered, err := resolve("frontmatter.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "name: dev\n", rendered)
+
+	rendered, err = resolve("frontmatter.yaml", prod)
+	require.NoError(t, err)
+	assert.Equal(t, "name: prod\n", rendered)
+
+	// Sidecar files are only read when enabled
+	rendered, err = resolve("sidecar.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "name: <no value>\n", rendered)
+
+	original := paramSchemaSidecars
+	paramSchemaSidecars = true
+	defer func() { paramSchemaSidecars = original }()
+
+	_, err = resolve("sidecar.yaml")
+	assert.ErrorContains(t, err, `missing required param "environment"`)
+
+	rendered, err = resolve("sidecar.yaml", prod)
+	require.NoError(t, err)
+	assert.Equal(t, "name: prod\n", rendered)
+}
+
+func TestParamSchemaSidecarPath(t *testing.T) {
+	assert.Equal(t, "pipelines/deploy.params.yaml", paramSchemaSidecarPath("pipelines/deploy.yaml"))
+	assert.Equal(t, "pipeline.params.yaml", paramSchemaSidecarPath("pipeline.jsonnet"))
+	assert.Equal(t, "pipeline.params.yaml", paramSchemaSidecarPath("pipeline"))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"text/template"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// maxPartials limits how many partial files one template can load, including partials of partials
+	maxPartials = 50
+
+	// partialFetchConcurrency limits how many partial files of a template are fetched at once
+	partialFetchConcurrency = 8
+)
+
+// templateReferencePattern finds the names used with include and template actions,
+// for example {{ include "partials/deploy-task" . }} or {{- template "steps" . }}
+var templateReferencePattern = regexp.MustCompile(`\{\{-?\s*(?:include|template)\s+"([^"]+)"`)
+
+// partialLoader returns the content of a partial file by name
+type partialLoader func(name string) (string, error)
+
+// templateReferences returns the names of the templates referenced by include and template actions
+func templateReferences(content string) []string {
+	var names []string
+	for _, match := range templateReferencePattern.FindAllStringSubmatch(content, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// loadPartials parses the partial files referenced by content into tmpl, so templates
+// defined in other files can be included. Names that are not defined by the templates
+// parsed so far are loaded as files of the same repository and parsed under that name;
+// the templates they define become available as well. Partials are loaded recursively,
+// with the partials referenced at the same depth fetched concurrently. The content of each
+// partial is added to sources under its name.
+func loadPartials(tmpl *template.Template, content string, load partialLoader, sources map[string]string) error {
+	pending := templateReferences(content)
+	loaded := 0
+	for len(pending) > 0 {
+		wave := undefinedPartials(tmpl, pending)
+		if len(wave) > maxPartials-loaded {
+			// Names past the limit are only an error if no other partial defines them
+			wave = wave[:maxPartials-loaded]
+		}
+		partials, errs := fetchPartials(wave, load)
+
+		// Parse in reference order, so a partial defining a name referenced next to it
+		// takes precedence over a file of that name, as with one partial at a time
+		next := pending
+		pending = nil
+		for _, name := range next {
+			if tmpl.Lookup(name) != nil {
+				continue
+			}
+			i := slices.Index(wave, name)
+			if i < 0 {
+				return fmt.Errorf("template loads more than %d partials", maxPartials)
+			}
+			if errs[i] != nil {
+				return fmt.Errorf("failed to load partial %q: %w", name, errs[i])
+			}
+			sources[name] = partials[i]
+			if _, err := tmpl.New(name).Parse(partials[i]); err != nil {
+				return fmt.Errorf("failed to parse partial %q: %w", name, err)
+			}
+			loaded++
+			debugf("Loaded partial %s (%d bytes)", name, len(partials[i]))
+			pending = append(pending, templateReferences(partials[i])...)
+		}
+	}
+	return nil
+}
+
+// undefinedPartials returns the names, without duplicates, that no template parsed so far
+// defines
+func undefinedPartials(tmpl *template.Template, names []string) []string {
+	var undefined []string
+	for _, name := range names {
+		if tmpl.Lookup(name) == nil && !slices.Contains(undefined, name) {
+			undefined = append(undefined, name)
+		}
+	}
+	return undefined
+}
+
+// fetchPartials loads partial files concurrently, at most partialFetchConcurrency at a
+// time. Errors are returned per name rather than failing the group, since a name that
+// could not be loaded may still be defined by one of the other partials.
+func fetchPartials(names []string, load partialLoader) ([]string, []error) {
+	partials := make([]string, len(names))
+	errs := make([]error, len(names))
+	var group errgroup.Group
+	group.SetLimit(partialFetchConcurrency)
+	for i, name := range names {
+		group.Go(func() error {
+			partials[i], errs[i] = load(name)
+			return nil
+		})
+	}
+	_ = group.Wait()
+	return partials, errs
+}
+
+// includeFunc returns the include template function, which renders a named template to a
+// string so it can be piped to other functions such as indent
+func includeFunc(tmpl **template.Template, guard *renderGuard) func(name string, data interface{}) (string, error) {
+	return func(name string, data interface{}) (string, error) {
+		if err := guard.enter(); err != nil {
+			return "", err
+		}
+		defer guard.leave()
+		var buf bytes.Buffer
+		if err := (*tmpl).ExecuteTemplate(&buf, name, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+}
+
+// partialFileCandidates returns the files tried for a partial name: the name itself when it
+// has an extension, otherwise the name with a .yaml or .tpl extension
+func partialFileCandidates(name string) []string {
+	if path.Ext(name) != "" {
+		return []string{name}
+	}
+	return []string{name + ".yaml", name + ".tpl"}
+}
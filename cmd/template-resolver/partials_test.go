@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+// mapLoader loads partials from a map and records the names requested
+func mapLoader(files map[string]string, requested *[]string) partialLoader {
+	var mu sync.Mutex
+	return func(name string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		*requested = append(*requested, name)
+		content, ok := files[name]
+		if !ok {
+			return "", fmt.Errorf("file %s not found", name)
+		}
+		return content, nil
+	}
+}
+
+func TestRenderTemplateWithPartials(t *testing.T) {
+	files := map[string]string{
+		"partials/deploy-task": "- name: deploy-{{ .app }}\n  taskRef:\n    name: {{ template \"task-name\" . }}",
+		"partials/helpers":     `{{ define "task-name" }}deploy{{ end }}`,
+	}
+
+	content := "{{ template \"partials/helpers\" }}tasks:\n{{ include \"partials/deploy-task\" . | indent 2 }}\n"
+	var requested []string
+	result, err := renderTemplateWithOptions(context.Background(), content, map[string]interface{}{"app": "api"}, renderOptions{loadPartial: mapLoader(files, &requested)})
+	require.NoError(t, err)
+	assert.Equal(t, "tasks:\n  - name: deploy-api\n    taskRef:\n      name: deploy\n", result)
+	assert.ElementsMatch(t, []string{"partials/helpers", "partials/deploy-task"}, requested)
+
+	// Templates defined in the template itself are not fetched
+	requested = nil
+	_, err = renderTemplateWithOptions(context.Background(), `{{ define "local" }}x{{ end }}{{ include "local" . }}`, nil, renderOptions{loadPartial: mapLoader(files, &requested)})
+	require.NoError(t, err)
+	assert.Empty(t, requested)
+
+	_, err = renderTemplateWithOptions(context.Background(), `{{ include "partials/missing" . }}`, nil, renderOptions{loadPartial: mapLoader(files, &requested)})
+	assert.ErrorContains(t, err, `failed to load partial "partials/missing"`)
+
+	_, err = renderTemplateWithOptions(context.Background(), `{{ include "partials/broken" . }}`, nil, renderOptions{loadPartial: mapLoader(map[string]string{"partials/broken": "{{ if }}"}, &requested)})
+	assert.ErrorContains(t, err, `failed to parse partial "partials/broken"`)
+
+	// Every partial loading a new one is stopped at the limit
+	endless := func(name string) (string, error) {
+		return fmt.Sprintf(`{{ include "%sx" . }}`, name), nil
+	}
+	_, err = renderTemplateWithOptions(context.Background(), `{{ include "p" . }}`, nil, renderOptions{loadPartial: endless})
+	assert.ErrorContains(t, err, "more than 50 partials")
+}
+
+func TestLoadPartialsConcurrently(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	load := func(name string) (string, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			current := maxRunning.Load()
+			if n <= current || maxRunning.CompareAndSwap(current, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return fmt.Sprintf(`{{ define "%s-step" }}%s{{ end }}`, name, name), nil
+	}
+
+	var content strings.Builder
+	for i := range 20 {
+		fmt.Fprintf(&content, `{{ template "partials/%d" }}{{ template "partials/%d-step" }}`, i, i)
+	}
+	start := time.Now()
+	result, err := renderTemplateWithOptions(context.Background(), content.String(), nil, renderOptions{loadPartial: load})
+	require.NoError(t, err)
+	assert.Contains(t, result, "partials/19")
+	assert.Equal(t, int32(partialFetchConcurrency), maxRunning.Load())
+	assert.Less(t, time.Since(start), 20*20*time.Millisecond)
+}
+
+func TestLoadPartialsDefinedBySibling(t *testing.T) {
+	// "steps" is not a file, but it is defined by the partial referenced before it
+	files := map[string]string{
+		"partials/helpers": `{{ define "steps" }}- name: build{{ end }}`,
+	}
+	var requested []string
+	result, err := renderTemplateWithOptions(context.Background(), `{{ template "partials/helpers" }}steps:
+{{ include "steps" . }}`, nil, renderOptions{loadPartial: mapLoader(files, &requested)})
+	require.NoError(t, err)
+	assert.Equal(t, "steps:\n- name: build", result)
+}
+
+func TestPartialFileCandidates(t *testing.T) {
+	assert.Equal(t, []string{"partials/task.yaml", "partials/task.tpl"}, partialFileCandidates("partials/task"))
+	assert.Equal(t, []string{"partials/_helpers.tpl"}, partialFileCandidates("partials/_helpers.tpl"))
+}
+
+func TestResolverPartials(t *testing.T) {
+	r := &resolver{
+		fetcher: &mockFetcher{templates: map[string]string{
+			"repo1:pipeline.yaml":       "kind: Pipeline\nspec:\n  tasks:\n{{ include \"partials/build\" . | indent 2 }}\n",
+			"repo1:partials/build.yaml": "- name: build-{{ .AppName }}",
+		}},
+		cache: newMemoryCache(),
+	}
+
+	params := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+		{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "pipeline.yaml"}},
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+	}
+	resource, err := r.Resolve(context.Background(), params)
+	require.NoError(t, err)
+	assert.Contains(t, string(resource.Data()), "  - name: build-api")
+}
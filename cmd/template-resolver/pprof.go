@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// registerPprof serves the net/http/pprof profiles under /debug/pprof/ when ENABLE_PPROF is
+// set, to profile memory growth during large renders. Profiles reveal the contents of memory,
+// including credentials, so they require the same credentials as the API.
+func registerPprof(mux *http.ServeMux) {
+	if !pprofEnabled {
+		return
+	}
+	mux.HandleFunc("/debug/pprof/", requireAuth(pprof.Index))
+	mux.HandleFunc("/debug/pprof/cmdline", requireAuth(pprof.Cmdline))
+	mux.HandleFunc("/debug/pprof/profile", requireAuth(pprof.Profile))
+	mux.HandleFunc("/debug/pprof/symbol", requireAuth(pprof.Symbol))
+	mux.HandleFunc("/debug/pprof/trace", requireAuth(pprof.Trace))
+}
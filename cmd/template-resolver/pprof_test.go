@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterPprof(t *testing.T) {
+	originalEnabled, originalToken := pprofEnabled, apiToken
+	defer func() { pprofEnabled, apiToken = originalEnabled, originalToken }()
+	apiToken = ""
+
+	get := func(mux *http.ServeMux, path string, token string) int {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		mux.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	pprofEnabled = false
+	mux := http.NewServeMux()
+	registerPprof(mux)
+	assert.Equal(t, http.StatusNotFound, get(mux, "/debug/pprof/", ""))
+
+	pprofEnabled = true
+	mux = http.NewServeMux()
+	registerPprof(mux)
+	assert.Equal(t, http.StatusOK, get(mux, "/debug/pprof/", ""))
+	assert.Equal(t, http.StatusOK, get(mux, "/debug/pprof/heap", ""))
+
+	apiToken = "secret-token"
+	assert.Equal(t, http.StatusUnauthorized, get(mux, "/debug/pprof/heap", ""))
+	assert.Equal(t, http.StatusOK, get(mux, "/debug/pprof/heap", "secret-token"))
+}
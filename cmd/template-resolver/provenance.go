@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+const (
+	// AnnotationProvenance holds the SLSA provenance of the resolved template: an in-toto
+	// statement, or a DSSE envelope holding it when a signing key is configured
+	AnnotationProvenance = "template-resolver.tekton.dev/provenance"
+
+	// AnnotationTransparencyLog is the UUID of the Rekor entry of the signed provenance
+	AnnotationTransparencyLog = "template-resolver.tekton.dev/transparency-log-entry"
+
+	inTotoStatementType  = "https://in-toto.io/Statement/v1"
+	slsaProvenanceType   = "https://slsa.dev/provenance/v1"
+	inTotoPayloadType    = "application/vnd.in-toto+json"
+	provenanceBuildType  = "https://github.com/ThriveMarket/tekton-template-resolver/render/v1"
+	provenanceBuilderID  = "https://github.com/ThriveMarket/tekton-template-resolver"
+	rekorEntriesEndpoint = "/api/v1/log/entries"
+)
+
+// inTotoStatement is an in-toto attestation about the rendered template
+type inTotoStatement struct {
+	Type          string          `json:"_type"`
+	Subject       []inTotoSubject `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     slsaProvenance  `json:"predicate"`
+}
+
+// inTotoSubject is an artifact an attestation is about, or one it was made from
+type inTotoSubject struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest"`
+}
+
+// slsaProvenance is the SLSA v1 provenance predicate: what was rendered from which
+// template and params, by which resolver
+type slsaProvenance struct {
+	BuildDefinition struct {
+		BuildType            string                 `json:"buildType"`
+		ExternalParameters   map[string]interface{} `json:"externalParameters"`
+		ResolvedDependencies []inTotoSubject        `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID      string            `json:"id"`
+			Version map[string]string `json:"version"`
+		} `json:"builder"`
+		Metadata struct {
+			StartedOn  string `json:"startedOn"`
+			FinishedOn string `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// dsseEnvelope is a signed attestation in the Dead Simple Signing Envelope format
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// provenanceRequest describes a resolution for its provenance
+type provenanceRequest struct {
+	repository string
+	path       string
+	revision   string
+	params     []pipelinev1.Param
+	fetched    *FetchedTemplate
+	rendered   []byte
+	startedOn  time.Time
+}
+
+// provenanceStatement builds the SLSA provenance of a rendered template. The subject is the
+// rendered template, named after its path, and the template as fetched is its dependency.
+func provenanceStatement(request provenanceRequest) inTotoStatement {
+	statement := inTotoStatement{
+		Type:          inTotoStatementType,
+		PredicateType: slsaProvenanceType,
+		Subject: []inTotoSubject{{
+			Name:   request.path,
+			Digest: map[string]string{"sha256": sha256Hex(request.rendered)},
+		}},
+	}
+
+	params := make(map[string]interface{}, len(request.params))
+	for _, param := range request.params {
+		switch param.Name {
+		case RepositoryParam, PathParam, RevisionParam:
+			continue
+		}
+		params[param.Name] = param.Value
+	}
+	definition := &statement.Predicate.BuildDefinition
+	definition.BuildType = provenanceBuildType
+	definition.ExternalParameters = map[string]interface{}{
+		RepositoryParam: request.repository,
+		PathParam:       request.path,
+		"params":        params,
+	}
+	if request.revision != "" {
+		definition.ExternalParameters[RevisionParam] = request.revision
+	}
+
+	dependency := inTotoSubject{
+		Name:   request.path,
+		URI:    request.repository,
+		Digest: map[string]string{"sha256": sha256Hex([]byte(request.fetched.Content))},
+	}
+	if request.fetched.Commit != "" {
+		dependency.Digest["gitCommit"] = request.fetched.Commit
+	}
+	definition.ResolvedDependencies = []inTotoSubject{dependency}
+
+	run := &statement.Predicate.RunDetails
+	run.Builder.ID = provenanceBuilderID
+	run.Builder.Version = map[string]string{"template-resolver": resolverVersion()}
+	run.Metadata.StartedOn = request.startedOn.UTC().Format(time.RFC3339)
+	run.Metadata.FinishedOn = time.Now().UTC().Format(time.RFC3339)
+	return statement
+}
+
+// addProvenanceAnnotations adds the provenance of a rendered template to its annotations when
+// PROVENANCE_ENABLED is set, signed with PROVENANCE_SIGNING_KEY when configured and then
+// uploaded to the REKOR_URL transparency log. A failed upload is logged rather than failing
+// the resolution, the signed provenance is returned either way.
+func addProvenanceAnnotations(ctx context.Context, annotations map[string]string, request provenanceRequest) (map[string]string, error) {
+	if !provenanceEnabled {
+		return annotations, nil
+	}
+	statement, err := json.Marshal(provenanceStatement(request))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode provenance: %w", err)
+	}
+	if provenanceSigner == nil {
+		annotations[AnnotationProvenance] = string(statement)
+		return annotations, nil
+	}
+
+	envelope, err := signDSSE(provenanceSigner, inTotoPayloadType, statement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign provenance: %w", err)
+	}
+	encoded, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode signed provenance: %w", err)
+	}
+	annotations[AnnotationProvenance] = string(encoded)
+
+	if rekorURL != "" {
+		uuid, err := uploadToRekor(ctx, rekorURL, encoded, provenanceSigner.Public())
+		if err != nil {
+			contextLogger(ctx).Warnf("Failed to upload provenance to %s: %v", rekorURL, err)
+		} else {
+			annotations[AnnotationTransparencyLog] = uuid
+		}
+	}
+	return annotations, nil
+}
+
+// dssePAE is the pre-authentication encoding DSSE signatures are computed over
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// signDSSE signs a payload into a DSSE envelope with an ECDSA or Ed25519 key
+func signDSSE(signer crypto.Signer, payloadType string, payload []byte) (*dsseEnvelope, error) {
+	message := dssePAE(payloadType, payload)
+	var sig []byte
+	var err error
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		sig, err = signer.Sign(rand.Reader, message, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(message)
+		sig, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dsseEnvelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []dsseSignature{{Sig: base64.StdEncoding.EncodeToString(sig)}},
+	}, nil
+}
+
+// loadSigningKey reads the PEM encoded ECDSA or Ed25519 private key provenance is signed with,
+// in the PKCS #8 format or as an EC PRIVATE KEY. An empty path disables signing.
+func loadSigningKey(keyFile string) (crypto.Signer, error) {
+	if keyFile == "" {
+		return nil, nil
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provenance signing key: %w", err)
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("invalid provenance signing key %s: no PEM data found", keyFile)
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid provenance signing key %s: %w", keyFile, err)
+	}
+	switch key := parsed.(type) {
+	case *ecdsa.PrivateKey:
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("invalid provenance signing key %s: must be an ECDSA or Ed25519 key", keyFile)
+}
+
+// uploadToRekor records a signed envelope in a Rekor transparency log as a dsse entry and
+// returns the UUID of the entry
+func uploadToRekor(ctx context.Context, baseURL string, envelope []byte, publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	entry := map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "dsse",
+		"spec": map[string]interface{}{
+			"proposedContent": map[string]interface{}{
+				"envelope":  string(envelope),
+				"verifiers": []string{base64.StdEncoding.EncodeToString(publicKeyPEM)},
+			},
+		},
+	}
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+rekorEntriesEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	resp, err := newHTTPClient().Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			debugf("Failed to close Rekor response body: %v", closeErr)
+		}
+	}()
+	if resp.StatusCode != http.StatusCreated {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("HTTP error from Rekor: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	// The response maps the UUID of the new entry to its details
+	var entries map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return "", fmt.Errorf("failed to parse Rekor response: %w", err)
+	}
+	if len(entries) != 1 {
+		return "", fmt.Errorf("expected one Rekor entry, got %d", len(entries))
+	}
+	for uuid := range entries {
+		return uuid, nil
+	}
+	return "", nil
+}
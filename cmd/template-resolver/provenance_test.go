@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestProvenanceStatement(t *testing.T) {
+	statement := provenanceStatement(provenanceRequest{
+		repository: "https://github.com/example/templates",
+		path:       "pipelines/deploy.yaml",
+		revision:   "main",
+		params: []pipelinev1.Param{
+			{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("https://github.com/example/templates")},
+			{Name: "app-name", Value: *pipelinev1.NewStructuredValues("api")},
+		},
+		fetched:   &FetchedTemplate{Content: "template", Commit: "0123456789abcdef0123456789abcdef01234567"},
+		rendered:  []byte("rendered"),
+		startedOn: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	})
+
+	assert.Equal(t, inTotoStatementType, statement.Type)
+	assert.Equal(t, slsaProvenanceType, statement.PredicateType)
+	assert.Equal(t, []inTotoSubject{{Name: "pipelines/deploy.yaml", Digest: map[string]string{"sha256": sha256Hex([]byte("rendered"))}}}, statement.Subject)
+
+	definition := statement.Predicate.BuildDefinition
+	assert.Equal(t, map[string]interface{}{
+		RepositoryParam: "https://github.com/example/templates",
+		PathParam:       "pipelines/deploy.yaml",
+		RevisionParam:   "main",
+		"params":        map[string]interface{}{"app-name": *pipelinev1.NewStructuredValues("api")},
+	}, definition.ExternalParameters)
+	assert.Equal(t, []inTotoSubject{{
+		Name: "pipelines/deploy.yaml",
+		URI:  "https://github.com/example/templates",
+		Digest: map[string]string{
+			"sha256":    sha256Hex([]byte("template")),
+			"gitCommit": "0123456789abcdef0123456789abcdef01234567",
+		},
+	}}, definition.ResolvedDependencies)
+	assert.Equal(t, "2026-01-02T03:04:05Z", statement.Predicate.RunDetails.Metadata.StartedOn)
+	assert.Equal(t, provenanceBuilderID, statement.Predicate.RunDetails.Builder.ID)
+}
+
+func TestSignDSSE(t *testing.T) {
+	payload := []byte(`{"_type":"https://in-toto.io/Statement/v1"}`)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	envelope, err := signDSSE(ecKey, inTotoPayloadType, payload)
+	require.NoError(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(payload), envelope.Payload)
+	sig, err := base64.StdEncoding.DecodeString(envelope.Signatures[0].Sig)
+	require.NoError(t, err)
+	digest := sha256.Sum256(dssePAE(inTotoPayloadType, payload))
+	assert.True(t, ecdsa.VerifyASN1(&ecKey.PublicKey, digest[:], sig))
+
+	public, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	envelope, err = signDSSE(edKey, inTotoPayloadType, payload)
+	require.NoError(t, err)
+	sig, err = base64.StdEncoding.DecodeString(envelope.Signatures[0].Sig)
+	require.NoError(t, err)
+	assert.True(t, ed25519.Verify(public, dssePAE(inTotoPayloadType, payload), sig))
+
+	assert.Equal(t, "DSSEv1 4 type 7 payload", string(dssePAE("type", []byte("payload"))))
+}
+
+// writeKeyFile writes a PEM block to a temporary file and returns its path
+func writeKeyFile(t *testing.T, blockType string, der []byte) string {
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return keyFile
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	signer, err := loadSigningKey("")
+	require.NoError(t, err)
+	assert.Nil(t, signer)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+	signer, err = loadSigningKey(writeKeyFile(t, "EC PRIVATE KEY", der))
+	require.NoError(t, err)
+	assert.True(t, ecKey.Equal(signer))
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err = x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	signer, err = loadSigningKey(writeKeyFile(t, "PRIVATE KEY", der))
+	require.NoError(t, err)
+	assert.True(t, edKey.Equal(signer))
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err = x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err)
+	_, err = loadSigningKey(writeKeyFile(t, "PRIVATE KEY", der))
+	assert.ErrorContains(t, err, "must be an ECDSA or Ed25519 key")
+
+	_, err = loadSigningKey(filepath.Join(t.TempDir(), "missing.pem"))
+	assert.ErrorContains(t, err, "failed to read provenance signing key")
+}
+
+func TestResolverProvenance(t *testing.T) {
+	originalEnabled, originalSigner, originalRekor := provenanceEnabled, provenanceSigner, rekorURL
+	defer func() { provenanceEnabled, provenanceSigner, rekorURL = originalEnabled, originalSigner, originalRekor }()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	var uploaded map[string]interface{}
+	rekor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != rekorEntriesEndpoint {
+			http.NotFound(w, r)
+			return
+		}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&uploaded))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"24296fb24b8ad77a": {"logIndex": 42}}`))
+	}))
+	defer rekor.Close()
+
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:pipeline.yaml": "metadata:\n  name: {{ .AppName }}\n",
+	}}}
+	resolve := func() map[string]string {
+		resource, err := r.Resolve(context.Background(), []pipelinev1.Param{
+			{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("repo1")},
+			{Name: PathParam, Value: *pipelinev1.NewStructuredValues("pipeline.yaml")},
+			{Name: "app-name", Value: *pipelinev1.NewStructuredValues("api")},
+		})
+		require.NoError(t, err)
+		return resource.Annotations()
+	}
+
+	provenanceEnabled, provenanceSigner, rekorURL = false, nil, ""
+	assert.NotContains(t, resolve(), AnnotationProvenance)
+
+	provenanceEnabled = true
+	var statement inTotoStatement
+	require.NoError(t, json.Unmarshal([]byte(resolve()[AnnotationProvenance]), &statement))
+	assert.Equal(t, sha256Hex([]byte("metadata:\n  name: api\n")), statement.Subject[0].Digest["sha256"])
+
+	provenanceSigner, rekorURL = key, rekor.URL
+	annotations := resolve()
+	var envelope dsseEnvelope
+	require.NoError(t, json.Unmarshal([]byte(annotations[AnnotationProvenance]), &envelope))
+	assert.Equal(t, inTotoPayloadType, envelope.PayloadType)
+	assert.Equal(t, "24296fb24b8ad77a", annotations[AnnotationTransparencyLog])
+	assert.Equal(t, "dsse", uploaded["kind"])
+
+	// A failed upload still returns the signed provenance
+	rekorURL = rekor.URL + "/missing"
+	annotations = resolve()
+	assert.Contains(t, annotations, AnnotationProvenance)
+	assert.NotContains(t, annotations, AnnotationTransparencyLog)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyForURL returns the proxy to use for a request to u, or nil to connect directly.
+// Hosts listed in NO_PROXY (and loopback addresses) are always reached directly.
+func proxyForURL(u *url.URL) (*url.URL, error) {
+	cfg := &httpproxy.Config{
+		HTTPProxy:  httpProxy,
+		HTTPSProxy: httpsProxy,
+		NoProxy:    noProxy,
+	}
+	return cfg.ProxyFunc()(u)
+}
+
+// proxyFromConfig implements http.Transport.Proxy using the resolver proxy configuration
+func proxyFromConfig(req *http.Request) (*url.URL, error) {
+	return proxyForURL(req.URL)
+}
+
+// gitProxyOptions selects the proxy for a Git clone. HTTP(S) remotes use the same proxy as
+// other requests; SSH remotes can only be tunnelled through a SOCKS5 proxy.
+func gitProxyOptions(repoURL string) (transport.ProxyOptions, error) {
+	endpoint, err := transport.NewEndpoint(repoURL)
+	if err != nil {
+		return transport.ProxyOptions{}, fmt.Errorf("invalid Git repository URL %s: %w", repoURL, err)
+	}
+
+	scheme := endpoint.Protocol
+	if scheme == "ssh" {
+		scheme = "https"
+	}
+	if scheme != "http" && scheme != "https" {
+		return transport.ProxyOptions{}, nil
+	}
+
+	proxyURL, err := proxyForURL(&url.URL{Scheme: scheme, Host: endpoint.Host})
+	if err != nil || proxyURL == nil {
+		return transport.ProxyOptions{}, err
+	}
+	if endpoint.Protocol == "ssh" && proxyURL.Scheme != "socks5" && proxyURL.Scheme != "socks5h" {
+		debugf("Connecting to %s directly, SSH remotes only support SOCKS5 proxies", endpoint.Host)
+		return transport.ProxyOptions{}, nil
+	}
+
+	debugf("Cloning %s through proxy %s", endpoint.Host, proxyURL.Redacted())
+	opts := transport.ProxyOptions{URL: proxyURL.Scheme + "://" + proxyURL.Host}
+	if proxyURL.User != nil {
+		opts.Username = proxyURL.User.Username()
+		opts.Password, _ = proxyURL.User.Password()
+	}
+	return opts, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// clientLimiterIdle is how long the limiter of a client that stopped sending requests is
+// kept. A new limiter starts with a full burst, so this only needs to exceed the time the
+// burst takes to refill.
+const clientLimiterIdle = 10 * time.Minute
+
+// rateLimiter limits the requests accepted from all clients together and from each client
+type rateLimiter struct {
+	global    *rate.Limiter
+	perClient rate.Limit
+	burst     int
+
+	mu         sync.Mutex
+	clients    map[string]*clientLimiter
+	lastPruned time.Time
+}
+
+// clientLimiter is the limiter of one client and when it was last used
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newRateLimiter creates a limiter accepting global requests per minute from all clients and
+// perClient requests per minute from each client, with bursts of up to burst requests. A
+// limit of 0 disables it; the limiter is nil when both are disabled.
+func newRateLimiter(global, perClient, burst int) *rateLimiter {
+	if global <= 0 && perClient <= 0 {
+		return nil
+	}
+	burst = max(burst, 1)
+	limiter := &rateLimiter{
+		perClient: perMinute(perClient),
+		burst:     burst,
+		clients:   map[string]*clientLimiter{},
+	}
+	if global > 0 {
+		limiter.global = rate.NewLimiter(perMinute(global), burst)
+	}
+	return limiter
+}
+
+// perMinute converts a number of requests per minute to a rate, unlimited when not positive
+func perMinute(requests int) rate.Limit {
+	if requests <= 0 {
+		return rate.Inf
+	}
+	return rate.Limit(float64(requests) / 60)
+}
+
+// clientID identifies the client of a request by its IP address
+func clientID(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientLimiterFor returns the limiter of a client, dropping the limiters of clients that
+// have been idle for a while
+func (l *rateLimiter) clientLimiterFor(client string, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastPruned) > time.Minute {
+		for id, c := range l.clients {
+			if now.Sub(c.lastSeen) > clientLimiterIdle {
+				delete(l.clients, id)
+			}
+		}
+		l.lastPruned = now
+	}
+
+	c, ok := l.clients[client]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(l.perClient, l.burst)}
+		l.clients[client] = c
+	}
+	c.lastSeen = now
+	return c.limiter
+}
+
+// reserve takes a request from the limits of client. When a limit is exhausted, nothing is
+// taken and it returns how long to wait before retrying.
+func (l *rateLimiter) reserve(client string, now time.Time) (bool, time.Duration) {
+	var reservations []*rate.Reservation
+	if l.perClient != rate.Inf {
+		reservations = append(reservations, l.clientLimiterFor(client, now).ReserveN(now, 1))
+	}
+	if l.global != nil {
+		reservations = append(reservations, l.global.ReserveN(now, 1))
+	}
+
+	var wait time.Duration
+	for _, reservation := range reservations {
+		wait = max(wait, reservation.DelayFrom(now))
+	}
+	if wait == 0 {
+		return true, 0
+	}
+	for _, reservation := range reservations {
+		reservation.CancelAt(now)
+	}
+	return false, wait
+}
+
+// limit rejects requests over the limits with 429 Too Many Requests, so a single
+// misbehaving client cannot starve the others. A nil limiter accepts every request.
+func (l *rateLimiter) limit(handler http.HandlerFunc) http.HandlerFunc {
+	if l == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ok, wait := l.reserve(clientID(r), time.Now()); !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeAPIError(w, http.StatusTooManyRequests, "Rate limit exceeded, retry in %d seconds", retryAfter)
+			return
+		}
+		handler(w, r)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterPerClient(t *testing.T) {
+	limiter := newRateLimiter(0, 60, 2)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		ok, _ := limiter.reserve("10.0.0.1", now)
+		assert.True(t, ok, "requests within the burst are accepted")
+	}
+	ok, wait := limiter.reserve("10.0.0.1", now)
+	assert.False(t, ok)
+	assert.Equal(t, time.Second, wait)
+
+	// Other clients have their own limits
+	ok, _ = limiter.reserve("10.0.0.2", now)
+	assert.True(t, ok)
+
+	// The limit refills at 60 requests per minute
+	ok, _ = limiter.reserve("10.0.0.1", now.Add(time.Second))
+	assert.True(t, ok)
+}
+
+func TestRateLimiterGlobal(t *testing.T) {
+	limiter := newRateLimiter(30, 60, 1)
+	now := time.Now()
+
+	ok, _ := limiter.reserve("10.0.0.1", now)
+	assert.True(t, ok)
+	ok, wait := limiter.reserve("10.0.0.2", now)
+	assert.False(t, ok, "the global limit applies to all clients")
+	assert.Equal(t, 2*time.Second, wait)
+
+	// A rejected request takes nothing from the client limit
+	ok, _ = limiter.reserve("10.0.0.2", now.Add(2*time.Second))
+	assert.True(t, ok)
+}
+
+func TestRateLimiterPrunesIdleClients(t *testing.T) {
+	limiter := newRateLimiter(0, 60, 1)
+	now := time.Now()
+
+	limiter.reserve("10.0.0.1", now)
+	limiter.reserve("10.0.0.2", now.Add(clientLimiterIdle))
+	assert.Len(t, limiter.clients, 2)
+
+	limiter.reserve("10.0.0.2", now.Add(clientLimiterIdle+2*time.Minute))
+	assert.Len(t, limiter.clients, 1)
+	assert.Contains(t, limiter.clients, "10.0.0.2")
+}
+
+func TestRateLimiterLimit(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	assert.Nil(t, newRateLimiter(0, 0, 10), "no limiter without limits")
+
+	limited := newRateLimiter(0, 1, 1).limit(handler)
+	call := func(remoteAddr string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/render", nil)
+		request.RemoteAddr = remoteAddr
+		recorder := httptest.NewRecorder()
+		limited(recorder, request)
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusOK, call("10.0.0.1:40000").Code)
+	recorder := call("10.0.0.1:40001")
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "60", recorder.Header().Get("Retry-After"))
+	assert.Contains(t, recorder.Body.String(), "Rate limit exceeded")
+	assert.Equal(t, http.StatusOK, call("10.0.0.2:40000").Code)
+
+	// The nil limiter passes requests through
+	recorder = httptest.NewRecorder()
+	(*rateLimiter)(nil).limit(handler)(recorder, httptest.NewRequest(http.MethodPost, "/render", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
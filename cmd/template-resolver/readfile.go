@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// maxReadFiles limits how many different files one template can read with readFile
+const maxReadFiles = 50
+
+// fileReader returns the content of a file of the repository of the template, by its path
+// in the repository
+type fileReader func(name string) (string, error)
+
+// repositoryFilePath resolves a path given to readFile: relative to the directory of the
+// template, or to the repository root when it starts with a slash. Paths leading out of
+// the repository are rejected.
+func repositoryFilePath(templatePath, name string) (string, error) {
+	var resolved string
+	if strings.HasPrefix(name, "/") {
+		resolved = path.Clean(strings.TrimLeft(name, "/"))
+	} else {
+		resolved = path.Join(path.Dir(strings.TrimPrefix(templatePath, "/")), name)
+	}
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", fmt.Errorf("file %s is outside the repository", name)
+	}
+	if resolved == "." || name == "" {
+		return "", fmt.Errorf("file name is empty")
+	}
+	return resolved, nil
+}
+
+// readFileFunc returns the readFile template function, which returns the content of another
+// file of the repository as it is, without rendering it, e.g. to embed a script. Files are
+// read once per render however often they are used.
+func readFileFunc(read fileReader) func(name string) (string, error) {
+	files := map[string]string{}
+	return func(name string) (string, error) {
+		if read == nil {
+			return "", fmt.Errorf("readFile is not available")
+		}
+		if content, ok := files[name]; ok {
+			return content, nil
+		}
+		if len(files) >= maxReadFiles {
+			return "", fmt.Errorf("template reads more than %d files", maxReadFiles)
+		}
+		content, err := read(name)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file %q: %w", name, err)
+		}
+		files[name] = content
+		return content, nil
+	}
+}
+
+// readRepositoryFile fetches a file read by a template from the same repository and revision
+func (r *resolver) readRepositoryFile(ctx context.Context, repository, revision, templatePath, name string, opts FetchOptions) (string, error) {
+	filePath, err := repositoryFilePath(templatePath, name)
+	if err != nil {
+		return "", err
+	}
+	debugContextf(ctx, "Reading file %s for the template", filePath)
+	fetched, err := r.fetchTemplate(ctx, repository, revision, filePath, opts)
+	if err != nil {
+		return "", err
+	}
+	return fetched.Content, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestRepositoryFilePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		err      string
+	}{
+		{name: "scripts/build.sh", expected: "pipelines/scripts/build.sh"},
+		{name: "../shared/lint.sh", expected: "shared/lint.sh"},
+		{name: "/shared/lint.sh", expected: "shared/lint.sh"},
+		{name: "./build.sh", expected: "pipelines/build.sh"},
+		{name: "../../etc/passwd", err: "outside the repository"},
+		{name: "/../secrets", err: "outside the repository"},
+		{name: "", err: "file name is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, err := repositoryFilePath("pipelines/deploy.yaml", tt.name)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, resolved)
+		})
+	}
+}
+
+func TestReadFileFunc(t *testing.T) {
+	reads := 0
+	readFile := readFileFunc(func(name string) (string, error) {
+		reads++
+		return "content of " + name, nil
+	})
+
+	// Files are read once per render
+	for range 3 {
+		content, err := readFile("build.sh")
+		require.NoError(t, err)
+		assert.Equal(t, "content of build.sh", content)
+	}
+	assert.Equal(t, 1, reads)
+
+	for i := 1; i < maxReadFiles; i++ {
+		_, err := readFile(fmt.Sprintf("file-%d", i))
+		require.NoError(t, err)
+	}
+	_, err := readFile("one-too-many")
+	assert.ErrorContains(t, err, fmt.Sprintf("more than %d files", maxReadFiles))
+
+	_, err = readFileFunc(nil)("build.sh")
+	assert.ErrorContains(t, err, "readFile is not available")
+}
+
+func TestResolverReadFile(t *testing.T) {
+	r := &resolver{fetcher: &notFoundFetcher{templates: map[string]string{
+		"repo1:pipelines/deploy.yaml": `metadata:
+  name: {{ .AppName }}
+script: |
+{{ readFile "scripts/build.sh" | indent 2 }}
+lint: {{ readFile "/shared/lint.sh" }}
+`,
+		"repo1:pipelines/scripts/build.sh": "#!/bin/sh\necho {{ not rendered }}",
+		"repo1:shared/lint.sh":             "golangci-lint run",
+		"repo1:pipelines/missing.yaml":     `{{ readFile "nope.sh" }}`,
+	}}}
+	resolve := func(path string) (string, error) {
+		resource, err := r.Resolve(context.Background(), []pipelinev1.Param{
+			{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+			{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: path}},
+			{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		})
+		if err != nil {
+			return "", err
+		}
+		return string(resource.Data()), nil
+	}
+
+	rendered, err := resolve("pipelines/deploy.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "metadata:\n  name: api\nscript: |\n  #!/bin/sh\n  echo {{ not rendered }}\nlint: golangci-lint run\n", rendered)
+
+	_, err = resolve("pipelines/missing.yaml")
+	assert.ErrorContains(t, err, `failed to read file "nope.sh": file pipelines/nope.sh not found`)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// redactedValue replaces sensitive values in log messages
+const redactedValue = "[REDACTED]"
+
+// redactMinLength is the length below which values are not redacted. Replacing every "1" or
+// "on" in the logs would make them unreadable without protecting anything.
+const redactMinLength = 4
+
+// redactedValues are the sensitive values of a resolution. Values read while a template
+// renders, such as lookups of Secrets, are added to the values of its context, so the
+// loggers derived from it redact them from then on.
+type redactedValues struct {
+	mu       sync.RWMutex
+	values   []string
+	replacer *strings.Replacer
+}
+
+// redactedValuesKey holds the redactedValues of a resolution in its context
+type redactedValuesKey struct{}
+
+// add adds values to redact
+func (r *redactedValues) add(values []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var added bool
+	for _, value := range values {
+		if len(value) >= redactMinLength && !slices.Contains(r.values, value) {
+			r.values = append(r.values, value)
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+
+	// Longer values go first, so a value containing a shorter one is redacted as a whole
+	slices.SortFunc(r.values, func(a, b string) int { return len(b) - len(a) })
+	pairs := make([]string, 0, 2*len(r.values))
+	for _, value := range r.values {
+		pairs = append(pairs, value, redactedValue)
+	}
+	r.replacer = strings.NewReplacer(pairs...)
+}
+
+// replace returns s with the values replaced by [REDACTED]
+func (r *redactedValues) replace(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// redactingCore replaces sensitive values in the messages and string fields of the log
+// entries it writes
+type redactingCore struct {
+	zapcore.Core
+	values *redactedValues
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.redactFields(fields)), values: c.values}
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	entry.Message = c.values.replace(entry.Message)
+	return c.Core.Write(entry, c.redactFields(fields))
+}
+
+func (c *redactingCore) redactFields(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		if field.Type == zapcore.StringType {
+			field.String = c.values.replace(field.String)
+		}
+		redacted[i] = field
+	}
+	return redacted
+}
+
+// withRedactedValues returns a context whose logger never writes the given values, such as
+// template data read from a Secret. Messages logged through debugContextf and the other
+// context loggers of the request have them replaced with [REDACTED]. When ctx already
+// redacts values, the values are added to them and ctx is returned as it is, so loggers
+// derived from it before, such as the one a template renders with, redact them too.
+func withRedactedValues(ctx context.Context, values []string) context.Context {
+	redacted, ok := ctx.Value(redactedValuesKey{}).(*redactedValues)
+	if !ok {
+		if !slices.ContainsFunc(values, func(value string) bool { return len(value) >= redactMinLength }) {
+			return ctx
+		}
+		ctx = withRedaction(ctx)
+		redacted = ctx.Value(redactedValuesKey{}).(*redactedValues)
+	}
+	redacted.add(values)
+	return ctx
+}
+
+// withRedaction returns a context whose logger redacts the values withRedactedValues adds
+// to it later. Resolutions whose templates can read Secrets start with one, so values read
+// while rendering are redacted from the logs of the whole resolution.
+func withRedaction(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(redactedValuesKey{}).(*redactedValues); ok {
+		return ctx
+	}
+	redacted := &redactedValues{}
+	redacting := contextLogger(ctx).Desugar().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &redactingCore{Core: core, values: redacted}
+	}))
+	ctx = context.WithValue(ctx, redactedValuesKey{}, redacted)
+	return context.WithValue(ctx, loggerKey{}, redacting.Sugar())
+}
+
+// sensitiveStrings returns the strings of a value and of everything nested in it, the values
+// withRedactedValues keeps out of the logs
+func sensitiveStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		var values []string
+		for _, nested := range v {
+			values = append(values, sensitiveStrings(nested)...)
+		}
+		return values
+	case []interface{}:
+		var values []string
+		for _, nested := range v {
+			values = append(values, sensitiveStrings(nested)...)
+		}
+		return values
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
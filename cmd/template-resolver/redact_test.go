@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRedactedValues(t *testing.T) {
+	logs := captureLog(t)
+	original := debugMode
+	defer func() { debugMode = original }()
+	debugMode = true
+
+	ctx := withLogFields(context.Background(), "request_id", "abc")
+	ctx = withRedactedValues(ctx, []string{"registry.internal", "registry.internal:5000", "on"})
+	ctx = withLogFields(ctx, "endpoint", "https://registry.internal:5000/v2")
+	debugContextf(ctx, "Pushing to %s and %s, logging on", "registry.internal:5000", "registry.internal")
+
+	assert.Contains(t, logs.String(), `"msg":"Pushing to [REDACTED] and [REDACTED], logging on","request_id":"abc","endpoint":"https://[REDACTED]/v2"`)
+	assert.NotContains(t, logs.String(), "registry.internal")
+
+	// Other resolutions are not affected
+	logs.Reset()
+	debugContextf(context.Background(), "Pushing to %s", "registry.internal")
+	assert.Contains(t, logs.String(), `"msg":"Pushing to registry.internal"`)
+
+	// Nothing to redact leaves the context as it is
+	assert.Equal(t, ctx, withRedactedValues(ctx, []string{"abc"}))
+}
+
+func TestSensitiveStrings(t *testing.T) {
+	assert.ElementsMatch(t, []string{"registry.internal", "5000", "alpha", "beta"}, sensitiveStrings(map[string]interface{}{
+		"registry": map[string]interface{}{"host": "registry.internal", "port": 5000},
+		"names":    []interface{}{"alpha", "beta"},
+		"unset":    nil,
+	}))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// renderInlineRequest is the body of the render endpoint: a Go template and the data it is
+// rendered with, used as is instead of being built from params
+type renderInlineRequest struct {
+	Template string                 `json:"template" description:"Go template to render"`
+	Data     map[string]interface{} `json:"data,omitempty" description:"Data the template is rendered with"`
+
+	// Helm adds the Sprig and Helm functions, as the helm param does
+	Helm bool `json:"helm,omitempty" description:"Add the Sprig and Helm functions"`
+}
+
+// renderInline renders a template sent in a request with the functions of resolved Go
+// templates. Nothing is fetched, so include can only use templates defined in the template
+// itself.
+func (r *resolver) renderInline(ctx context.Context, request renderInlineRequest) (string, error) {
+	data := request.Data
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	return renderTemplateWithOptions(ctx, request.Template, data, renderOptions{
+		loadPartial: func(string) (string, error) {
+			return "", fmt.Errorf("inline templates cannot load partial files")
+		},
+		lookup: r.lookup(ctx),
+		helm:   request.Helm,
+	})
+}
+
+// renderHandler serves the render endpoint, which lets developers and CI try template
+// snippets against the function set of the resolver without pushing them anywhere
+func renderHandler(resolver *resolver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		var request renderInlineRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize)).Decode(&request); err != nil {
+			writeRequestBodyError(w, err, "Failed to parse request: %v")
+			return
+		}
+		if request.Template == "" {
+			writeAPIError(w, http.StatusBadRequest, "template is required")
+			return
+		}
+
+		rendered, err := resolver.renderInline(r.Context(), request)
+		if err != nil {
+			writeAPIError(w, http.StatusUnprocessableEntity, "Failed to render template: %v", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/yaml")
+		if _, err := io.WriteString(w, rendered); err != nil {
+			logger.Errorf("Error writing response: %v", err)
+		}
+	}
+}
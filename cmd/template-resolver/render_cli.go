@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+// renderCommand is the subcommand rendering a local template instead of serving requests
+const renderCommand = "render"
+
+// paramFlags collects the repeated -param name=value flags of the local template commands
+type paramFlags []pipelinev1.Param
+
+func (p *paramFlags) String() string {
+	names := make([]string, len(*p))
+	for i, param := range *p {
+		names[i] = param.Name
+	}
+	return strings.Join(names, ",")
+}
+
+// Set parses a name=value flag. Values holding a JSON array or object become array and
+// object params, anything else is a string param.
+func (p *paramFlags) Set(flagValue string) error {
+	name, value, ok := strings.Cut(flagValue, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value, got %q", flagValue)
+	}
+	param := pipelinev1.Param{Name: name, Value: *pipelinev1.NewStructuredValues(value)}
+	if strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{") {
+		if err := json.Unmarshal([]byte(value), &param.Value); err != nil {
+			return fmt.Errorf("invalid value for param %s: %w", name, err)
+		}
+	}
+	*p = append(*p, param)
+	return nil
+}
+
+// renderCommandParams returns the params resolving a local template like a ResolutionRequest
+// would: the template is read from a file:// repository at root, which defaults to the
+// directory of the template, so partials and readFile work as they do in the repository.
+func renderCommandParams(templateFile, root, valuesFile string, params []pipelinev1.Param) ([]pipelinev1.Param, error) {
+	templateFile, err := filepath.Abs(templateFile)
+	if err != nil {
+		return nil, err
+	}
+	if root == "" {
+		root = filepath.Dir(templateFile)
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		return nil, err
+	}
+	templatePath, err := filepath.Rel(root, templateFile)
+	if err != nil || !filepath.IsLocal(templatePath) {
+		return nil, fmt.Errorf("template %s is not inside the repository directory %s", templateFile, root)
+	}
+
+	result := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues(fileScheme + filepath.ToSlash(root))},
+		{Name: PathParam, Value: *pipelinev1.NewStructuredValues(filepath.ToSlash(templatePath))},
+	}
+	if valuesFile != "" {
+		values, err := os.ReadFile(valuesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read values file: %w", err)
+		}
+		result = append(result, pipelinev1.Param{Name: ValuesParam, Value: *pipelinev1.NewStructuredValues(string(values))})
+	}
+	for _, param := range params {
+		switch param.Name {
+		case RepositoryParam, PathParam, RevisionParam:
+			return nil, fmt.Errorf("param %s is set from the template file", param.Name)
+		case ValuesParam:
+			if valuesFile != "" {
+				return nil, fmt.Errorf("param %s cannot be combined with -values", param.Name)
+			}
+		}
+	}
+	return append(result, params...), nil
+}
+
+// runRenderCommand renders a local template with a values file and params and writes the
+// result to out, so template authors can try changes without deploying the resolver. The
+// template goes through the same steps as a resolution, including rendered validation.
+func runRenderCommand(ctx context.Context, resolver *resolver, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet(renderCommand, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	valuesFile := fs.String("values", "", "YAML values file the template is rendered with")
+	root := fs.String("root", "", "Repository directory partials and files are read from (default: the directory of the template)")
+	_ = fs.Bool("debug", debugMode, "Enable debug logging")
+	var params paramFlags
+	fs.Var(&params, "param", "Param of the request as name=value, repeatable")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w\nusage: template-resolver render [-values file] [-param name=value]... [-root dir] template", err)
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: template-resolver render [-values file] [-param name=value]... [-root dir] template")
+	}
+
+	rendered, err := resolver.renderLocalTemplate(ctx, fs.Arg(0), *root, *valuesFile, params)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(rendered)
+	return err
+}
+
+// renderLocalTemplate resolves a local template with a values file and params
+func (r *resolver) renderLocalTemplate(ctx context.Context, templateFile, root, valuesFile string, params []pipelinev1.Param) ([]byte, error) {
+	resolveParams, err := renderCommandParams(templateFile, root, valuesFile, params)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.ValidateParams(ctx, resolveParams); err != nil {
+		return nil, err
+	}
+	resource, err := r.Resolve(ctx, resolveParams)
+	if err != nil {
+		return nil, err
+	}
+	return resource.Data(), nil
+}
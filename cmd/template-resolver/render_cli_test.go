@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestParamFlags(t *testing.T) {
+	var params paramFlags
+	require.NoError(t, params.Set("app-name=api"))
+	require.NoError(t, params.Set(`environments=["dev","prod"]`))
+	require.NoError(t, params.Set(`labels={"team":"payments"}`))
+	require.NoError(t, params.Set("url=https://example.com/?a=b"))
+
+	assert.Equal(t, "app-name,environments,labels,url", params.String())
+	assert.Equal(t, pipelinev1.ParamTypeString, params[0].Value.Type)
+	assert.Equal(t, []string{"dev", "prod"}, params[1].Value.ArrayVal)
+	assert.Equal(t, map[string]string{"team": "payments"}, params[2].Value.ObjectVal)
+	assert.Equal(t, "https://example.com/?a=b", params[3].Value.StringVal)
+
+	assert.Error(t, params.Set("no-value"))
+	assert.Error(t, params.Set("=value"))
+	assert.Error(t, params.Set("broken=[1"))
+}
+
+func TestRenderCommandParams(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "pipelines"), 0o755))
+	templateFile := filepath.Join(dir, "pipelines", "build.yaml")
+	valuesFile := filepath.Join(dir, "values.yaml")
+	require.NoError(t, os.WriteFile(valuesFile, []byte("replicas: 2\n"), 0o600))
+
+	params, err := renderCommandParams(templateFile, "", valuesFile, nil)
+	require.NoError(t, err)
+	require.Len(t, params, 3)
+	assert.Equal(t, "file://"+filepath.ToSlash(filepath.Join(dir, "pipelines")), params[0].Value.StringVal)
+	assert.Equal(t, "build.yaml", params[1].Value.StringVal)
+	assert.Equal(t, ValuesParam, params[2].Name)
+	assert.Equal(t, "replicas: 2\n", params[2].Value.StringVal)
+
+	// The repository root can be above the template, for partials in other directories
+	params, err = renderCommandParams(templateFile, dir, "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "pipelines/build.yaml", params[1].Value.StringVal)
+
+	_, err = renderCommandParams(templateFile, filepath.Join(dir, "other"), "", nil)
+	assert.ErrorContains(t, err, "is not inside the repository directory")
+
+	_, err = renderCommandParams(templateFile, "", filepath.Join(dir, "missing.yaml"), nil)
+	assert.ErrorContains(t, err, "failed to read values file")
+
+	_, err = renderCommandParams(templateFile, "", "", []pipelinev1.Param{
+		{Name: RevisionParam, Value: *pipelinev1.NewStructuredValues("main")},
+	})
+	assert.ErrorContains(t, err, "param revision is set from the template file")
+
+	_, err = renderCommandParams(templateFile, "", valuesFile, []pipelinev1.Param{
+		{Name: ValuesParam, Value: *pipelinev1.NewStructuredValues("a: 1")},
+	})
+	assert.ErrorContains(t, err, "cannot be combined with -values")
+}
+
+func TestRunRenderCommand(t *testing.T) {
+	originalAllow := allowFileRepositories
+	defer func() { allowFileRepositories = originalAllow }()
+	allowFileRepositories = true
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "partials"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "partials", "labels.tpl"),
+		[]byte(`app: {{ .Values.app }}`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pipeline.yaml"), []byte(`apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: {{ .Values.app }}
+  labels:
+    {{ include "partials/labels.tpl" . }}
+spec:
+  tasks:
+    - name: build
+      taskRef:
+        name: {{ .Task }}
+`), 0o600))
+	valuesFile := filepath.Join(dir, "values.yaml")
+	require.NoError(t, os.WriteFile(valuesFile, []byte("app: api\n"), 0o600))
+
+	r := NewResolver()
+	r.cache = newMemoryCache()
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	err := runRenderCommand(ctx, r, []string{"-values", valuesFile, "-param", "task=buildah", filepath.Join(dir, "pipeline.yaml")}, &out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "name: api\n")
+	assert.Contains(t, out.String(), "app: api\n")
+	assert.Contains(t, out.String(), "name: buildah\n")
+
+	err = runRenderCommand(ctx, r, []string{"-values", valuesFile}, &out)
+	assert.ErrorContains(t, err, "usage: template-resolver render")
+
+	err = runRenderCommand(ctx, r, []string{"-unknown", filepath.Join(dir, "pipeline.yaml")}, &out)
+	assert.ErrorContains(t, err, "flag provided but not defined")
+
+	err = runRenderCommand(ctx, r, []string{filepath.Join(dir, "missing.yaml")}, &out)
+	assert.Error(t, err)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxSnippetLength limits the template line quoted in render errors, templates with long
+// lines of inline JSON would otherwise flood the status of the PipelineRun
+const maxSnippetLength = 160
+
+// templateErrorPattern matches the location text/template puts in front of parse errors,
+// template: name:line: and execution errors, template: name:line:column:
+var templateErrorPattern = regexp.MustCompile(`template: ([^:\s]+):(\d+):(?:(\d+):)? `)
+
+// templateError is a parse or execution error of a Go template, located in the template file
+// it comes from. Errors raised in included templates are located in the included template.
+type templateError struct {
+	// Template is the name of the file the error is in: the requested template or a partial
+	Template string
+	Line     int
+	// Column is the column of the offending action, 0 for parse errors which only have a line
+	Column int
+	// Snippet is the offending line of the template, when its source is known
+	Snippet string
+	Message string
+	err     error
+}
+
+func (e *templateError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "template %s line %d", e.Template, e.Line)
+	if e.Column > 0 {
+		fmt.Fprintf(&b, ", column %d", e.Column)
+	}
+	fmt.Fprintf(&b, ": %s", e.Message)
+	if e.Snippet != "" {
+		gutter := strconv.Itoa(e.Line)
+		fmt.Fprintf(&b, "\n  %s | %s", gutter, e.Snippet)
+		if e.Column > 0 && e.Column <= len(e.Snippet)+1 {
+			fmt.Fprintf(&b, "\n  %s | %s^", strings.Repeat(" ", len(gutter)), strings.Repeat(" ", e.Column-1))
+		}
+	}
+	return b.String()
+}
+
+func (e *templateError) Unwrap() error {
+	return e.err
+}
+
+// newTemplateError locates a parse or execution error of a Go template. The innermost
+// location of the error is used, so an error in an included template points at the
+// included template rather than the include; what the error was wrapped with is kept.
+// Sources maps the template files to their content, for the snippet. Errors without a
+// location are returned as they are.
+func newTemplateError(err error, sources map[string]string) error {
+	var located *templateError
+	if err == nil || errors.As(err, &located) {
+		return err
+	}
+	message := err.Error()
+	matches := templateErrorPattern.FindAllStringSubmatchIndex(message, -1)
+	if len(matches) == 0 {
+		return err
+	}
+	match := matches[len(matches)-1]
+
+	// Keep what the error was wrapped with, but not the includes leading to the location
+	located = &templateError{
+		Template: message[match[2]:match[3]],
+		Message:  message[:matches[0][0]] + message[match[1]:],
+		err:      err,
+	}
+	located.Line, _ = strconv.Atoi(message[match[4]:match[5]])
+	if match[6] >= 0 {
+		// text/template counts columns from 0
+		column, _ := strconv.Atoi(message[match[6]:match[7]])
+		located.Column = column + 1
+	}
+	if source, ok := sources[located.Template]; ok {
+		lines := strings.Split(source, "\n")
+		if located.Line >= 1 && located.Line <= len(lines) {
+			located.Snippet = strings.TrimRight(lines[located.Line-1], "\r")
+			if len(located.Snippet) > maxSnippetLength {
+				located.Snippet = located.Snippet[:maxSnippetLength] + "..."
+			}
+		}
+	}
+	return located
+}
+
+// yamlContextLines is the number of rendered lines quoted before and after the line of a
+// YAML error
+const yamlContextLines = 2
+
+// yamlErrorPattern matches the line YAML parsers report syntax errors at
+var yamlErrorPattern = regexp.MustCompile(`yaml: line (\d+): `)
+
+// yamlError is a YAML error in rendered output, with the rendered lines around the line the
+// parser reported. Parsers report some errors, such as unclosed flow collections, at the line
+// before the offending one, which the context covers.
+type yamlError struct {
+	Line int
+	// Context holds the numbered lines around Line, the line itself marked with >
+	Context string
+	err     error
+}
+
+func (e *yamlError) Error() string {
+	return e.err.Error() + "\n" + e.Context
+}
+
+func (e *yamlError) Unwrap() error {
+	return e.err
+}
+
+// newYAMLError locates a YAML error in the content it was raised for. Errors without a line
+// in the content are returned as they are.
+func newYAMLError(err error, content string) error {
+	var located *yamlError
+	if err == nil || errors.As(err, &located) {
+		return err
+	}
+	match := yamlErrorPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return err
+	}
+	line, _ := strconv.Atoi(match[1])
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if line < 1 || line > len(lines) {
+		return err
+	}
+
+	first, last := max(line-yamlContextLines, 1), min(line+yamlContextLines, len(lines))
+	width := len(strconv.Itoa(last))
+	var b strings.Builder
+	for i := first; i <= last; i++ {
+		marker := " "
+		if i == line {
+			marker = ">"
+		}
+		text := strings.TrimRight(lines[i-1], "\r")
+		if len(text) > maxSnippetLength {
+			text = text[:maxSnippetLength] + "..."
+		}
+		fmt.Fprintf(&b, "%s %*d | %s", marker, width, i, text)
+		if i < last {
+			b.WriteByte('\n')
+		}
+	}
+	return &yamlError{Line: line, Context: b.String(), err: err}
+}
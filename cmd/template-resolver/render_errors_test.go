@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestRenderTemplateParseError(t *testing.T) {
+	_, err := renderTemplate("name: api\n{{ if }}image: api{{ end }}\n", map[string]interface{}{})
+	var located *templateError
+	require.ErrorAs(t, err, &located)
+	assert.Equal(t, "pipeline", located.Template)
+	assert.Equal(t, 2, located.Line)
+	assert.Equal(t, 0, located.Column)
+	assert.Equal(t, "{{ if }}image: api{{ end }}", located.Snippet)
+	assert.Equal(t, "template pipeline line 2: missing value for if\n  2 | {{ if }}image: api{{ end }}", err.Error())
+}
+
+func TestRenderTemplateExecutionError(t *testing.T) {
+	_, err := renderTemplate("name: api\nreplicas: {{ index .Replicas 3 }}\n", map[string]interface{}{"Replicas": []int{1}})
+	var located *templateError
+	require.ErrorAs(t, err, &located)
+	assert.Equal(t, 2, located.Line)
+	assert.Equal(t, 14, located.Column)
+	assert.Equal(t, "template pipeline line 2, column 14: executing \"pipeline\" at <index .Replicas 3>: error calling index: index out of range: 3\n"+
+		"  2 | replicas: {{ index .Replicas 3 }}\n"+
+		"    |              ^", err.Error())
+}
+
+func TestRenderTemplateErrorInPartial(t *testing.T) {
+	files := map[string]string{
+		"partials/labels": "team: {{ .team }}\napp: {{ .app | missing }}",
+		"partials/broken": "a: 1\n{{ if }}",
+		"partials/steps":  `{{ define "step" }}- name: {{ index .names 5 }}{{ end }}`,
+	}
+	load := func(name string) (string, error) { return files[name], nil }
+
+	// Errors point at the partial, not at the include
+	_, err := renderTemplateWithOptions(context.Background(), "metadata:\n  labels:\n{{ include \"partials/labels\" . | indent 4 }}\n", map[string]interface{}{}, renderOptions{loadPartial: load})
+	var located *templateError
+	require.ErrorAs(t, err, &located)
+	assert.Equal(t, "partials/labels", located.Template)
+	assert.Equal(t, 2, located.Line)
+	assert.Equal(t, `app: {{ .app | missing }}`, located.Snippet)
+
+	// Templates defined in a partial are located in the partial
+	_, err = renderTemplateWithOptions(context.Background(), "steps:\n{{ include \"partials/steps\" . }}{{ template \"step\" . }}\n", map[string]interface{}{"names": []string{}}, renderOptions{loadPartial: load})
+	require.ErrorAs(t, err, &located)
+	assert.Equal(t, "partials/steps", located.Template)
+	assert.Equal(t, 1, located.Line)
+	assert.Equal(t, 31, located.Column)
+	assert.True(t, strings.HasPrefix(located.Message, `executing "step" at <index .names 5>`), located.Message)
+
+	// What the error was wrapped with is kept
+	_, err = renderTemplateWithOptions(context.Background(), `{{ include "partials/broken" . }}`, map[string]interface{}{}, renderOptions{loadPartial: load})
+	require.ErrorAs(t, err, &located)
+	assert.Equal(t, "template partials/broken line 2: failed to parse partial \"partials/broken\": missing value for if\n  2 | {{ if }}", err.Error())
+}
+
+func TestNewTemplateError(t *testing.T) {
+	assert.NoError(t, newTemplateError(nil, nil))
+
+	plain := errors.New("render timed out")
+	assert.Equal(t, plain, newTemplateError(plain, nil))
+
+	// Unknown sources have no snippet, long lines are shortened
+	err := newTemplateError(errors.New("template: tpl:1:3: executing \"tpl\" at <.x>: boom"), nil)
+	assert.Equal(t, "template tpl line 1, column 4: executing \"tpl\" at <.x>: boom", err.Error())
+
+	long := strings.Repeat("a", 200)
+	err = newTemplateError(errors.New("template: pipeline:1:180: oops"), map[string]string{"pipeline": long})
+	var located *templateError
+	require.ErrorAs(t, err, &located)
+	assert.Equal(t, strings.Repeat("a", maxSnippetLength)+"...", located.Snippet)
+	assert.NotContains(t, err.Error(), "^")
+
+	// Located errors are not located again, and unwrap to the original error
+	wrapped := fmt.Errorf("failed to render template: %w", err)
+	assert.Equal(t, err, newTemplateError(err, nil))
+	assert.ErrorIs(t, wrapped, located.err)
+}
+
+func TestNewYAMLError(t *testing.T) {
+	content := "apiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n  name: api\n    labels: {}\nspec:\n  tasks: []\n"
+	err := newYAMLError(checkYAMLDocuments(content), content)
+	var located *yamlError
+	require.ErrorAs(t, err, &located)
+	assert.Equal(t, 5, located.Line)
+	assert.Equal(t, "yaml: line 5: mapping values are not allowed in this context\n"+
+		"  3 | metadata:\n"+
+		"  4 |   name: api\n"+
+		"> 5 |     labels: {}\n"+
+		"  6 | spec:\n"+
+		"  7 |   tasks: []", err.Error())
+
+	// The context stops at the ends of the content and the numbers are aligned
+	content = strings.Repeat("a: 1\n", 9) + "b: [1\n"
+	err = newYAMLError(errors.New("yaml: line 10: did not find expected ',' or ']'"), content)
+	require.ErrorAs(t, err, &located)
+	assert.Equal(t, "   8 | a: 1\n   9 | a: 1\n> 10 | b: [1", located.Context)
+
+	// Errors of sigs.k8s.io/yaml are located too
+	err = newYAMLError(errors.New("error converting YAML to JSON: yaml: line 1: did not find expected key"), "a: 1\nb: 2\n")
+	require.ErrorAs(t, err, &located)
+	assert.Equal(t, "> 1 | a: 1\n  2 | b: 2", located.Context)
+
+	// Errors without a line in the content are returned as they are
+	assert.NoError(t, newYAMLError(nil, ""))
+	anchor := errors.New("yaml: unknown anchor 'x' referenced")
+	assert.Equal(t, anchor, newYAMLError(anchor, "a: *x\n"))
+	outside := errors.New("yaml: line 12: mapping values are not allowed in this context")
+	assert.Equal(t, outside, newYAMLError(outside, "a: 1\n"))
+	assert.ErrorIs(t, err, located.err)
+}
+
+func TestResolverYAMLErrorContext(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:pipeline.yaml": "apiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n  name: {{ .Name }}\n    namespace: ci\nspec:\n  tasks: []\n",
+	}}}
+	params := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("repo1")},
+		{Name: PathParam, Value: *pipelinev1.NewStructuredValues("pipeline.yaml")},
+		{Name: "name", Value: *pipelinev1.NewStructuredValues("api")},
+	}
+
+	// Tekton validation reports the rendered lines around the error
+	_, err := r.Resolve(context.Background(), params)
+	var located *yamlError
+	require.ErrorAs(t, err, &located)
+	assert.Equal(t, 5, located.Line)
+	assert.Contains(t, err.Error(), "rendered template is not valid YAML")
+	assert.Contains(t, err.Error(), "  4 |   name: api\n> 5 |     namespace: ci\n")
+
+	// So does strict YAML, before anything else parses the template
+	_, err = r.Resolve(context.Background(), append(params, pipelinev1.Param{Name: StrictYAMLParam, Value: *pipelinev1.NewStructuredValues("true")}))
+	require.ErrorAs(t, err, &located)
+	assert.Contains(t, err.Error(), "failed to render template: rendered template is not valid YAML: yaml: line 5: mapping values are not allowed in this context\n")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolverRenderInline(t *testing.T) {
+	r := &resolver{}
+	ctx := context.Background()
+
+	rendered, err := r.renderInline(ctx, renderInlineRequest{
+		Template: "name: {{ .name | toString }}\nimage: {{ .images.api | toJson }}\n",
+		Data:     map[string]interface{}{"name": "api", "images": map[string]interface{}{"api": "api:1.0"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "name: api\nimage: \"api:1.0\"\n", rendered)
+
+	// Templates defined in the template itself can be included
+	rendered, err = r.renderInline(ctx, renderInlineRequest{
+		Template: `{{ define "label" }}app: {{ . }}{{ end }}{{ include "label" "api" }}`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "app: api", rendered)
+
+	_, err = r.renderInline(ctx, renderInlineRequest{Template: `{{ include "common.tpl" . }}`})
+	assert.ErrorContains(t, err, "inline templates cannot load partial files")
+
+	_, err = r.renderInline(ctx, renderInlineRequest{Template: `{{ lookup "ConfigMap" "settings" }}`})
+	assert.Error(t, err)
+}
+
+func TestRenderHandler(t *testing.T) {
+	handler := renderHandler(&resolver{})
+	post := func(body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodPost, "/render", strings.NewReader(body)))
+		return recorder
+	}
+
+	recorder := post(`{"template": "name: {{ .name }}\n", "data": {"name": "api"}}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/yaml", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, "name: api\n", recorder.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"template": `).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"data": {}}`).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(`{"template": "`+strings.Repeat("x", maxRequestBodySize)+`"}`).Code)
+
+	recorder = post(`{"template": "{{ .name"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "Failed to render template")
+
+	recorder = httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/render", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
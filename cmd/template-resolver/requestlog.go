@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the ID of a request of the standalone server. A valid ID sent by
+// the client is kept, so a resolution can be followed from the calling CI job; otherwise one
+// is generated. The ID is returned in the same header.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern matches the request IDs accepted from clients
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// unloggedPaths are probed every few seconds, which would drown the access log
+var unloggedPaths = map[string]bool{"/health": true, "/ready": true}
+
+type requestIDKey struct{}
+
+// withRequestID returns a context carrying the ID of the request being served
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestID returns the ID of the request served with ctx, or "" outside of one
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// responseRecorder records the status and size of a response for the access log
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// withRequestLogging assigns every request an ID, returned in the X-Request-ID header and
+// added to the logs of the request through its context, and writes an access log entry once
+// the request is served
+func withRequestLogging(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w}
+		ctx := withLogFields(withRequestID(r.Context(), id), "request_id", id)
+		handler.ServeHTTP(recorder, r.WithContext(ctx))
+
+		if unloggedPaths[r.URL.Path] {
+			return
+		}
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		contextLogger(ctx).Infow("Request served",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"bytes", recorder.bytes,
+			"duration", time.Since(start),
+			"remote_addr", clientID(r),
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRequestLogging(t *testing.T) {
+	logs := captureLog(t)
+	var seen string
+	handler := withRequestLogging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r.Context())
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("rendered"))
+	}))
+
+	// A generated ID is returned and available to the handler
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/resolve", nil))
+	id := recorder.Header().Get(RequestIDHeader)
+	assert.Len(t, id, 36)
+	assert.Equal(t, id, seen)
+	var entry map[string]interface{}
+	assert.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, "Request served", entry["msg"])
+	assert.Equal(t, id, entry["request_id"])
+	assert.Equal(t, "/resolve", entry["path"])
+	assert.Equal(t, float64(http.StatusCreated), entry["status"])
+	assert.Equal(t, float64(8), entry["bytes"])
+
+	// IDs sent by clients are kept when valid
+	logs.Reset()
+	request := httptest.NewRequest(http.MethodPost, "/resolve", nil)
+	request.Header.Set(RequestIDHeader, "ci-job-42")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, "ci-job-42", recorder.Header().Get(RequestIDHeader))
+	assert.Contains(t, logs.String(), `"request_id":"ci-job-42"`)
+
+	request = httptest.NewRequest(http.MethodPost, "/resolve", nil)
+	request.Header.Set(RequestIDHeader, "not valid\n")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.NotEqual(t, "not valid\n", recorder.Header().Get(RequestIDHeader))
+	assert.Len(t, recorder.Header().Get(RequestIDHeader), 36)
+
+	// Probes are not logged
+	logs.Reset()
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.NotEmpty(t, recorder.Header().Get(RequestIDHeader))
+	assert.Empty(t, logs.String())
+}
@@ -4,18 +4,42 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"strconv"
 	"strings"
+	"time"
 
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
 	"github.com/tektoncd/pipeline/pkg/resolution/common"
 	"github.com/tektoncd/pipeline/pkg/resolution/resolver/framework"
 	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	kubeclient "knative.dev/pkg/client/injection/kube/client"
+	"knative.dev/pkg/injection"
+	"knative.dev/pkg/injection/clients/dynamicclient"
 )
 
 // resolver is the main implementation of the Tekton resolver
 type resolver struct {
 	fetcher TemplateFetcher
+
+	// kubeClient reads per-request credentials secrets. It is only set when running as a
+	// Tekton resolver.
+	kubeClient kubernetes.Interface
+
+	// dynamicClient reads TemplateBindings. It is only set when running as a Tekton resolver.
+	dynamicClient dynamic.Interface
+
+	// cache holds fetched templates and rendered results, nil when caching is disabled
+	cache Cache
+
+	// watcher keeps the WATCH_TEMPLATES cached, nil when none are watched
+	watcher *templateWatcher
+
+	// environmentChecked and repositoriesChecked record the startup checks that passed
+	environmentChecked  bool
+	repositoriesChecked bool
 }
 
 // NewResolver creates a new resolver with the default template fetcher
@@ -25,29 +49,165 @@ func NewResolver() *resolver {
 	}
 }
 
-// Initialize sets up any dependencies needed by the resolver. None atm.
-func (r *resolver) Initialize(context.Context) error {
+// Initialize sets up any dependencies needed by the resolver. The Kubernetes client is
+// only available when the framework injected it (it is absent in standalone mode).
+func (r *resolver) Initialize(ctx context.Context) error {
+	if ctx.Value(kubeclient.Key{}) != nil {
+		r.kubeClient = kubeclient.Get(ctx)
+	}
+	if ctx.Value(dynamicclient.Key{}) != nil {
+		r.dynamicClient = dynamicclient.Get(ctx)
+	}
+	if err := r.startupCheck(ctx); err != nil {
+		return fmt.Errorf("startup check failed:\n%w", err)
+	}
+
+	// Initialize may be called again by the framework, keep the cache created first
+	if r.cache == nil {
+		cache, err := newCache(cacheBackend)
+		if err != nil {
+			return err
+		}
+		r.cache = cache
+		if fetcher, ok := r.fetcher.(*gitTemplateFetcher); ok {
+			fetcher.cache = cache
+		}
+	}
 	return nil
 }
 
-// GetName returns a string name to refer to this resolver by.
+// GetName returns a string name to refer to this resolver by, RESOLVER_NAME.
 func (r *resolver) GetName(context.Context) string {
-	return "Template"
+	return resolverName
 }
 
-// GetSelector returns a map of labels to match requests to this resolver.
+// GetSelector returns a map of labels to match requests to this resolver. Requests are
+// matched by their resolution.tekton.dev/type label, RESOLVER_TYPE, so several instances of
+// the resolver can serve distinct requests in one cluster.
 func (r *resolver) GetSelector(context.Context) map[string]string {
 	return map[string]string{
-		common.LabelKeyResolverType: "template",
+		common.LabelKeyResolverType: resolverType,
 	}
 }
 
+// aliasResolver serves the requests of another resolver type with a resolver, so pipelines
+// can move from one resolver type to another while both are in use
+type aliasResolver struct {
+	*resolver
+	resolverType string
+}
+
+// GetName returns the name of the resolver with the alias, which also names the work queue
+// of the controller serving the alias
+func (a *aliasResolver) GetName(ctx context.Context) string {
+	return fmt.Sprintf("%s (%s)", a.resolver.GetName(ctx), a.resolverType)
+}
+
+// GetSelector matches the requests of the alias
+func (a *aliasResolver) GetSelector(context.Context) map[string]string {
+	return map[string]string{
+		common.LabelKeyResolverType: a.resolverType,
+	}
+}
+
+// Resolve logs the requests still using the alias before resolving them
+func (a *aliasResolver) Resolve(ctx context.Context, params []pipelinev1.Param) (framework.ResolvedResource, error) {
+	contextLogger(ctx).Infof("ResolutionRequest %s/%s uses the resolver type alias %s of %s",
+		common.RequestNamespace(ctx), common.RequestName(ctx), a.resolverType, resolverType)
+	return a.resolver.Resolve(ctx, params)
+}
+
+// resolverControllers returns the controllers serving the requests of the resolver type and
+// of each of its aliases. The framework watches a single resolver type per controller.
+func resolverControllers(ctx context.Context, r *resolver) []injection.ControllerConstructor {
+	controllers := []injection.ControllerConstructor{framework.NewController(ctx, r)}
+	served := map[string]bool{resolverType: true}
+	for _, alias := range resolverTypeAliases {
+		if served[alias] {
+			continue
+		}
+		served[alias] = true
+		controllers = append(controllers, framework.NewController(ctx, &aliasResolver{resolver: r, resolverType: alias}))
+	}
+	return controllers
+}
+
+// validateResolverType checks that a resolver type can be the value of the type label of
+// ResolutionRequests
+func validateResolverType(value string) error {
+	if value == "" {
+		return fmt.Errorf("resolver type cannot be empty")
+	}
+	if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+		return fmt.Errorf("invalid resolver type %q: %s", value, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 // Parameters required for template resolution
 const (
 	RepositoryParam = "repository"
 	PathParam       = "path"
+
+	// Optional branch, tag or commit to fetch the template from
+	RevisionParam = "revision"
+
+	// Optional submodule mode for Git clones: "true", "shallow" or "false"
+	SubmodulesParam = "submodules"
+
+	// Optional name of a Secret in the request namespace holding Git credentials
+	GitCredentialsSecretParam = "git-credentials-secret"
+
+	// Optional directory of the repository with a kustomization applied to the rendered template
+	KustomizationParam = "kustomization"
+
+	// Optional "true" to render Helm chart templates, with params under .Values and Sprig functions
+	HelmParam = "helm"
+
+	// Optional rendering engine, detected from the template extension when not set
+	EngineParam = "engine"
+
+	// Optional YAML document exposed to Go templates as .Values, like a Helm values file
+	ValuesParam = "values"
+
+	// Optional name of a ConfigMap in the request namespace whose data is added to .Values
+	ValuesFromConfigMapParam = "values-from-configmap"
+
+	// Optional name of a Secret in the request namespace whose data is added to .Values
+	// without ever being logged
+	ValuesFromSecretParam = "values-from-secret"
+
+	// Optional "true" to convert string params holding booleans and numbers to typed values
+	CoerceTypesParam = "coerce-types"
+
+	// Optional "true" to fail the resolution when a Go template renders invalid YAML
+	StrictYAMLParam = "strict-yaml"
+
+	// Optional "true" to declare the params the tasks of a rendered Pipeline reference but
+	// the Pipeline does not
+	DeclareParamsParam = "declare-params"
+
+	// Optional names of the params holding Tekton task lists, replacing the detection of
+	// task lists by param name
+	StructuredParamsParam = "structured-params"
+
+	// Optional name of a TemplateBinding in the request namespace providing the repository,
+	// path, revision and default params
+	BindingParam = "binding"
 )
 
+// isOptionParam reports whether a param configures the resolution rather than being
+// template input
+func isOptionParam(name string) bool {
+	switch name {
+	case SubmodulesParam, GitCredentialsSecretParam, KustomizationParam, HelmParam, EngineParam, ValuesParam,
+		ValuesFromConfigMapParam, ValuesFromSecretParam, CoerceTypesParam, StrictYAMLParam,
+		DeclareParamsParam, StructuredParamsParam, BindingParam:
+		return true
+	}
+	return false
+}
+
 // Validate ensures that the resolution params from a request are as expected.
 func (r *resolver) ValidateParams(ctx context.Context, params []pipelinev1.Param) error {
 	// Create a map for easier lookup
@@ -56,62 +216,430 @@ func (r *resolver) ValidateParams(ctx context.Context, params []pipelinev1.Param
 		paramMap[param.Name] = true
 	}
 
-	// Check for required parameters
-	if !paramMap[RepositoryParam] {
+	// Check for required parameters, which a TemplateBinding may provide instead
+	if !paramMap[RepositoryParam] && !paramMap[BindingParam] {
 		return fmt.Errorf("missing required parameter: %s", RepositoryParam)
 	}
-	if !paramMap[PathParam] {
+	if !paramMap[PathParam] && !paramMap[BindingParam] {
 		return fmt.Errorf("missing required parameter: %s", PathParam)
 	}
 
+	for _, param := range params {
+		if param.Name == SubmodulesParam {
+			if _, err := parseSubmodulesMode(param.Value.StringVal); err != nil {
+				return err
+			}
+		}
+		if param.Name == EngineParam {
+			if _, err := detectEngine(param.Value.StringVal, ""); err != nil {
+				return err
+			}
+		}
+		if param.Name == HelmParam || param.Name == CoerceTypesParam || param.Name == StrictYAMLParam ||
+			param.Name == DeclareParamsParam {
+			if _, err := strconv.ParseBool(param.Value.StringVal); err != nil {
+				return fmt.Errorf("invalid %s param %q, must be true or false", param.Name, param.Value.StringVal)
+			}
+		}
+	}
+	if _, err := parseValues(params); err != nil {
+		return err
+	}
+
 	// Post-dev and post-prod steps are optional
 	return nil
 }
 
 // Resolve fetches the template from Git, applies parameters, and returns the rendered template.
-// For YAML array parameters that look like Tekton tasks:
+// For YAML array parameters that look like Tekton tasks, steps, StepActions or sidecars:
 // - The structured objects are stored directly in templateData[camelName] for iteration
-// - The task names are stored in templateData[camelName+"Names"] for runAfter references
+// - Their names are stored in templateData[camelName+"Names"] for runAfter references
 // - The original string is also stored as templateData[camelName+"Raw"] for direct fromYAML usage
 func (r *resolver) Resolve(ctx context.Context, params []pipelinev1.Param) (framework.ResolvedResource, error) {
-	debugf("Resolve called with %d params", len(params))
+	startedOn := time.Now()
+	applyResolverConfig(ctx)
+	debugContextf(ctx, "Resolve called with %d params", len(params))
+	// Secrets read by lookup, in this template or the templates it is built from, are
+	// redacted from the logs of the whole resolution
+	if len(templateLookupSecrets) > 0 {
+		ctx = withRedaction(ctx)
+	}
 
-	// Extract required parameters
-	var repository, path string
+	// Fill in the template and default params of a TemplateBinding
+	params, err := r.applyBinding(ctx, params)
+	if err != nil {
+		return nil, err
+	}
 
-	// Dynamic parameter map to pass to template
-	templateData := make(map[string]interface{})
+	// Extract required parameters
+	var repository, path, revision, kustomization, engineName, valuesConfigMap, valuesSecret string
+	var helm bool
+	coerceTypes := coerceParamTypes
+	strict := strictYAML
+	declarePipelineParams := declareParams
+	fetchOpts := FetchOptions{Submodules: gitSubmodules}
 
 	// First, extract required parameters
 	for _, param := range params {
 		switch param.Name {
 		case RepositoryParam:
 			repository = param.Value.StringVal
-			debugf("Repository: %s", repository)
-			templateData[RepositoryParam] = repository
+			debugContextf(ctx, "Repository: %s", repository)
 		case PathParam:
 			path = param.Value.StringVal
-			debugf("Path: %s", path)
-			templateData[PathParam] = path
+			debugContextf(ctx, "Path: %s", path)
+		case RevisionParam:
+			revision = param.Value.StringVal
+			debugContextf(ctx, "Revision: %s", revision)
+		case SubmodulesParam:
+			mode, err := parseSubmodulesMode(param.Value.StringVal)
+			if err != nil {
+				return nil, err
+			}
+			debugContextf(ctx, "Submodules: %s", mode)
+			fetchOpts.Submodules = mode
+		case GitCredentialsSecretParam:
+			creds, err := r.loadGitCredentials(ctx, param.Value.StringVal)
+			if err != nil {
+				return nil, err
+			}
+			fetchOpts.Credentials = creds
+		case KustomizationParam:
+			kustomization = param.Value.StringVal
+			debugContextf(ctx, "Kustomization: %s", kustomization)
+		case HelmParam:
+			helm, _ = strconv.ParseBool(param.Value.StringVal)
+			debugContextf(ctx, "Helm mode: %t", helm)
+		case CoerceTypesParam:
+			coerceTypes, _ = strconv.ParseBool(param.Value.StringVal)
+			debugContextf(ctx, "Type coercion: %t", coerceTypes)
+		case StrictYAMLParam:
+			strict, _ = strconv.ParseBool(param.Value.StringVal)
+			debugContextf(ctx, "Strict YAML: %t", strict)
+		case DeclareParamsParam:
+			declarePipelineParams, _ = strconv.ParseBool(param.Value.StringVal)
+			debugContextf(ctx, "Declare params: %t", declarePipelineParams)
+		case EngineParam:
+			engineName = param.Value.StringVal
+		case ValuesFromConfigMapParam:
+			valuesConfigMap = param.Value.StringVal
+		case ValuesFromSecretParam:
+			valuesSecret = param.Value.StringVal
+		}
+	}
+
+	// Repositories without a git-credentials-secret may have credentials configured for them
+	if fetchOpts.Credentials == nil {
+		creds, err := r.repositoryCredentials(ctx, repository)
+		if err != nil {
+			return nil, err
 		}
+		fetchOpts.Credentials = creds
+	}
+	// Templates resolved for another template are part of its resolution
+	if !isNestedResolution(ctx) {
+		defer observeResolution(repository, fetchOpts, startedOn)
+	}
+
+	// Tag the logs of the rest of the resolution with what is being resolved
+	ctx = withLogFields(ctx, "repository", repository, "path", path, "revision", revision)
+	ctx = withCacheRepository(ctx, repository)
+	if namespace := common.RequestNamespace(ctx); namespace != "" {
+		ctx = withLogFields(ctx, "namespace", namespace)
+	}
+
+	// Paths holding a glob render every file matching them and merge the results
+	if isGlobPath(path) {
+		request := provenanceRequest{repository: repository, path: path, revision: revision, params: params, startedOn: startedOn}
+		return r.resolveGlob(ctx, request, kustomization, declarePipelineParams, fetchOpts)
 	}
 
 	// Fetch template from Git repository
-	templateContent, err := r.fetcher.FetchTemplate(repository, path)
+	fetched, err := r.fetchTemplate(ctx, repository, revision, path, fetchOpts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch template: %w", err)
 	}
+	source := &pipelinev1.RefSource{
+		URI:        repository,
+		EntryPoint: path,
+	}
+
+	// Check the params against the schema the template declares and fill in its defaults
+	content, schema, err := r.templateParamSchema(ctx, repository, revision, path, fetched.Content, fetchOpts)
+	if err != nil {
+		return nil, err
+	}
+	content, schema, overlays, err := r.applyBase(ctx, repository, revision, path, content, schema, fetchOpts)
+	if err != nil {
+		return nil, err
+	}
+	if params, err = applyParamSchema(schema, params); err != nil {
+		return nil, err
+	}
+	structured := declaredStructuredParams(schema, params)
+	var dependencies []templateDependency
+	if schema != nil {
+		dependencies = schema.Templates
+	}
+
+	// Lint and the template data debug output record what the template is rendered with
+	capture := capturedRender(ctx)
+	if capture != nil && schema != nil {
+		for _, spec := range schema.Params {
+			capture.declared = append(capture.declared, spec.Name)
+		}
+		if frontmatter, ok := strings.CutSuffix(fetched.Content, content); ok {
+			capture.frontmatterLines = strings.Count(frontmatter, "\n")
+		}
+	}
+
+	// The default values of the template in the repository are overridden by the values
+	// from a ConfigMap and then a Secret of the request namespace, which are read at every
+	// resolution. Secret values never reach the logs.
+	var baseValues map[string]interface{}
+	var valuesFile string
+	if templateValuesFiles {
+		if baseValues, valuesFile, err = r.defaultValues(ctx, repository, revision, path, fetchOpts); err != nil {
+			return nil, err
+		}
+	}
+	if valuesConfigMap != "" {
+		configMapValues, err := r.configMapValues(ctx, valuesConfigMap)
+		if err != nil {
+			return nil, err
+		}
+		if baseValues, err = mergeMaps(true, copyMap(baseValues), configMapValues); err != nil {
+			return nil, err
+		}
+	}
+	if valuesSecret != "" {
+		secretValues, err := r.secretValues(ctx, valuesSecret)
+		if err != nil {
+			return nil, err
+		}
+		ctx = withRedactedValues(ctx, sensitiveStrings(secretValues))
+		if capture != nil {
+			capture.sensitive = append(capture.sensitive, sensitiveStrings(secretValues)...)
+		}
+		if baseValues, err = mergeMaps(true, copyMap(baseValues), secretValues); err != nil {
+			return nil, err
+		}
+	}
 
-	// Process all parameters including the required ones we already set
+	// The same template rendered with the same params usually produces the same result.
+	// Templates that include partials or use the time are not cached, and neither are
+	// results using values from a ConfigMap or Secret, which can change at any time and
+	// must not be stored, or kustomized results, which depend on the patch files as well.
+	// Neither are templates built from other templates, which can change on their own, or
+	// templates resolved for another template, which are not combined like the ones returned,
+	// or templates extending a base, which is read at every resolution.
+	deterministic := renderCacheable(content) && valuesConfigMap == "" && valuesSecret == "" && len(dependencies) == 0 && len(overlays) == 0
+	nested := isNestedResolution(ctx)
+	var renderKey string
+	if deterministic && kustomization == "" && !nested && capture == nil {
+		if renderKey, err = renderCacheKey(content, schema, params, valuesFile); err != nil {
+			debugContextf(ctx, "Not caching rendered template: %v", err)
+		}
+	}
+	annotations := cacheHintAnnotations(revision, deterministic)
+	provenance := provenanceRequest{repository: repository, path: path, revision: revision, params: params, fetched: fetched, startedOn: startedOn}
+	if rendered, ok := r.cachedRender(ctx, renderKey); ok {
+		debugContextf(ctx, "Using cached rendered template (%d bytes)", len(rendered))
+		provenance.rendered = rendered
+		source.Digest = sourceDigest(fetched, rendered)
+		annotations, err = addProvenanceAnnotations(ctx, addRenderAnnotations(annotations, fetched, revision, true), provenance)
+		if err != nil {
+			return nil, err
+		}
+		return &templateResource{data: rendered, source: source, annotations: annotations, fetched: fetched}, nil
+	}
+
+	engineName, err = detectEngine(engineName, path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRestrictedEngine(engineName); err != nil {
+		return nil, err
+	}
+	if helm && engineName != EngineGoTemplate {
+		return nil, fmt.Errorf("the %s param requires the %s engine, not %s", HelmParam, EngineGoTemplate, engineName)
+	}
+	if len(dependencies) > 0 && engineName != EngineGoTemplate {
+		return nil, fmt.Errorf("only %s templates can be built from other templates, not %s", EngineGoTemplate, engineName)
+	}
+	if len(overlays) > 0 && engineName != EngineGoTemplate {
+		return nil, fmt.Errorf("only %s templates can extend a base template, not %s", EngineGoTemplate, engineName)
+	}
+	templates, err := r.resolveDependencies(ctx, dependencies, repository, revision, path, params)
+	if err != nil {
+		return nil, err
+	}
+	debugContextf(ctx, "Rendering template with the %s engine", engineName)
+
+	// Render the template
+	renderedTemplate, err := templateEngines[engineName].render(ctx, renderRequest{
+		content: content,
+		path:    path,
+		params:  params,
+		options: renderOptions{
+			loadPartial: func(name string) (string, error) {
+				return r.fetchPartial(ctx, repository, revision, name, fetchOpts)
+			},
+			readFile: func(name string) (string, error) {
+				return r.readRepositoryFile(ctx, repository, revision, path, name, fetchOpts)
+			},
+			lookup:      r.lookup(ctx),
+			helm:        helm,
+			values:      baseValues,
+			coerceTypes: coerceTypes,
+			strictYAML:  strict,
+			structured:  structured,
+			templates:   templates,
+			overlays:    overlays,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+
+	if renderedTemplate, err = r.finishRender(ctx, renderedTemplate, repository, revision, kustomization, params, declarePipelineParams, fetchOpts); err != nil {
+		return nil, err
+	}
+
+	// The rendered template is copied into bytes once, for both the cache and the response
+	data := []byte(renderedTemplate)
+	r.storeRender(ctx, renderKey, data)
+
+	source.Digest = sourceDigest(fetched, data)
+
+	// Templates resolved for another template are covered by the provenance of the other one
+	annotations = addRenderAnnotations(annotations, fetched, revision, false)
+	if !nested {
+		provenance.rendered = data
+		if annotations, err = addProvenanceAnnotations(ctx, annotations, provenance); err != nil {
+			return nil, err
+		}
+	}
+
+	return &templateResource{
+		data:        data,
+		source:      source,
+		annotations: annotations,
+		fetched:     fetched,
+	}, nil
+}
+
+// finishRender turns the rendered output of a template into the resource Tekton takes: the
+// kustomization is applied, documents are combined, the workspaces and, with declare, the
+// params the tasks use are declared, and the result is validated. Templates resolved for
+// another template are only kustomized, since they are spliced into it as they are.
+func (r *resolver) finishRender(ctx context.Context, rendered, repository, revision, kustomization string, params []pipelinev1.Param, declare bool, opts FetchOptions) (string, error) {
+	nested := isNestedResolution(ctx)
+	var err error
+	if kustomization != "" {
+		if rendered, err = r.applyKustomization(ctx, repository, revision, kustomization, rendered, opts); err != nil {
+			return "", err
+		}
+	}
+
+	// Tekton takes a single resource, the Tasks and StepActions rendered with it are inlined.
+	// Templates resolved for another template are spliced into it as they are.
+	if !nested {
+		if rendered, err = combineDocuments(ctx, rendered, validateRendered); err != nil {
+			return "", err
+		}
+	}
+
+	// Tasks passed in params often bind workspaces, or reference params, the template does
+	// not declare
+	if declareWorkspaces && !nested {
+		if rendered, err = addWorkspaceDeclarations(ctx, rendered); err != nil {
+			return "", err
+		}
+	}
+	if declare && !nested {
+		if rendered, err = addParamDeclarations(ctx, rendered, params); err != nil {
+			return "", err
+		}
+	}
+
+	// Final validation before returning, which only feeds the debug log
+	if currentSettings().debug {
+		if err := checkYAMLDocuments(rendered); err != nil {
+			debugContextf(ctx, "Final YAML validation failed: %v", err)
+		} else {
+			debugContextf(ctx, "Final YAML validation passed\n")
+		}
+	}
+	if validateRendered && !nested {
+		if err := validateTektonResource(ctx, rendered); err != nil {
+			return "", err
+		}
+	}
+
+	debugContextf(ctx, "Creating template resource with %d bytes of data", len(rendered))
+	return rendered, nil
+}
+
+// objectParamValue returns the fields of an object param, parsing the ones holding YAML or
+// JSON objects and arrays so templates can use .Config.deploy.replicas instead of calling
+// fromYAML on each field
+func objectParamValue(object map[string]string) map[string]interface{} {
+	result := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		result[key] = structuredParamValue(value)
+	}
+	return result
+}
+
+// structuredParamValue parses a JSON object or array, or a YAML mapping or sequence spanning
+// several lines. Everything else stays a string, so a single-line value such as
+// "note: see the runbook" is not mistaken for a mapping.
+func structuredParamValue(value string) interface{} {
+	trimmed := strings.TrimSpace(value)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") && !strings.Contains(trimmed, "\n") {
+		return value
+	}
+	var parsed interface{}
+	if err := yaml.Unmarshal([]byte(trimmed), &parsed); err != nil {
+		return value
+	}
+	switch parsed.(type) {
+	case map[string]interface{}, []interface{}:
+		return parsed
+	default:
+		return value
+	}
+}
+
+// goTemplateData builds the data of a Go template from the request params: repository,
+// path and revision under their param names, the other params as added by addParamTemplateData
+func goTemplateData(params []pipelinev1.Param, structured structuredParams) map[string]interface{} {
+	templateData := make(map[string]interface{})
+	for _, param := range params {
+		switch param.Name {
+		case RepositoryParam, PathParam, RevisionParam:
+			templateData[param.Name] = param.Value.StringVal
+		}
+	}
+	addParamTemplateData(templateData, params, structured)
+	return templateData
+}
+
+// addParamTemplateData adds the request params to the template data under their camelCase
+// names, parsing the structured params that hold Tekton tasks, steps, StepActions or
+// sidecars into objects and names
+func addParamTemplateData(templateData map[string]interface{}, params []pipelinev1.Param, structured structuredParams) {
 	for _, param := range params {
 		debugf("Processing param: %s (type: %s)", param.Name, param.Value.Type)
 
 		// Convert parameter name to camel case for template
 		camelName := toCamelCase(param.Name)
 
-		// Skip parameters we've already set (repository and path)
+		// Skip parameters we've already set (repository, path and the resolution options)
 		// and skip if we've already processed this parameter name
-		if param.Name == RepositoryParam || param.Name == PathParam {
+		if param.Name == RepositoryParam || param.Name == PathParam || param.Name == RevisionParam ||
+			isOptionParam(param.Name) {
 			continue
 		}
 
@@ -126,7 +654,8 @@ func (r *resolver) Resolve(ctx context.Context, params []pipelinev1.Param) (fram
 			debugf("Processing array parameter %s", param.Name)
 
 			// Try to parse structured YAML arrays
-			if strings.Contains(param.Name, "steps") || strings.Contains(param.Name, "tasks") {
+			marked := structured.marked(param)
+			if marked {
 				// First try to parse the array directly as JSON
 				// This is needed for complex YAML structures
 				allItemsJSON := "["
@@ -141,45 +670,10 @@ func (r *resolver) Resolve(ctx context.Context, params []pipelinev1.Param) (fram
 				debugf("Trying to parse array as JSON: %s", allItemsJSON)
 
 				var taskObjects []map[string]interface{}
-				if err := json.Unmarshal([]byte(allItemsJSON), &taskObjects); err == nil {
+				err := json.Unmarshal([]byte(allItemsJSON), &taskObjects)
+				if err == nil {
 					debugf("Successfully parsed JSON array with %d objects", len(taskObjects))
-
-					// Create a YAML string for the template to use with fromYAML
-					yamlBytes, err := yaml.Marshal(taskObjects)
-					if err == nil {
-						yamlString := string(yamlBytes)
-						debugf("Adding YAML string as %s", camelName)
-						templateData[camelName] = yamlString
-					} else {
-						debugf("Failed to convert objects to YAML: %v, using original JSON", err)
-						templateData[camelName] = allItemsJSON
-					}
-
-					// Store the structured objects with a different key
-					structuredKey := camelName + "Objects"
-					debugf("Adding structured task objects as %s", structuredKey)
-					templateData[structuredKey] = taskObjects
-
-					// Extract task names (for runAfter references)
-					var taskNames []string
-					for _, task := range taskObjects {
-						if name, ok := task["name"].(string); ok {
-							taskNames = append(taskNames, name)
-						}
-					}
-
-					// Add names for reference in templates
-					if len(taskNames) > 0 {
-						namesParam := camelName + "Names"
-						debugf("Adding task names as %s: %v", namesParam, taskNames)
-						templateData[namesParam] = taskNames
-
-						// Add last task name for convenience
-						lastNameParam := camelName + "Name"
-						lastTaskName := taskNames[len(taskNames)-1]
-						debugf("Adding last task name as %s: %s", lastNameParam, lastTaskName)
-						templateData[lastNameParam] = lastTaskName
-					}
+					addStructuredTemplateData(templateData, camelName, taskObjects, allItemsJSON)
 
 					// Skip the rest of the processing
 					continue
@@ -188,71 +682,43 @@ func (r *resolver) Resolve(ctx context.Context, params []pipelinev1.Param) (fram
 				debugf("Failed to parse structured JSON array: %v", err)
 			}
 
+			// Arrays not declared structured are passed through as they are
+			if structured != nil && !structured[param.Name] {
+				templateData[camelName] = param.Value.ArrayVal
+				continue
+			}
+
 			// Fall back to standard array processing
 			var tasks []map[string]interface{}
 			for i, arrayItem := range param.Value.ArrayVal {
 				var task map[string]interface{}
 				if err := yaml.Unmarshal([]byte(arrayItem), &task); err != nil {
-					log.Printf("WARNING: Failed to parse %s array item %d as YAML: %v", param.Name, i, err)
+					logger.Warnf("Failed to parse %s array item %d as YAML: %v", param.Name, i, err)
 					continue
 				}
 
-				// Check if this looks like a task (has a "name" field)
-				if _, hasName := task["name"]; hasName {
+				// Check if this looks like a task (has a "name" field), or like a step, StepAction
+				// or sidecar in a structured param
+				if _, hasName := task["name"]; hasName || marked && isStructuredItem(task) {
 					tasks = append(tasks, task)
 				}
 			}
 
 			// If we found tasks, store them as a YAML string and extract names
 			if len(tasks) > 0 {
-				// Create a YAML string for the template to use with fromYAML
-				yamlBytes, err := yaml.Marshal(tasks)
-				if err == nil {
-					yamlString := string(yamlBytes)
-					debugf("Adding YAML string as %s", camelName)
-					templateData[camelName] = yamlString
-				} else {
-					debugf("Failed to convert tasks to YAML: %v", err)
-					templateData[camelName] = ""
-				}
-
-				// Store the task objects with a different key
-				structuredKey := camelName + "Objects"
-				debugf("Adding structured task objects as %s", structuredKey)
-				templateData[structuredKey] = tasks
-
-				// Extract task names
-				var taskNames []string
-				for _, task := range tasks {
-					if name, ok := task["name"].(string); ok {
-						taskNames = append(taskNames, name)
-					}
-				}
-
-				// Add task names to template data
-				if len(taskNames) > 0 {
-					namesParam := camelName + "Names"
-					debugf("Adding task names as %s", namesParam)
-					templateData[namesParam] = taskNames
-
-					// Add last task name for convenience
-					lastNameParam := camelName + "Name"
-					lastTaskName := taskNames[len(taskNames)-1]
-					debugf("Adding last task name as %s: %s", lastNameParam, lastTaskName)
-					templateData[lastNameParam] = lastTaskName
-				}
+				addStructuredTemplateData(templateData, camelName, tasks, "")
 			} else {
 				// Just a regular array parameter
 				templateData[camelName] = param.Value.ArrayVal
 			}
 
 		case pipelinev1.ParamTypeObject:
-			// Pass through object parameters
-			templateData[camelName] = param.Value.ObjectVal
+			// Object parameters, with YAML and JSON values parsed into nested structures
+			templateData[camelName] = objectParamValue(param.Value.ObjectVal)
 
 		default: // String or other type
 			// Try to parse string as YAML tasks if it looks like YAML
-			if param.Value.Type == pipelinev1.ParamTypeString && strings.Contains(param.Value.StringVal, "name:") {
+			if param.Value.Type == pipelinev1.ParamTypeString && structured.marked(param) {
 				paramVal := param.Value.StringVal
 				if paramVal != "" {
 					var tasks []map[string]interface{}
@@ -261,42 +727,7 @@ func (r *resolver) Resolve(ctx context.Context, params []pipelinev1.Param) (fram
 						templateData[camelName] = paramVal
 					} else if len(tasks) > 0 {
 						// It parsed as tasks, store as YAML string for templates
-						// Create a YAML string for the template to use with fromYAML
-						yamlBytes, err := yaml.Marshal(tasks)
-						if err == nil {
-							yamlString := string(yamlBytes)
-							debugf("Adding YAML string as %s", camelName)
-							templateData[camelName] = yamlString
-						} else {
-							debugf("Failed to convert tasks to YAML: %v", err)
-							templateData[camelName] = paramVal
-						}
-
-						// Store the task objects with a different key
-						structuredKey := camelName + "Objects"
-						debugf("Adding structured task objects as %s", structuredKey)
-						templateData[structuredKey] = tasks
-
-						// Extract task names
-						var taskNames []string
-						for _, task := range tasks {
-							if name, ok := task["name"].(string); ok {
-								taskNames = append(taskNames, name)
-							}
-						}
-
-						// Add task names to template data
-						if len(taskNames) > 0 {
-							namesParam := camelName + "Names"
-							debugf("Adding task names as %s", namesParam)
-							templateData[namesParam] = taskNames
-
-							// Add last task name for convenience
-							lastNameParam := camelName + "Name"
-							lastTaskName := taskNames[len(taskNames)-1]
-							debugf("Adding last task name as %s: %s", lastNameParam, lastTaskName)
-							templateData[lastNameParam] = lastTaskName
-						}
+						addStructuredTemplateData(templateData, camelName, tasks, paramVal)
 					} else {
 						// Empty tasks array, use empty string
 						templateData[camelName] = ""
@@ -310,31 +741,29 @@ func (r *resolver) Resolve(ctx context.Context, params []pipelinev1.Param) (fram
 			}
 		}
 	}
+}
 
-	// Render the template
-	renderedTemplate, err := renderTemplate(templateContent, templateData)
-	if err != nil {
-		return nil, fmt.Errorf("failed to render template: %w", err)
+// fetchPartial fetches a partial file from the same repository and revision as the template
+func (r *resolver) fetchPartial(ctx context.Context, repository, revision, name string, opts FetchOptions) (string, error) {
+	var err error
+	for _, candidate := range partialFileCandidates(name) {
+		var fetched *FetchedTemplate
+		if fetched, err = r.fetchTemplate(ctx, repository, revision, candidate, opts); err == nil {
+			return fetched.Content, nil
+		}
+		debugContextf(ctx, "Partial %s not found at %s: %v", name, candidate, err)
 	}
+	return "", err
+}
 
-	debugf("Creating template resource with %d bytes of data", len(renderedTemplate))
-
-	// Final validation before returning
-	var obj interface{}
-	if err := yaml.Unmarshal([]byte(renderedTemplate), &obj); err != nil {
-		debugf("Final YAML validation failed: %v", err)
-	} else {
-		debugf("Final YAML validation passed\n")
+// sourceDigest returns the RefSource digest for a resolved template: the sha256 of the
+// rendered bytes, so consumers can verify the exact content Tekton received, and the commit
+// SHA for Git sources. Sources that did not report a commit get no sha1 rather than a
+// made-up value.
+func sourceDigest(fetched *FetchedTemplate, rendered []byte) map[string]string {
+	digest := map[string]string{"sha256": sha256Hex(rendered)}
+	if fetched.Commit != "" {
+		digest["sha1"] = fetched.Commit
 	}
-
-	return &templateResource{
-		data: []byte(renderedTemplate),
-		source: &pipelinev1.RefSource{
-			URI: repository,
-			Digest: map[string]string{
-				"sha1": "unknown", // In a real implementation, we should calculate this
-			},
-			EntryPoint: path,
-		},
-	}, nil
+	return digest
 }
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tektoncd/pipeline/pkg/resolution/resolver/framework"
+)
+
+// ResolverConfigName is the ConfigMap in the namespace of the resolver holding its settings
+const ResolverConfigName = "template-resolver-config"
+
+// Keys of the resolver ConfigMap, each overriding the environment variable of the same setting
+const (
+	ConfigKeyDebug             = "debug"
+	ConfigKeyHTTPTimeout       = "http-timeout"
+	ConfigKeyResolutionTimeout = "resolution-timeout"
+	ConfigKeyGitCloneDepth     = "git-clone-depth"
+	ConfigKeyGitDefaultBranch  = "git-default-branch"
+)
+
+// resolverSettings are the settings that can be changed through the resolver ConfigMap
+type resolverSettings struct {
+	debug             bool
+	httpTimeout       time.Duration
+	resolutionTimeout time.Duration
+	gitCloneDepth     int
+	gitDefaultBranch  string
+}
+
+var (
+	// envSettings holds the settings loaded from the environment, which apply to keys the
+	// ConfigMap does not set
+	envSettings = resolverSettings{
+		httpTimeout:       DefaultHTTPTimeout,
+		resolutionTimeout: DefaultResolutionTimeout,
+		gitCloneDepth:     DefaultGitCloneDepth,
+		gitDefaultBranch:  DefaultGitBranch,
+	}
+
+	// configSettings holds the settings computed from the ConfigMap. They are replaced as a
+	// whole, so requests read them without locking, and nil until a ConfigMap was seen.
+	configSettings atomic.Pointer[resolverSettings]
+
+	// resolverConfigMu serializes applying the ConfigMap
+	resolverConfigMu sync.Mutex
+	// appliedResolverConfig is the ConfigMap data the settings were last computed from, nil
+	// until a ConfigMap was seen
+	appliedResolverConfig map[string]string
+)
+
+// currentSettings returns the settings requests run with: those computed from the ConfigMap
+// once one was applied, and the settings loaded from the environment until then
+func currentSettings() resolverSettings {
+	if settings := configSettings.Load(); settings != nil {
+		return *settings
+	}
+	return resolverSettings{
+		debug:             debugMode,
+		httpTimeout:       httpTimeout,
+		resolutionTimeout: resolutionTimeout,
+		gitCloneDepth:     gitCloneDepth,
+		gitDefaultBranch:  gitDefaultBranch,
+	}
+}
+
+// captureEnvSettings records the settings loaded from the environment as the base the
+// ConfigMap is applied to
+func captureEnvSettings() {
+	envSettings = currentSettings()
+}
+
+// settingsFromConfig applies the keys of the resolver ConfigMap to the settings from the
+// environment. Invalid values are logged and ignored.
+func settingsFromConfig(config map[string]string) resolverSettings {
+	settings := envSettings
+	for key, value := range config {
+		var err error
+		switch key {
+		case ConfigKeyDebug:
+			var debug bool
+			if debug, err = strconv.ParseBool(value); err == nil {
+				settings.debug = debug
+			}
+		case ConfigKeyHTTPTimeout:
+			var timeout time.Duration
+			if timeout, err = time.ParseDuration(value); err == nil {
+				settings.httpTimeout = timeout
+			}
+		case ConfigKeyResolutionTimeout:
+			var timeout time.Duration
+			if timeout, err = time.ParseDuration(value); err == nil {
+				settings.resolutionTimeout = timeout
+			}
+		case ConfigKeyGitCloneDepth:
+			var depth int
+			if depth, err = strconv.Atoi(value); err == nil {
+				settings.gitCloneDepth = depth
+			}
+		case ConfigKeyGitDefaultBranch:
+			settings.gitDefaultBranch = value
+		default:
+			logger.Warnf("Unknown key %s in ConfigMap %s", key, ResolverConfigName)
+		}
+		if err != nil {
+			logger.Warnf("Invalid value for %s in ConfigMap %s, ignoring it: %v", key, ResolverConfigName, err)
+		}
+	}
+	return settings
+}
+
+// applyResolverConfig updates the settings from the resolver ConfigMap the framework stored
+// in ctx, so operators can change them without restarting the controller. Nothing changes
+// until a ConfigMap has been seen, which keeps standalone mode on its environment settings,
+// and the settings are only recomputed when the ConfigMap data changed.
+func applyResolverConfig(ctx context.Context) {
+	config := framework.GetResolverConfigFromContext(ctx)
+
+	resolverConfigMu.Lock()
+	defer resolverConfigMu.Unlock()
+	if (appliedResolverConfig == nil && len(config) == 0) || maps.Equal(config, appliedResolverConfig) {
+		return
+	}
+
+	settings := settingsFromConfig(config)
+	configSettings.Store(&settings)
+	appliedResolverConfig = maps.Clone(config)
+	logger.Infof("Applied ConfigMap %s: HTTP Timeout=%v, Resolution Timeout=%v, Git Clone Depth=%d, Git Default Branch=%s, Debug=%t",
+		ResolverConfigName, settings.httpTimeout, settings.resolutionTimeout, settings.gitCloneDepth, settings.gitDefaultBranch, settings.debug)
+}
+
+// GetConfigName returns the name of the ConfigMap the framework watches for the resolver
+func (r *resolver) GetConfigName(context.Context) string {
+	return ResolverConfigName
+}
+
+// GetResolutionTimeout returns how long the framework lets a request run: resolution-timeout
+// from the ConfigMap, or RESOLUTION_TIMEOUT when the ConfigMap does not set it. The
+// framework calls it first for every request, so the ConfigMap is applied here as well.
+func (r *resolver) GetResolutionTimeout(ctx context.Context, _ time.Duration, _ map[string]string) (time.Duration, error) {
+	applyResolverConfig(ctx)
+	return currentSettings().resolutionTimeout, nil
+}
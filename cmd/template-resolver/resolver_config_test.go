@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tektoncd/pipeline/pkg/resolution/resolver/framework"
+	"go.uber.org/zap/zapcore"
+)
+
+// resetResolverConfig restores the settings changed by applying a ConfigMap
+func resetResolverConfig(t *testing.T) {
+	originalEnv := envSettings
+	originalDebug, originalHTTP, originalResolution := debugMode, httpTimeout, resolutionTimeout
+	originalDepth, originalBranch := gitCloneDepth, gitDefaultBranch
+	t.Cleanup(func() {
+		envSettings = originalEnv
+		appliedResolverConfig = nil
+		configSettings.Store(nil)
+		debugMode, httpTimeout, resolutionTimeout = originalDebug, originalHTTP, originalResolution
+		gitCloneDepth, gitDefaultBranch = originalDepth, originalBranch
+	})
+}
+
+func TestSettingsFromConfig(t *testing.T) {
+	resetResolverConfig(t)
+	envSettings = resolverSettings{
+		httpTimeout:       30 * time.Second,
+		resolutionTimeout: time.Minute,
+		gitCloneDepth:     1,
+		gitDefaultBranch:  "main",
+	}
+
+	assert.Equal(t, envSettings, settingsFromConfig(nil))
+
+	assert.Equal(t, resolverSettings{
+		debug:             true,
+		httpTimeout:       10 * time.Second,
+		resolutionTimeout: 5 * time.Minute,
+		gitCloneDepth:     0,
+		gitDefaultBranch:  "trunk",
+	}, settingsFromConfig(map[string]string{
+		ConfigKeyDebug:             "true",
+		ConfigKeyHTTPTimeout:       "10s",
+		ConfigKeyResolutionTimeout: "5m",
+		ConfigKeyGitCloneDepth:     "0",
+		ConfigKeyGitDefaultBranch:  "trunk",
+	}))
+
+	// Invalid values and unknown keys keep the environment settings
+	assert.Equal(t, envSettings, settingsFromConfig(map[string]string{
+		ConfigKeyDebug:         "maybe",
+		ConfigKeyHTTPTimeout:   "soon",
+		ConfigKeyGitCloneDepth: "deep",
+		"unknown":              "value",
+	}))
+}
+
+func TestApplyResolverConfig(t *testing.T) {
+	resetResolverConfig(t)
+	gitDefaultBranch = "main"
+	gitCloneDepth = 1
+	captureEnvSettings()
+
+	// Without a ConfigMap the environment settings stay in place
+	applyResolverConfig(context.Background())
+	assert.Equal(t, "main", currentSettings().gitDefaultBranch)
+	assert.Nil(t, appliedResolverConfig)
+
+	ctx := framework.InjectResolverConfigToContext(context.Background(), map[string]string{
+		ConfigKeyGitDefaultBranch: "trunk",
+		ConfigKeyGitCloneDepth:    "5",
+	})
+	applyResolverConfig(ctx)
+	assert.Equal(t, "trunk", currentSettings().gitDefaultBranch)
+	assert.Equal(t, 5, currentSettings().gitCloneDepth)
+	// The settings loaded from the environment are left as they are
+	assert.Equal(t, "main", gitDefaultBranch)
+
+	// Removing a key restores its environment setting
+	ctx = framework.InjectResolverConfigToContext(context.Background(), map[string]string{
+		ConfigKeyGitDefaultBranch: "trunk",
+	})
+	applyResolverConfig(ctx)
+	assert.Equal(t, "trunk", currentSettings().gitDefaultBranch)
+	assert.Equal(t, 1, currentSettings().gitCloneDepth)
+
+	applyResolverConfig(framework.InjectResolverConfigToContext(context.Background(), map[string]string{}))
+	assert.Equal(t, "main", currentSettings().gitDefaultBranch)
+}
+
+func TestApplyResolverConfigConcurrently(t *testing.T) {
+	resetResolverConfig(t)
+	captureEnvSettings()
+
+	// Requests read the settings while others apply a changed ConfigMap, which the race
+	// detector reports unless the settings are published safely
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				ctx := framework.InjectResolverConfigToContext(context.Background(), map[string]string{
+					ConfigKeyGitCloneDepth: strconv.Itoa(i*50 + j),
+					ConfigKeyDebug:         strconv.FormatBool(j%2 == 0),
+				})
+				applyResolverConfig(ctx)
+				settings := currentSettings()
+				assert.GreaterOrEqual(t, settings.gitCloneDepth, 0)
+				_ = refOrDefault("")
+				_ = newHTTPClient()
+				_ = logger.Desugar().Core().Enabled(zapcore.DebugLevel)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestResolverGetResolutionTimeout(t *testing.T) {
+	resetResolverConfig(t)
+	resolutionTimeout = 2 * time.Minute
+	captureEnvSettings()
+	r := &resolver{}
+
+	assert.Equal(t, ResolverConfigName, r.GetConfigName(context.Background()))
+
+	timeout, err := r.GetResolutionTimeout(context.Background(), time.Minute, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, timeout)
+
+	ctx := framework.InjectResolverConfigToContext(context.Background(), map[string]string{ConfigKeyResolutionTimeout: "90s"})
+	timeout, err = r.GetResolutionTimeout(ctx, time.Minute, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Second, timeout)
+}
@@ -12,15 +12,16 @@ import (
 // mockFetcher is an implementation of TemplateFetcher for testing
 type mockFetcher struct {
 	templates map[string]string
+	commit    string
 }
 
 // FetchTemplate implements the TemplateFetcher interface for testing
-func (m *mockFetcher) FetchTemplate(repo, path string) (string, error) {
+func (m *mockFetcher) FetchTemplate(repo, revision, path string, opts FetchOptions) (*FetchedTemplate, error) {
 	key := repo + ":" + path
 	if template, ok := m.templates[key]; ok {
-		return template, nil
+		return &FetchedTemplate{Content: template, Commit: m.commit}, nil
 	}
-	return "apiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n  name: default-pipeline\nspec:\n  params:\n  - name: param1\n    type: string\n", nil
+	return &FetchedTemplate{Content: "apiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n  name: default-pipeline\nspec:\n  params:\n  - name: param1\n    type: string\n", Commit: m.commit}, nil
 }
 
 // TestResolverBasicParams tests the resolver with basic parameters
@@ -158,3 +159,75 @@ spec:
 	assert.Contains(t, renderedData, "- staging")
 	assert.Contains(t, renderedData, "- production")
 }
+
+// TestResolverRefSourceDigest tests that the resolved commit and the digest of the rendered
+// template are reported in the RefSource
+func TestResolverRefSourceDigest(t *testing.T) {
+	params := []pipelinev1.Param{
+		{Name: "repository", Value: pipelinev1.ParamValue{Type: "string", StringVal: "https://github.com/example/repo"}},
+		{Name: "path", Value: pipelinev1.ParamValue{Type: "string", StringVal: "pipeline.yaml"}},
+	}
+
+	r := &resolver{fetcher: &mockFetcher{commit: "0123456789abcdef0123456789abcdef01234567"}}
+	result, err := r.Resolve(context.Background(), params)
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/example/repo", result.RefSource().URI)
+	assert.Equal(t, "pipeline.yaml", result.RefSource().EntryPoint)
+	assert.Equal(t, map[string]string{
+		"sha1":   "0123456789abcdef0123456789abcdef01234567",
+		"sha256": sha256Hex(result.Data()),
+	}, result.RefSource().Digest)
+
+	// Sources without a commit report no sha1 instead of a placeholder
+	r = &resolver{fetcher: &mockFetcher{}}
+	result, err = r.Resolve(context.Background(), params)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"sha256": sha256Hex(result.Data())}, result.RefSource().Digest)
+}
+
+// TestResolverObjectParameter tests that YAML and JSON fields of object params are parsed
+func TestResolverObjectParameter(t *testing.T) {
+	template := `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: {{ .Config.name }}
+  annotations:
+    replicas: "{{ .Config.deploy.replicas }}"
+    region: {{ index .Config.regions 1 }}
+    note: "{{ .Config.note }}"
+    legacy: "{{ (fromYAML .Config.deploy).replicas }}"
+spec:
+  params:
+  - name: param1
+    type: string
+`
+	params := []pipelinev1.Param{
+		{Name: "repository", Value: pipelinev1.ParamValue{Type: "string", StringVal: "https://github.com/example/repo"}},
+		{Name: "path", Value: pipelinev1.ParamValue{Type: "string", StringVal: "pipeline.yaml"}},
+		{Name: "config", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeObject, ObjectVal: map[string]string{
+			"name":    "object-pipeline",
+			"deploy":  "replicas: 3\nstrategy: rolling\n",
+			"regions": `["us-east-1", "eu-west-1"]`,
+			"note":    "see: runbook",
+		}}},
+	}
+
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{"https://github.com/example/repo:pipeline.yaml": template}}}
+	result, err := r.Resolve(context.Background(), params)
+	require.NoError(t, err)
+
+	renderedData := string(result.Data())
+	assert.Contains(t, renderedData, "name: object-pipeline")
+	assert.Contains(t, renderedData, `replicas: "3"`)
+	assert.Contains(t, renderedData, "region: eu-west-1")
+	assert.Contains(t, renderedData, `note: "see: runbook"`)
+	assert.Contains(t, renderedData, `legacy: "3"`)
+}
+
+func TestStructuredParamValue(t *testing.T) {
+	assert.Equal(t, map[string]interface{}{"replicas": 3}, structuredParamValue(`{"replicas": 3}`))
+	assert.Equal(t, []interface{}{"a", "b"}, structuredParamValue("- a\n- b"))
+	assert.Equal(t, "replicas: 3", structuredParamValue("replicas: 3"))
+	assert.Equal(t, "line one\nline two", structuredParamValue("line one\nline two"))
+	assert.Equal(t, "{not yaml", structuredParamValue("{not yaml"))
+}
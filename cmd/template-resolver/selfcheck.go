@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"knative.dev/pkg/system"
+)
+
+// startupCheck verifies what the resolver depends on when it is initialized, so a broken
+// deployment fails at once with what to fix rather than on its first request. All problems
+// are reported together. The framework initializes the resolver again with the Kubernetes
+// client, which the REPOSITORY_CREDENTIALS Secrets are read with, so those and the
+// STARTUP_CHECK_REPOSITORIES using them are checked once the client is known.
+func (r *resolver) startupCheck(ctx context.Context) error {
+	var errs []error
+	if !r.environmentChecked {
+		errs = append(errs, checkEnvironment()...)
+		r.environmentChecked = true
+	}
+	if !r.repositoriesChecked && (r.kubeClient != nil || len(repositoryCredentials) == 0) {
+		errs = append(errs, r.checkRepositoryCredentials(ctx)...)
+		for _, repoURL := range startupCheckRepositories {
+			if err := r.checkRepositoryReachable(ctx, repoURL); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		r.repositoriesChecked = true
+	}
+	return errors.Join(errs...)
+}
+
+// checkEnvironment checks the directories the resolver writes to and the credential files
+// it is configured with
+func checkEnvironment() []error {
+	var errs []error
+	// Jsonnet, CUE, ytt and Kustomize render in temporary directories
+	if dir, err := os.MkdirTemp("", "template-resolver-check-"); err != nil {
+		errs = append(errs, fmt.Errorf("temporary directory %s is not writable, mount a writable volume there or set TMPDIR: %w", os.TempDir(), err))
+	} else {
+		_ = os.RemoveAll(dir)
+	}
+	if gitCacheDir != "" {
+		if err := checkWritableDir(gitCacheDir); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s is not writable, mount a writable volume there: %w", EnvGitCacheDir, gitCacheDir, err))
+		}
+	}
+
+	// A missing SSH key only means SSH repositories are cloned without it
+	if _, err := os.Stat(gitSSHKeyFile); err == nil {
+		if _, err := gitssh.NewPublicKeysFromFile("git", gitSSHKeyFile, ""); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s is not an unencrypted SSH private key: %w", EnvGitSSHKeyFile, gitSSHKeyFile, err))
+		}
+	}
+	if gitSSHKnownHosts != "" {
+		if _, err := sshHostKeyCallback(); err != nil {
+			errs = append(errs, fmt.Errorf("check %s: %w", EnvGitSSHKnownHosts, err))
+		}
+	}
+	if netrcFile != "" {
+		if _, err := os.Stat(netrcFile); err == nil {
+			if _, err := os.ReadFile(netrcFile); err != nil {
+				errs = append(errs, fmt.Errorf("%s %s is not readable: %w", EnvNetrc, netrcFile, err))
+			}
+		}
+	}
+	return errs
+}
+
+// checkWritableDir creates a directory if needed and checks a file can be written to it
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, ".template-resolver-check-")
+	if err != nil {
+		return err
+	}
+	_ = file.Close()
+	return os.Remove(file.Name())
+}
+
+// checkRepositoryCredentials reads the Secret of each REPOSITORY_CREDENTIALS entry, which
+// must hold credentials and a valid SSH key when it has one
+func (r *resolver) checkRepositoryCredentials(ctx context.Context) []error {
+	if len(repositoryCredentials) == 0 || r.kubeClient == nil {
+		return nil
+	}
+	namespace := os.Getenv(system.NamespaceEnvKey)
+	if namespace == "" {
+		return []error{fmt.Errorf("%s is set but %s is not, the credentials Secrets cannot be read", EnvRepoCredentials, system.NamespaceEnvKey)}
+	}
+	var errs []error
+	for _, credential := range repositoryCredentials {
+		creds, err := r.readGitCredentials(ctx, namespace, credential.secret)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s pattern %s: %w", EnvRepoCredentials, credential.pattern, err))
+			continue
+		}
+		if len(creds.SSHPrivateKey) > 0 {
+			if _, err := gitssh.NewPublicKeys("git", creds.SSHPrivateKey, ""); err != nil {
+				errs = append(errs, fmt.Errorf("%s pattern %s: credentials secret %s/%s does not hold an unencrypted SSH private key: %w",
+					EnvRepoCredentials, credential.pattern, namespace, credential.secret, err))
+			}
+		}
+	}
+	return errs
+}
+
+// checkRepositoryReachable lists the references of a Git repository with the credentials
+// the resolver would clone it with, like git ls-remote
+func (r *resolver) checkRepositoryReachable(ctx context.Context, repoURL string) error {
+	creds, err := r.repositoryCredentials(ctx, repoURL)
+	if err != nil {
+		return err
+	}
+	auth, err := gitAuth(repoURL, creds)
+	if err != nil {
+		return err
+	}
+	proxyOpts, err := gitProxyOptions(repoURL)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, currentSettings().resolutionTimeout)
+	defer cancel()
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{repoURL}})
+	if _, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth, ProxyOptions: proxyOpts}); err != nil {
+		return fmt.Errorf("%s: %w", EnvCheckRepos, gitCloneError(ctx, repoURL, "", err))
+	}
+	debugf("Repository %s is reachable", repoURL)
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckEnvironment(t *testing.T) {
+	originalCacheDir, originalKeyFile, originalKnownHosts := gitCacheDir, gitSSHKeyFile, gitSSHKnownHosts
+	defer func() { gitCacheDir, gitSSHKeyFile, gitSSHKnownHosts = originalCacheDir, originalKeyFile, originalKnownHosts }()
+
+	dir := t.TempDir()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	pemBlock, err := ssh.MarshalPrivateKey(privateKey, "")
+	require.NoError(t, err)
+	keyFile := filepath.Join(dir, "ssh-privatekey")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(pemBlock), 0o600))
+
+	// A missing SSH key is not a problem, the cache directory is created
+	gitCacheDir, gitSSHKeyFile, gitSSHKnownHosts = filepath.Join(dir, "cache"), filepath.Join(dir, "missing"), ""
+	assert.Empty(t, checkEnvironment())
+	assert.DirExists(t, gitCacheDir)
+
+	gitSSHKeyFile = keyFile
+	assert.Empty(t, checkEnvironment())
+
+	// Every problem is reported
+	notADir := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(notADir, []byte("x"), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, []byte("not a key"), 0o600))
+	gitCacheDir, gitSSHKnownHosts = filepath.Join(notADir, "cache"), filepath.Join(dir, "known_hosts")
+	t.Setenv("TMPDIR", filepath.Join(dir, "missing-tmp"))
+	errs := checkEnvironment()
+	require.Len(t, errs, 4)
+	assert.ErrorContains(t, errs[0], "temporary directory "+filepath.Join(dir, "missing-tmp")+" is not writable")
+	assert.ErrorContains(t, errs[1], "GIT_CACHE_DIR "+gitCacheDir+" is not writable")
+	assert.ErrorContains(t, errs[2], "GIT_SSH_KEY_FILE "+keyFile+" is not an unencrypted SSH private key")
+	assert.ErrorContains(t, errs[3], "failed to load SSH known hosts")
+}
+
+func TestCheckRepositoryCredentials(t *testing.T) {
+	original := repositoryCredentials
+	defer func() { repositoryCredentials = original }()
+	repositoryCredentials = []repositoryCredential{
+		{pattern: "github.com/acme/*", secret: "acme-git"},
+		{pattern: "github.com/*/*", secret: "github-token"},
+		{pattern: "gitlab.com/*", secret: "missing"},
+	}
+	t.Setenv("SYSTEM_NAMESPACE", "tekton-pipelines-resolvers")
+
+	r := &resolver{
+		kubeClient: fake.NewSimpleClientset(
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "acme-git", Namespace: "tekton-pipelines-resolvers"},
+				Data:       map[string][]byte{"ssh-privatekey": []byte("acme-key")},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "github-token", Namespace: "tekton-pipelines-resolvers"},
+				Data:       map[string][]byte{"token": []byte("tok")},
+			},
+		),
+	}
+	errs := r.checkRepositoryCredentials(context.Background())
+	require.Len(t, errs, 2)
+	assert.ErrorContains(t, errs[0], "REPOSITORY_CREDENTIALS pattern github.com/acme/*: credentials secret tekton-pipelines-resolvers/acme-git does not hold an unencrypted SSH private key")
+	assert.ErrorContains(t, errs[1], "REPOSITORY_CREDENTIALS pattern gitlab.com/*: failed to read Git credentials secret tekton-pipelines-resolvers/missing")
+
+	t.Setenv("SYSTEM_NAMESPACE", "")
+	errs = r.checkRepositoryCredentials(context.Background())
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "SYSTEM_NAMESPACE is not")
+
+	// Secrets are read once the framework provides the Kubernetes client
+	assert.Empty(t, (&resolver{}).checkRepositoryCredentials(context.Background()))
+}
+
+func TestResolverStartupCheck(t *testing.T) {
+	repoDir, _ := newTestGitRepository(t)
+	original := startupCheckRepositories
+	defer func() { startupCheckRepositories = original }()
+	startupCheckRepositories = []string{repoDir}
+
+	r := NewResolver()
+	require.NoError(t, r.Initialize(context.Background()))
+	assert.True(t, r.environmentChecked)
+	assert.True(t, r.repositoriesChecked)
+
+	// Checks that passed are not run again when the framework initializes the resolver
+	startupCheckRepositories = []string{filepath.Join(repoDir, "missing")}
+	require.NoError(t, r.Initialize(context.Background()))
+
+	err := NewResolver().Initialize(context.Background())
+	assert.ErrorContains(t, err, "startup check failed")
+	assert.ErrorContains(t, err, "STARTUP_CHECK_REPOSITORIES: git repository "+filepath.Join(repoDir, "missing")+" not found")
+}
@@ -1,51 +1,130 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"net"
 	"net/http"
-
-	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
+// maxRequestBodySize is the largest request body the standalone API reads, enough for the
+// params of any request and an inline template of the default MAX_TEMPLATE_SIZE
+const maxRequestBodySize = 10 << 20
+
+// writeRequestBodyError responds to a request whose body could not be read or parsed, with
+// 413 Request Entity Too Large when it is over maxRequestBodySize
+func writeRequestBodyError(w http.ResponseWriter, err error, format string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeAPIError(w, http.StatusRequestEntityTooLarge, "Request body is over the limit of %d bytes", tooLarge.Limit)
+		return
+	}
+	writeAPIError(w, http.StatusBadRequest, format, err)
+}
+
 // runStandalone starts a simple HTTP server that can process template resolution requests
-// without requiring the Knative/Tekton infrastructure
+// without requiring the Knative/Tekton infrastructure. On SIGINT or SIGTERM it stops
+// accepting connections and waits up to SHUTDOWN_TIMEOUT for in-flight requests, so rolling
+// restarts do not cut renders off mid-request.
 func runStandalone(resolver *resolver, port int) {
-	log.Printf("Starting standalone server on port %d", port)
+	logger.Infof("Starting standalone server on port %d", port)
+	if !authEnabled() {
+		logger.Warnf("%s and %s are not set, anyone who can reach port %d can render templates", EnvAPIToken, EnvAPIBasicUsername, port)
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		logger.Fatalf("Server failed: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	http.HandleFunc("/resolve", func(w http.ResponseWriter, r *http.Request) {
+	draining := &atomic.Bool{}
+	server := &http.Server{Handler: withRequestLogging(standaloneHandler(resolver, draining))}
+	if err := serveUntilDone(ctx, server, listener, draining, shutdownTimeout); err != nil {
+		logger.Fatalf("Server failed: %v", err)
+	}
+	logger.Info("Standalone server stopped")
+}
+
+// serveUntilDone serves requests until ctx is done, then shuts the server down gracefully:
+// readiness reports the server as draining, no new connections are accepted, and requests
+// in flight get up to timeout to complete
+func serveUntilDone(ctx context.Context, server *http.Server, listener net.Listener, draining *atomic.Bool, timeout time.Duration) error {
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Infof("Shutting down, waiting up to %v for in-flight requests", timeout)
+	draining.Store(true)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to drain in-flight requests: %w", err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// standaloneHandler routes the endpoints of the standalone server. Readiness fails once
+// draining is set, so no new traffic is sent to a server that is shutting down.
+func standaloneHandler(resolver *resolver, draining *atomic.Bool) http.Handler {
+	mux := http.NewServeMux()
+	limiter := newRateLimiter(rateLimitGlobal, rateLimitPerClient, rateLimitBurst)
+
+	mux.HandleFunc("/resolve", cors(limiter.limit(requireAuth(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
 			return
 		}
 
-		body, err := io.ReadAll(r.Body)
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to read request body: %v", err), http.StatusBadRequest)
+			writeRequestBodyError(w, err, "Failed to read request body: %v")
 			return
 		}
 
-		var request struct {
-			Parameters []pipelinev1.Param `json:"parameters"`
-		}
+		var request resolveRequest
 
 		if err := json.Unmarshal(body, &request); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to parse request: %v", err), http.StatusBadRequest)
+			writeAPIError(w, http.StatusBadRequest, "Failed to parse request: %v", err)
 			return
 		}
 
 		// Validate parameters
 		if err := resolver.ValidateParams(r.Context(), request.Parameters); err != nil {
-			http.Error(w, fmt.Sprintf("Invalid parameters: %v", err), http.StatusBadRequest)
+			writeAPIError(w, http.StatusBadRequest, "Invalid parameters: %v", err)
+			return
+		}
+
+		// Show template authors the data their template sees instead of the rendered template
+		if r.URL.Query().Get("debug") == debugDataQuery {
+			writeTemplateData(w, r, resolver, request.Parameters)
 			return
 		}
 
 		// Resolve the template
 		result, err := resolver.Resolve(r.Context(), request.Parameters)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to resolve template: %v", err), http.StatusInternalServerError)
+			writeAPIError(w, http.StatusInternalServerError, "Failed to resolve template: %v", err)
 			return
 		}
 
@@ -53,28 +132,97 @@ func runStandalone(resolver *resolver, port int) {
 		w.Header().Set("Content-Type", "application/yaml")
 		w.WriteHeader(http.StatusOK)
 		if _, err := w.Write(result.Data()); err != nil {
-			log.Printf("Error writing response: %v", err)
+			logger.Errorf("Error writing response: %v", err)
 		}
-	})
+	}))))
+
+	// Let template repositories check their templates in CI
+	mux.HandleFunc("/lint", cors(limiter.limit(requireAuth(lintHandler(resolver)))))
+
+	// Let developers try template snippets without a repository
+	mux.HandleFunc("/render", cors(limiter.limit(requireAuth(renderHandler(resolver)))))
+
+	// Describe the API for clients generating bindings
+	mux.HandleFunc("/openapi.json", openAPIHandler)
+	mux.HandleFunc("/docs", apiDocsHandler)
+
+	// Allow template authors to force a refresh after pushing changes
+	mux.HandleFunc("/cache/invalidate", requireAuth(cacheInvalidateHandler(resolver)))
+	mux.HandleFunc("/watch/push", watchPushHandler(resolver))
+
+	// Expose the cache metrics to Prometheus
+	registerMetrics(mux)
+
+	// Profile the server when enabled
+	registerPprof(mux)
 
 	// Add a health check endpoint
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		if _, err := fmt.Fprintln(w, "OK"); err != nil {
-			log.Printf("Error writing health response: %v", err)
+			logger.Errorf("Error writing health response: %v", err)
 		}
 	})
 
 	// Add a readiness endpoint
-	http.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		if draining.Load() {
+			http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		if _, err := fmt.Fprintln(w, "Ready"); err != nil {
-			log.Printf("Error writing readiness response: %v", err)
+			logger.Errorf("Error writing readiness response: %v", err)
 		}
 	})
 
-	// Start the server
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), nil); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	return mux
+}
+
+// runAdminServer serves administrative endpoints next to the Knative controller, which
+// has no HTTP server of its own for them
+func runAdminServer(resolver *resolver, port int) {
+	logger.Infof("Starting admin server on port %d", port)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cache/invalidate", requireAuth(cacheInvalidateHandler(resolver)))
+	mux.HandleFunc("/watch/push", watchPushHandler(resolver))
+	registerMetrics(mux)
+	registerPprof(mux)
+
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", port), mux); err != nil {
+		logger.Errorf("Admin server failed: %v", err)
+	}
+}
+
+// cacheInvalidateHandler evicts the cached templates of a repository, or of one path in it.
+// Example request body: {"repository": "https://github.com/org/repo", "path": "pipelines/deploy.yaml"}
+func cacheInvalidateHandler(resolver *resolver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		var request cacheInvalidateRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize)).Decode(&request); err != nil {
+			writeRequestBodyError(w, err, "Failed to parse request: %v")
+			return
+		}
+		if request.Repository == "" {
+			writeAPIError(w, http.StatusBadRequest, "Invalid parameters: missing required parameter: %s", RepositoryParam)
+			return
+		}
+
+		evicted, err := resolver.invalidateTemplates(r.Context(), request.Repository, request.Path)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "Failed to invalidate cache: %v", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(cacheInvalidateResponse{Evicted: evicted}); err != nil {
+			logger.Errorf("Error writing response: %v", err)
+		}
 	}
 }
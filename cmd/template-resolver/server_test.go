@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheInvalidateHandler(t *testing.T) {
+	fetcher := &countingFetcher{}
+	r := &resolver{fetcher: fetcher, cache: newMemoryCache()}
+	ctx := context.Background()
+
+	for _, path := range []string{"a.yaml", "b.yaml"} {
+		_, err := r.fetchTemplate(ctx, "repo1", "", path, FetchOptions{})
+		require.NoError(t, err)
+	}
+	_, err := r.fetchTemplate(ctx, "repo2", "main", "a.yaml", FetchOptions{})
+	require.NoError(t, err)
+
+	handler := cacheInvalidateHandler(r)
+	invalidate := func(body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodPost, "/cache/invalidate", strings.NewReader(body)))
+		return recorder
+	}
+
+	// A single path
+	recorder := invalidate(`{"repository": "repo1", "path": "a.yaml"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"evicted": 1}`, recorder.Body.String())
+
+	// Everything else cached for the repository, but not other repositories
+	recorder = invalidate(`{"repository": "repo1"}`)
+	assert.JSONEq(t, `{"evicted": 1}`, recorder.Body.String())
+
+	_, err = r.fetchTemplate(ctx, "repo2", "main", "a.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, fetcher.calls)
+
+	_, err = r.fetchTemplate(ctx, "repo1", "", "a.yaml", FetchOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 4, fetcher.calls)
+
+	assert.Equal(t, http.StatusBadRequest, invalidate(`{"path": "a.yaml"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, invalidate(`not json`).Code)
+
+	recorder = httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, "/cache/invalidate", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestServeUntilDoneDrainsRequests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_, _ = io.WriteString(w, "rendered")
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	draining := &atomic.Bool{}
+	done := make(chan error, 1)
+	go func() {
+		done <- serveUntilDone(ctx, server, listener, draining, 5*time.Second)
+	}()
+
+	type response struct {
+		body string
+		err  error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- response{body: string(body), err: err}
+	}()
+
+	// Stop while the request is in flight, then let it finish
+	<-started
+	cancel()
+	require.Eventually(t, draining.Load, time.Second, 10*time.Millisecond)
+	close(release)
+
+	result := <-responses
+	require.NoError(t, result.err)
+	assert.Equal(t, "rendered", result.body)
+	assert.NoError(t, <-done)
+
+	_, err = net.Dial("tcp", listener.Addr().String())
+	assert.Error(t, err, "no connections are accepted after shutdown")
+}
+
+func TestServeUntilDoneTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serveUntilDone(ctx, server, listener, &atomic.Bool{}, 50*time.Millisecond)
+	}()
+	go func() {
+		if resp, err := http.Get("http://" + listener.Addr().String()); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+	cancel()
+	assert.ErrorContains(t, <-done, "failed to drain in-flight requests")
+}
+
+func TestStandaloneHandlerReadiness(t *testing.T) {
+	draining := &atomic.Bool{}
+	handler := standaloneHandler(&resolver{fetcher: &mockFetcher{}}, draining)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	draining.Store(true)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	// Liveness is not affected by draining
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestResolveRequestBodyLimit(t *testing.T) {
+	handler := standaloneHandler(&resolver{fetcher: &mockFetcher{}}, &atomic.Bool{})
+
+	body := `{"parameters": [{"name": "padding", "value": "` + strings.Repeat("x", maxRequestBodySize) + `"}]}`
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/resolve", strings.NewReader(body)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "Request body is over the limit of 10485760 bytes")
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/resolve", strings.NewReader("not json")))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
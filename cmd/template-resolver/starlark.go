@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"gopkg.in/yaml.v3"
+)
+
+// starlarkEntryPoint is the function of a Starlark template called with the params
+const starlarkEntryPoint = "main"
+
+// starlarkParams converts the request params to the dict passed to main: strings stay
+// strings, arrays become lists and objects become dicts
+func starlarkParams(params []pipelinev1.Param) (*starlark.Dict, error) {
+	values := engineParamValues(params)
+	dict := starlark.NewDict(len(values))
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		var value starlark.Value
+		switch typed := values[name].(type) {
+		case string:
+			value = starlark.String(typed)
+		case []string:
+			items := make([]starlark.Value, 0, len(typed))
+			for _, item := range typed {
+				items = append(items, starlark.String(item))
+			}
+			value = starlark.NewList(items)
+		case map[string]string:
+			object := starlark.NewDict(len(typed))
+			for k, v := range typed {
+				if err := object.SetKey(starlark.String(k), starlark.String(v)); err != nil {
+					return nil, err
+				}
+			}
+			value = object
+		}
+		if err := dict.SetKey(starlark.String(name), value); err != nil {
+			return nil, err
+		}
+	}
+	return dict, nil
+}
+
+// fromStarlark converts the value returned by a Starlark template to plain Go values that
+// can be encoded as YAML
+func fromStarlark(value starlark.Value) (interface{}, error) {
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		if i, ok := v.Int64(); ok {
+			return i, nil
+		}
+		return nil, fmt.Errorf("integer %s is too large", v)
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.String:
+		return string(v), nil
+	case *starlark.List, starlark.Tuple:
+		items := []interface{}{}
+		iter := starlark.Iterate(v)
+		defer iter.Done()
+		var item starlark.Value
+		for iter.Next(&item) {
+			converted, err := fromStarlark(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, converted)
+		}
+		return items, nil
+	case *starlark.Dict:
+		result := make(map[string]interface{}, v.Len())
+		for _, entry := range v.Items() {
+			key, ok := starlark.AsString(entry[0])
+			if !ok {
+				return nil, fmt.Errorf("dict keys must be strings, got %s", entry[0].Type())
+			}
+			converted, err := fromStarlark(entry[1])
+			if err != nil {
+				return nil, err
+			}
+			result[key] = converted
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("cannot convert Starlark %s to YAML", value.Type())
+	}
+}
+
+// renderStarlark executes a Starlark template and calls its main function with the params
+// dict. The returned structure, usually a dict describing a Pipeline, is encoded as YAML.
+// The json module is available for parsing params; load() is not supported because only
+// the template file itself is fetched.
+func renderStarlark(ctx context.Context, content string, params []pipelinev1.Param) (string, error) {
+	thread := &starlark.Thread{
+		Name: "template",
+		Print: func(_ *starlark.Thread, msg string) {
+			debugf("Starlark: %s", msg)
+		},
+	}
+
+	// Stop runaway loops when the request is cancelled or times out
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+
+	predeclared := starlark.StringDict{"json": starlarkjson.Module}
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, "template.star", content, predeclared)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute Starlark template: %w", err)
+	}
+
+	entryPoint, ok := globals[starlarkEntryPoint].(starlark.Callable)
+	if !ok {
+		names := make([]string, 0, len(globals))
+		for name := range globals {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("starlark template must define %s(params), found %v", starlarkEntryPoint, names)
+	}
+
+	dict, err := starlarkParams(params)
+	if err != nil {
+		return "", err
+	}
+	result, err := starlark.Call(thread, entryPoint, starlark.Tuple{dict}, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to call Starlark %s: %w", starlarkEntryPoint, err)
+	}
+
+	converted, err := fromStarlark(result)
+	if err != nil {
+		return "", err
+	}
+	rendered, err := yaml.Marshal(converted)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert Starlark result to YAML: %w", err)
+	}
+	return string(rendered), nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+const starlarkTestTemplate = `
+def task(name, env):
+    return {"name": name + "-" + env, "taskRef": {"name": name}}
+
+def main(params):
+    envs = params["environments"]
+    return {
+        "apiVersion": "tekton.dev/v1",
+        "kind": "Pipeline",
+        "metadata": {"name": params["app-name"], "labels": params["labels"]},
+        "spec": {
+            "tasks": [task("deploy", env) for env in envs],
+            "timeout": None,
+            "finally": (),
+        },
+    }
+`
+
+func TestRenderStarlark(t *testing.T) {
+	params := []pipelinev1.Param{
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		{Name: "environments", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{"dev", "prod"}}},
+		{Name: "labels", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeObject, ObjectVal: map[string]string{"team": "platform"}}},
+		{Name: GitCredentialsSecretParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "git-creds"}},
+	}
+
+	rendered, err := renderStarlark(context.Background(), starlarkTestTemplate, params)
+	require.NoError(t, err)
+	assert.Equal(t, `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+    labels:
+        team: platform
+    name: api
+spec:
+    finally: []
+    tasks:
+        - name: deploy-dev
+          taskRef:
+            name: deploy
+        - name: deploy-prod
+          taskRef:
+            name: deploy
+    timeout: null
+`, rendered)
+
+	// Options and credentials are not passed to the template
+	_, err = renderStarlark(context.Background(), `def main(params): return params["git-credentials-secret"]`, params)
+	assert.ErrorContains(t, err, "key \"git-credentials-secret\" not in dict")
+
+	// Params holding JSON can be decoded with the json module
+	rendered, err = renderStarlark(context.Background(), `def main(params): return json.decode(params["config"])`, []pipelinev1.Param{
+		{Name: "config", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: `{"replicas": 2}`}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "replicas: 2\n", rendered)
+}
+
+func TestRenderStarlarkErrors(t *testing.T) {
+	_, err := renderStarlark(context.Background(), "pipeline = {}\n", nil)
+	assert.ErrorContains(t, err, "must define main(params), found [pipeline]")
+
+	_, err = renderStarlark(context.Background(), "def main(params)\n", nil)
+	assert.ErrorContains(t, err, "failed to execute Starlark template")
+
+	_, err = renderStarlark(context.Background(), `load("lib.star", "task")`, nil)
+	assert.Error(t, err)
+
+	_, err = renderStarlark(context.Background(), "def main(params): return {1: 2}\n", nil)
+	assert.ErrorContains(t, err, "dict keys must be strings")
+
+	_, err = renderStarlark(context.Background(), "def main(params): return set([1])\n", nil)
+	assert.Error(t, err)
+
+	// Loops are stopped when the request times out
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = renderStarlark(ctx, `
+def main(params):
+    for i in range(1000000000):
+        pass
+`, nil)
+	assert.ErrorContains(t, err, "context deadline exceeded")
+}
+
+func TestResolverStarlarkTemplate(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:pipeline.star": `def main(params): return {"kind": "Pipeline", "metadata": {"name": params["app-name"]}}`,
+	}}}
+	resource, err := r.Resolve(context.Background(), []pipelinev1.Param{
+		{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+		{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "pipeline.star"}},
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "kind: Pipeline\nmetadata:\n    name: api\n", string(resource.Data()))
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// structuredParams names the params holding lists of Tekton tasks, steps, StepActions or
+// sidecars, which are parsed into objects and names. A nil set stands for the naming heuristic of earlier
+// releases, used when the request and the template declare no structured params.
+type structuredParams map[string]bool
+
+// structuredParamNameHints are the words that mark an array param as structured when
+// nothing is declared, such as extra-steps, debug-sidecars or finally
+var structuredParamNameHints = []string{"tasks", "steps", "stepactions", "step-actions", "sidecars", "finally"}
+
+// finallyTaskProblems reports the tasks of a param declared finally in the param schema
+// that set runAfter. Finally tasks run after every task of the DAG and Tekton rejects their
+// runAfter, so it is an error instead of being dropped. Items that are not YAML objects
+// are left to the parsing of structured params.
+func finallyTaskProblems(name string, value pipelinev1.ParamValue) []string {
+	var tasks []map[string]interface{}
+	if value.Type == pipelinev1.ParamTypeArray {
+		for _, item := range value.ArrayVal {
+			var task map[string]interface{}
+			if err := yaml.Unmarshal([]byte(item), &task); err == nil {
+				tasks = append(tasks, task)
+			}
+		}
+	} else if err := yaml.Unmarshal([]byte(value.StringVal), &tasks); err != nil {
+		return nil
+	}
+
+	var problems []string
+	for i, task := range tasks {
+		if _, ok := task["runAfter"]; !ok {
+			continue
+		}
+		taskName := structuredItemName(task)
+		if taskName == "" {
+			taskName = fmt.Sprint(i)
+		}
+		problems = append(problems, fmt.Sprintf("finally task %q of param %q sets runAfter, but finally tasks run after every task of the pipeline", taskName, name))
+	}
+	return problems
+}
+
+// marked reports whether a param is parsed as a structured list. Without declarations,
+// array params are parsed when their name contains one of structuredParamNameHints and
+// string params when their value contains name:.
+func (s structuredParams) marked(param pipelinev1.Param) bool {
+	if s != nil {
+		return s[param.Name]
+	}
+	if param.Value.Type == pipelinev1.ParamTypeArray {
+		name := strings.ToLower(param.Name)
+		return slices.ContainsFunc(structuredParamNameHints, func(hint string) bool {
+			return strings.Contains(name, hint)
+		})
+	}
+	return strings.Contains(param.Value.StringVal, "name:")
+}
+
+// declaredStructuredParams collects the params marked structured in the param schema of the
+// template and listed in the structured-params param, as an array or a comma-separated
+// string. It returns nil, keeping the naming heuristic, when nothing is declared and
+// TEMPLATE_PARAM_HEURISTICS is enabled.
+func declaredStructuredParams(schema *paramSchema, params []pipelinev1.Param) structuredParams {
+	var names []string
+	if schema != nil {
+		for _, spec := range schema.Params {
+			if spec.Structured || spec.Finally {
+				names = append(names, spec.Name)
+			}
+		}
+	}
+	for _, param := range params {
+		if param.Name != StructuredParamsParam {
+			continue
+		}
+		if param.Value.Type == pipelinev1.ParamTypeArray {
+			names = append(names, param.Value.ArrayVal...)
+		} else {
+			names = append(names, strings.Split(param.Value.StringVal, ",")...)
+		}
+	}
+
+	if len(names) == 0 && structuredParamHeuristics {
+		return nil
+	}
+	structured := structuredParams{}
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			structured[name] = true
+		}
+	}
+	return structured
+}
+
+// structuredItemKeys are the fields of which an item of a structured param needs one to be
+// kept: the name of a task, step or sidecar, the ref of a step using a StepAction, the image
+// of an unnamed step and the metadata of a StepAction resource
+var structuredItemKeys = []string{"name", "ref", "image", "metadata", "taskRef", "taskSpec"}
+
+// isStructuredItem reports whether an array item looks like a Tekton task, step, StepAction
+// or sidecar
+func isStructuredItem(item map[string]interface{}) bool {
+	return slices.ContainsFunc(structuredItemKeys, func(key string) bool {
+		_, ok := item[key]
+		return ok
+	})
+}
+
+// structuredItemName returns the name a task, step or sidecar is referenced by, or the
+// metadata name of a StepAction resource, which steps reference in their ref. Unnamed
+// steps return an empty name.
+func structuredItemName(item map[string]interface{}) string {
+	if name, ok := item["name"].(string); ok {
+		return name
+	}
+	if metadata, ok := item["metadata"].(map[string]interface{}); ok {
+		if name, ok := metadata["name"].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// addStructuredTemplateData adds a parsed structured list to the template data: the list
+// as YAML under camelName, or fallback when it cannot be marshaled, the objects under
+// camelName+"Objects", their names under camelName+"Names" and the last name under
+// camelName+"Name".
+func addStructuredTemplateData(templateData map[string]interface{}, camelName string, objects []map[string]interface{}, fallback string) {
+	// Create a YAML string for the template to use with fromYAML
+	if yamlBytes, err := yaml.Marshal(objects); err == nil {
+		debugf("Adding YAML string as %s", camelName)
+		templateData[camelName] = string(yamlBytes)
+	} else {
+		debugf("Failed to convert objects to YAML: %v", err)
+		templateData[camelName] = fallback
+	}
+
+	// Store the structured objects with a different key
+	structuredKey := camelName + "Objects"
+	debugf("Adding structured objects as %s", structuredKey)
+	templateData[structuredKey] = objects
+
+	// Extract names (for runAfter and step references)
+	var names []string
+	for _, object := range objects {
+		if name := structuredItemName(object); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) > 0 {
+		namesParam := camelName + "Names"
+		debugf("Adding names as %s: %v", namesParam, names)
+		templateData[namesParam] = names
+
+		// Add last name for convenience
+		lastNameParam := camelName + "Name"
+		debugf("Adding last name as %s: %s", lastNameParam, names[len(names)-1])
+		templateData[lastNameParam] = names[len(names)-1]
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestDeclaredStructuredParams(t *testing.T) {
+	schema := &paramSchema{Params: []paramSpec{
+		{Name: "build", Type: pipelinev1.ParamTypeArray, Structured: true},
+		{Name: "app-name", Type: pipelinev1.ParamTypeString},
+	}}
+
+	assert.Nil(t, declaredStructuredParams(nil, nil))
+	assert.Equal(t, structuredParams{"build": true}, declaredStructuredParams(schema, nil))
+	assert.Equal(t, structuredParams{"build": true, "checks": true, "extra": true}, declaredStructuredParams(schema, []pipelinev1.Param{
+		{Name: StructuredParamsParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "checks, extra,"}},
+	}))
+	assert.Equal(t, structuredParams{"checks": true}, declaredStructuredParams(nil, []pipelinev1.Param{
+		{Name: StructuredParamsParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{"checks"}}},
+	}))
+
+	original := structuredParamHeuristics
+	defer func() { structuredParamHeuristics = original }()
+	structuredParamHeuristics = false
+	assert.Equal(t, structuredParams{}, declaredStructuredParams(nil, nil))
+}
+
+func TestStructuredParamsMarked(t *testing.T) {
+	steps := pipelinev1.Param{Name: "validation-steps", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{`{"name": "lint"}`}}}
+	checks := pipelinev1.Param{Name: "checks", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{`{"name": "lint"}`}}}
+	label := pipelinev1.Param{Name: "label", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "name: value"}}
+
+	// Without declarations the param names and values decide
+	var heuristic structuredParams
+	assert.True(t, heuristic.marked(steps))
+	assert.False(t, heuristic.marked(checks))
+	assert.True(t, heuristic.marked(label))
+
+	declared := structuredParams{"checks": true}
+	assert.False(t, declared.marked(steps))
+	assert.True(t, declared.marked(checks))
+	assert.False(t, declared.marked(label))
+}
+
+func TestResolverStructuredParams(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:pipeline.yaml": `---
+params:
+  - name: checks
+    type: array
+    structured: true
+---
+metadata:
+  name: {{ .ChecksName }}-{{ len .ValidationSteps }}-{{ .Note }}
+`,
+	}}}
+	params := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+		{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "pipeline.yaml"}},
+		{Name: "checks", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{`{"name": "lint"}`, `{"name": "test"}`}}},
+		{Name: "validation-steps", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{`{"name": "a"}`, `{"name": "b"}`, `{"name": "c"}`}}},
+		{Name: "note", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "name:x"}},
+	}
+
+	// Only the declared param is parsed, the others are passed through as they are
+	resource, err := r.Resolve(context.Background(), params)
+	require.NoError(t, err)
+	assert.Equal(t, "metadata:\n  name: test-3-name:x\n", string(resource.Data()))
+
+	_, err = parseParamSchema([]byte("params:\n  - name: config\n    type: object\n    structured: true\n"))
+	assert.ErrorContains(t, err, `param "config" is an object and cannot be structured`)
+}
+
+func TestStructuredItems(t *testing.T) {
+	var heuristic structuredParams
+	for _, name := range []string{"extra-steps", "debug-sidecars", "step-actions", "stepActions", "post-tasks"} {
+		assert.True(t, heuristic.marked(pipelinev1.Param{Name: name, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray}}), name)
+	}
+
+	assert.True(t, isStructuredItem(map[string]interface{}{"image": "alpine"}))
+	assert.True(t, isStructuredItem(map[string]interface{}{"ref": map[string]interface{}{"name": "git-clone"}}))
+	assert.False(t, isStructuredItem(map[string]interface{}{"value": "x"}))
+
+	assert.Equal(t, "lint", structuredItemName(map[string]interface{}{"name": "lint"}))
+	assert.Equal(t, "git-clone", structuredItemName(map[string]interface{}{
+		"apiVersion": "tekton.dev/v1beta1", "kind": "StepAction", "metadata": map[string]interface{}{"name": "git-clone"},
+	}))
+	assert.Empty(t, structuredItemName(map[string]interface{}{"image": "alpine"}))
+}
+
+func TestResolverStructuredTaskParams(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:task.yaml": `apiVersion: tekton.dev/v1
+kind: Task
+metadata:
+  name: build
+spec:
+  steps:
+    - name: build
+      image: golang
+{{ .ExtraSteps | indent 4 }}
+  sidecars:
+{{ .DebugSidecars | indent 4 }}
+  description: {{ index .ExtraStepsNames 0 }} {{ len .ExtraStepsObjects }} {{ .DebugSidecarsName }}
+`,
+	}}}
+	params := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("repo1")},
+		{Name: PathParam, Value: *pipelinev1.NewStructuredValues("task.yaml")},
+		{Name: "extra-steps", Value: *pipelinev1.NewStructuredValues(
+			"name: scan\nref:\n  name: trivy-scan\n",
+			"image: alpine\nscript: echo done\n",
+		)},
+		{Name: "debug-sidecars", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{`{"name": "docker", "image": "docker:dind"}`}}},
+	}
+
+	// Unnamed steps are kept, and only named ones are listed in the names
+	resource, err := r.Resolve(context.Background(), params)
+	require.NoError(t, err)
+	data := string(resource.Data())
+	assert.Contains(t, data, "description: scan 2 docker")
+	assert.Contains(t, data, "name: trivy-scan")
+	assert.Contains(t, data, "script: echo done")
+	assert.Contains(t, data, "image: docker:dind")
+}
+
+func TestFinallyStructuredParams(t *testing.T) {
+	schema := &paramSchema{Params: []paramSpec{{Name: "notify", Type: pipelinev1.ParamTypeArray, Finally: true}}}
+	assert.Equal(t, structuredParams{"notify": true}, declaredStructuredParams(schema, nil))
+
+	_, err := applyParamSchema(schema, []pipelinev1.Param{
+		{Name: "notify", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{`{"name": "slack"}`, `{"name": "cleanup"}`}}},
+	})
+	require.NoError(t, err)
+
+	// Finally tasks run after the whole DAG, a runAfter on them fails the request
+	_, err = applyParamSchema(schema, []pipelinev1.Param{
+		{Name: "notify", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{
+			`{"name": "slack", "runAfter": ["deploy"], "taskRef": {"name": "slack"}}`,
+			`{"name": "cleanup"}`,
+		}}},
+	})
+	assert.EqualError(t, err, `params do not match the template schema: finally task "slack" of param "notify" sets runAfter, but finally tasks run after every task of the pipeline`)
+
+	schema.Params[0].Type = pipelinev1.ParamTypeString
+	_, err = applyParamSchema(schema, []pipelinev1.Param{
+		{Name: "notify", Value: *pipelinev1.NewStructuredValues("- runAfter: [deploy]\n  taskRef:\n    name: slack\n")},
+	})
+	assert.ErrorContains(t, err, `finally task "0" of param "notify" sets runAfter`)
+
+	// Params are not finally params because of their name
+	templateData := map[string]interface{}{}
+	addParamTemplateData(templateData, []pipelinev1.Param{
+		{Name: "finally-steps", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{
+			`{"name": "notify", "runAfter": ["deploy"], "taskRef": {"name": "slack"}}`,
+		}}},
+	}, nil)
+	assert.Equal(t, []map[string]interface{}{
+		{"name": "notify", "runAfter": []interface{}{"deploy"}, "taskRef": map[string]interface{}{"name": "slack"}},
+	}, templateData["FinallyStepsObjects"])
+}
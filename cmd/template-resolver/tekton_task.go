@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"gopkg.in/yaml.v3"
+	"knative.dev/pkg/apis"
+	kjson "sigs.k8s.io/json"
+)
+
+// pipelineTaskFields are the fields of a Tekton pipeline task in the order Tekton declares
+// them, the order toTektonTask renders them in
+var pipelineTaskFields = jsonFieldNames(reflect.TypeOf(pipelinev1.PipelineTask{}))
+
+// jsonFieldNames returns the JSON names of the fields of a struct type, in declaration order
+func jsonFieldNames(structType reflect.Type) []string {
+	names := make([]string, 0, structType.NumField())
+	for i := 0; i < structType.NumField(); i++ {
+		name, _, _ := strings.Cut(structType.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// toTektonTask renders pipeline tasks as the items of a YAML sequence, ready to be indented
+// under the tasks or finally of a Pipeline: a task from the Objects of a structured param,
+// fromYAML or dict, a list of them, or a YAML string holding either. Every task is checked
+// against Tekton's PipelineTask type, so unknown fields such as a misspelled taskRef and
+// invalid tasks fail the render with the task and field at fault instead of producing a
+// Pipeline Tekton rejects. Fields are rendered in Tekton's order, nested fields with name
+// first and the others sorted, and multi-line strings such as scripts as block scalars.
+func toTektonTask(ctx context.Context, value interface{}) (string, error) {
+	if text, ok := value.(string); ok {
+		var parsed interface{}
+		if err := yaml.Unmarshal([]byte(text), &parsed); err != nil {
+			return "", fmt.Errorf("toTektonTask: %w", err)
+		}
+		value = parsed
+	}
+	var tasks []map[string]interface{}
+	if isMap(value) {
+		task, err := toStringMap(value)
+		if err != nil {
+			return "", err
+		}
+		tasks = append(tasks, task)
+	} else {
+		listed, err := taskList(value)
+		if err != nil {
+			return "", fmt.Errorf("toTektonTask: %w", err)
+		}
+		tasks = listed
+	}
+
+	sequence := &yaml.Node{Kind: yaml.SequenceNode}
+	for i, task := range tasks {
+		if err := validatePipelineTask(ctx, task); err != nil {
+			name := structuredItemName(task)
+			if name == "" {
+				name = fmt.Sprintf("%d", i)
+			}
+			return "", fmt.Errorf("toTektonTask: pipeline task %q: %w", name, err)
+		}
+		node, err := orderedYAMLNode(task, pipelineTaskFields)
+		if err != nil {
+			return "", err
+		}
+		sequence.Content = append(sequence.Content, node)
+	}
+	if len(sequence.Content) == 0 {
+		return "", nil
+	}
+
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(sequence); err != nil {
+		return "", fmt.Errorf("toTektonTask: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("toTektonTask: %w", err)
+	}
+	return strings.TrimRight(buffer.String(), "\n"), nil
+}
+
+// validatePipelineTask decodes a task into Tekton's PipelineTask type the way the Kubernetes
+// API server does, rejecting unknown fields and fields in the wrong case, and runs the
+// defaulting and validation Tekton runs on each task of a Pipeline. The task is checked on
+// its own, so $(params.x) and $(tasks.x.results.y) references pass, and are checked by
+// Tekton against the Pipeline the task is rendered into.
+func validatePipelineTask(ctx context.Context, task map[string]interface{}) error {
+	encoded, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	var pipelineTask pipelinev1.PipelineTask
+	strictErrors, err := kjson.UnmarshalStrict(encoded, &pipelineTask, kjson.DisallowUnknownFields)
+	if err != nil {
+		return err
+	}
+	if len(strictErrors) > 0 {
+		return errors.Join(strictErrors...)
+	}
+	pipelineTask.SetDefaults(ctx)
+	if errs := pipelineTask.Validate(ctx).Filter(apis.ErrorLevel); errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// orderedYAMLNode converts a decoded YAML value to a node whose mapping keys are in a stable
+// order: the keys listed in order first, then name, then the others sorted
+func orderedYAMLNode(value interface{}, order []string) (*yaml.Node, error) {
+	switch typed := value.(type) {
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range typed {
+			child, err := orderedYAMLNode(item, nil)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case []map[string]interface{}:
+		items := make([]interface{}, 0, len(typed))
+		for _, item := range typed {
+			items = append(items, item)
+		}
+		return orderedYAMLNode(items, order)
+	}
+	if !isMap(value) {
+		node := &yaml.Node{}
+		if err := node.Encode(value); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+
+	m, err := toStringMap(value)
+	if err != nil {
+		return nil, err
+	}
+	rank := func(key string) int {
+		for i, ordered := range order {
+			if key == ordered {
+				return i
+			}
+		}
+		if key == "name" {
+			return len(order)
+		}
+		return len(order) + 1
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if rank(keys[i]) != rank(keys[j]) {
+			return rank(keys[i]) < rank(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, key := range keys {
+		child, err := orderedYAMLNode(m[key], nil)
+		if err != nil {
+			return nil, err
+		}
+		// Keys are tagged as strings, so keys such as "true" or "1" are quoted
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+	}
+	return node, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToTektonTask(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    interface{}
+		expected string
+		err      string
+	}{
+		{
+			name:     "empty list",
+			input:    "[]",
+			expected: "",
+		},
+		{
+			name: "fields in Tekton's order",
+			input: map[string]interface{}{
+				"params":   []interface{}{map[string]interface{}{"value": "main", "name": "revision"}},
+				"runAfter": []interface{}{"clone"},
+				"taskRef":  map[string]interface{}{"name": "build"},
+				"name":     "build",
+			},
+			expected: `- name: build
+  taskRef:
+    name: build
+  runAfter:
+    - clone
+  params:
+    - name: revision
+      value: main`,
+		},
+		{
+			name: "list of tasks with a script",
+			input: `- taskSpec:
+    steps:
+    - script: |
+        echo one
+        echo two
+      image: alpine
+      name: echo
+  name: echo
+- name: test
+  taskRef: {name: go-test}`,
+			expected: `- name: echo
+  taskSpec:
+    steps:
+      - name: echo
+        image: alpine
+        script: |
+          echo one
+          echo two
+- name: test
+  taskRef:
+    name: go-test`,
+		},
+		{
+			name: "param and result references",
+			input: `- name: deploy
+  runAfter: [build]
+  when:
+    - input: $(params.environment)
+      operator: in
+      values: [prod]
+  params:
+    - name: image
+      value: $(tasks.build.results.image)
+    - name: args
+      value: ["$(params.args[*])"]
+  taskRef:
+    name: deploy`,
+			expected: `- name: deploy
+  taskRef:
+    name: deploy
+  when:
+    - input: $(params.environment)
+      operator: in
+      values:
+        - prod
+  runAfter:
+    - build
+  params:
+    - name: image
+      value: $(tasks.build.results.image)
+    - name: args
+      value:
+        - $(params.args[*])`,
+		},
+		{
+			name: "keys that are not strings in YAML",
+			input: map[string]interface{}{
+				"name": "build",
+				"taskSpec": map[string]interface{}{
+					"metadata": map[string]interface{}{"labels": map[string]interface{}{"true": "yes", "1": "one", "null": "none"}},
+					"steps":    []interface{}{map[string]interface{}{"name": "build", "image": "golang"}},
+				},
+			},
+			expected: `- name: build
+  taskSpec:
+    metadata:
+      labels:
+        "1": one
+        "null": none
+        "true": "yes"
+    steps:
+      - name: build
+        image: golang`,
+		},
+		{
+			name:  "unknown field",
+			input: map[string]interface{}{"name": "build", "taskref": map[string]interface{}{"name": "build"}},
+			err:   `toTektonTask: pipeline task "build": unknown field "taskref"`,
+		},
+		{
+			name:  "invalid task",
+			input: map[string]interface{}{"name": "build"},
+			err:   `toTektonTask: pipeline task "build": expected exactly one, got neither: taskRef, taskSpec`,
+		},
+		{
+			name:  "invalid YAML",
+			input: "invalid: yaml: missing quote",
+			err:   "toTektonTask: yaml: mapping values are not allowed in this context",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := toTektonTask(context.Background(), tt.input)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestToTektonTaskTemplate(t *testing.T) {
+	template := `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: build
+spec:
+  tasks:
+{{ toTektonTask .ExtraTasks.Objects | indent 4 }}
+`
+	result, err := renderTemplate(template, map[string]interface{}{
+		"ExtraTasks": map[string]interface{}{"Objects": []map[string]interface{}{
+			{"taskRef": map[string]interface{}{"name": "golangci-lint"}, "name": "lint"},
+		}},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, result, "  tasks:\n    - name: lint\n      taskRef:\n        name: golangci-lint\n")
+}
@@ -2,94 +2,96 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"sort"
 	"strings"
 	"text/template"
+	"time"
 
+	"github.com/google/uuid"
 	"gopkg.in/yaml.v3"
 )
 
-// formatTasksYAML processes the input YAML string to ensure it works correctly in a Pipeline
-func formatTasksYAML(yamlContent string) (string, error) {
-	debugf("formatTasksYAML input:\n%s", yamlContent)
+// renderOptions connect template rendering to the request being resolved
+type renderOptions struct {
+	// loadPartial fetches partial files, partials are not supported when nil
+	loadPartial partialLoader
 
-	if yamlContent == "" {
-		debugf("Empty YAML content provided\n")
-		return "", nil
-	}
-
-	// Parse YAML to get tasks
-	var tasks []map[string]interface{}
-	err := yaml.Unmarshal([]byte(yamlContent), &tasks)
-	if err != nil {
-		debugf("YAML Unmarshal error: %v", err)
-		return "", err
-	}
-
-	// If no tasks, return empty string
-	if len(tasks) == 0 {
-		debugf("No tasks found in YAML\n")
-		return "", nil
-	}
+	// lookup reads ConfigMaps and Secrets, the lookup function fails when nil
+	lookup lookupFunc
 
-	debugf("Found %d tasks", len(tasks))
+	// readFile reads other files of the repository, the readFile function fails when nil
+	readFile fileReader
 
-	// Create a new Pipeline tasks section
-	var result strings.Builder
+	// helm adds the Sprig and Helm functions for templates taken from Helm charts
+	helm bool
 
-	// Process each task
-	for i, task := range tasks {
-		debugf("Processing task %d: %v", i, task)
-
-		taskBytes, err := yaml.Marshal(task)
-		if err != nil {
-			debugf("YAML Marshal error for task %d: %v", i, err)
-			return "", err
-		}
-
-		// Convert to string and add to result
-		taskStr := string(taskBytes)
-		debugf("Raw task %d YAML:\n%s", i, taskStr)
-
-		if !strings.HasPrefix(taskStr, "- ") {
-			taskStr = "- " + strings.TrimPrefix(taskStr, "---\n")
-			debugf("Fixed task %d prefix", i)
-		}
+	// values are added to .Values underneath the values param, such as the default values
+	// file of the template and the data of the values-from-configmap ConfigMap
+	values map[string]interface{}
 
-		// Properly indent each line of the task YAML
-		lines := strings.Split(taskStr, "\n")
-		var indentedTask strings.Builder
+	// coerceTypes converts string params holding booleans and numbers to typed values
+	coerceTypes bool
 
-		// Add the first line with 4 spaces indent
-		if len(lines) > 0 {
-			// skipping this. I think these are pre-indented?
-			indentedTask.WriteString("    " + lines[0] + "\n")
+	// strictYAML fails rendering when the result is not valid YAML, instead of returning it
+	strictYAML bool
 
-			// Indent all remaining lines with 6 spaces (4 base + 2 for YAML hierarchy)
-			for _, line := range lines[1:] {
-				if line != "" {
-					indentedTask.WriteString("      " + line + "\n")
-				}
-			}
-		}
+	// structured names the params parsed as Tekton task lists, detected by name when nil
+	structured structuredParams
 
-		// Add the properly indented task to the result
-		result.WriteString(indentedTask.String())
-		debugf("Added indented task %d", i)
-	}
+	// templates holds the rendered templates the template is built from, as .Templates
+	templates map[string]interface{}
 
-	resultStr := result.String()
-	debugf("formatTasksYAML result:\n%s", resultStr)
-	return resultStr, nil
+	// overlays are the templates extending the rendered one, from its base down to the
+	// requested template, whose templates replace the blocks of the same name
+	overlays []templateOverlay
 }
 
 // renderTemplate applies Go template processing to the template content
 func renderTemplate(templateContent string, data map[string]interface{}) (string, error) {
+	return renderTemplateWithOptions(context.Background(), templateContent, data, renderOptions{})
+}
+
+// renderTemplateWithOptions applies Go template processing to the template content, with
+// partials and lookups provided by opts. Rendering is cancelled with ctx or after
+// RENDER_TIMEOUT.
+func renderTemplateWithOptions(ctx context.Context, templateContent string, data map[string]interface{}, opts renderOptions) (string, error) {
+	var tmpl *template.Template
+	guard := &renderGuard{ctx: ctx}
+
 	// Create a template with custom functions
 	funcMap := template.FuncMap{
-		"toJson": func(v interface{}) string {
+		"include": includeFunc(&tmpl, guard),
+		"tpl": func(text string, data interface{}) (string, error) {
+			// Render a string, e.g. a param value, as a template with the given data.
+			// It can use the functions and templates available to the main template.
+			if err := guard.enter(); err != nil {
+				return "", err
+			}
+			defer guard.leave()
+			t, err := tmpl.Clone()
+			if err != nil {
+				return "", err
+			}
+			if _, err := t.New("tpl").Parse(text); err != nil {
+				return "", fmt.Errorf("failed to parse tpl text: %w", err)
+			}
+			guard.guardRanges(t)
+			var buf bytes.Buffer
+			if err := t.ExecuteTemplate(&buf, "tpl", data); err != nil {
+				return "", err
+			}
+			return buf.String(), nil
+		},
+		"toJson":       toJSON,
+		"toPrettyJson": toPrettyJSON,
+		"fromJSON":     fromJSON,
+		"toToml":       toTOML,
+		"toJsonYAML": func(v interface{}) string {
+			// YAML rendered through JSON, the behavior of toJson before it returned JSON
 			// Skip null values
 			if v == nil {
 				return ""
@@ -117,7 +119,13 @@ func renderTemplate(templateContent string, data map[string]interface{}) (string
 			yamlStr = strings.TrimPrefix(yamlStr, "---\n")
 			return strings.TrimSpace(yamlStr)
 		},
-		"fromYAML": func(yamlStr string) interface{} {
+		"fromYAML": func(value interface{}) interface{} {
+			// Fields of object params may already have been parsed
+			yamlStr, ok := value.(string)
+			if !ok {
+				return value
+			}
+
 			// Handle empty strings
 			if strings.TrimSpace(yamlStr) == "" {
 				return nil
@@ -127,16 +135,68 @@ func renderTemplate(templateContent string, data map[string]interface{}) (string
 			var result interface{}
 			err := yaml.Unmarshal([]byte(yamlStr), &result)
 			if err != nil {
-				debugf("Error parsing YAML with fromYAML function: %v", err)
+				debugContextf(ctx, "Error parsing YAML with fromYAML function: %v", err)
 				// Return a map with error information
 				return map[string]string{
 					"error": fmt.Sprintf("Error parsing YAML: %v", err),
 				}
 			}
 
-			debugf("Successfully parsed YAML with fromYAML function: %v", result)
+			debugContextf(ctx, "Successfully parsed YAML with fromYAML function: %v", result)
 			return result
 		},
+		"merge": func(dst interface{}, srcs ...interface{}) (map[string]interface{}, error) {
+			// Deep-merge maps, keeping the values already in dst
+			return mergeMaps(false, dst, srcs...)
+		},
+		"mergeOverwrite": func(dst interface{}, srcs ...interface{}) (map[string]interface{}, error) {
+			// Deep-merge maps, later values overwrite earlier ones
+			return mergeMaps(true, dst, srcs...)
+		},
+		"regexMatch":       regexMatch,
+		"regexFind":        regexFind,
+		"regexReplaceAll":  regexReplaceAll,
+		"regexSplit":       regexSplit,
+		"sha1sum":          sha1sum,
+		"sha256sum":        sha256sum,
+		"adler32sum":       adler32sum,
+		"now":              time.Now,
+		"date":             formatDate,
+		"dateInZone":       formatDateInZone,
+		"duration":         formatDuration,
+		"env":              templateEnv,
+		"trimTrailing":     trimTrailing,
+		"squashBlankLines": squashBlankLines,
+		"ternary":          ternary,
+		"dict":             dict,
+		"set":              setKey,
+		"unset":            unsetKey,
+		"keys":             mapKeys,
+		"values":           mapValues,
+		"leafTasks":        leafTasks,
+		"runAfter":         runAfterTasks,
+
+		// Matrix blocks fanning pipeline tasks out across the values of array params
+		"matrix":             matrix,
+		"matrixCombinations": matrixCombinations,
+		"matrixExclude":      matrixExclude,
+		"matrixInclude":      matrixInclude,
+		"uuidv4": func() string {
+			// Random UUID for unique task or workspace names
+			return uuid.NewString()
+		},
+		"readFile": readFileFunc(opts.readFile),
+		"lookup": func(kind, name string) (map[string]interface{}, error) {
+			// Read an allowlisted ConfigMap or Secret from the request namespace
+			if opts.lookup == nil {
+				return nil, fmt.Errorf("lookup is not available")
+			}
+			return opts.lookup(kind, name)
+		},
+		"toTektonTask": func(value interface{}) (string, error) {
+			// Validate pipeline tasks against Tekton's schema and render them in its order
+			return toTektonTask(ctx, value)
+		},
 		"trimLeading": func(v string) string {
 			return strings.TrimLeft(v, " \t")
 		},
@@ -207,7 +267,7 @@ func renderTemplate(templateContent string, data map[string]interface{}) (string
 			// Marshal the object to YAML
 			yamlBytes, err := yaml.Marshal(obj)
 			if err != nil {
-				debugf("Error converting object to YAML with toYAML function: %v", err)
+				debugContextf(ctx, "Error converting object to YAML with toYAML function: %v", err)
 				return fmt.Sprintf("Error: %v", err)
 			}
 
@@ -250,44 +310,80 @@ func renderTemplate(templateContent string, data map[string]interface{}) (string
 			yamlStr = strings.Join(lines, "\n")
 			yamlStr = strings.TrimSpace(yamlStr)
 
-			debugf("toYAML function result after indentation fix: %s", yamlStr)
+			debugContextf(ctx, "toYAML function result after indentation fix: %s", yamlStr)
 			return yamlStr
 		},
 	}
+	if opts.helm {
+		funcMap = helmFuncMap(funcMap)
+	}
+	if restrictedTemplates {
+		restrictFuncs(funcMap)
+	}
 
-	debugf("Template content before parsing:\n%s", templateContent)
-	debugf("Template data: %v", data)
+	debugContextf(ctx, "Template content before parsing:\n%s", templateContent)
+	debugContextf(ctx, "Template data: %v", data)
 
+	// The content of each template file, to quote the offending line of errors
+	sources := map[string]string{"pipeline": templateContent}
 	tmpl, err := template.New("pipeline").Funcs(funcMap).Parse(templateContent)
 	if err != nil {
-		debugf("Template parsing error: %v", err)
-		return "", err
+		debugContextf(ctx, "Template parsing error: %v", err)
+		return "", newTemplateError(err, sources)
+	}
+	references := templateContent
+	for _, overlay := range opts.overlays {
+		sources[overlay.name] = overlay.content
+		if _, err := tmpl.New(overlay.name).Parse(overlay.content); err != nil {
+			debugContextf(ctx, "Template parsing error: %v", err)
+			return "", newTemplateError(err, sources)
+		}
+		references += "\n" + overlay.content
+	}
+	if opts.loadPartial != nil {
+		if err := loadPartials(tmpl, references, opts.loadPartial, sources); err != nil {
+			return "", newTemplateError(err, sources)
+		}
 	}
 
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		debugf("Template execution error: %v", err)
-		return "", err
+	result, err := executeTemplate(ctx, guard, tmpl, data)
+	if err != nil {
+		debugContextf(ctx, "Template execution error: %v", err)
+		return "", newTemplateError(err, sources)
 	}
 
-	result := buf.String()
-	debugf("Rendered template:\n%s", result)
-
-	// Validate the resulting YAML
-	var obj interface{}
-	if err := yaml.Unmarshal([]byte(result), &obj); err != nil {
-		debugf("Generated YAML is invalid: %v", err)
-		// Try to identify the problematic line
-		lines := strings.Split(result, "\n")
-		for i, line := range lines {
-			var testObj interface{}
-			if err := yaml.Unmarshal([]byte(line), &testObj); err != nil {
-				debugf("Potential YAML issue at line %d: %s", i+1, line)
+	if renderNormalizeWhitespace {
+		result = normalizeWhitespace(result)
+	}
+	debugContextf(ctx, "Rendered template:\n%s", result)
+
+	// Validate the resulting YAML. Unless it is strict, this only feeds the debug log, so
+	// large templates are not parsed again unless debugging.
+	if opts.strictYAML || currentSettings().debug {
+		if err := checkYAMLDocuments(result); err != nil {
+			err = newYAMLError(err, result)
+			if opts.strictYAML {
+				return "", fmt.Errorf("rendered template is not valid YAML: %w", err)
 			}
+			debugContextf(ctx, "Generated YAML is invalid: %v", err)
+		} else {
+			debugContextf(ctx, "Generated YAML is valid\n")
 		}
-	} else {
-		debugf("Generated YAML is valid\n")
 	}
 
 	return result, nil
 }
+
+// checkYAMLDocuments reports whether content is valid YAML. The documents are decoded one at a
+// time, so only a single document of a large multi-document template is held as a tree.
+func checkYAMLDocuments(content string) error {
+	decoder := yaml.NewDecoder(strings.NewReader(content))
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
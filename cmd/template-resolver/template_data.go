@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+// debugDataQuery is the value of the debug query param of /resolve returning the template
+// data instead of the rendered template
+const debugDataQuery = "data"
+
+// writeTemplateData resolves a template and responds with the data its Go template was
+// rendered with, for debugging templates that use the wrong keys. The data is returned when
+// rendering or validation failed as well, with the error. Values read from a Secret are
+// redacted. It is only served in debug mode, as the data can hold anything the params hold.
+func writeTemplateData(w http.ResponseWriter, r *http.Request, resolver *resolver, params []pipelinev1.Param) {
+	if !currentSettings().debug {
+		writeAPIError(w, http.StatusForbidden, "Template data is only returned in debug mode, set %s=true", EnvDebug)
+		return
+	}
+
+	ctx, capture := withRenderCapture(r.Context())
+	_, err := resolver.Resolve(ctx, params)
+	if capture.data == nil {
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "Failed to resolve template: %v", err)
+		} else {
+			writeAPIError(w, http.StatusUnprocessableEntity, "Only templates rendered with the %s engine have template data", EngineGoTemplate)
+		}
+		return
+	}
+
+	response := templateDataResponse{Data: redactTemplateData(capture.data, capture.sensitive).(map[string]interface{})}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Errorf("Error writing response: %v", err)
+	}
+}
+
+// redactTemplateData returns a copy of template data with the strings read from a Secret
+// replaced by [REDACTED]
+func redactTemplateData(value interface{}, sensitive []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			result[key] = redactTemplateData(nested, sensitive)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, nested := range v {
+			result[i] = redactTemplateData(nested, sensitive)
+		}
+		return result
+	case nil:
+		return nil
+	default:
+		// Secret values are strings, but YAML in them can be read as numbers and booleans
+		if slices.Contains(sensitive, fmt.Sprint(v)) {
+			return redactedValue
+		}
+		return value
+	}
+}
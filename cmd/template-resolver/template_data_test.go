@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"github.com/tektoncd/pipeline/pkg/resolution/common"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestResolveDebugData(t *testing.T) {
+	original := debugMode
+	defer func() { debugMode = original }()
+
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:pipeline.yaml": "metadata:\n  name: {{ .AppName }}-{{ .Values.region }}\n",
+		"repo1:broken.yaml":   "metadata:\n  name: {{ .AppName | missingFunction }}\n",
+		"repo1:invalid.yaml":  "apiVersion: tekton.dev/v1\nkind: Task\nmetadata:\n  name: {{ .AppName }}\nspec: {}\n",
+		"repo1:task.star":     `def main(params): return {"kind": "Task"}`,
+	}}}
+	handler := standaloneHandler(r, &atomic.Bool{})
+	resolve := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		body := `{"parameters": [{"name": "repository", "value": "repo1"}, {"name": "path", "value": "` + path + `"},
+			{"name": "app-name", "value": "api"}, {"name": "tasks", "value": ["build", "test"]}, {"name": "values", "value": "region: us-east-1"}]}`
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/resolve?debug=data", strings.NewReader(body)))
+		return recorder
+	}
+
+	debugMode = false
+	recorder := resolve("pipeline.yaml")
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "only returned in debug mode, set DEBUG=true")
+
+	debugMode = true
+	recorder = resolve("pipeline.yaml")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var response templateDataResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Empty(t, response.Error)
+	assert.Equal(t, "api", response.Data["AppName"])
+	assert.Equal(t, "repo1", response.Data["repository"])
+	assert.Equal(t, "us-east-1", response.Data["Values"].(map[string]interface{})["region"])
+	assert.Contains(t, response.Data, "Tasks")
+
+	// The data is what is needed most when the template fails
+	for _, path := range []string{"broken.yaml", "invalid.yaml"} {
+		recorder = resolve(path)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		response = templateDataResponse{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, "api", response.Data["AppName"])
+		assert.NotEmpty(t, response.Error, path)
+	}
+
+	assert.Equal(t, http.StatusUnprocessableEntity, resolve("task.star").Code)
+
+	r.fetcher = &notFoundFetcher{}
+	assert.Equal(t, http.StatusInternalServerError, resolve("pipeline.yaml").Code)
+}
+
+func TestWriteTemplateDataRedactsSecrets(t *testing.T) {
+	originalSecrets, originalDebug := templateLookupSecrets, debugMode
+	defer func() { templateLookupSecrets, debugMode = originalSecrets, originalDebug }()
+	templateLookupSecrets = []string{"pipeline-endpoints/*"}
+	debugMode = true
+
+	r := &resolver{
+		fetcher: &mockFetcher{templates: map[string]string{
+			"repo1:pipeline.yaml": "metadata:\n  name: {{ .AppName }}\n",
+		}},
+		kubeClient: fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "pipeline-endpoints", Namespace: "team-a"},
+			Data: map[string][]byte{
+				"registry": []byte("registry.internal.example.com"),
+				"port":     []byte("5000"),
+			},
+		}),
+	}
+	params := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+		{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "pipeline.yaml"}},
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		{Name: ValuesFromSecretParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "pipeline-endpoints"}},
+	}
+	ctx := common.InjectRequestNamespace(context.Background(), "team-a")
+
+	recorder := httptest.NewRecorder()
+	writeTemplateData(recorder, httptest.NewRequest(http.MethodPost, "/resolve?debug=data", nil).WithContext(ctx), r, params)
+	assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.NotContains(t, recorder.Body.String(), "internal.example.com")
+
+	var response templateDataResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	values := response.Data["Values"].(map[string]interface{})
+	assert.Equal(t, "[REDACTED]", values["registry"])
+	assert.Equal(t, "[REDACTED]", values["port"])
+	assert.Equal(t, "api", values["appName"])
+}
+
+func TestRedactTemplateData(t *testing.T) {
+	data := map[string]interface{}{
+		"Values": map[string]interface{}{"token": "s3cret", "port": 5000, "hosts": []interface{}{"s3cret", "public"}, "empty": nil},
+		"Name":   "public",
+	}
+	assert.Equal(t, map[string]interface{}{
+		"Values": map[string]interface{}{"token": "[REDACTED]", "port": "[REDACTED]", "hosts": []interface{}{"[REDACTED]", "public"}, "empty": nil},
+		"Name":   "public",
+	}, redactTemplateData(data, []string{"s3cret", "5000"}))
+	assert.Equal(t, "s3cret", data["Values"].(map[string]interface{})["token"])
+}
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1" // #nosec G505 -- used for content hashes in templates, not for security
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/adler32"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	// Embed the time zone database, the container image does not ship one for dateInZone
+	_ "time/tzdata"
+)
+
+// toStringMap converts the map types found in template data to map[string]interface{}:
+// maps from fromYAML and object params (map[string]string). Nested maps are converted
+// when they are merged. A nil value is treated as an empty map.
+func toStringMap(value interface{}) (map[string]interface{}, error) {
+	switch m := value.(type) {
+	case nil:
+		return map[string]interface{}{}, nil
+	case map[string]interface{}:
+		return m, nil
+	case map[string]string:
+		result := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			result[k] = v
+		}
+		return result, nil
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			result[fmt.Sprint(k)] = v
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("cannot use %T, expected a map", value)
+	}
+}
+
+// isMap reports whether a value is one of the map types toStringMap accepts
+func isMap(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}, map[string]string, map[interface{}]interface{}:
+		return true
+	}
+	return false
+}
+
+// mergeMaps deep-merges the src maps into dst, in order. Nested maps are merged key by key.
+// For other values dst wins unless overwrite is set, in which case the src value wins.
+// A map[string]interface{} dst is updated in place, like Helm's merge functions, and
+// the merged map is returned.
+func mergeMaps(overwrite bool, dst interface{}, srcs ...interface{}) (map[string]interface{}, error) {
+	result, err := toStringMap(dst)
+	if err != nil {
+		return nil, err
+	}
+	for _, src := range srcs {
+		srcMap, err := toStringMap(src)
+		if err != nil {
+			return nil, err
+		}
+		for key, srcValue := range srcMap {
+			dstValue, exists := result[key]
+			switch {
+			case !exists:
+				result[key] = srcValue
+			case isMap(dstValue) && isMap(srcValue):
+				merged, err := mergeMaps(overwrite, copyMap(dstValue), srcValue)
+				if err != nil {
+					return nil, err
+				}
+				result[key] = merged
+			case overwrite:
+				result[key] = srcValue
+			}
+		}
+	}
+	return result, nil
+}
+
+// copyMap returns a shallow copy of a map so nested maps shared with other values are not modified
+func copyMap(value interface{}) map[string]interface{} {
+	m, _ := toStringMap(value)
+	result := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+// marshalJSON encodes a value as JSON without escaping <, > and &, which are common in
+// shell scripts embedded in pipelines. A non-empty indent pretty-prints the result.
+func marshalJSON(value interface{}, indent string) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if indent != "" {
+		encoder.SetIndent("", indent)
+	}
+	if err := encoder.Encode(value); err != nil {
+		return "", fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// toJSON renders a value as compact JSON, e.g. for a param holding a JSON document
+func toJSON(value interface{}) (string, error) {
+	return marshalJSON(value, "")
+}
+
+// toPrettyJSON renders a value as JSON indented with two spaces
+func toPrettyJSON(value interface{}) (string, error) {
+	return marshalJSON(value, "  ")
+}
+
+// fromJSON parses a JSON document. An empty string returns an empty map, like fromYAML.
+func fromJSON(value interface{}) (interface{}, error) {
+	// Fields of object params may already have been parsed
+	s, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+	if strings.TrimSpace(s) == "" {
+		return map[string]interface{}{}, nil
+	}
+	var result interface{}
+	if err := json.Unmarshal([]byte(s), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return result, nil
+}
+
+// toTOML renders a map as a TOML document, e.g. for tool configuration files written by a step
+func toTOML(value interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(value); err != nil {
+		return "", fmt.Errorf("failed to encode TOML: %w", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// trimTrailing removes spaces and tabs at the end of every line
+func trimTrailing(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// squashBlankLines collapses runs of blank or whitespace-only lines into a single empty line
+func squashBlankLines(s string) string {
+	lines := strings.Split(s, "\n")
+	result := make([]string, 0, len(lines))
+	blank := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			if blank {
+				continue
+			}
+			blank = true
+			result = append(result, "")
+			continue
+		}
+		blank = false
+		result = append(result, line)
+	}
+	return strings.Join(result, "\n")
+}
+
+// normalizeWhitespace is the cleanup pass applied to rendered templates when
+// RENDER_NORMALIZE_WHITESPACE is set
+func normalizeWhitespace(s string) string {
+	return squashBlankLines(trimTrailing(s))
+}
+
+// ternary returns trueValue when condition is true and falseValue otherwise, in the same
+// argument order as Sprig so it can be piped: {{ .Debug | ternary "debug" "info" }}
+func ternary(trueValue, falseValue interface{}, condition bool) interface{} {
+	if condition {
+		return trueValue
+	}
+	return falseValue
+}
+
+// dict builds a map from alternating keys and values, e.g. {{ dict "name" .AppName "replicas" 2 }}
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("dict requires an even number of arguments, got %d", len(pairs))
+	}
+	result := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict keys must be strings, got %T", pairs[i])
+		}
+		result[key] = pairs[i+1]
+	}
+	return result, nil
+}
+
+// setKey sets a key in a map and returns the map. A map[string]interface{} is updated in
+// place, like Sprig's set, so {{ $_ := set $values "key" "value" }} works.
+func setKey(m interface{}, key string, value interface{}) (map[string]interface{}, error) {
+	result, err := toStringMap(m)
+	if err != nil {
+		return nil, err
+	}
+	result[key] = value
+	return result, nil
+}
+
+// unsetKey removes a key from a map and returns the map, updating a map[string]interface{} in place
+func unsetKey(m interface{}, key string) (map[string]interface{}, error) {
+	result, err := toStringMap(m)
+	if err != nil {
+		return nil, err
+	}
+	delete(result, key)
+	return result, nil
+}
+
+// mapKeys returns the keys of one or more maps, sorted and without duplicates so the
+// rendered output is the same on every run
+func mapKeys(maps ...interface{}) ([]string, error) {
+	seen := make(map[string]bool)
+	keys := []string{}
+	for _, m := range maps {
+		values, err := toStringMap(m)
+		if err != nil {
+			return nil, err
+		}
+		for key := range values {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// mapValues returns the values of a map ordered by their keys
+func mapValues(m interface{}) ([]interface{}, error) {
+	keys, err := mapKeys(m)
+	if err != nil {
+		return nil, err
+	}
+	values, _ := toStringMap(m)
+	result := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, values[key])
+	}
+	return result, nil
+}
+
+// The regular expression functions take their arguments in the same order as Sprig/Helm,
+// e.g. {{ regexReplaceAll "[^a-z0-9-]+" .Branch "-" }}
+
+// regexMatch reports whether s contains a match of the regular expression
+func regexMatch(regex, s string) (bool, error) {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s), nil
+}
+
+// regexFind returns the first match of the regular expression in s, or an empty string
+func regexFind(regex, s string) (string, error) {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return "", err
+	}
+	return re.FindString(s), nil
+}
+
+// regexReplaceAll replaces the matches of the regular expression in s. The replacement
+// can reference groups with $1 or ${name}.
+func regexReplaceAll(regex, s, replacement string) (string, error) {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return "", err
+	}
+	return re.ReplaceAllString(s, replacement), nil
+}
+
+// regexSplit splits s around the matches of the regular expression into at most n
+// substrings, all of them when n is negative
+func regexSplit(regex, s string, n int) ([]string, error) {
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return nil, err
+	}
+	return re.Split(s, n), nil
+}
+
+// sha1sum returns the hex SHA-1 digest of s, for deterministic names rather than security
+func sha1sum(s string) string {
+	sum := sha1.Sum([]byte(s)) // #nosec G401 -- not used for security
+	return hex.EncodeToString(sum[:])
+}
+
+// sha256sum returns the hex SHA-256 digest of s
+func sha256sum(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// adler32sum returns the Adler-32 checksum of s as a decimal string, like Sprig
+func adler32sum(s string) string {
+	return strconv.FormatUint(uint64(adler32.Checksum([]byte(s))), 10)
+}
+
+// toTime converts the values accepted by the date functions to a time: a time.Time from
+// now, or Unix seconds as an integer
+func toTime(value interface{}) (time.Time, error) {
+	switch t := value.(type) {
+	case time.Time:
+		return t, nil
+	case *time.Time:
+		return *t, nil
+	case int:
+		return time.Unix(int64(t), 0), nil
+	case int64:
+		return time.Unix(t, 0), nil
+	case int32:
+		return time.Unix(int64(t), 0), nil
+	default:
+		return time.Time{}, fmt.Errorf("cannot format %T as a date", value)
+	}
+}
+
+// formatDate formats a date with a Go layout such as "2006-01-02T15:04:05Z07:00" in the
+// local time zone of the resolver
+func formatDate(layout string, date interface{}) (string, error) {
+	return formatDateInZone(layout, date, "Local")
+}
+
+// formatDateInZone formats a date with a Go layout in the named IANA time zone, e.g. "UTC"
+func formatDateInZone(layout string, date interface{}, zone string) (string, error) {
+	t, err := toTime(date)
+	if err != nil {
+		return "", err
+	}
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return "", fmt.Errorf("invalid time zone %q: %w", zone, err)
+	}
+	return t.In(location).Format(layout), nil
+}
+
+// formatDuration formats a number of seconds, or a Go duration string, as a duration like "1h30m0s"
+func formatDuration(value interface{}) (string, error) {
+	switch d := value.(type) {
+	case int:
+		return (time.Duration(d) * time.Second).String(), nil
+	case int64:
+		return (time.Duration(d) * time.Second).String(), nil
+	case float64:
+		return time.Duration(d * float64(time.Second)).String(), nil
+	case string:
+		if seconds, err := strconv.ParseInt(d, 10, 64); err == nil {
+			return (time.Duration(seconds) * time.Second).String(), nil
+		}
+		duration, err := time.ParseDuration(d)
+		if err != nil {
+			return "", fmt.Errorf("invalid duration %q: %w", d, err)
+		}
+		return duration.String(), nil
+	default:
+		return "", fmt.Errorf("cannot convert %T to a duration", value)
+	}
+}
+
+// templateEnv returns the value of an environment variable listed in TEMPLATE_ENV_ALLOWLIST,
+// so operators decide which cluster-level settings templates can read
+func templateEnv(name string) (string, error) {
+	for _, allowed := range templateEnvAllowlist {
+		if allowed == name {
+			return os.Getenv(name), nil
+		}
+	}
+	return "", fmt.Errorf("environment variable %s is not in %s", name, EnvTemplateEnvAllow)
+}
+
+// taskResultReference matches a reference to the results of another task, which makes a
+// task run after that task like runAfter does
+var taskResultReference = regexp.MustCompile(`\$\(tasks\.([a-z0-9]([-a-z0-9]*[a-z0-9])?)\.results\.`)
+
+// taskList converts the lists of objects found in template data, such as task lists and
+// matrix combinations, to maps: the Objects of structured params, lists from fromYAML and
+// YAML strings such as structured params
+func taskList(value interface{}) ([]map[string]interface{}, error) {
+	switch typed := value.(type) {
+	case nil:
+		return nil, nil
+	case []map[string]interface{}:
+		return typed, nil
+	case string:
+		var tasks []map[string]interface{}
+		if err := yaml.Unmarshal([]byte(typed), &tasks); err != nil {
+			return nil, fmt.Errorf("failed to parse list: %w", err)
+		}
+		return tasks, nil
+	case []interface{}:
+		tasks := make([]map[string]interface{}, 0, len(typed))
+		for _, item := range typed {
+			task, err := toStringMap(item)
+			if err != nil {
+				return nil, err
+			}
+			tasks = append(tasks, task)
+		}
+		return tasks, nil
+	default:
+		return nil, fmt.Errorf("expected a list of objects, got %T", value)
+	}
+}
+
+// leafTasks returns the names of the tasks of one or more lists that no other task of the
+// lists runs after, through runAfter or a result reference: the last tasks of the DAG, which
+// a task appended to it has to run after
+func leafTasks(lists ...interface{}) ([]string, error) {
+	var tasks []map[string]interface{}
+	for _, list := range lists {
+		listed, err := taskList(list)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, listed...)
+	}
+
+	followed := map[string]bool{}
+	for _, task := range tasks {
+		if runAfter, ok := task["runAfter"].([]interface{}); ok {
+			for _, name := range runAfter {
+				followed[fmt.Sprint(name)] = true
+			}
+		}
+		encoded, err := json.Marshal(task)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range taskResultReference.FindAllStringSubmatch(string(encoded), -1) {
+			followed[match[1]] = true
+		}
+	}
+
+	leaves := []string{}
+	for _, task := range tasks {
+		if name := structuredItemName(task); name != "" && !followed[name] {
+			leaves = append(leaves, name)
+		}
+	}
+	return leaves, nil
+}
+
+// runAfterTasks renders the leafTasks of the lists as a flow sequence, for the runAfter of a
+// task appended to the DAG: runAfter: {{ runAfter .BuildTasksObjects .TestTasks }}
+func runAfterTasks(lists ...interface{}) (string, error) {
+	leaves, err := leafTasks(lists...)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := json.Marshal(leaves)
+	return string(encoded), err
+}
+
+// matrixValues converts the values of a matrix param to strings, which is all Tekton
+// accepts: array params, lists from fromYAML and YAML or JSON list strings
+func matrixValues(name string, value interface{}) ([]string, error) {
+	switch typed := value.(type) {
+	case []string:
+		return typed, nil
+	case []interface{}:
+		values := make([]string, 0, len(typed))
+		for _, item := range typed {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values, nil
+	case string:
+		var values []interface{}
+		if err := yaml.Unmarshal([]byte(typed), &values); err != nil {
+			return nil, fmt.Errorf("matrix param %q is not a list: %w", name, err)
+		}
+		return matrixValues(name, values)
+	default:
+		return nil, fmt.Errorf("matrix param %q must be a list, got %T", name, value)
+	}
+}
+
+// matrixPairs reads the alternating param names and value lists of the matrix functions
+func matrixPairs(function string, pairs []interface{}) ([]string, [][]string, error) {
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return nil, nil, fmt.Errorf("%s requires pairs of param names and values, got %d arguments", function, len(pairs))
+	}
+	names := make([]string, 0, len(pairs)/2)
+	values := make([][]string, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		name, ok := pairs[i].(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s param names must be strings, got %T", function, pairs[i])
+		}
+		list, err := matrixValues(name, pairs[i+1])
+		if err != nil {
+			return nil, nil, err
+		}
+		names = append(names, name)
+		values = append(values, list)
+	}
+	return names, values, nil
+}
+
+// matrix builds the matrix of a pipeline task fanning it out across every combination of
+// the values of its params, e.g. {{ matrix "platform" .Platforms "go-version" .GoVersions }}
+func matrix(pairs ...interface{}) (map[string]interface{}, error) {
+	names, values, err := matrixPairs("matrix", pairs)
+	if err != nil {
+		return nil, err
+	}
+	params := make([]interface{}, 0, len(names))
+	for i, name := range names {
+		params = append(params, map[string]interface{}{"name": name, "value": values[i]})
+	}
+	return map[string]interface{}{"params": params}, nil
+}
+
+// matrixCombinations returns every combination of the values of the params as maps of
+// param names to values, the first param varying slowest. Like the sequences of until and
+// seq, at most maxRangeIterations combinations are built, since building them cannot be
+// cancelled with the render.
+func matrixCombinations(pairs ...interface{}) ([]map[string]interface{}, error) {
+	names, values, err := matrixPairs("matrixCombinations", pairs)
+	if err != nil {
+		return nil, err
+	}
+	size := 1
+	for _, list := range values {
+		if size *= len(list); size > maxRangeIterations {
+			return nil, fmt.Errorf("matrixCombinations: combinations are over the limit of %d", maxRangeIterations)
+		}
+	}
+	combinations := []map[string]interface{}{{}}
+	for i, name := range names {
+		next := make([]map[string]interface{}, 0, len(combinations)*len(values[i]))
+		for _, combination := range combinations {
+			for _, value := range values[i] {
+				extended := copyMap(combination)
+				extended[name] = value
+				next = append(next, extended)
+			}
+		}
+		combinations = next
+	}
+	return combinations, nil
+}
+
+// matrixExclude drops the combinations matching any of the excluded maps, which match when
+// all of their keys have the values of the combination, like the exclude of a GitHub
+// Actions matrix: {{ matrixExclude $combinations (dict "platform" "windows") }}
+func matrixExclude(combinations interface{}, excluded ...interface{}) ([]map[string]interface{}, error) {
+	listed, err := taskList(combinations)
+	if err != nil {
+		return nil, err
+	}
+	exclusions := make([]map[string]interface{}, 0, len(excluded))
+	for _, exclusion := range excluded {
+		m, err := toStringMap(exclusion)
+		if err != nil {
+			return nil, err
+		}
+		exclusions = append(exclusions, m)
+	}
+
+	kept := []map[string]interface{}{}
+	for _, combination := range listed {
+		if !slices.ContainsFunc(exclusions, func(exclusion map[string]interface{}) bool {
+			for key, value := range exclusion {
+				if fmt.Sprint(combination[key]) != fmt.Sprint(value) {
+					return false
+				}
+			}
+			return true
+		}) {
+			kept = append(kept, combination)
+		}
+	}
+	return kept, nil
+}
+
+// matrixInclude builds a matrix running each combination once, as the include entries
+// Tekton runs on their own when a matrix has no params, for combinations a full matrix
+// cannot express, such as those left by matrixExclude. Params are listed in name order.
+func matrixInclude(combinations interface{}) (map[string]interface{}, error) {
+	listed, err := taskList(combinations)
+	if err != nil {
+		return nil, err
+	}
+	include := make([]interface{}, 0, len(listed))
+	for _, combination := range listed {
+		names, err := mapKeys(combination)
+		if err != nil {
+			return nil, err
+		}
+		params := make([]interface{}, 0, len(names))
+		for _, name := range names {
+			params = append(params, map[string]interface{}{"name": name, "value": fmt.Sprint(combination[name])})
+		}
+		include = append(include, map[string]interface{}{"params": params})
+	}
+	return map[string]interface{}{"include": include}, nil
+}
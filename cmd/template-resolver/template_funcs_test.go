@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeMaps(t *testing.T) {
+	defaults := func() map[string]interface{} {
+		return map[string]interface{}{
+			"replicas": 1,
+			"image":    map[string]interface{}{"repository": "registry/app", "tag": "latest"},
+			"labels":   map[string]interface{}{"team": "platform"},
+		}
+	}
+	overrides := map[string]interface{}{
+		"replicas": 3,
+		"image":    map[string]interface{}{"tag": "v1"},
+		"extra":    true,
+	}
+
+	merged, err := mergeMaps(false, defaults(), overrides)
+	require.NoError(t, err)
+	assert.Equal(t, 1, merged["replicas"])
+	assert.Equal(t, map[string]interface{}{"repository": "registry/app", "tag": "latest"}, merged["image"])
+	assert.Equal(t, true, merged["extra"])
+
+	merged, err = mergeMaps(true, defaults(), overrides)
+	require.NoError(t, err)
+	assert.Equal(t, 3, merged["replicas"])
+	assert.Equal(t, map[string]interface{}{"repository": "registry/app", "tag": "v1"}, merged["image"])
+	assert.Equal(t, map[string]interface{}{"team": "platform"}, merged["labels"])
+
+	// Object params and maps with non-string keys can be merged too
+	merged, err = mergeMaps(true, map[string]string{"a": "1"}, map[interface{}]interface{}{"b": "2"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": "1", "b": "2"}, merged)
+
+	_, err = mergeMaps(false, defaults(), []string{"not", "a", "map"})
+	assert.ErrorContains(t, err, "expected a map")
+}
+
+func TestMergeTemplateFunctions(t *testing.T) {
+	data := map[string]interface{}{
+		"Defaults":  "image:\n  repository: registry/app\n  tag: latest\nreplicas: 1\n",
+		"Overrides": map[string]string{"replicas": "3", "env": "prod"},
+	}
+
+	result, err := renderTemplate(`{{ $values := mergeOverwrite (fromYAML .Defaults) .Overrides }}replicas: {{ $values.replicas }}, tag: {{ $values.image.tag }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "replicas: 3, tag: latest", result)
+
+	// merge updates its first argument in place and keeps the values it already has
+	result, err = renderTemplate(`{{ $values := fromYAML .Defaults }}{{ $_ := merge $values .Overrides }}replicas: {{ $values.replicas }}, env: {{ $values.env }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "replicas: 1, env: prod", result)
+}
+
+func TestRegexTemplateFunctions(t *testing.T) {
+	data := map[string]interface{}{"Branch": "feature/JIRA-123_Add login"}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		wantErr  bool
+	}{
+		{name: "match", template: `{{ regexMatch "^feature/" .Branch }}`, expected: "true"},
+		{name: "no match", template: `{{ regexMatch "^release/" .Branch }}`, expected: "false"},
+		{name: "find", template: `{{ regexFind "[A-Z]+-[0-9]+" .Branch }}`, expected: "JIRA-123"},
+		{name: "find without match", template: `{{ regexFind "[0-9]{5}" .Branch }}`, expected: ""},
+		{name: "sanitize task name", template: `{{ regexReplaceAll "[^A-Za-z0-9-]+" .Branch "-" }}`, expected: "feature-JIRA-123-Add-login"},
+		{name: "replace with groups", template: `{{ regexReplaceAll "^(\\w+)/(.*)$" .Branch "$2 ($1)" }}`, expected: "JIRA-123_Add login (feature)"},
+		{name: "split", template: `{{ range regexSplit "[/_ ]" .Branch -1 }}[{{ . }}]{{ end }}`, expected: "[feature][JIRA-123][Add][login]"},
+		{name: "split limit", template: `{{ len (regexSplit "[/_ ]" .Branch 2) }}`, expected: "2"},
+		{name: "invalid regex", template: `{{ regexMatch "(" .Branch }}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := renderTemplate(tt.template, data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestHashTemplateFunctions(t *testing.T) {
+	result, err := renderTemplate(`{{ sha1sum "hello" }} {{ sha256sum "hello" }} {{ adler32sum "hello" }}`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d 2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824 103547413", result)
+
+	// Hashing structured params is deterministic, so names derived from them are stable
+	data := map[string]interface{}{"Config": map[string]string{"env": "prod", "region": "us-east-1"}}
+	first, err := renderTemplate(`deploy-{{ .Config | toString | sha256sum }}`, data)
+	require.NoError(t, err)
+	second, err := renderTemplate(`deploy-{{ .Config | toString | sha256sum }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+}
+
+func TestDateTemplateFunctions(t *testing.T) {
+	data := map[string]interface{}{"Timestamp": 1700000000}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		wantErr  bool
+	}{
+		{name: "date in zone", template: `{{ dateInZone "2006-01-02T15:04:05Z07:00" .Timestamp "UTC" }}`, expected: "2023-11-14T22:13:20Z"},
+		{name: "other zone", template: `{{ dateInZone "15:04 MST" .Timestamp "America/New_York" }}`, expected: "17:13 EST"},
+		{name: "duration from seconds", template: `{{ duration 5400 }}`, expected: "1h30m0s"},
+		{name: "duration from string", template: `{{ duration "95" }} {{ duration "1h" }}`, expected: "1m35s 1h0m0s"},
+		{name: "invalid zone", template: `{{ dateInZone "2006" .Timestamp "Mars/Olympus" }}`, wantErr: true},
+		{name: "invalid date", template: `{{ date "2006" "yesterday" }}`, wantErr: true},
+		{name: "invalid duration", template: `{{ duration "soon" }}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := renderTemplate(tt.template, data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+
+	// now can be formatted like any other date
+	result, err := renderTemplate(`{{ now | date "2006" }}`, nil)
+	require.NoError(t, err)
+	assert.Len(t, result, 4)
+}
+
+func TestUUIDTemplateFunction(t *testing.T) {
+	result, err := renderTemplate(`{{ uuidv4 }} {{ uuidv4 }}`, nil)
+	require.NoError(t, err)
+	ids := strings.Fields(result)
+	require.Len(t, ids, 2)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, ids[0])
+	assert.NotEqual(t, ids[0], ids[1])
+}
+
+func TestEnvTemplateFunction(t *testing.T) {
+	originalAllowlist := templateEnvAllowlist
+	defer func() { templateEnvAllowlist = originalAllowlist }()
+	templateEnvAllowlist = []string{"REGISTRY_HOST", "UNSET_VARIABLE"}
+	t.Setenv("REGISTRY_HOST", "registry.example.com")
+	t.Setenv("SECRET_TOKEN", "hunter2")
+
+	result, err := renderTemplate(`image: {{ env "REGISTRY_HOST" }}/app{{ env "UNSET_VARIABLE" }}`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "image: registry.example.com/app", result)
+
+	_, err = renderTemplate(`token: {{ env "SECRET_TOKEN" }}`, nil)
+	assert.ErrorContains(t, err, "SECRET_TOKEN is not in TEMPLATE_ENV_ALLOWLIST")
+}
+
+func TestDictTemplateFunctions(t *testing.T) {
+	data := map[string]interface{}{"Debug": true, "Labels": map[string]string{"team": "platform", "app": "api"}}
+
+	result, err := renderTemplate(`level: {{ .Debug | ternary "debug" "info" }}, cache: {{ ternary "on" "off" false }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "level: debug, cache: off", result)
+
+	// Maps built with dict can be changed with set and unset before rendering them
+	result, err = renderTemplate(`{{ $step := dict "name" "build" "image" "golang" "debug" true }}{{ $_ := set $step "image" "golang:1.24" }}{{ $_ := unset $step "debug" }}{{ toYAML $step }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "image: golang:1.24\nname: build", result)
+
+	result, err = renderTemplate(`{{ keys .Labels (dict "env" "prod" "app" "web") }} {{ values .Labels }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "[app env team] [api platform]", result)
+
+	_, err = renderTemplate(`{{ dict "name" }}`, data)
+	assert.ErrorContains(t, err, "even number of arguments")
+
+	_, err = renderTemplate(`{{ dict 1 "value" }}`, data)
+	assert.ErrorContains(t, err, "keys must be strings")
+
+	_, err = renderTemplate(`{{ set "not a map" "key" "value" }}`, data)
+	assert.ErrorContains(t, err, "expected a map")
+}
+
+func TestJSONAndTOMLTemplateFunctions(t *testing.T) {
+	data := map[string]interface{}{
+		"Config": `{"name": "build", "args": ["--race", "-v"], "script": "test -f a && echo <ok>"}`,
+		"Values": map[string]interface{}{"name": "app", "server": map[string]interface{}{"port": 8080}},
+	}
+
+	result, err := renderTemplate(`{{ $config := fromJSON .Config }}{{ $config.name }} {{ index $config.args 0 }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "build --race", result)
+
+	// toJson renders compact JSON without escaping shell operators
+	result, err = renderTemplate(`{{ fromJSON .Config | toJson }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, `{"args":["--race","-v"],"name":"build","script":"test -f a && echo <ok>"}`, result)
+
+	result, err = renderTemplate(`{{ toPrettyJson .Values }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "{\n  \"name\": \"app\",\n  \"server\": {\n    \"port\": 8080\n  }\n}", result)
+
+	result, err = renderTemplate(`{{ toToml .Values }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "name = \"app\"\n\n[server]\n  port = 8080", result)
+
+	// The previous toJson behavior is available as toJsonYAML
+	result, err = renderTemplate(`{{ toJsonYAML .Values }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "name: app\nserver:\n    port: 8080", result)
+
+	result, err = renderTemplate(`{{ fromJSON "" | toJson }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "{}", result)
+
+	_, err = renderTemplate(`{{ fromJSON "{not json" }}`, data)
+	assert.ErrorContains(t, err, "failed to parse JSON")
+}
+
+func TestWhitespaceTemplateFunctions(t *testing.T) {
+	assert.Equal(t, "a:\n  b: c\n\nd: e", trimTrailing("a:  \n  b: c\t\n \nd: e "))
+	assert.Equal(t, "a\n\nb\n\nc\n", squashBlankLines("a\n\n\n  \nb\n\nc\n"))
+
+	result, err := renderTemplate("{{ squashBlankLines \"steps:\\n\\n\\n- name: build\" }}", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "steps:\n\n- name: build", result)
+
+	original := renderNormalizeWhitespace
+	defer func() { renderNormalizeWhitespace = original }()
+
+	content := "tasks:  \n{{ range .Tasks }}\n\n  - name: {{ . }}  \n{{ end }}\n"
+	data := map[string]interface{}{"Tasks": []string{"build", "test"}}
+
+	renderNormalizeWhitespace = false
+	result, err = renderTemplate(content, data)
+	require.NoError(t, err)
+	assert.Equal(t, "tasks:  \n\n\n  - name: build  \n\n\n  - name: test  \n\n", result)
+
+	renderNormalizeWhitespace = true
+	result, err = renderTemplate(content, data)
+	require.NoError(t, err)
+	assert.Equal(t, "tasks:\n\n  - name: build\n\n  - name: test\n", result)
+}
+
+func TestDAGTemplateFunctions(t *testing.T) {
+	data := map[string]interface{}{
+		"BuildTasksObjects": []map[string]interface{}{
+			{"name": "build"},
+			{"name": "unit-test", "runAfter": []interface{}{"build"}},
+			{"name": "lint"},
+		},
+		"ScanTasks": "- name: scan\n  params:\n    - name: image\n      value: $(tasks.build.results.image)\n",
+	}
+
+	// Tasks followed through runAfter or a result reference are not leaves
+	leaves, err := leafTasks(data["BuildTasksObjects"], data["ScanTasks"], nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"unit-test", "lint", "scan"}, leaves)
+
+	result, err := renderTemplate(`runAfter: {{ runAfter .BuildTasksObjects (fromYAML .ScanTasks) }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, `runAfter: ["unit-test","lint","scan"]`, result)
+
+	result, err = renderTemplate(`runAfter: {{ runAfter .Missing }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, `runAfter: []`, result)
+
+	_, err = leafTasks(42)
+	assert.EqualError(t, err, "expected a list of objects, got int")
+}
+
+func TestMatrixTemplateFunctions(t *testing.T) {
+	data := map[string]interface{}{
+		"Platforms":  []string{"linux", "windows"},
+		"GoVersions": "[\"1.22\", \"1.23\"]",
+	}
+
+	result, err := renderTemplate(`{{ matrix "platform" .Platforms "go-version" .GoVersions | toYAML }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "params:\n    - name: platform\n      value:\n        - linux\n        - windows\n    - name: go-version\n      value:\n        - \"1.22\"\n        - \"1.23\"", result)
+
+	combinations, err := matrixCombinations("platform", data["Platforms"], "go-version", data["GoVersions"])
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"platform": "linux", "go-version": "1.22"},
+		{"platform": "linux", "go-version": "1.23"},
+		{"platform": "windows", "go-version": "1.22"},
+		{"platform": "windows", "go-version": "1.23"},
+	}, combinations)
+
+	// Exclusions match on the keys they set
+	kept, err := matrixExclude(combinations, map[string]interface{}{"platform": "windows", "go-version": "1.22"}, map[string]string{"go-version": "1.24"})
+	require.NoError(t, err)
+	assert.Len(t, kept, 3)
+
+	included, err := matrixInclude(kept[2:])
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"include": []interface{}{
+		map[string]interface{}{"params": []interface{}{
+			map[string]interface{}{"name": "go-version", "value": "1.23"},
+			map[string]interface{}{"name": "platform", "value": "windows"},
+		}},
+	}}, included)
+
+	result, err = renderTemplate(`{{ $all := matrixCombinations "platform" .Platforms "go-version" .GoVersions }}{{ len (matrixExclude $all (dict "platform" "windows")) }}`, data)
+	require.NoError(t, err)
+	assert.Equal(t, "2", result)
+
+	_, err = matrix("platform")
+	assert.EqualError(t, err, "matrix requires pairs of param names and values, got 1 arguments")
+	_, err = matrixCombinations("platform", 42)
+	assert.EqualError(t, err, `matrix param "platform" must be a list, got int`)
+
+	// The size of the product is checked before any combination is built
+	values := make([]interface{}, 100)
+	for i := range values {
+		values[i] = fmt.Sprint(i)
+	}
+	_, err = matrixCombinations("a", values, "b", values, "c", values)
+	assert.EqualError(t, err, "matrixCombinations: combinations are over the limit of 100000")
+	combinations, err = matrixCombinations("a", values, "b", values, "c", []interface{}{})
+	require.NoError(t, err)
+	assert.Empty(t, combinations)
+}
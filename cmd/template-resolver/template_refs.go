@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"text/template/parse"
+)
+
+// dataReference is a field of the template data a Go template uses, such as .AppName or
+// .Values.image. Keys holds the field names from the root of the data.
+type dataReference struct {
+	Keys []string
+	Line int
+}
+
+// String formats the reference as it is written in the template
+func (d dataReference) String() string {
+	return "." + strings.Join(d.Keys, ".")
+}
+
+// templateDataReferences returns the fields of the template data a Go template uses, in the
+// order they appear: the fields of the dot where it is the data, outside range and with, and
+// the fields of $ everywhere. Branches that do not run with the data at hand are included,
+// which is what a render cannot check. Functions are not resolved, so templates using any
+// function can be read, and the templates the content defines are skipped, as their data is
+// whatever they are invoked with.
+func templateDataReferences(content string) ([]dataReference, error) {
+	tree := parse.New("template")
+	tree.Mode = parse.SkipFuncCheck
+	if _, err := tree.Parse(content, "", "", map[string]*parse.Tree{}); err != nil {
+		return nil, err
+	}
+	var references []dataReference
+	add := func(node parse.Node, keys []string) {
+		line := strings.Count(content[:min(int(node.Position()), len(content))], "\n") + 1
+		references = append(references, dataReference{Keys: keys, Line: line})
+	}
+
+	var walkNode func(node parse.Node, dotIsRoot bool)
+	walkPipe := func(pipe *parse.PipeNode, dotIsRoot bool) {
+		if pipe == nil {
+			return
+		}
+		for _, cmd := range pipe.Cmds {
+			for _, arg := range cmd.Args {
+				walkNode(arg, dotIsRoot)
+			}
+		}
+	}
+	walkList := func(list *parse.ListNode, dotIsRoot bool) {
+		if list == nil {
+			return
+		}
+		for _, node := range list.Nodes {
+			walkNode(node, dotIsRoot)
+		}
+	}
+	walkNode = func(node parse.Node, dotIsRoot bool) {
+		switch node := node.(type) {
+		case *parse.FieldNode:
+			if dotIsRoot {
+				add(node, node.Ident)
+			}
+		case *parse.VariableNode:
+			if node.Ident[0] == "$" && len(node.Ident) > 1 {
+				add(node, node.Ident[1:])
+			}
+		case *parse.ChainNode:
+			walkNode(node.Node, dotIsRoot)
+		case *parse.PipeNode:
+			walkPipe(node, dotIsRoot)
+		case *parse.ActionNode:
+			walkPipe(node.Pipe, dotIsRoot)
+		case *parse.TemplateNode:
+			walkPipe(node.Pipe, dotIsRoot)
+		case *parse.IfNode:
+			walkPipe(node.Pipe, dotIsRoot)
+			walkList(node.List, dotIsRoot)
+			walkList(node.ElseList, dotIsRoot)
+		case *parse.RangeNode:
+			walkPipe(node.Pipe, dotIsRoot)
+			walkList(node.List, false)
+			walkList(node.ElseList, dotIsRoot)
+		case *parse.WithNode:
+			walkPipe(node.Pipe, dotIsRoot)
+			walkList(node.List, false)
+			walkList(node.ElseList, dotIsRoot)
+		case *parse.ListNode:
+			walkList(node, dotIsRoot)
+		}
+	}
+	walkList(tree.Root, true)
+	return references, nil
+}
+
+// undefinedDataReferences returns the references of a Go template to data it was not
+// rendered with and that its param schema does not declare either. Fields under .Values are
+// checked against the values, other nested fields are not checked.
+func undefinedDataReferences(content string, data map[string]interface{}, declared []string) ([]dataReference, error) {
+	references, err := templateDataReferences(content)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	knownValues := map[string]bool{}
+	for _, name := range declared {
+		known[toCamelCase(name)] = true
+		knownValues[helmValueName(name)] = true
+	}
+	values, _ := data["Values"].(map[string]interface{})
+
+	var undefined []dataReference
+	for _, reference := range references {
+		name := reference.Keys[0]
+		if _, ok := data[name]; !ok && !known[name] {
+			undefined = append(undefined, reference)
+			continue
+		}
+		if name != "Values" || len(reference.Keys) < 2 || values == nil {
+			continue
+		}
+		if _, ok := values[reference.Keys[1]]; !ok && !knownValues[reference.Keys[1]] {
+			undefined = append(undefined, reference)
+		}
+	}
+	return undefined, nil
+}
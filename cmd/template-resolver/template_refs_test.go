@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateDataReferences(t *testing.T) {
+	references, err := templateDataReferences(`name: {{ .AppName | lower }}
+{{- if and .Deploy (eq .Values.env "prod") }}
+{{- range .Environments }}
+  - {{ .name }}-{{ $.Suffix }}
+{{- end }}
+{{- with .Config }}{{ .replicas }}{{ else }}{{ .Fallback }}{{ end }}
+{{- end }}
+{{ define "helper" }}{{ .Ignored }}{{ end }}
+{{ template "helper" .Helper }}
+{{ (.Object).field }}
+{{ $name := .Name }}{{ $name.other }}
+`)
+	require.NoError(t, err)
+	var names []string
+	var lines []int
+	for _, reference := range references {
+		names = append(names, reference.String())
+		lines = append(lines, reference.Line)
+	}
+	assert.Equal(t, []string{".AppName", ".Deploy", ".Values.env", ".Environments", ".Suffix", ".Config", ".Fallback", ".Helper", ".Object", ".Name"}, names)
+	assert.Equal(t, []int{1, 2, 2, 3, 4, 6, 6, 9, 10, 11}, lines)
+
+	// Functions are not resolved
+	references, err = templateDataReferences(`{{ customFunction .Value }}`)
+	require.NoError(t, err)
+	assert.Len(t, references, 1)
+
+	_, err = templateDataReferences("{{ .Unclosed")
+	assert.Error(t, err)
+}
+
+func TestUndefinedDataReferences(t *testing.T) {
+	data := map[string]interface{}{
+		"AppName": "api",
+		"Values":  map[string]interface{}{"image": "api:1.0"},
+	}
+	content := "{{ .AppName }} {{ .Team }} {{ .Owner }} {{ .Values.image }} {{ .Values.teamName }} {{ .Values.region }} {{ .AppName.nested }}"
+
+	undefined, err := undefinedDataReferences(content, data, []string{"team-name"})
+	require.NoError(t, err)
+	var names []string
+	for _, reference := range undefined {
+		names = append(names, reference.String())
+	}
+	assert.Equal(t, []string{".Team", ".Owner", ".Values.region"}, names)
+
+	// Values are not checked when the template has none, .Values is reported instead
+	undefined, err = undefinedDataReferences("{{ .Values.image }}", map[string]interface{}{}, nil)
+	require.NoError(t, err)
+	require.Len(t, undefined, 1)
+	assert.Equal(t, ".Values.image", undefined[0].String())
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
 )
 
 func TestRenderTemplate(t *testing.T) {
@@ -22,8 +25,8 @@ spec:
     {{.PostProdSteps}}
     {{- end}}
     {{- if .JsonObject}}
-    # Json object with toJson function
-    {{toJson .JsonObject | indent 4}}
+    # Json object with toJsonYAML function
+    {{toJsonYAML .JsonObject | indent 4}}
     {{- end}}
     {{- if .IndentText}}
     # Text with indent function
@@ -100,7 +103,7 @@ spec:
 			wantErr:      true,
 		},
 		{
-			name: "with toJson function",
+			name: "with toJsonYAML function",
 			data: map[string]interface{}{
 				"JsonObject": map[string]interface{}{
 					"name": "test-json",
@@ -110,7 +113,7 @@ spec:
 				},
 			},
 			wantContains: []string{
-				"# Json object with toJson function",
+				"# Json object with toJsonYAML function",
 				"    name: test-json",
 				"    taskRef:",
 				"      name: test-task",
@@ -162,109 +165,6 @@ spec:
 	}
 }
 
-func TestFormatTasksYAML(t *testing.T) {
-	tests := []struct {
-		name        string
-		input       string
-		contains    []string
-		notContains []string
-		expectError bool
-	}{
-		{
-			name:        "empty input",
-			input:       "",
-			contains:    []string{},
-			expectError: false,
-		},
-		{
-			name:        "invalid YAML",
-			input:       "invalid: yaml: missing quote",
-			contains:    []string{},
-			expectError: true,
-		},
-		{
-			name:        "no tasks in YAML",
-			input:       "[]",
-			contains:    []string{},
-			expectError: false,
-		},
-		{
-			name: "single task",
-			input: `- name: test-task
-  taskRef:
-    name: task-ref`,
-			contains: []string{
-				"- name: test-task",
-				"taskRef:",
-				"name: task-ref",
-			},
-			expectError: false,
-		},
-		{
-			name: "multiple tasks",
-			input: `- name: task1
-  taskRef:
-    name: task-ref1
-- name: task2
-  taskRef:
-    name: task-ref2`,
-			contains: []string{
-				"- name: task1",
-				"taskRef:",
-				"name: task-ref1",
-				"- name: task2",
-				"name: task-ref2",
-			},
-			expectError: false,
-		},
-		{
-			name: "complex task with runAfter",
-			input: `- name: complex-task
-  runAfter:
-  - previous-task
-  taskSpec:
-    steps:
-    - name: step1
-      image: step-image
-      script: |
-        echo "Running step"`,
-			contains: []string{
-				"- name: complex-task",
-				"runAfter:",
-				"- previous-task",
-				"taskSpec:",
-				"steps:",
-				"name: step1",
-				"image: step-image",
-				"script:",
-			},
-			expectError: false,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result, err := formatTasksYAML(tt.input)
-
-			if tt.expectError {
-				assert.Error(t, err)
-			} else {
-				assert.NoError(t, err)
-
-				// Check that result contains expected substrings
-				for _, expected := range tt.contains {
-					assert.Contains(t, result, expected, "Result should contain %q", expected)
-				}
-
-				// Check that result does not contain unwanted substrings
-				for _, unexpected := range tt.notContains {
-					assert.NotContains(t, result, unexpected, "Result should not contain %q", unexpected)
-				}
-			}
-		})
-	}
-}
-
 // In some cases, we want the yaml to be at a certain indentation
 // level, but if it's in a list.. we need it to trim the preceeding
 // whitespace so that it will align correctly.
@@ -299,3 +199,111 @@ foo:
 	}
 
 }
+
+func TestTplFunction(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		data     map[string]interface{}
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "param containing template expressions",
+			template: `image: {{ tpl .Image . }}`,
+			data:     map[string]interface{}{"Image": "registry/{{ .AppName }}:{{ .Tag }}", "AppName": "api", "Tag": "v1"},
+			expected: "image: registry/api:v1",
+		},
+		{
+			name:     "functions and defined templates are available",
+			template: `{{ define "suffix" }}-prod{{ end }}name: {{ tpl .Name . }}`,
+			data:     map[string]interface{}{"Name": `{{ .AppName | toString }}{{ template "suffix" }}`, "AppName": "api"},
+			expected: "name: api-prod",
+		},
+		{
+			name:     "plain strings are unchanged",
+			template: `name: {{ tpl .Name . }}`,
+			data:     map[string]interface{}{"Name": "api"},
+			expected: "name: api",
+		},
+		{
+			name:     "invalid template text",
+			template: `name: {{ tpl .Name . }}`,
+			data:     map[string]interface{}{"Name": "{{ .AppName "},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := renderTemplate(tt.template, tt.data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestCheckYAMLDocuments(t *testing.T) {
+	assert.NoError(t, checkYAMLDocuments("kind: Task\n---\nkind: Pipeline\n"))
+	assert.NoError(t, checkYAMLDocuments(""))
+	assert.Error(t, checkYAMLDocuments("kind: Task\n---\nkind: [Pipeline\n"))
+}
+
+func TestRenderTemplateStrictYAML(t *testing.T) {
+	content := "name: {{ .Name }}\nimage: [{{ .Image }}\n"
+	data := map[string]interface{}{"Name": "api", "Image": "golang"}
+
+	// Invalid YAML is returned unless strict
+	result, err := renderTemplateWithOptions(context.Background(), content, data, renderOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "name: api\nimage: [golang\n", result)
+
+	_, err = renderTemplateWithOptions(context.Background(), content, data, renderOptions{strictYAML: true})
+	assert.ErrorContains(t, err, "rendered template is not valid YAML")
+
+	result, err = renderTemplateWithOptions(context.Background(), "name: {{ .Name }}\n", data, renderOptions{strictYAML: true})
+	require.NoError(t, err)
+	assert.Equal(t, "name: api\n", result)
+}
+
+func TestResolverStrictYAML(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:pipeline.yaml": "metadata:\n  name: {{ .Name }}\n  labels: {app: api\n",
+	}}}
+	params := func(extra ...pipelinev1.Param) []pipelinev1.Param {
+		return append([]pipelinev1.Param{
+			{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("repo1")},
+			{Name: PathParam, Value: *pipelinev1.NewStructuredValues("pipeline.yaml")},
+			{Name: "name", Value: *pipelinev1.NewStructuredValues("api")},
+		}, extra...)
+	}
+	strict := pipelinev1.Param{Name: StrictYAMLParam, Value: *pipelinev1.NewStructuredValues("true")}
+
+	// Without Tekton validation nothing else parses the rendered template
+	originalValidate := validateRendered
+	validateRendered = false
+	defer func() { validateRendered = originalValidate }()
+
+	_, err := r.Resolve(context.Background(), params())
+	assert.NoError(t, err)
+
+	_, err = r.Resolve(context.Background(), params(strict))
+	assert.ErrorContains(t, err, "rendered template is not valid YAML")
+
+	// TEMPLATE_STRICT_YAML applies to requests that do not set strict-yaml
+	original := strictYAML
+	strictYAML = true
+	defer func() { strictYAML = original }()
+	_, err = r.Resolve(context.Background(), params())
+	assert.ErrorContains(t, err, "rendered template is not valid YAML")
+	strict.Value.StringVal = "false"
+	_, err = r.Resolve(context.Background(), params(strict))
+	assert.NoError(t, err)
+
+	strict.Value.StringVal = "always"
+	assert.ErrorContains(t, r.ValidateParams(context.Background(), params(strict)), "invalid strict-yaml param")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenRefreshMargin is how long before it expires a cached token is replaced, so a token
+// never expires in the middle of a fetch
+const tokenRefreshMargin = 5 * time.Minute
+
+// tokenCache reuses a short-lived access token, such as a GitHub App installation token or
+// an Azure managed identity token, minting a new one shortly before it expires
+type tokenCache struct {
+	// mint obtains a new token and the time it expires, zero when unknown
+	mint func() (string, time.Time, error)
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// Token returns the cached token, minting a new one when there is none yet or the current
+// one expires within tokenRefreshMargin. Tokens without an expiry are not cached.
+func (c *tokenCache) Token() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Until(c.expires) > tokenRefreshMargin {
+		return c.token, nil
+	}
+	token, expires, err := c.mint()
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expires = token, expires
+	return token, nil
+}
+
+// Invalidate drops the cached token after it was rejected, so the next call to Token mints
+// a new one
+func (c *tokenCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token, c.expires = "", time.Time{}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenCache(t *testing.T) {
+	minted := 0
+	lifetime := time.Hour
+	cache := &tokenCache{mint: func() (string, time.Time, error) {
+		minted++
+		if minted == 3 {
+			return "", time.Time{}, errors.New("token service unavailable")
+		}
+		var expires time.Time
+		if lifetime > 0 {
+			expires = time.Now().Add(lifetime)
+		}
+		return "token", expires, nil
+	}}
+
+	// Tokens are reused until they are about to expire
+	token, err := cache.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+	_, err = cache.Token()
+	require.NoError(t, err)
+	assert.Equal(t, 1, minted)
+
+	cache.Invalidate()
+	_, err = cache.Token()
+	require.NoError(t, err)
+	assert.Equal(t, 2, minted)
+
+	// Failures are returned and not cached
+	cache.expires = time.Now().Add(tokenRefreshMargin - time.Second)
+	_, err = cache.Token()
+	assert.EqualError(t, err, "token service unavailable")
+	assert.Equal(t, 3, minted)
+
+	// Tokens without an expiry are minted for every call
+	lifetime = 0
+	_, err = cache.Token()
+	require.NoError(t, err)
+	_, err = cache.Token()
+	require.NoError(t, err)
+	assert.Equal(t, 5, minted)
+}
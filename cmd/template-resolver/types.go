@@ -4,18 +4,67 @@ import (
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
 )
 
-// TemplateFetcher defines the interface for fetching templates
+// TemplateFetcher defines the interface for fetching templates.
+// An empty revision means the fetcher should use the configured default branch.
 type TemplateFetcher interface {
-	FetchTemplate(repoURL, filePath string) (string, error)
+	FetchTemplate(repoURL, revision, filePath string, opts FetchOptions) (*FetchedTemplate, error)
 }
 
+// TemplateLister is implemented by fetchers that can list the files of a repository, for
+// template paths holding a glob. The files matching the path.Match pattern are returned
+// relative to the repository root, read from the same commit.
+type TemplateLister interface {
+	ListTemplates(repoURL, revision, pattern string, opts FetchOptions) (*TemplateListing, error)
+}
+
+// TemplateListing holds the files of a repository matching a glob pattern
+type TemplateListing struct {
+	// Files maps the path of each matching file to its content
+	Files map[string]string
+
+	// Commit is the Git commit SHA the files were read at, empty when the source has none
+	Commit string
+}
+
+// FetchedTemplate is the content of a template and the version it was read at
+type FetchedTemplate struct {
+	Content string
+
+	// Commit is the resolved Git commit SHA, empty when the source does not report one
+	Commit string
+}
+
+// FetchOptions holds per-request settings for sources that support them
+type FetchOptions struct {
+	// Submodules selects whether Git submodules are initialized when cloning:
+	// SubmodulesNone (or empty), SubmodulesFull or SubmodulesShallow
+	Submodules string
+
+	// Credentials are loaded from the git-credentials-secret param and used only for this request
+	Credentials *GitCredentials
+}
+
+// Submodule modes accepted by the submodules param and GIT_SUBMODULES
+const (
+	SubmodulesNone    = "false"
+	SubmodulesFull    = "true"
+	SubmodulesShallow = "shallow"
+)
+
 // Default implementation for fetching templates
-type gitTemplateFetcher struct{}
+type gitTemplateFetcher struct {
+	// cache holds HTTP validators of raw file responses, nil when caching is disabled
+	cache Cache
+}
 
 // templateResource wraps the rendered template data
 type templateResource struct {
-	data   []byte
-	source *pipelinev1.RefSource
+	data        []byte
+	source      *pipelinev1.RefSource
+	annotations map[string]string
+
+	// fetched is the template the resource was rendered from
+	fetched *FetchedTemplate
 }
 
 // Data returns the bytes of our rendered template
@@ -25,7 +74,7 @@ func (r *templateResource) Data() []byte {
 
 // Annotations returns any metadata needed alongside the data
 func (r *templateResource) Annotations() map[string]string {
-	return nil
+	return r.annotations
 }
 
 // RefSource returns source reference information about the template
@@ -3,6 +3,8 @@ package main
 import (
 	"strings"
 	"unicode"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
 )
 
 // Helper function to convert parameter names to camel case for Go templates
@@ -19,3 +21,13 @@ func toCamelCase(paramName string) string {
 	}
 	return strings.Join(parts, "")
 }
+
+// paramString returns the string value of the named param, empty when it is missing
+func paramString(params []pipelinev1.Param, name string) string {
+	for _, param := range params {
+		if param.Name == name {
+			return param.Value.StringVal
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	"sigs.k8s.io/yaml"
+)
+
+// tektonResource is a Tekton type the resolver can default and validate
+type tektonResource interface {
+	apis.Defaultable
+	apis.Validatable
+}
+
+// newTektonResource returns an empty object of the Tekton type identified by apiVersion and
+// kind, or nil for types that are not validated, such as non-Tekton resources
+func newTektonResource(apiVersion, kind string) tektonResource {
+	switch apiVersion + "/" + kind {
+	case "tekton.dev/v1/Pipeline":
+		return &pipelinev1.Pipeline{}
+	case "tekton.dev/v1/Task":
+		return &pipelinev1.Task{}
+	case "tekton.dev/v1beta1/Pipeline":
+		return &pipelinev1beta1.Pipeline{}
+	case "tekton.dev/v1beta1/Task":
+		return &pipelinev1beta1.Task{}
+	case "tekton.dev/v1beta1/StepAction":
+		return &pipelinev1beta1.StepAction{}
+	}
+	return nil
+}
+
+// tektonValidationError lists the fields Tekton's validation rejected in a rendered resource
+type tektonValidationError struct {
+	kind     string
+	name     string
+	fieldErr *apis.FieldError
+}
+
+func (e *tektonValidationError) Error() string {
+	return fmt.Sprintf("rendered %s %q is invalid: %v", e.kind, e.name, e.fieldErr)
+}
+
+func (e *tektonValidationError) Unwrap() error {
+	return e.fieldErr
+}
+
+// tektonDiagnostics decodes a rendered template into its Tekton Go type and runs the
+// defaulting and validation Tekton itself runs. It returns every diagnostic, warnings
+// included, or nil when the resource is valid or is not a Tekton Pipeline or Task.
+func tektonDiagnostics(ctx context.Context, rendered string) (*tektonValidationError, error) {
+	var typeMeta metav1.TypeMeta
+	if err := yaml.Unmarshal([]byte(rendered), &typeMeta); err != nil {
+		return nil, fmt.Errorf("rendered template is not valid YAML: %w", newYAMLError(err, rendered))
+	}
+	resource := newTektonResource(typeMeta.APIVersion, typeMeta.Kind)
+	if resource == nil {
+		debugContextf(ctx, "Not validating rendered %s %s", typeMeta.APIVersion, typeMeta.Kind)
+		return nil, nil
+	}
+
+	if err := yaml.Unmarshal([]byte(rendered), resource); err != nil {
+		return nil, fmt.Errorf("rendered template is not a valid %s: %w", typeMeta.Kind, err)
+	}
+	resource.SetDefaults(ctx)
+	fieldErr := resource.Validate(ctx)
+	if fieldErr == nil {
+		return nil, nil
+	}
+	name := ""
+	if object, ok := resource.(metav1.Object); ok {
+		name = object.GetName()
+	}
+	return &tektonValidationError{kind: typeMeta.Kind, name: name, fieldErr: fieldErr}, nil
+}
+
+// validateTektonResource fails a rendered Tekton Pipeline or Task that Tekton would reject,
+// naming the invalid fields instead of letting the PipelineRun fail later with a cryptic
+// message. Warnings do not fail the request. Resources of other types are not checked.
+func validateTektonResource(ctx context.Context, rendered string) error {
+	diagnostics, err := tektonDiagnostics(ctx, rendered)
+	if err != nil || diagnostics == nil {
+		return err
+	}
+	if warnings := diagnostics.fieldErr.Filter(apis.WarningLevel); warnings != nil {
+		debugContextf(ctx, "Rendered %s %q has validation warnings: %v", diagnostics.kind, diagnostics.name, warnings)
+	}
+	if errs := diagnostics.fieldErr.Filter(apis.ErrorLevel); errs != nil {
+		return &tektonValidationError{kind: diagnostics.kind, name: diagnostics.name, fieldErr: errs}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestValidateTektonResource(t *testing.T) {
+	tests := []struct {
+		name     string
+		rendered string
+		wantErr  string
+	}{
+		{
+			name: "valid pipeline",
+			rendered: `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: api
+spec:
+  tasks:
+    - name: build
+      taskRef:
+        name: build
+`,
+		},
+		{
+			name: "pipeline task without a task",
+			rendered: `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: api
+spec:
+  tasks:
+    - name: build
+`,
+			wantErr: `rendered Pipeline "api" is invalid: expected exactly one, got neither: spec.tasks[0].taskRef, spec.tasks[0].taskSpec`,
+		},
+		{
+			name: "task without steps",
+			rendered: `apiVersion: tekton.dev/v1
+kind: Task
+metadata:
+  name: build
+spec: {}
+`,
+			wantErr: `rendered Task "build" is invalid: missing field(s): spec.steps`,
+		},
+		{
+			name: "v1beta1 pipeline with an undeclared param",
+			rendered: `apiVersion: tekton.dev/v1beta1
+kind: Pipeline
+metadata:
+  name: api
+spec:
+  tasks:
+    - name: build
+      taskRef:
+        name: build
+      params:
+        - name: image
+          value: $(params.image)
+`,
+			wantErr: `non-existent variable`,
+		},
+		{
+			name:     "other resources are not checked",
+			rendered: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n",
+		},
+		{
+			name:     "invalid YAML",
+			rendered: "kind: [Pipeline",
+			wantErr:  "rendered template is not valid YAML",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTektonResource(context.Background(), tt.rendered)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolverValidatesRenderedResource(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:task.yaml": "apiVersion: tekton.dev/v1\nkind: Task\nmetadata:\n  name: {{ .AppName }}\nspec: {}\n",
+	}}}
+	params := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+		{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "task.yaml"}},
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+	}
+
+	_, err := r.Resolve(context.Background(), params)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `rendered Task "api" is invalid`)
+
+	original := validateRendered
+	validateRendered = false
+	defer func() { validateRendered = original }()
+	resource, err := r.Resolve(context.Background(), params)
+	require.NoError(t, err)
+	assert.Contains(t, string(resource.Data()), "name: api")
+}
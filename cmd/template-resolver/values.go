@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"github.com/tektoncd/pipeline/pkg/resolution/common"
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// valuesFileSuffix replaces the extension of a template to name its default values file
+const valuesFileSuffix = ".values.yaml"
+
+// parseValues parses the values param, a YAML document holding template data like a Helm
+// values file. It returns nil when the request has no values param.
+func parseValues(params []pipelinev1.Param) (map[string]interface{}, error) {
+	for _, param := range params {
+		if param.Name != ValuesParam {
+			continue
+		}
+		values := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(param.Value.StringVal), &values); err != nil {
+			return nil, fmt.Errorf("invalid %s param, must be a YAML mapping: %w", ValuesParam, err)
+		}
+		return values, nil
+	}
+	return nil, nil
+}
+
+// templateValues returns the .Values of a Go template: the base values, such as those of the
+// values-from-configmap ConfigMap, deep-merged with the values param and then the individual
+// params. Later sources override the values of the same name.
+func templateValues(base map[string]interface{}, params []pipelinev1.Param) (map[string]interface{}, error) {
+	values, err := parseValues(params)
+	if err != nil {
+		return nil, err
+	}
+	return mergeMaps(true, copyMap(base), values, helmValues(params))
+}
+
+// hasValuesParam reports whether the request sends a values document
+func hasValuesParam(params []pipelinev1.Param) bool {
+	return slices.ContainsFunc(params, func(param pipelinev1.Param) bool {
+		return param.Name == ValuesParam
+	})
+}
+
+// configMapValues reads the values-from-configmap ConfigMap of the request namespace, so
+// environment configuration shared by many PipelineRuns does not have to be repeated in each
+// of them. Like lookup, only ConfigMaps matching TEMPLATE_LOOKUP_CONFIGMAPS can be read.
+func (r *resolver) configMapValues(ctx context.Context, name string) (map[string]interface{}, error) {
+	if r.kubeClient == nil {
+		return nil, fmt.Errorf("%s is only supported when running as a Tekton resolver", ValuesFromConfigMapParam)
+	}
+	namespace := common.RequestNamespace(ctx)
+	if namespace == "" {
+		return nil, fmt.Errorf("cannot read %s %s: request namespace is unknown", ValuesFromConfigMapParam, name)
+	}
+	if !allowlisted(name, templateLookupConfigMaps) {
+		return nil, fmt.Errorf("%s %s is not allowed by %s", ValuesFromConfigMapParam, name, EnvTemplateLookupConfigMaps)
+	}
+
+	debugContextf(ctx, "Loading values from ConfigMap %s/%s", namespace, name)
+	configMap, err := r.kubeClient.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values ConfigMap %s/%s: %w", namespace, name, err)
+	}
+	return dataValues(configMap.Data, fmt.Sprintf("ConfigMap %s/%s", namespace, name))
+}
+
+// dataValues converts the data of a ConfigMap or Secret into template values. Keys ending in
+// .yaml or .yml hold values files, which are merged in the order of their keys; every other
+// key is a value of its own, with YAML and JSON objects and arrays parsed like the fields of
+// object params.
+func dataValues(data map[string]string, source string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".yaml") && !strings.HasSuffix(key, ".yml") {
+			values[key] = structuredParamValue(data[key])
+			continue
+		}
+		file := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(data[key]), &file); err != nil {
+			return nil, fmt.Errorf("invalid values file %s in %s, must be a YAML mapping: %w", key, source, err)
+		}
+		merged, err := mergeMaps(true, values, file)
+		if err != nil {
+			return nil, err
+		}
+		values = merged
+	}
+	return values, nil
+}
+
+// secretValues reads the values-from-secret Secret of the request namespace, for sensitive
+// values such as internal endpoints. Like lookup, only the keys matching TEMPLATE_LOOKUP_SECRETS
+// ("name/key") are read, and the values are kept out of the logs of the resolution.
+func (r *resolver) secretValues(ctx context.Context, name string) (map[string]interface{}, error) {
+	if r.kubeClient == nil {
+		return nil, fmt.Errorf("%s is only supported when running as a Tekton resolver", ValuesFromSecretParam)
+	}
+	namespace := common.RequestNamespace(ctx)
+	if namespace == "" {
+		return nil, fmt.Errorf("cannot read %s %s: request namespace is unknown", ValuesFromSecretParam, name)
+	}
+	keys := lookupSecretKeys(name)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s %s is not allowed by %s", ValuesFromSecretParam, name, EnvTemplateLookupSecrets)
+	}
+
+	debugContextf(ctx, "Loading values from Secret %s/%s", namespace, name)
+	secret, err := r.kubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values Secret %s/%s: %w", namespace, name, err)
+	}
+	data := make(map[string]string, len(secret.Data))
+	for key, value := range secret.Data {
+		if allowlisted(name+"/"+key, keys) {
+			data[key] = string(value)
+		}
+	}
+	return dataValues(data, fmt.Sprintf("Secret %s/%s", namespace, name))
+}
+
+// defaultValuesPaths returns the files that may hold the default values of a template, in
+// order of preference: the template's own values file, with its extension replaced by
+// .values.yaml, then values.yaml in its directory
+func defaultValuesPaths(templatePath string) []string {
+	return []string{
+		strings.TrimSuffix(templatePath, path.Ext(templatePath)) + valuesFileSuffix,
+		path.Join(path.Dir(templatePath), "values.yaml"),
+	}
+}
+
+// defaultValues reads the default values of a template from the first values file found
+// next to it in the same repository and revision. It returns the values and the content of
+// the file, or nil values when the template has none.
+func (r *resolver) defaultValues(ctx context.Context, repository, revision, templatePath string, opts FetchOptions) (map[string]interface{}, string, error) {
+	for _, valuesPath := range defaultValuesPaths(templatePath) {
+		fetched, err := r.fetchTemplate(ctx, repository, revision, valuesPath, opts)
+		if err != nil {
+			debugContextf(ctx, "No default values at %s: %v", valuesPath, err)
+			continue
+		}
+		values := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(fetched.Content), &values); err != nil {
+			return nil, "", fmt.Errorf("invalid values file %s, must be a YAML mapping: %w", valuesPath, err)
+		}
+		debugContextf(ctx, "Using default values from %s", valuesPath)
+		return values, fetched.Content, nil
+	}
+	return nil, "", nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"github.com/tektoncd/pipeline/pkg/resolution/common"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestTemplateValues(t *testing.T) {
+	values, err := templateValues(nil, []pipelinev1.Param{
+		{Name: ValuesParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "appName: api\ndeploy:\n  replicas: 2\n  region: us-east-1\n"}},
+		{Name: "deploy", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeObject, ObjectVal: map[string]string{"replicas": "3"}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"appName": "api",
+		"deploy":  map[string]interface{}{"replicas": "3", "region": "us-east-1"},
+	}, values)
+
+	_, err = templateValues(nil, []pipelinev1.Param{
+		{Name: ValuesParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "- not\n- a mapping\n"}},
+	})
+	assert.ErrorContains(t, err, "invalid values param")
+}
+
+func TestResolverValuesParam(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:pipeline.yaml": "metadata:\n  name: {{ .AppName }}-{{ .Values.environment }}-{{ .Values.deploy.replicas }}\n",
+	}}}
+	params := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+		{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "pipeline.yaml"}},
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		{Name: "environment", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "prod"}},
+		{Name: ValuesParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "environment: dev\ndeploy:\n  replicas: 2\n"}},
+	}
+	require.NoError(t, r.ValidateParams(context.Background(), params))
+
+	// Individual params override the values document
+	resource, err := r.Resolve(context.Background(), params)
+	require.NoError(t, err)
+	assert.Equal(t, "metadata:\n  name: api-prod-2\n", string(resource.Data()))
+
+	params[4].Value.StringVal = "environment: [dev"
+	assert.ErrorContains(t, r.ValidateParams(context.Background(), params), "invalid values param")
+}
+
+func TestDataValues(t *testing.T) {
+	values, err := dataValues(map[string]string{
+		"values.yaml":    "deploy:\n  replicas: 2\n  region: us-east-1\n",
+		"zz-prod.yaml":   "deploy:\n  replicas: 5\n",
+		"registry":       "registry.example.com",
+		"allowed-images": `["golang", "alpine"]`,
+	}, "ConfigMap team-a/settings")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"deploy":         map[string]interface{}{"replicas": 5, "region": "us-east-1"},
+		"registry":       "registry.example.com",
+		"allowed-images": []interface{}{"golang", "alpine"},
+	}, values)
+
+	_, err = dataValues(map[string]string{"values.yaml": "- not a mapping"}, "ConfigMap team-a/settings")
+	assert.ErrorContains(t, err, "invalid values file values.yaml in ConfigMap team-a/settings")
+}
+
+func TestResolverValuesFromConfigMap(t *testing.T) {
+	original := templateLookupConfigMaps
+	defer func() { templateLookupConfigMaps = original }()
+	templateLookupConfigMaps = []string{"pipeline-*"}
+
+	r := &resolver{
+		fetcher: &mockFetcher{templates: map[string]string{
+			"repo1:pipeline.yaml": "metadata:\n  name: {{ .AppName }}-{{ .Values.environment }}\n  annotations:\n    registry: {{ .Values.registry }}\n",
+		}},
+		kubeClient: fake.NewSimpleClientset(
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "pipeline-settings", Namespace: "team-a"},
+				Data:       map[string]string{"values.yaml": "environment: staging\nregistry: registry.example.com\n"},
+			},
+			&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "private", Namespace: "team-a"},
+			},
+		),
+	}
+	ctx := common.InjectRequestNamespace(context.Background(), "team-a")
+	params := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+		{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "pipeline.yaml"}},
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		{Name: ValuesFromConfigMapParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "pipeline-settings"}},
+		{Name: ValuesParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "environment: production\n"}},
+	}
+
+	// The values param overrides the ConfigMap
+	resource, err := r.Resolve(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, "metadata:\n  name: api-production\n  annotations:\n    registry: registry.example.com\n", string(resource.Data()))
+
+	resource, err = r.Resolve(ctx, params[:4])
+	require.NoError(t, err)
+	assert.Contains(t, string(resource.Data()), "name: api-staging")
+
+	params[3].Value.StringVal = "private"
+	_, err = r.Resolve(ctx, params)
+	assert.ErrorContains(t, err, "not allowed by TEMPLATE_LOOKUP_CONFIGMAPS")
+
+	params[3].Value.StringVal = "pipeline-missing"
+	_, err = r.Resolve(ctx, params)
+	assert.ErrorContains(t, err, "failed to read values ConfigMap team-a/pipeline-missing")
+
+	_, err = (&resolver{fetcher: r.fetcher}).Resolve(ctx, params)
+	assert.ErrorContains(t, err, "only supported when running as a Tekton resolver")
+}
+
+func TestResolverValuesFromSecret(t *testing.T) {
+	logs := captureLog(t)
+	originalSecrets, originalDebug := templateLookupSecrets, debugMode
+	defer func() { templateLookupSecrets, debugMode = originalSecrets, originalDebug }()
+	templateLookupSecrets = []string{"pipeline-endpoints/registry", "pipeline-endpoints/*.yaml"}
+	debugMode = true
+
+	r := &resolver{
+		fetcher: &mockFetcher{templates: map[string]string{
+			"repo1:pipeline.yaml": "metadata:\n  name: {{ .AppName }}\n  annotations:\n    registry: {{ .Values.registry }}\n    cache: {{ .Values.cache.host }}\n",
+		}},
+		kubeClient: fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "pipeline-endpoints", Namespace: "team-a"},
+			Data: map[string][]byte{
+				"registry":    []byte("registry.internal.example.com"),
+				"values.yaml": []byte("cache:\n  host: cache.internal.example.com\n"),
+				"password":    []byte("not-allowlisted"),
+			},
+		}),
+	}
+	ctx := common.InjectRequestNamespace(context.Background(), "team-a")
+	params := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+		{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "pipeline.yaml"}},
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		{Name: ValuesFromSecretParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "pipeline-endpoints"}},
+	}
+
+	resource, err := r.Resolve(ctx, params)
+	require.NoError(t, err)
+	assert.Equal(t, "metadata:\n  name: api\n  annotations:\n    registry: registry.internal.example.com\n    cache: cache.internal.example.com\n", string(resource.Data()))
+
+	// The values reach the template, never the logs
+	assert.Contains(t, logs.String(), "[REDACTED]")
+	assert.NotContains(t, logs.String(), "internal.example.com")
+
+	params[3].Value.StringVal = "other"
+	_, err = r.Resolve(ctx, params)
+	assert.ErrorContains(t, err, "not allowed by TEMPLATE_LOOKUP_SECRETS")
+}
+
+func TestDefaultValuesPaths(t *testing.T) {
+	assert.Equal(t, []string{"pipelines/deploy.values.yaml", "pipelines/values.yaml"}, defaultValuesPaths("pipelines/deploy.yaml"))
+	assert.Equal(t, []string{"pipeline.values.yaml", "values.yaml"}, defaultValuesPaths("pipeline.tpl"))
+}
+
+func TestResolverDefaultValuesFile(t *testing.T) {
+	original := templateValuesFiles
+	defer func() { templateValuesFiles = original }()
+	templateValuesFiles = true
+
+	templates := map[string]string{
+		"repo1:pipelines/deploy.yaml":        "metadata:\n  name: {{ .Values.appName }}-{{ .Values.environment }}-{{ .Values.deploy.replicas }}\n",
+		"repo1:pipelines/deploy.values.yaml": "appName: app\nenvironment: dev\ndeploy:\n  replicas: 1\n",
+		"repo1:pipelines/values.yaml":        "appName: shared\nenvironment: shared\n",
+		"repo1:pipelines/build.yaml":         "metadata:\n  name: {{ .Values.appName }}-{{ .Values.environment }}\n",
+		"repo1:broken/pipeline.yaml":         "metadata:\n  name: broken\n",
+		"repo1:broken/values.yaml":           "- not a mapping",
+	}
+	r := &resolver{fetcher: &notFoundFetcher{templates: templates}}
+	resolve := func(path string, extra ...pipelinev1.Param) (string, error) {
+		params := append([]pipelinev1.Param{
+			{Name: RepositoryParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "repo1"}},
+			{Name: PathParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: path}},
+		}, extra...)
+		resource, err := r.Resolve(context.Background(), params)
+		if err != nil {
+			return "", err
+		}
+		return string(resource.Data()), nil
+	}
+
+	// Request params override the defaults of the template
+	rendered, err := resolve("pipelines/deploy.yaml",
+		pipelinev1.Param{Name: "environment", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "prod"}})
+	require.NoError(t, err)
+	assert.Equal(t, "metadata:\n  name: app-prod-1\n", rendered)
+
+	// Templates without their own values file use values.yaml in their directory
+	rendered, err = resolve("pipelines/build.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "metadata:\n  name: shared-shared\n", rendered)
+
+	_, err = resolve("broken/pipeline.yaml")
+	assert.ErrorContains(t, err, "invalid values file broken/values.yaml")
+}
+
+// notFoundFetcher serves the templates it holds and fails for any other path
+type notFoundFetcher struct {
+	templates map[string]string
+}
+
+func (f *notFoundFetcher) FetchTemplate(repo, revision, path string, opts FetchOptions) (*FetchedTemplate, error) {
+	if content, ok := f.templates[repo+":"+path]; ok {
+		return &FetchedTemplate{Content: content}, nil
+	}
+	return nil, fmt.Errorf("file %s not found in repository", path)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+// maxPushEventSize is the largest push event body the watch webhook reads
+const maxPushEventSize = 25 << 20
+
+// watchedTemplate is a template of WATCH_TEMPLATES kept in the cache and linted on change
+type watchedTemplate struct {
+	repository string
+	path       string
+	revision   string
+}
+
+func (t watchedTemplate) String() string {
+	if t.revision == "" {
+		return t.repository + " " + t.path
+	}
+	return t.repository + " " + t.path + "@" + t.revision
+}
+
+// parseWatchedTemplates parses the "repository=path[@revision]" entries of WATCH_TEMPLATES.
+// Invalid entries are logged and skipped.
+func parseWatchedTemplates(entries []string) []watchedTemplate {
+	var templates []watchedTemplate
+	for _, entry := range entries {
+		repository, path, ok := strings.Cut(entry, "=")
+		repository, path = strings.TrimSpace(repository), strings.TrimSpace(path)
+		path, revision, _ := strings.Cut(path, "@")
+		if !ok || repository == "" || path == "" {
+			logger.Warnf("Ignoring invalid %s entry %q, expected repository=path[@revision]", EnvWatchTemplates, entry)
+			continue
+		}
+		templates = append(templates, watchedTemplate{repository: repository, path: path, revision: revision})
+	}
+	return templates
+}
+
+// templateWatcher polls the WATCH_TEMPLATES, or checks them when their repository reports
+// a push, so their cache entries never expire and templates broken by a push are reported
+// before any PipelineRun uses them
+type templateWatcher struct {
+	resolver  *resolver
+	templates []watchedTemplate
+
+	// mu serializes checks and guards digests, the content digest each template was last
+	// linted at
+	mu      sync.Mutex
+	digests map[watchedTemplate]string
+}
+
+func newTemplateWatcher(r *resolver, templates []watchedTemplate) *templateWatcher {
+	return &templateWatcher{resolver: r, templates: templates, digests: make(map[watchedTemplate]string)}
+}
+
+// startTemplateWatcher checks the templates in the background, once at startup and then
+// every interval (only on push events when interval is 0), and serves push events through
+// the resolver's HTTP servers
+func startTemplateWatcher(r *resolver, templates []watchedTemplate, interval time.Duration) {
+	if len(templates) == 0 {
+		return
+	}
+	if r.cache == nil {
+		logger.Warnf("%s is set but %s is not, watched templates are linted but not cached", EnvWatchTemplates, EnvCacheBackend)
+	}
+	r.watcher = newTemplateWatcher(r, templates)
+
+	go func() {
+		r.watcher.check(context.Background(), nil)
+		if interval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			r.watcher.check(context.Background(), nil)
+		}
+	}()
+}
+
+// check refreshes the watched templates, those of the repositories matching when it is
+// set, and returns how many were checked
+func (w *templateWatcher) check(ctx context.Context, matching func(repository string) bool) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	checked := 0
+	for _, template := range w.templates {
+		if matching != nil && !matching(template.repository) {
+			continue
+		}
+		if err := w.checkTemplate(ctx, template); err != nil {
+			logger.Warnf("Failed to check watched template %s: %v", template, err)
+		}
+		checked++
+	}
+	return checked
+}
+
+// checkTemplate fetches a template into the cache and lints it when its content changed
+// since the last check, recording whether it is valid in the watched templates metric
+func (w *templateWatcher) checkTemplate(ctx context.Context, template watchedTemplate) error {
+	ctx, cancel := context.WithTimeout(ctx, currentSettings().resolutionTimeout)
+	defer cancel()
+	ctx = withCacheRepository(ctx, template.repository)
+
+	opts := FetchOptions{Submodules: gitSubmodules}
+	creds, err := w.resolver.repositoryCredentials(ctx, template.repository)
+	if err != nil {
+		return err
+	}
+	opts.Credentials = creds
+	fetched, err := w.resolver.refreshTemplate(ctx, template.repository, template.revision, template.path, opts)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256([]byte(fetched.Commit + "\x00" + fetched.Content))
+	digest := hex.EncodeToString(sum[:])
+	if w.digests[template] == digest {
+		return nil
+	}
+	debugf("Watched template %s changed, linting it", template)
+
+	params := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues(template.repository)},
+		{Name: PathParam, Value: *pipelinev1.NewStructuredValues(template.path)},
+	}
+	if template.revision != "" {
+		params = append(params, pipelinev1.Param{Name: RevisionParam, Value: *pipelinev1.NewStructuredValues(template.revision)})
+	}
+	result := w.resolver.lint(ctx, params)
+	recordWatchedTemplate(template, result.Valid)
+	if !result.Valid {
+		var problems []string
+		for _, diagnostic := range result.Diagnostics {
+			if diagnostic.Severity == LintSeverityError {
+				problems = append(problems, diagnostic.Message)
+			}
+		}
+		logger.Errorf("Watched template %s is broken: %s", template, strings.Join(problems, "; "))
+	} else {
+		logger.Infof("Watched template %s is valid", template)
+	}
+	w.digests[template] = digest
+	return nil
+}
+
+// pushEvent holds the repository URLs of the push events of GitHub, GitLab and Gitea
+type pushEvent struct {
+	Repository struct {
+		CloneURL string `json:"clone_url"`
+		SSHURL   string `json:"ssh_url"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+	Project struct {
+		HTTPURL string `json:"git_http_url"`
+		SSHURL  string `json:"git_ssh_url"`
+		WebURL  string `json:"web_url"`
+	} `json:"project"`
+}
+
+// repositories returns the host and path of the repository an event was sent for
+func (e pushEvent) repositories() map[string]bool {
+	names := map[string]bool{}
+	for _, repoURL := range []string{e.Repository.CloneURL, e.Repository.SSHURL, e.Repository.HTMLURL, e.Project.HTTPURL, e.Project.SSHURL, e.Project.WebURL} {
+		if repoURL == "" {
+			continue
+		}
+		if name, err := repositoryName(repoURL); err == nil {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// watchPushHandler checks the watched templates of the repository a push event was sent
+// for, in the background so the forge does not time out. Events are authenticated with
+// WATCH_WEBHOOK_SECRET when set, as a GitHub or Gitea signature or a GitLab token, and with
+// the API credentials otherwise.
+func watchPushHandler(resolver *resolver) http.HandlerFunc {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxPushEventSize))
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "Failed to read push event: %v", err)
+			return
+		}
+		if watchWebhookSecret != "" && !validPushSignature(r, body) {
+			writeAPIError(w, http.StatusUnauthorized, "Invalid push event signature")
+			return
+		}
+
+		var event pushEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "Failed to parse push event: %v", err)
+			return
+		}
+		pushed := event.repositories()
+		matching := func(repository string) bool {
+			name, err := repositoryName(repository)
+			return err == nil && pushed[name]
+		}
+		watched := 0
+		for _, template := range resolver.watcher.templates {
+			if matching(template.repository) {
+				watched++
+			}
+		}
+		if watched > 0 {
+			go resolver.watcher.check(context.Background(), matching)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(map[string]int{"templates": watched}); err != nil {
+			logger.Errorf("Error writing response: %v", err)
+		}
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if resolver.watcher == nil {
+			writeAPIError(w, http.StatusNotFound, "%s is not set", EnvWatchTemplates)
+			return
+		}
+		if watchWebhookSecret == "" {
+			requireAuth(handler)(w, r)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// validPushSignature checks the signature of a push event: the HMAC-SHA256 of its body in
+// X-Hub-Signature-256 (GitHub) or X-Gitea-Signature (Gitea), or the secret itself in
+// X-Gitlab-Token (GitLab)
+func validPushSignature(r *http.Request, body []byte) bool {
+	if token := r.Header.Get("X-Gitlab-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(watchWebhookSecret)) == 1
+	}
+	signature := strings.TrimPrefix(r.Header.Get("X-Hub-Signature-256"), "sha256=")
+	if signature == "" {
+		signature = r.Header.Get("X-Gitea-Signature")
+	}
+	received, err := hex.DecodeString(signature)
+	if err != nil || len(received) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(watchWebhookSecret))
+	mac.Write(body)
+	return hmac.Equal(received, mac.Sum(nil))
+}
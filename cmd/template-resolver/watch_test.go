@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWatchedTemplates(t *testing.T) {
+	templates := parseWatchedTemplates([]string{
+		"https://github.com/org/templates=pipelines/build.yaml",
+		" https://github.com/org/templates = pipelines/deploy.yaml@v1.2.0 ",
+		"https://github.com/org/templates",
+		"=pipelines/build.yaml",
+	})
+	assert.Equal(t, []watchedTemplate{
+		{repository: "https://github.com/org/templates", path: "pipelines/build.yaml"},
+		{repository: "https://github.com/org/templates", path: "pipelines/deploy.yaml", revision: "v1.2.0"},
+	}, templates)
+	assert.Equal(t, "https://github.com/org/templates pipelines/deploy.yaml@v1.2.0", templates[1].String())
+}
+
+func TestTemplateWatcherCheck(t *testing.T) {
+	fetcher := &mockFetcher{templates: map[string]string{
+		"https://github.com/org/templates:pipeline.yaml": "apiVersion: tekton.dev/v1\nkind: Pipeline\nmetadata:\n  name: build\nspec:\n  description: Build\n",
+	}, commit: "abc123"}
+	r := &resolver{fetcher: fetcher, cache: newMemoryCache()}
+	template := watchedTemplate{repository: "https://github.com/org/templates", path: "pipeline.yaml"}
+	watcher := newTemplateWatcher(r, []watchedTemplate{template, {repository: "https://github.com/org/other", path: "pipeline.yaml"}})
+	valid := func() float64 {
+		return testutil.ToFloat64(watchedTemplateValid.WithLabelValues(repositoryHash(template.repository), template.path, template.revision))
+	}
+
+	// The template is cached and linted
+	assert.Equal(t, 2, watcher.check(context.Background(), nil))
+	assert.Equal(t, 1.0, valid())
+	cached, found, err := r.cache.Get(context.Background(), templateCacheKey(template.repository, "", template.path, gitSubmodules))
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Contains(t, string(cached), "Build")
+	digest := watcher.digests[template]
+	assert.NotEmpty(t, digest)
+
+	// A push breaking the template is reported
+	fetcher.templates["https://github.com/org/templates:pipeline.yaml"] = "{{ if }}"
+	fetcher.commit = "def456"
+	matching := func(repository string) bool { return repository == template.repository }
+	assert.Equal(t, 1, watcher.check(context.Background(), matching))
+	assert.Equal(t, 0.0, valid())
+	assert.NotEqual(t, digest, watcher.digests[template])
+}
+
+func TestWatchPushHandler(t *testing.T) {
+	originalSecret, originalToken := watchWebhookSecret, apiToken
+	defer func() { watchWebhookSecret, apiToken = originalSecret, originalToken }()
+	watchWebhookSecret, apiToken = "push-secret", ""
+
+	r := &resolver{fetcher: &mockFetcher{}}
+	push := func(body string, headers map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/watch/push", bytes.NewReader([]byte(body)))
+		for name, value := range headers {
+			request.Header.Set(name, value)
+		}
+		recorder := httptest.NewRecorder()
+		watchPushHandler(r)(recorder, request)
+		return recorder
+	}
+	github := `{"repository": {"clone_url": "https://github.com/org/templates.git"}}`
+	signature := func(body string) string {
+		mac := hmac.New(sha256.New, []byte(watchWebhookSecret))
+		mac.Write([]byte(body))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	// Nothing is watched
+	assert.Equal(t, http.StatusNotFound, push(github, nil).Code)
+
+	r.watcher = newTemplateWatcher(r, []watchedTemplate{{repository: "https://github.com/org/templates", path: "pipeline.yaml"}})
+	recorder := push(github, map[string]string{"X-Hub-Signature-256": "sha256=" + signature(github)})
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.JSONEq(t, `{"templates": 1}`, recorder.Body.String())
+
+	gitlab := `{"project": {"git_http_url": "https://gitlab.com/org/other.git"}}`
+	recorder = push(gitlab, map[string]string{"X-Gitlab-Token": "push-secret"})
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.JSONEq(t, `{"templates": 0}`, recorder.Body.String())
+
+	gitea := `{"repository": {"ssh_url": "git@github.com:org/templates.git"}}`
+	assert.Equal(t, http.StatusAccepted, push(gitea, map[string]string{"X-Gitea-Signature": signature(gitea)}).Code)
+
+	// Events must be signed with the secret
+	assert.Equal(t, http.StatusUnauthorized, push(github, nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, push(github, map[string]string{"X-Hub-Signature-256": "sha256=" + signature("{}")}).Code)
+	assert.Equal(t, http.StatusUnauthorized, push(gitlab, map[string]string{"X-Gitlab-Token": "wrong"}).Code)
+
+	recorder = httptest.NewRecorder()
+	watchPushHandler(r)(recorder, httptest.NewRequest(http.MethodGet, "/watch/push", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"github.com/tektoncd/pipeline/pkg/resolution/common"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// webhookPath is the path the validating admission webhook is served under
+const webhookPath = "/validate"
+
+// defaultWebhookTimeout bounds a review when the API server does not send its own timeout
+const defaultWebhookTimeout = 10 * time.Second
+
+// webhookRef is a reference to this resolver found in a PipelineRun
+type webhookRef struct {
+	// field locates the reference in the PipelineRun, such as spec.pipelineRef
+	field  string
+	params []pipelinev1.Param
+}
+
+// runWebhookServer serves the validating admission webhook over TLS with the certificate
+// at WEBHOOK_TLS_CERT_FILE, which is reloaded when it is renewed
+func runWebhookServer(resolver *resolver, port int) {
+	logger.Infof("Starting admission webhook on port %d", port)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(webhookPath, webhookHandler(resolver))
+	certificate := &reloadingCertificate{certFile: webhookCertFile, keyFile: webhookKeyFile}
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: defaultWebhookTimeout,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certificate.get},
+	}
+	if err := server.ListenAndServeTLS("", ""); err != nil {
+		logger.Errorf("Admission webhook failed: %v", err)
+	}
+}
+
+// webhookHandler reviews PipelineRuns sent by the API server in an AdmissionReview and
+// denies those whose references to this resolver would fail to resolve
+func webhookHandler(resolver *resolver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeAPIError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		var review admissionv1.AdmissionReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "Failed to parse admission review: %v", err)
+			return
+		}
+		if review.Request == nil {
+			writeAPIError(w, http.StatusBadRequest, "Admission review has no request")
+			return
+		}
+
+		// The API server gives up on the webhook after the timeout it sends
+		timeout := defaultWebhookTimeout
+		if value, err := time.ParseDuration(r.URL.Query().Get("timeout")); err == nil && value > 0 {
+			timeout = value
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		ctx = common.InjectRequestNamespace(ctx, review.Request.Namespace)
+		ctx = common.InjectRequestName(ctx, review.Request.Name)
+
+		response := &admissionv1.AdmissionResponse{UID: review.Request.UID, Allowed: true}
+		if err := resolver.reviewPipelineRun(ctx, review.Request.Object.Raw); err != nil {
+			debugContextf(ctx, "Denying PipelineRun %s/%s: %v", review.Request.Namespace, review.Request.Name, err)
+			response.Allowed = false
+			response.Result = &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Code:    http.StatusForbidden,
+				Reason:  metav1.StatusReasonForbidden,
+				Message: err.Error(),
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(admissionv1.AdmissionReview{TypeMeta: review.TypeMeta, Response: response}); err != nil {
+			logger.Errorf("Error writing admission response: %v", err)
+		}
+	}
+}
+
+// reviewPipelineRun checks every reference of a PipelineRun to this resolver: its params
+// must be valid, its repository must match WEBHOOK_ALLOWED_REPOSITORIES when set, and with
+// WEBHOOK_DRY_RUN the template must render. References whose params hold variables such as
+// $(params.path) are only resolved at run time, so they are not rendered, but a repository
+// given as is must still match the allowlist.
+func (r *resolver) reviewPipelineRun(ctx context.Context, raw []byte) error {
+	var pipelineRun pipelinev1.PipelineRun
+	if err := json.Unmarshal(raw, &pipelineRun); err != nil {
+		return fmt.Errorf("failed to parse PipelineRun: %w", err)
+	}
+
+	var errs []error
+	for _, ref := range webhookRefs(&pipelineRun) {
+		if err := r.reviewRef(ctx, ref); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ref.field, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reviewRef checks one reference to this resolver
+func (r *resolver) reviewRef(ctx context.Context, ref webhookRef) error {
+	if err := r.ValidateParams(ctx, ref.params); err != nil {
+		return err
+	}
+	// Variables are substituted at run time, but a literal repository can be checked already
+	params := ref.params
+	bindingVariable := strings.Contains(paramString(params, BindingParam), "$(")
+	if !bindingVariable {
+		var err error
+		if params, err = r.applyBinding(ctx, params); err != nil {
+			return err
+		}
+	}
+
+	if len(webhookRepositories) > 0 {
+		repository := paramString(params, RepositoryParam)
+		if bindingVariable || strings.Contains(repository, "$(") {
+			debugContextf(ctx, "Not checking the repository of %s, it is substituted at run time", ref.field)
+		} else {
+			name, err := repositoryName(repository)
+			if err != nil {
+				return err
+			}
+			if !allowlisted(name, webhookRepositories) {
+				return fmt.Errorf("repository %s is not allowed by %s", repository, EnvWebhookRepos)
+			}
+		}
+	}
+
+	if paramsHaveVariables(params) {
+		debugContextf(ctx, "Not rendering %s, its params are substituted at run time", ref.field)
+		return nil
+	}
+	if webhookDryRun {
+		if _, err := r.Resolve(ctx, params); err != nil {
+			return fmt.Errorf("dry-run render failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// webhookRefs returns the references of a PipelineRun to this resolver, by its resolver
+// type or one of its aliases: the referenced Pipeline and the tasks and finally tasks of an
+// embedded Pipeline
+func webhookRefs(pipelineRun *pipelinev1.PipelineRun) []webhookRef {
+	served := func(resolverRef pipelinev1.ResolverRef) bool {
+		name := string(resolverRef.Resolver)
+		return name == resolverType || slices.Contains(resolverTypeAliases, name)
+	}
+
+	var refs []webhookRef
+	if ref := pipelineRun.Spec.PipelineRef; ref != nil && served(ref.ResolverRef) {
+		refs = append(refs, webhookRef{field: "spec.pipelineRef", params: ref.Params})
+	}
+	if spec := pipelineRun.Spec.PipelineSpec; spec != nil {
+		taskRefs := func(field string, tasks []pipelinev1.PipelineTask) {
+			for _, task := range tasks {
+				if task.TaskRef != nil && served(task.TaskRef.ResolverRef) {
+					refs = append(refs, webhookRef{field: fmt.Sprintf("spec.pipelineSpec.%s[%s].taskRef", field, task.Name), params: task.TaskRef.Params})
+				}
+			}
+		}
+		taskRefs("tasks", spec.Tasks)
+		taskRefs("finally", spec.Finally)
+	}
+	return refs
+}
+
+// paramsHaveVariables reports whether any param value holds a Tekton variable reference
+func paramsHaveVariables(params []pipelinev1.Param) bool {
+	for _, param := range params {
+		encoded, err := json.Marshal(param.Value)
+		if err != nil || strings.Contains(string(encoded), "$(") {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadingCertificate serves a certificate from files, loading it again when the files
+// change so certificates renewed by cert-manager are used without a restart
+type reloadingCertificate struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	modified    time.Time
+}
+
+func (c *reloadingCertificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook certificate: %w", err)
+	}
+	if c.certificate != nil && info.ModTime().Equal(c.modified) {
+		return c.certificate, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhook certificate: %w", err)
+	}
+	c.certificate, c.modified = &certificate, info.ModTime()
+	return c.certificate, nil
+}
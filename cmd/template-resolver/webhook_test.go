@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tektoncd/pipeline/pkg/resolution/common"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const webhookTestPipelineRun = `{
+  "apiVersion": "tekton.dev/v1",
+  "kind": "PipelineRun",
+  "metadata": {"name": "deploy", "namespace": "team-a"},
+  "spec": {
+    "pipelineRef": {
+      "resolver": "template",
+      "params": [
+        {"name": "repository", "value": "https://github.com/org/templates"},
+        {"name": "path", "value": "pipeline.yaml"}
+      ]
+    }
+  }
+}`
+
+func TestReviewPipelineRun(t *testing.T) {
+	originalRepositories, originalDryRun := webhookRepositories, webhookDryRun
+	defer func() { webhookRepositories, webhookDryRun = originalRepositories, originalDryRun }()
+	webhookRepositories, webhookDryRun = nil, false
+	r := &resolver{fetcher: &mockFetcher{}}
+
+	require.NoError(t, r.reviewPipelineRun(context.Background(), []byte(webhookTestPipelineRun)))
+
+	// Every reference to this resolver is checked, those of other resolvers are not
+	pipelineRun := `{
+  "spec": {
+    "pipelineSpec": {
+      "tasks": [
+        {"name": "build", "taskRef": {"resolver": "template", "params": [{"name": "repository", "value": "https://github.com/org/templates"}]}},
+        {"name": "test", "taskRef": {"resolver": "git", "params": [{"name": "url", "value": "https://github.com/org/tasks"}]}}
+      ],
+      "finally": [
+        {"name": "notify", "taskRef": {"resolver": "template", "params": [{"name": "path", "value": "notify.yaml"}]}}
+      ]
+    }
+  }
+}`
+	err := r.reviewPipelineRun(context.Background(), []byte(pipelineRun))
+	assert.EqualError(t, err, "spec.pipelineSpec.tasks[build].taskRef: missing required parameter: path\n"+
+		"spec.pipelineSpec.finally[notify].taskRef: missing required parameter: repository")
+
+	// Repositories must match the allowlist, unless they are only known at run time
+	webhookRepositories = []string{"github.com/acme/*"}
+	err = r.reviewPipelineRun(context.Background(), []byte(webhookTestPipelineRun))
+	assert.EqualError(t, err, "spec.pipelineRef: repository https://github.com/org/templates is not allowed by WEBHOOK_ALLOWED_REPOSITORIES")
+	webhookRepositories = []string{"github.com/org/*"}
+	require.NoError(t, r.reviewPipelineRun(context.Background(), []byte(webhookTestPipelineRun)))
+	webhookRepositories = []string{"github.com/acme/*"}
+	withVariable := bytes.Replace([]byte(webhookTestPipelineRun), []byte("https://github.com/org/templates"), []byte("$(params.repository)"), 1)
+	require.NoError(t, r.reviewPipelineRun(context.Background(), withVariable))
+	// A variable in another param does not skip the allowlist
+	withPathVariable := bytes.Replace([]byte(webhookTestPipelineRun), []byte(`"pipeline.yaml"`), []byte(`"$(params.path)"`), 1)
+	err = r.reviewPipelineRun(context.Background(), withPathVariable)
+	assert.EqualError(t, err, "spec.pipelineRef: repository https://github.com/org/templates is not allowed by WEBHOOK_ALLOWED_REPOSITORIES")
+
+	// The repository of a TemplateBinding is checked as well
+	r.dynamicClient = newTestBindingClient()
+	withBinding := `{"spec": {"pipelineRef": {"resolver": "template", "params": [{"name": "binding", "value": "my-service"}]}}}`
+	err = r.reviewPipelineRun(common.InjectRequestNamespace(context.Background(), "team-a"), []byte(withBinding))
+	assert.EqualError(t, err, "spec.pipelineRef: repository https://github.com/org/templates is not allowed by WEBHOOK_ALLOWED_REPOSITORIES")
+	webhookRepositories = nil
+
+	// A dry run renders the template
+	webhookDryRun = true
+	r.fetcher = &mockFetcher{templates: map[string]string{"https://github.com/org/templates:pipeline.yaml": "{{ if }}"}}
+	err = r.reviewPipelineRun(context.Background(), []byte(webhookTestPipelineRun))
+	assert.ErrorContains(t, err, "spec.pipelineRef: dry-run render failed")
+	require.NoError(t, r.reviewPipelineRun(context.Background(), withPathVariable))
+
+	assert.ErrorContains(t, r.reviewPipelineRun(context.Background(), []byte("not json")), "failed to parse PipelineRun")
+}
+
+func TestWebhookHandler(t *testing.T) {
+	r := &resolver{fetcher: &mockFetcher{}}
+	review := func(pipelineRun string) *admissionv1.AdmissionResponse {
+		body, err := json.Marshal(admissionv1.AdmissionReview{
+			TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+			Request: &admissionv1.AdmissionRequest{
+				UID:       "0b6a7e3c-6f0e-4b8e-9d0c-2f5d1c7a9e11",
+				Name:      "deploy",
+				Namespace: "team-a",
+				Object:    runtime.RawExtension{Raw: []byte(pipelineRun)},
+			},
+		})
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		webhookHandler(r)(recorder, httptest.NewRequest(http.MethodPost, webhookPath+"?timeout=5s", bytes.NewReader(body)))
+		require.Equal(t, http.StatusOK, recorder.Code)
+
+		var response admissionv1.AdmissionReview
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		assert.Equal(t, "AdmissionReview", response.Kind)
+		require.NotNil(t, response.Response)
+		assert.Equal(t, "0b6a7e3c-6f0e-4b8e-9d0c-2f5d1c7a9e11", string(response.Response.UID))
+		return response.Response
+	}
+
+	assert.True(t, review(webhookTestPipelineRun).Allowed)
+
+	denied := review(`{"spec": {"pipelineRef": {"resolver": "template", "params": [{"name": "path", "value": "pipeline.yaml"}]}}}`)
+	assert.False(t, denied.Allowed)
+	require.NotNil(t, denied.Result)
+	assert.Equal(t, int32(http.StatusForbidden), denied.Result.Code)
+	assert.Equal(t, "spec.pipelineRef: missing required parameter: repository", denied.Result.Message)
+
+	recorder := httptest.NewRecorder()
+	webhookHandler(r)(recorder, httptest.NewRequest(http.MethodPost, webhookPath, bytes.NewReader([]byte(`{}`))))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = httptest.NewRecorder()
+	webhookHandler(r)(recorder, httptest.NewRequest(http.MethodGet, webhookPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestReloadingCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeCertificate := func(commonName string, modified time.Time) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: commonName}, NotAfter: time.Now().Add(time.Hour)}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		require.NoError(t, err)
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+		require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+		require.NoError(t, os.Chtimes(certFile, modified, modified))
+	}
+	commonName := func(certificate *tls.Certificate) string {
+		parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+		require.NoError(t, err)
+		return parsed.Subject.CommonName
+	}
+
+	certificate := &reloadingCertificate{certFile: certFile, keyFile: keyFile}
+	_, err := certificate.get(nil)
+	assert.ErrorContains(t, err, "failed to read webhook certificate")
+
+	writeCertificate("first", time.Now().Add(-time.Minute))
+	first, err := certificate.get(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(first))
+
+	// A renewed certificate is picked up
+	writeCertificate("second", time.Now())
+	second, err := certificate.get(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "second", commonName(second))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// workspaceReference matches a reference to a workspace in the fields of a task, such as
+// $(workspaces.source.path), which Tekton propagates from the Pipeline to embedded tasks
+var workspaceReference = regexp.MustCompile(`\$\(workspaces\.([-a-zA-Z0-9_]+)\.`)
+
+// workspaceUsage is a workspace of a Pipeline used by one of its tasks
+type workspaceUsage struct {
+	name string
+
+	// optional is set when the task declares the workspace it binds as optional
+	optional bool
+}
+
+// addWorkspaceDeclarations declares the workspaces the tasks and finally tasks of a
+// rendered Pipeline use but the Pipeline does not, which Tekton would only report once a
+// PipelineRun starts. Tasks use a workspace by binding it in their workspaces, or, for
+// embedded task specs, by referencing it as $(workspaces.name.path). A workspace is
+// declared optional when every task binding it declares it optional. Other resources, and
+// Pipelines declaring all of their workspaces, are returned as they are.
+func addWorkspaceDeclarations(ctx context.Context, rendered string) (string, error) {
+	documents := splitYAMLDocuments(rendered)
+	if len(documents) != 1 {
+		return rendered, nil
+	}
+	var pipeline map[string]interface{}
+	if err := yaml.Unmarshal([]byte(documents[0]), &pipeline); err != nil {
+		// Invalid YAML is reported by the validation
+		return rendered, nil
+	}
+	spec, _ := pipeline["spec"].(map[string]interface{})
+	if kind, _ := pipeline["kind"].(string); kind != "Pipeline" || spec == nil {
+		return rendered, nil
+	}
+
+	declarations, _ := spec["workspaces"].([]interface{})
+	declared := map[string]bool{}
+	for _, item := range declarations {
+		if declaration, ok := item.(map[string]interface{}); ok {
+			if name, ok := declaration["name"].(string); ok {
+				declared[name] = true
+			}
+		}
+	}
+
+	var missing []string
+	required := map[string]bool{}
+	for _, field := range []string{"tasks", "finally"} {
+		tasks, _ := spec[field].([]interface{})
+		for _, item := range tasks {
+			task, _ := item.(map[string]interface{})
+			usages, err := pipelineTaskWorkspaces(task)
+			if err != nil {
+				return "", err
+			}
+			for _, usage := range usages {
+				if declared[usage.name] {
+					continue
+				}
+				if _, seen := required[usage.name]; !seen {
+					missing = append(missing, usage.name)
+				}
+				required[usage.name] = required[usage.name] || !usage.optional
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return rendered, nil
+	}
+	debugContextf(ctx, "Declaring the workspaces used by the tasks of the Pipeline: %s", strings.Join(missing, ", "))
+
+	for _, name := range missing {
+		declaration := map[string]interface{}{"name": name}
+		if !required[name] {
+			declaration["optional"] = true
+		}
+		declarations = append(declarations, declaration)
+	}
+	spec["workspaces"] = declarations
+
+	declaredPipeline, err := yaml.Marshal(pipeline)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the Pipeline with its workspaces: %w", err)
+	}
+	return string(declaredPipeline), nil
+}
+
+// pipelineTaskWorkspaces returns the Pipeline workspaces a pipeline task binds, by their
+// workspace or, without one, their name, and those its embedded task spec references
+// without declaring them
+func pipelineTaskWorkspaces(task map[string]interface{}) ([]workspaceUsage, error) {
+	taskSpec, _ := task["taskSpec"].(map[string]interface{})
+	optional := map[string]bool{}
+	taskDeclared := map[string]bool{}
+	if specWorkspaces, ok := taskSpec["workspaces"].([]interface{}); ok {
+		for _, item := range specWorkspaces {
+			declaration, _ := item.(map[string]interface{})
+			name, _ := declaration["name"].(string)
+			taskDeclared[name] = true
+			optional[name], _ = declaration["optional"].(bool)
+		}
+	}
+
+	var usages []workspaceUsage
+	bound := map[string]bool{}
+	bindings, _ := task["workspaces"].([]interface{})
+	for _, item := range bindings {
+		binding, _ := item.(map[string]interface{})
+		name, _ := binding["name"].(string)
+		workspace, _ := binding["workspace"].(string)
+		if workspace == "" {
+			workspace = name
+		}
+		if workspace == "" {
+			continue
+		}
+		bound[name] = true
+		usages = append(usages, workspaceUsage{name: workspace, optional: optional[name]})
+	}
+
+	if taskSpec == nil {
+		return usages, nil
+	}
+	encoded, err := json.Marshal(taskSpec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the workspaces of task %v: %w", task["name"], err)
+	}
+	for _, match := range workspaceReference.FindAllStringSubmatch(string(encoded), -1) {
+		name := match[1]
+		if !taskDeclared[name] && !bound[name] {
+			bound[name] = true
+			usages = append(usages, workspaceUsage{name: name})
+		}
+	}
+	return usages, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestAddWorkspaceDeclarations(t *testing.T) {
+	rendered := `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: build
+spec:
+  workspaces:
+    - name: source
+  tasks:
+    - name: clone
+      taskRef:
+        name: git-clone
+      workspaces:
+        - name: output
+          workspace: source
+        - name: ssh-directory
+          workspace: ssh-creds
+    - name: build
+      taskSpec:
+        workspaces:
+          - name: cache
+            optional: true
+        steps:
+          - name: build
+            image: golang
+            script: cd $(workspaces.source.path) && go build -o $(workspaces.output.path)/app
+      workspaces:
+        - name: cache
+          workspace: go-cache
+  finally:
+    - name: report
+      taskRef:
+        name: report
+      workspaces:
+        - name: output
+`
+	declared, err := addWorkspaceDeclarations(context.Background(), rendered)
+	require.NoError(t, err)
+
+	var pipeline pipelinev1.Pipeline
+	require.NoError(t, yaml.Unmarshal([]byte(declared), &pipeline))
+	assert.Equal(t, []pipelinev1.PipelineWorkspaceDeclaration{
+		{Name: "source"},
+		{Name: "ssh-creds"},
+		{Name: "go-cache", Optional: true},
+		{Name: "output"},
+	}, pipeline.Spec.Workspaces)
+	assert.Len(t, pipeline.Spec.Tasks, 2)
+
+	// Resources declaring all of their workspaces, and other resources, are left as they are
+	unchanged, err := addWorkspaceDeclarations(context.Background(), declared)
+	require.NoError(t, err)
+	assert.Equal(t, declared, unchanged)
+	task := "apiVersion: tekton.dev/v1\nkind: Task\nmetadata:\n  name: build\nspec:\n  steps:\n    - image: $(workspaces.source.path)\n"
+	unchanged, err = addWorkspaceDeclarations(context.Background(), task)
+	require.NoError(t, err)
+	assert.Equal(t, task, unchanged)
+}
+
+func TestResolverDeclaresWorkspaces(t *testing.T) {
+	original := declareWorkspaces
+	defer func() { declareWorkspaces = original }()
+
+	r := &resolver{fetcher: &mockFetcher{templates: map[string]string{
+		"repo1:pipeline.yaml": `apiVersion: tekton.dev/v1
+kind: Pipeline
+metadata:
+  name: build
+spec:
+  tasks:
+{{ .ExtraTasks | indent 4 }}
+`,
+	}}}
+	params := []pipelinev1.Param{
+		{Name: RepositoryParam, Value: *pipelinev1.NewStructuredValues("repo1")},
+		{Name: PathParam, Value: *pipelinev1.NewStructuredValues("pipeline.yaml")},
+		{Name: "extra-tasks", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{
+			`{"name": "lint", "taskRef": {"name": "golangci-lint"}, "workspaces": [{"name": "source", "workspace": "shared"}]}`,
+		}}},
+	}
+
+	resource, err := r.Resolve(context.Background(), params)
+	require.NoError(t, err)
+	assert.Contains(t, string(resource.Data()), "workspaces:\n  - name: shared\n")
+
+	// Without the declaration Tekton's validation fails the resolution
+	declareWorkspaces = false
+	_, err = r.Resolve(context.Background(), params)
+	assert.ErrorContains(t, err, "shared")
+}
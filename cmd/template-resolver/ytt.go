@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// yttValuesHeader declares the params file as data values that may add keys the template
+// does not declare, so templates only need a schema for the values they want checked
+const yttValuesHeader = "#@data/values\n#@overlay/match-child-defaults missing_ok=True\n---\n"
+
+// yttValueName converts a param name to a ytt data value name, e.g. app-name becomes
+// app_name so it can be read as data.values.app_name
+func yttValueName(paramName string) string {
+	return strings.ReplaceAll(paramName, "-", "_")
+}
+
+// yttValues returns the data values file holding the request params
+func yttValues(params []pipelinev1.Param) (string, error) {
+	values := make(map[string]interface{})
+	for name, value := range engineParamValues(params) {
+		values[yttValueName(name)] = value
+	}
+
+	encoded, err := yaml.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode params for ytt: %w", err)
+	}
+	return yttValuesHeader + string(encoded), nil
+}
+
+// renderYtt renders a ytt template with the ytt binary at YTT_BINARY, with the params as
+// data values under snake_case names. Only the template file itself is fetched, so it cannot
+// load other files of the repository.
+func renderYtt(ctx context.Context, content string, params []pipelinev1.Param) (string, error) {
+	values, err := yttValues(params)
+	if err != nil {
+		return "", err
+	}
+
+	debugf("Rendering ytt template with %s", yttBinary)
+	args := []string{"-f", "template.yaml", "-f", "values.yaml"}
+	output, err := runEngineCommandWithFiles(ctx, yttBinary, args, map[string]string{
+		"template.yaml": content,
+		"values.yaml":   values,
+	}, "")
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
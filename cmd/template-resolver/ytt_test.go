@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestYttValues(t *testing.T) {
+	values, err := yttValues([]pipelinev1.Param{
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		{Name: "environments", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{"dev", "prod"}}},
+		{Name: EngineParam, Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: EngineYtt}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, yttValuesHeader+"app_name: api\nenvironments:\n    - dev\n    - prod\n", values)
+}
+
+func TestRenderYtt(t *testing.T) {
+	// The fake binary checks both files were written to its working directory
+	useEngineBinary(t, &yttBinary, `test -f template.yaml && grep -q "app_name: api" values.yaml || exit 1
+echo "$@"
+`)
+
+	params := []pipelinev1.Param{
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+	}
+	rendered, err := renderYtt(context.Background(), "#@ load(\"@ytt:data\", \"data\")\nname: #@ data.values.app_name\n", params)
+	require.NoError(t, err)
+	assert.Equal(t, "-f template.yaml -f values.yaml\n", rendered)
+}
+
+func TestRenderYttWithYtt(t *testing.T) {
+	if _, err := exec.LookPath(DefaultYttBinary); err != nil {
+		t.Skip("ytt is not installed")
+	}
+
+	params := []pipelinev1.Param{
+		{Name: "app-name", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeString, StringVal: "api"}},
+		{Name: "environments", Value: pipelinev1.ParamValue{Type: pipelinev1.ParamTypeArray, ArrayVal: []string{"dev", "prod"}}},
+	}
+	rendered, err := renderYtt(context.Background(), `#@ load("@ytt:data", "data")
+kind: Pipeline
+metadata:
+  name: #@ data.values.app_name
+spec:
+  tasks:
+  #@ for env in data.values.environments:
+  - name: #@ "deploy-" + env
+  #@ end
+`, params)
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "name: deploy-prod")
+}
@@ -0,0 +1,49 @@
+package goldentest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	assert.Empty(t, Diff("want", []byte("a\nb\n"), "got", []byte("a\nb\n")))
+
+	assert.Equal(t, `--- golden.yaml
++++ rendered
+@@ -1,3 +1,3 @@
+ name: api
+-replicas: 1
++replicas: 2
+ image: api:1.0
+`, Diff("golden.yaml", []byte("name: api\nreplicas: 1\nimage: api:1.0\n"), "rendered", []byte("name: api\nreplicas: 2\nimage: api:1.0\n")))
+
+	// A missing newline at the end is a difference of its own
+	assert.Equal(t, `--- want
++++ got
+@@ -1,1 +1,1 @@
+-a
++a
+\ No newline at end of file
+`, Diff("want", []byte("a\n"), "got", []byte("a")))
+
+	assert.Equal(t, "--- want\n+++ got\n@@ -0,0 +1,1 @@\n+a\n", Diff("want", nil, "got", []byte("a\n")))
+}
+
+func TestDiffHunks(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprintf("line %d\n", i))
+	}
+	want := strings.Join(lines, "")
+	lines[1] = "changed 2\n"
+	lines[17] = "changed 18\n"
+	got := strings.Join(lines, "")
+
+	diff := Diff("want", []byte(want), "got", []byte(got))
+	assert.Contains(t, diff, "@@ -1,5 +1,5 @@\n line 1\n-line 2\n+changed 2\n line 3\n")
+	assert.Contains(t, diff, "@@ -15,6 +15,6 @@\n line 15\n line 16\n line 17\n-line 18\n+changed 18\n line 19\n line 20\n")
+	assert.Equal(t, 2, strings.Count(diff, "@@ -"))
+}
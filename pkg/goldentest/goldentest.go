@@ -0,0 +1,161 @@
+// Package goldentest renders templates with the template resolver and compares the results
+// with golden files, so template repositories can write regression tests for their templates
+// that use the exact function set the resolver ships.
+//
+// Templates are rendered by the render subcommand of the template-resolver binary, found
+// through TEMPLATE_RESOLVER_BINARY or on the PATH, which can be installed with
+//
+//	go install thrivemarket.com/template-resolver/cmd/template-resolver@<version>
+//
+// A test renders each case and fails with a diff when the output differs from its golden
+// file. Run the tests with UPDATE_GOLDEN=true to write the rendered output to the golden
+// files instead:
+//
+//	func TestTemplates(t *testing.T) {
+//		goldentest.Run(t, goldentest.Case{
+//			Name:     "deploy",
+//			Template: "pipelines/deploy.yaml",
+//			Values:   "testdata/deploy.values.yaml",
+//			Golden:   "testdata/deploy.golden.yaml",
+//		})
+//	}
+package goldentest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	// BinaryEnv overrides the template-resolver binary templates are rendered with
+	BinaryEnv = "TEMPLATE_RESOLVER_BINARY"
+
+	// UpdateEnv makes Run write the rendered output to the golden files when true
+	UpdateEnv = "UPDATE_GOLDEN"
+
+	defaultBinary = "template-resolver"
+)
+
+// Case is a template rendered with fixture values, and the golden file of its output
+type Case struct {
+	// Name names the subtest of the case, the template path when empty
+	Name string
+
+	// Template is the template file to render
+	Template string
+
+	// Root is the repository directory partials and files are read from, the directory of
+	// the template when empty
+	Root string
+
+	// Values is a YAML values file passed as the values param, if any
+	Values string
+
+	// Params are the other params of the request
+	Params map[string]string
+
+	// Golden is the file holding the expected output
+	Golden string
+}
+
+// name returns the name of the subtest of the case
+func (c Case) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return filepath.ToSlash(c.Template)
+}
+
+// args returns the arguments of the render subcommand for the case
+func (c Case) args() []string {
+	args := []string{"render"}
+	if c.Root != "" {
+		args = append(args, "-root", c.Root)
+	}
+	if c.Values != "" {
+		args = append(args, "-values", c.Values)
+	}
+	names := make([]string, 0, len(c.Params))
+	for name := range c.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "-param", name+"="+c.Params[name])
+	}
+	return append(args, c.Template)
+}
+
+// Render renders the template of a case with the template-resolver binary
+func Render(c Case) ([]byte, error) {
+	binary := os.Getenv(BinaryEnv)
+	if binary == "" {
+		binary = defaultBinary
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(binary, c.args()...) // #nosec G204 -- the binary is chosen by the test
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("failed to render %s: %s", c.Template, message)
+		}
+		return nil, fmt.Errorf("failed to render %s: %w", c.Template, err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// Compare renders a case and returns a diff from its golden file to the rendered output,
+// empty when they match. With update set, the golden file is written instead.
+func Compare(c Case, update bool) (string, error) {
+	rendered, err := Render(c)
+	if err != nil {
+		return "", err
+	}
+	return CompareGolden(c.Golden, rendered, update)
+}
+
+// CompareGolden returns a diff from a golden file to the output, empty when they match. With
+// update set, the output is written to the golden file instead.
+func CompareGolden(golden string, output []byte, update bool) (string, error) {
+	if update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+			return "", fmt.Errorf("failed to create golden file directory: %w", err)
+		}
+		if err := os.WriteFile(golden, output, 0o644); err != nil { // #nosec G306 -- golden files are checked in
+			return "", fmt.Errorf("failed to write golden file: %w", err)
+		}
+		return "", nil
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		return "", fmt.Errorf("failed to read golden file, set %s=true to create it: %w", UpdateEnv, err)
+	}
+	return Diff(golden, want, "rendered", output), nil
+}
+
+// Run renders each case in a subtest and fails the ones whose output differs from their
+// golden file, with a diff. Golden files are written instead when UPDATE_GOLDEN is true.
+func Run(t *testing.T, cases ...Case) {
+	t.Helper()
+	update, _ := strconv.ParseBool(os.Getenv(UpdateEnv))
+	for _, c := range cases {
+		t.Run(c.name(), func(t *testing.T) {
+			diff, err := Compare(c, update)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff != "" {
+				t.Errorf("rendered %s differs from %s, set %s=true to update it:\n%s", c.Template, c.Golden, UpdateEnv, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package goldentest
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBinary installs a script printing its arguments as the template-resolver binary
+func fakeBinary(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake binary is a shell script")
+	}
+	binary := filepath.Join(t.TempDir(), "template-resolver")
+	require.NoError(t, os.WriteFile(binary, []byte("#!/bin/sh\nif [ \"$2\" = broken.yaml ]; then echo 'template is broken' >&2; exit 1; fi\necho \"$@\"\n"), 0o755))
+	t.Setenv(BinaryEnv, binary)
+}
+
+func TestCaseArgs(t *testing.T) {
+	c := Case{
+		Template: "pipelines/deploy.yaml",
+		Root:     ".",
+		Values:   "testdata/deploy.values.yaml",
+		Params:   map[string]string{"namespace": "prod", "app-name": "api"},
+	}
+	assert.Equal(t, []string{"render", "-root", ".", "-values", "testdata/deploy.values.yaml", "-param", "app-name=api", "-param", "namespace=prod", "pipelines/deploy.yaml"}, c.args())
+	assert.Equal(t, "pipelines/deploy.yaml", c.name())
+	assert.Equal(t, "deploy", Case{Name: "deploy"}.name())
+}
+
+func TestCompare(t *testing.T) {
+	fakeBinary(t)
+	dir := t.TempDir()
+	golden := filepath.Join(dir, "testdata", "task.golden.yaml")
+	c := Case{Template: "task.yaml", Params: map[string]string{"image": "alpine"}, Golden: golden}
+
+	_, err := Compare(c, false)
+	assert.ErrorContains(t, err, "set UPDATE_GOLDEN=true to create it")
+
+	diff, err := Compare(c, true)
+	require.NoError(t, err)
+	assert.Empty(t, diff)
+	content, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, "render -param image=alpine task.yaml\n", string(content))
+
+	diff, err = Compare(c, false)
+	require.NoError(t, err)
+	assert.Empty(t, diff)
+
+	c.Params["image"] = "busybox"
+	diff, err = Compare(c, false)
+	require.NoError(t, err)
+	assert.Contains(t, diff, "-render -param image=alpine task.yaml\n+render -param image=busybox task.yaml\n")
+
+	_, err = Compare(Case{Template: "broken.yaml", Golden: golden}, false)
+	assert.EqualError(t, err, "failed to render broken.yaml: template is broken")
+}
+
+func TestRun(t *testing.T) {
+	fakeBinary(t)
+	golden := filepath.Join(t.TempDir(), "task.golden.yaml")
+	require.NoError(t, os.WriteFile(golden, []byte("render task.yaml\n"), 0o600))
+
+	Run(t, Case{Name: "task", Template: "task.yaml", Golden: golden})
+}